@@ -0,0 +1,175 @@
+// Package asim declares the ASIM DNS schema versions the collector produces
+// and completes transformed records with the fields and aliases the schema
+// requires.
+package asim
+
+import (
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/LaurieRhodes/asim-dns-collector/internal/receiver/asimdns/dnswire"
+)
+
+// Schema is the ASIM schema name of DNS activity records
+const Schema = "Dns"
+
+// Schema versions. Legacy keeps the field layout of earlier collector
+// releases, where DnsResponseName holds the response code name and
+// SrcProcessId is a string.
+const (
+	Version017     = "0.1.7"
+	VersionLegacy  = "legacy"
+	DefaultVersion = Version017
+)
+
+// ValidateVersion checks a configured schema version
+func ValidateVersion(version string) error {
+	switch version {
+	case Version017, VersionLegacy:
+		return nil
+	default:
+		return fmt.Errorf("unsupported ASIM schema version %q, expected %s or %s", version, Version017, VersionLegacy)
+	}
+}
+
+// Record is the attribute set of a transformed record
+type Record interface {
+	Get(name string) (string, bool)
+	PutStr(name, value string)
+	PutInt(name string, value int64)
+}
+
+// Mandatory lists the fields of every record, and QueryMandatory those of
+// Query records, once completed
+var (
+	Mandatory = []string{
+		"EventCount", "EventStartTime", "EventEndTime", "EventType", "EventResult",
+		"EventProduct", "EventVendor", "EventSchema", "EventSchemaVersion", "EventSeverity",
+		"Dvc", "DvcHostname", "DvcIpAddr",
+	}
+	QueryMandatory = []string{"DnsQuery", "Domain", "SrcIpAddr", "Src", "IpAddr"}
+)
+
+// aliases maps ASIM alias fields to the fields they repeat, in order of
+// preference
+var aliases = []struct {
+	alias  string
+	fields []string
+}{
+	{"Src", []string{"SrcHostname", "SrcIpAddr"}},
+	{"Dst", []string{"DstHostname", "DstIpAddr"}},
+	{"IpAddr", []string{"SrcIpAddr"}},
+	{"Domain", []string{"DnsQuery"}},
+	{"SessionId", []string{"DnsSessionId"}},
+	{"Rule", []string{"RuleName"}},
+	{"Process", []string{"SrcProcessName"}},
+}
+
+// rcodeRefused is the REFUSED response code
+const rcodeRefused = 5
+
+// Complete adds the schema fields, defaults and aliases to a record whose
+// event occurred at eventTime. Fields already set are kept.
+func Complete(r Record, version string, eventTime time.Time) {
+	r.PutStr("EventSchema", Schema)
+	if version != VersionLegacy {
+		r.PutStr("EventSchemaVersion", version)
+	}
+
+	if _, ok := r.Get("EventCount"); !ok {
+		r.PutInt("EventCount", 1)
+	}
+	timestamp := eventTime.UTC().Format(time.RFC3339Nano)
+	setDefault(r, "EventStartTime", timestamp)
+	setDefault(r, "EventEndTime", timestamp)
+	setDefault(r, "EventResult", "NA")
+	setDefault(r, "EventSeverity", "Informational")
+
+	// DNS Client records describe queries made by the collector's own host
+	if product, _ := r.Get("EventProduct"); product == "DNS Client" {
+		copyDefault(r, "SrcIpAddr", "DvcIpAddr")
+		copyDefault(r, "SrcHostname", "DvcHostname")
+	}
+
+	rcode, hasRcode := intValue(r, "DnsResponseCode")
+	if hasRcode && rcode >= 0 && rcode <= 0xffff {
+		setDefault(r, "DnsResponseCodeName", dnswire.RcodeName(uint16(rcode)))
+	}
+
+	// A query answered without a policy or rate limit decision was allowed
+	if eventType, _ := r.Get("EventType"); eventType == "Query" && hasRcode {
+		if rcode == rcodeRefused {
+			setDefault(r, "DvcAction", "Deny")
+		} else {
+			setDefault(r, "DvcAction", "Allow")
+		}
+	}
+
+	for _, a := range aliases {
+		for _, field := range a.fields {
+			if value, ok := r.Get(field); ok && value != "" {
+				setDefault(r, a.alias, value)
+				break
+			}
+		}
+	}
+	if duration, ok := intValue(r, "DnsNetworkDuration"); ok {
+		if _, exists := r.Get("Duration"); !exists {
+			r.PutInt("Duration", duration)
+		}
+	}
+
+	if pid, ok := intValue(r, "SrcProcessId"); ok {
+		if version == VersionLegacy {
+			r.PutStr("SrcProcessId", strconv.FormatInt(pid, 10))
+		} else {
+			r.PutInt("SrcProcessId", pid)
+		}
+	}
+	if name, ok := r.Get("DnsResponseCodeName"); ok && version == VersionLegacy {
+		r.PutStr("DnsResponseName", name)
+	}
+}
+
+// Missing returns the mandatory fields a completed record lacks
+func Missing(r Record, version string) []string {
+	var missing []string
+	required := Mandatory
+	if eventType, _ := r.Get("EventType"); eventType == "Query" {
+		required = append(append([]string(nil), Mandatory...), QueryMandatory...)
+	}
+	for _, field := range required {
+		if field == "EventSchemaVersion" && version == VersionLegacy {
+			continue
+		}
+		if _, ok := r.Get(field); !ok {
+			missing = append(missing, field)
+		}
+	}
+	return missing
+}
+
+// setDefault sets a field that is not already set
+func setDefault(r Record, field, value string) {
+	if _, ok := r.Get(field); !ok {
+		r.PutStr(field, value)
+	}
+}
+
+// copyDefault sets a field that is not already set from another field
+func copyDefault(r Record, field, from string) {
+	if value, ok := r.Get(from); ok && value != "" {
+		setDefault(r, field, value)
+	}
+}
+
+// intValue returns the integer value of a field
+func intValue(r Record, field string) (int64, bool) {
+	value, ok := r.Get(field)
+	if !ok {
+		return 0, false
+	}
+	n, err := strconv.ParseInt(value, 10, 64)
+	return n, err == nil
+}
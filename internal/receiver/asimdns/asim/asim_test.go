@@ -0,0 +1,177 @@
+package asim
+
+import (
+	"strconv"
+	"testing"
+	"time"
+)
+
+// mapRecord stores attributes as strings, remembering which are integers
+type mapRecord struct {
+	values map[string]string
+	ints   map[string]bool
+}
+
+func newRecord(values map[string]string) *mapRecord {
+	return &mapRecord{values: values, ints: make(map[string]bool)}
+}
+
+func (m *mapRecord) Get(name string) (string, bool) {
+	value, ok := m.values[name]
+	return value, ok
+}
+
+func (m *mapRecord) PutStr(name, value string) {
+	m.values[name] = value
+	delete(m.ints, name)
+}
+
+func (m *mapRecord) PutInt(name string, value int64) {
+	m.values[name] = strconv.FormatInt(value, 10)
+	m.ints[name] = true
+}
+
+var eventTime = time.Date(2024, 5, 1, 12, 30, 0, 0, time.UTC)
+
+// device fields set on every record
+func withDevice(values map[string]string) map[string]string {
+	values["Dvc"] = "dns01"
+	values["DvcHostname"] = "dns01"
+	values["DvcIpAddr"] = "10.0.0.53"
+	values["EventVendor"] = "Microsoft"
+	return values
+}
+
+func clientRecord() *mapRecord {
+	return newRecord(withDevice(map[string]string{
+		"EventType":          "Query",
+		"EventSubType":       "response",
+		"EventProduct":       "DNS Client",
+		"EventResult":        "Failure",
+		"DnsQuery":           "missing.contoso.com",
+		"DnsResponseCode":    "3",
+		"DnsNetworkDuration": "12",
+		"DnsSessionId":       "4242-3008-1",
+		"SrcProcessId":       "4242",
+	}))
+}
+
+func serverRecord() *mapRecord {
+	return newRecord(withDevice(map[string]string{
+		"EventType":       "Query",
+		"EventSubType":    "response",
+		"EventProduct":    "DNS Server",
+		"EventResult":     "Success",
+		"DnsQuery":        "www.contoso.com",
+		"DnsResponseCode": "0",
+		"DnsResponseName": "192.0.2.10",
+		"SrcIpAddr":       "192.0.2.77",
+		"DstIpAddr":       "10.0.0.53",
+		"SrcProcessId":    "1800",
+	}))
+}
+
+func TestCompleteClientAndServer(t *testing.T) {
+	for name, r := range map[string]*mapRecord{"client": clientRecord(), "server": serverRecord()} {
+		Complete(r, DefaultVersion, eventTime)
+		if missing := Missing(r, DefaultVersion); len(missing) > 0 {
+			t.Errorf("%s record lacks %v", name, missing)
+		}
+		if !r.ints["SrcProcessId"] || !r.ints["EventCount"] {
+			t.Errorf("%s record has string SrcProcessId or EventCount", name)
+		}
+		if r.values["EventSchema"] != "Dns" || r.values["EventSchemaVersion"] != "0.1.7" {
+			t.Errorf("%s schema %q %q", name, r.values["EventSchema"], r.values["EventSchemaVersion"])
+		}
+		if r.values["EventStartTime"] != "2024-05-01T12:30:00Z" || r.values["EventEndTime"] != r.values["EventStartTime"] {
+			t.Errorf("%s times %q %q", name, r.values["EventStartTime"], r.values["EventEndTime"])
+		}
+	}
+
+	client := clientRecord()
+	Complete(client, DefaultVersion, eventTime)
+	for field, want := range map[string]string{
+		"SrcIpAddr":           "10.0.0.53",
+		"Src":                 "dns01",
+		"IpAddr":              "10.0.0.53",
+		"Domain":              "missing.contoso.com",
+		"DnsResponseCodeName": "NXDOMAIN",
+		"DvcAction":           "Allow",
+		"SessionId":           "4242-3008-1",
+		"Duration":            "12",
+		"EventSeverity":       "Informational",
+	} {
+		if got := client.values[field]; got != want {
+			t.Errorf("client %s = %q, want %q", field, got, want)
+		}
+	}
+	if _, ok := client.values["DnsResponseName"]; ok {
+		t.Error("client record reports the response code as DnsResponseName")
+	}
+
+	server := serverRecord()
+	Complete(server, DefaultVersion, eventTime)
+	if server.values["Src"] != "192.0.2.77" || server.values["Dst"] != "10.0.0.53" || server.values["DnsResponseName"] != "192.0.2.10" {
+		t.Errorf("server aliases %+v", server.values)
+	}
+}
+
+func TestCompleteKeepsExistingFields(t *testing.T) {
+	r := serverRecord()
+	r.values["DvcAction"] = "Drop"
+	r.values["EventSeverity"] = "High"
+	r.values["EventStartTime"] = "2024-05-01T12:00:00Z"
+	r.PutInt("EventCount", 7)
+	r.values["DnsResponseCode"] = "5"
+	Complete(r, DefaultVersion, eventTime)
+	if r.values["DvcAction"] != "Drop" || r.values["EventSeverity"] != "High" ||
+		r.values["EventStartTime"] != "2024-05-01T12:00:00Z" || r.values["EventCount"] != "7" {
+		t.Errorf("existing fields replaced: %+v", r.values)
+	}
+
+	refused := serverRecord()
+	refused.values["DnsResponseCode"] = "5"
+	Complete(refused, DefaultVersion, eventTime)
+	if refused.values["DvcAction"] != "Deny" || refused.values["DnsResponseCodeName"] != "REFUSED" {
+		t.Errorf("refused query %+v", refused.values)
+	}
+}
+
+func TestLegacyVersion(t *testing.T) {
+	r := clientRecord()
+	Complete(r, VersionLegacy, eventTime)
+	if r.ints["SrcProcessId"] || r.values["SrcProcessId"] != "4242" {
+		t.Errorf("legacy SrcProcessId %q", r.values["SrcProcessId"])
+	}
+	if r.values["DnsResponseName"] != "NXDOMAIN" {
+		t.Errorf("legacy DnsResponseName %q", r.values["DnsResponseName"])
+	}
+	if _, ok := r.values["EventSchemaVersion"]; ok {
+		t.Error("legacy records declare a schema version")
+	}
+	if missing := Missing(r, VersionLegacy); len(missing) > 0 {
+		t.Errorf("legacy record lacks %v", missing)
+	}
+}
+
+func TestInfoRecordsNeedNoQuery(t *testing.T) {
+	r := newRecord(withDevice(map[string]string{"EventType": "Info", "EventProduct": "DNS Server"}))
+	Complete(r, DefaultVersion, eventTime)
+	if missing := Missing(r, DefaultVersion); len(missing) > 0 {
+		t.Errorf("info record lacks %v", missing)
+	}
+	if _, ok := r.values["DvcAction"]; ok {
+		t.Error("info record has a device action")
+	}
+}
+
+func TestValidateVersion(t *testing.T) {
+	for _, v := range []string{Version017, VersionLegacy} {
+		if err := ValidateVersion(v); err != nil {
+			t.Errorf("%s: %v", v, err)
+		}
+	}
+	if err := ValidateVersion("0.2"); err == nil {
+		t.Error("unknown version accepted")
+	}
+}
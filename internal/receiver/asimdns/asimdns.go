@@ -14,6 +14,17 @@ import (
 	"go.opentelemetry.io/collector/pdata/plog"
 	"go.opentelemetry.io/collector/receiver"
 	"go.uber.org/zap"
+
+	"github.com/LaurieRhodes/asim-dns-collector/internal/receiver/asimdns/asim"
+	"github.com/LaurieRhodes/asim-dns-collector/internal/receiver/asimdns/dga"
+	"github.com/LaurieRhodes/asim-dns-collector/internal/receiver/asimdns/dnsname"
+	"github.com/LaurieRhodes/asim-dns-collector/internal/receiver/asimdns/filtering"
+	"github.com/LaurieRhodes/asim-dns-collector/internal/receiver/asimdns/rawevent"
+	"github.com/LaurieRhodes/asim-dns-collector/internal/receiver/asimdns/rules"
+	"github.com/LaurieRhodes/asim-dns-collector/internal/receiver/asimdns/severity"
+	"github.com/LaurieRhodes/asim-dns-collector/internal/receiver/asimdns/shedding"
+	"github.com/LaurieRhodes/asim-dns-collector/internal/receiver/asimdns/taxii"
+	"github.com/LaurieRhodes/asim-dns-collector/internal/receiver/asimdns/threatintel"
 )
 
 // Config defines configuration for the ASIM DNS receiver
@@ -30,6 +41,10 @@ type Config struct {
 	// EnableLevel sets the verbosity level of event tracing
 	EnableLevel int `mapstructure:"enable_level"`
 
+	// ASIM DNS schema version of the records: "0.1.7", or "legacy" for the
+	// field layout of earlier releases
+	AsimSchemaVersion string `mapstructure:"asim_schema_version"`
+	
 	// Event type filtering
 	IncludeInfoEvents bool     `mapstructure:"include_info_events"`
 	ExcludedEventIDs  []uint16 `mapstructure:"excluded_event_ids"`
@@ -37,12 +52,136 @@ type Config struct {
 	// Domain filtering
 	ExcludedDomains []string `mapstructure:"excluded_domains"`
 	
+	// Registered domain filtering; excludes every name under these registered domains
+	ExcludedRegisteredDomains []string `mapstructure:"excluded_registered_domains"`
+	
+	// Reverse lookup (PTR) targets. Targets inside ptr_local_networks or the
+	// subnets of the host's interfaces are classified as own_subnet; targets
+	// inside excluded_ptr_networks are filtered like excluded domains.
+	PTRLocalNetworks    []string `mapstructure:"ptr_local_networks"`
+	ExcludedPTRNetworks []string `mapstructure:"excluded_ptr_networks"`
+	
+	// Public Suffix List used to find registered domains. A newer
+	// public_suffix_list.dat replaces the list compiled into the collector.
+	PublicSuffixListFile           string `mapstructure:"public_suffix_list_file"`
+	PublicSuffixListReloadInterval int    `mapstructure:"public_suffix_list_reload_interval"`
+	
 	// Query deduplication
 	EnableDeduplication  bool `mapstructure:"enable_deduplication"`
 	DeduplicationWindow  int  `mapstructure:"deduplication_window"`
 	
+	// Deduplication mode: "drop" discards repeats, "aggregate" emits one summarised
+	// record per key when the aggregation window closes
+	DeduplicationMode    string   `mapstructure:"deduplication_mode"`
+	AggregationWindow    int      `mapstructure:"aggregation_window"`
+	// Defaults to query_name and query_type, and for the DNS Server client_ip
+	AggregationKeyFields []string `mapstructure:"aggregation_key_fields"`
+	MaxOpenAggregates    int      `mapstructure:"max_open_aggregates"`
+	
+	// DNS Server audit channel events, such as zone, record and server setting
+	// changes, emitted as ASIM Audit records on the asim.audit.events scope.
+	// Off by default.
+	EnableAuditEvents bool `mapstructure:"enable_audit_events"`
+	
 	// Query type filtering
 	ExcludeAAAARecords bool `mapstructure:"exclude_aaaa_records"`
+	
+	// Expression-based filter rules evaluated on the transformed ASIM attributes
+	FilterRules []rules.Config `mapstructure:"filter_rules"`
+	
+	// Threat intelligence indicator files matched against query names and
+	// resolved addresses. Matches bypass all volume filters.
+	ThreatIntelSources        []threatintel.SourceConfig `mapstructure:"threat_intel_sources"`
+	ThreatIntelReloadInterval int                        `mapstructure:"threat_intel_reload_interval"`
+	
+	// TAXII 2.1 collections polled for indicators used alongside the files above
+	TAXIICollections []taxii.CollectionConfig `mapstructure:"taxii_collections"`
+	
+	// DGA likelihood scoring of query names. Scores at or above the threshold
+	// are optionally mapped into the ASIM threat fields. DGAThreshold is a
+	// pointer so that an explicit 0 is told apart from an unset value.
+	EnableDGAScoring bool     `mapstructure:"enable_dga_scoring"`
+	DGAThreshold     *float64 `mapstructure:"dga_threshold"`
+	DGAThreatMapping bool     `mapstructure:"dga_threat_mapping"`
+	DGAAllowDomains  []string `mapstructure:"dga_allow_domains"`
+	
+	// DNS tunnelling detection per client or process and registered domain.
+	// Detections are emitted as separate records with evidence.
+	EnableTunnelDetection     bool     `mapstructure:"enable_tunnel_detection"`
+	TunnelWindow              int      `mapstructure:"tunnel_window"`
+	TunnelMaxTracked          int      `mapstructure:"tunnel_max_tracked"`
+	TunnelMinUniqueSubdomains int      `mapstructure:"tunnel_min_unique_subdomains"`
+	TunnelMinTXTQueries       int      `mapstructure:"tunnel_min_txt_queries"`
+	TunnelAllowDomains        []string `mapstructure:"tunnel_allow_domains"`
+	
+	// Newly observed domain flags backed by a persistent history of the
+	// registered domains queried per host and across hosts
+	EnableNewlyObservedDomains bool   `mapstructure:"enable_newly_observed_domains"`
+	NODHistoryDays             int    `mapstructure:"nod_history_days"`
+	NODWarmupPeriod            int    `mapstructure:"nod_warmup_period"`
+	NODCapacity                int    `mapstructure:"nod_capacity"`
+	NODHistoryFile             string `mapstructure:"nod_history_file"`
+	NODGlobalHistoryFile       string `mapstructure:"nod_global_history_file"`
+	NODSaveInterval            int    `mapstructure:"nod_save_interval"`
+	
+	// Offline GeoIP and ASN enrichment of client, server and answer addresses
+	// from MaxMind-format (.mmdb) databases. Enabled when either file is set.
+	GeoIPCityDatabase   string `mapstructure:"geoip_city_database"`
+	GeoIPASNDatabase    string `mapstructure:"geoip_asn_database"`
+	GeoIPReloadInterval int    `mapstructure:"geoip_reload_interval"`
+	GeoIPCacheSize      int    `mapstructure:"geoip_cache_size"`
+	
+	// Heavy-hitter statistics of query domains, processes and clients,
+	// tracked before and after filtering to help tune exclusions
+	EnableStatistics      bool   `mapstructure:"enable_statistics"`
+	StatisticsTopN        int    `mapstructure:"statistics_top_n"`
+	StatisticsWindow      int    `mapstructure:"statistics_window"`
+	StatisticsBuckets     int    `mapstructure:"statistics_buckets"`
+	StatisticsCapacity    int    `mapstructure:"statistics_capacity"`
+	StatisticsEndpoint    string `mapstructure:"statistics_endpoint"`
+	StatisticsLogInterval int    `mapstructure:"statistics_log_interval"`
+	
+	// Exclusion recommendations generated from traffic seen over a learning period
+	EnableRecommendations          bool     `mapstructure:"enable_recommendations"`
+	RecommendationLearningPeriod   int      `mapstructure:"recommendation_learning_period"`
+	RecommendationMinShare         float64  `mapstructure:"recommendation_min_share"`
+	RecommendationMaxSuggestions   int      `mapstructure:"recommendation_max_suggestions"`
+	RecommendationProtectedDomains []string `mapstructure:"recommendation_protected_domains"`
+	RecommendationOutputFile       string   `mapstructure:"recommendation_output_file"`
+	
+	// Priority-based load shedding. Records are queued before export and the
+	// lowest tiers are shed first when the queue fills or data is refused.
+	EnableLoadShedding      bool                  `mapstructure:"enable_load_shedding"`
+	SheddingQueueSize       int                   `mapstructure:"shedding_queue_size"`
+	// SheddingLowThreshold is a pointer so that an explicit 0, shedding the
+	// low tier at all times, is told apart from an unset value
+	SheddingLowThreshold    *float64              `mapstructure:"shedding_low_threshold"`
+	SheddingNormalThreshold float64               `mapstructure:"shedding_normal_threshold"`
+	SheddingRefusalHold     int                   `mapstructure:"shedding_refusal_hold"`
+	SheddingSummaryInterval int                   `mapstructure:"shedding_summary_interval"`
+	SheddingTiers           []shedding.TierConfig `mapstructure:"shedding_tiers"`
+	
+	// Severity policy. The base severity follows the response code, or the
+	// result when no code applies, and is raised by threat matches, likely
+	// DGA names and blocked queries. The first matching override replaces it.
+	SeverityResponseCodes map[string]string         `mapstructure:"severity_response_codes"`
+	SeverityFailure       string                    `mapstructure:"severity_failure"`
+	SeverityThreatMatch   string                    `mapstructure:"severity_threat_match"`
+	SeverityDGA           string                    `mapstructure:"severity_dga"`
+	SeverityPolicyBlock   string                    `mapstructure:"severity_policy_block"`
+	SeverityOverrides     []severity.OverrideConfig `mapstructure:"severity_overrides"`
+	
+	// Raw event preservation for re-processing history when the mapping
+	// improves. The raw ETW event, or its DNS packet, is kept as a map body or
+	// the EventOriginal attribute of records of the selected event types.
+	RawEventMode    string   `mapstructure:"raw_event_mode"`
+	RawEventContent string   `mapstructure:"raw_event_content"`
+	RawEventMaxSize int      `mapstructure:"raw_event_max_size"`
+	RawEventTypes   []string `mapstructure:"raw_event_types"`
+	
+	// Deduplication and aggregation state persistence across restarts
+	StateFile             string `mapstructure:"state_file"`
+	StateSnapshotInterval int    `mapstructure:"state_snapshot_interval"`
 }
 
 // Provider GUID constants
@@ -88,6 +227,14 @@ func (cfg *Config) Validate() error {
 		}
 	}
 
+	// Validate the ASIM schema version
+	if cfg.AsimSchemaVersion == "" {
+		cfg.AsimSchemaVersion = asim.DefaultVersion
+	}
+	if err := asim.ValidateVersion(cfg.AsimSchemaVersion); err != nil {
+		return fmt.Errorf("asim_schema_version: %w", err)
+	}
+	
 	// Set filtering defaults based on provider type
 	if cfg.ProviderGUID == DNSServerProviderGUID {
 		// For DNS Server, include info events by default
@@ -107,9 +254,267 @@ func (cfg *Config) Validate() error {
 		cfg.DeduplicationWindow = 300 // 5 minutes in seconds
 	}
 
+	// Validate deduplication mode and aggregation settings
+	switch cfg.DeduplicationMode {
+	case "":
+		cfg.DeduplicationMode = "drop"
+	case "drop", "aggregate":
+	default:
+		return fmt.Errorf("deduplication_mode must be \"drop\" or \"aggregate\", got %q", cfg.DeduplicationMode)
+	}
+
+	if cfg.AggregationWindow < 0 || cfg.MaxOpenAggregates < 0 {
+		return fmt.Errorf("aggregation_window and max_open_aggregates must not be negative")
+	}
+	if cfg.AggregationWindow == 0 {
+		cfg.AggregationWindow = cfg.DeduplicationWindow
+	}
+	if cfg.MaxOpenAggregates == 0 {
+		cfg.MaxOpenAggregates = 10000
+	}
+	if len(cfg.AggregationKeyFields) == 0 {
+		defaults := filtering.DefaultAggregationKeyFields
+		if cfg.ProviderGUID == DNSServerProviderGUID {
+			defaults = filtering.DefaultServerAggregationKeyFields
+		}
+		cfg.AggregationKeyFields = append([]string(nil), defaults...)
+	}
+	for _, field := range cfg.AggregationKeyFields {
+		if !filtering.ValidAggregationKeyField(field) {
+			return fmt.Errorf("unsupported aggregation_key_fields entry %q", field)
+		}
+	}
+
+	// Validate reverse lookup networks
+	if _, err := dnsname.ParseNetworks(cfg.PTRLocalNetworks); err != nil {
+		return fmt.Errorf("ptr_local_networks: %w", err)
+	}
+	if _, err := dnsname.ParseNetworks(cfg.ExcludedPTRNetworks); err != nil {
+		return fmt.Errorf("excluded_ptr_networks: %w", err)
+	}
+
+	// Set Public Suffix List defaults
+	if cfg.PublicSuffixListReloadInterval < 0 {
+		return fmt.Errorf("public_suffix_list_reload_interval must not be negative")
+	}
+	if cfg.PublicSuffixListReloadInterval == 0 {
+		cfg.PublicSuffixListReloadInterval = 3600
+	}
+
+	// Compile filter rules so expression errors and misspelt fields surface at startup
+	filterRules, err := rules.Compile(cfg.FilterRules)
+	if err != nil {
+		return err
+	}
+	if err := filterRules.CheckFields(knownAttribute); err != nil {
+		return err
+	}
+
+	// Validate threat intelligence sources
+	for i := range cfg.ThreatIntelSources {
+		if err := cfg.ThreatIntelSources[i].Validate(); err != nil {
+			return err
+		}
+	}
+	for i := range cfg.TAXIICollections {
+		if err := cfg.TAXIICollections[i].Validate(); err != nil {
+			return err
+		}
+	}
+	if cfg.ThreatIntelReloadInterval < 0 {
+		return fmt.Errorf("threat_intel_reload_interval must not be negative")
+	}
+	if cfg.ThreatIntelReloadInterval == 0 {
+		cfg.ThreatIntelReloadInterval = 60
+	}
+
+	// Set DGA scoring defaults
+	if cfg.DGAThreshold == nil {
+		threshold := dga.DefaultThreshold
+		cfg.DGAThreshold = &threshold
+	}
+	if *cfg.DGAThreshold < 0 || *cfg.DGAThreshold > 1 {
+		return fmt.Errorf("dga_threshold must be between 0 and 1, got %v", *cfg.DGAThreshold)
+	}
+
+	// Set tunnel detection defaults
+	if cfg.TunnelWindow < 0 || cfg.TunnelMaxTracked < 0 || cfg.TunnelMinUniqueSubdomains < 0 || cfg.TunnelMinTXTQueries < 0 {
+		return fmt.Errorf("tunnel detection settings must not be negative")
+	}
+	if cfg.TunnelWindow == 0 {
+		cfg.TunnelWindow = 600 // 10 minutes in seconds
+	}
+	if cfg.TunnelMaxTracked == 0 {
+		cfg.TunnelMaxTracked = 5000
+	}
+	if cfg.TunnelMinUniqueSubdomains == 0 {
+		cfg.TunnelMinUniqueSubdomains = 50
+	}
+	if cfg.TunnelMinTXTQueries == 0 {
+		cfg.TunnelMinTXTQueries = 30
+	}
+
+	// Set newly observed domain defaults
+	if cfg.NODHistoryDays < 0 || cfg.NODWarmupPeriod < 0 || cfg.NODCapacity < 0 || cfg.NODSaveInterval < 0 {
+		return fmt.Errorf("newly observed domain settings must not be negative")
+	}
+	if cfg.NODHistoryDays == 0 {
+		cfg.NODHistoryDays = 30
+	}
+	if cfg.NODWarmupPeriod == 0 {
+		cfg.NODWarmupPeriod = 604800 // 7 days in seconds
+	}
+	if cfg.NODCapacity == 0 {
+		cfg.NODCapacity = 100000
+	}
+	if cfg.NODSaveInterval == 0 {
+		cfg.NODSaveInterval = 300
+	}
+
+	// Set GeoIP defaults
+	if cfg.GeoIPReloadInterval < 0 || cfg.GeoIPCacheSize < 0 {
+		return fmt.Errorf("geoip_reload_interval and geoip_cache_size must not be negative")
+	}
+	if cfg.GeoIPReloadInterval == 0 {
+		cfg.GeoIPReloadInterval = 3600
+	}
+	if cfg.GeoIPCacheSize == 0 {
+		cfg.GeoIPCacheSize = 10000
+	}
+
+	// Set statistics defaults
+	if cfg.StatisticsTopN < 0 || cfg.StatisticsWindow < 0 || cfg.StatisticsBuckets < 0 ||
+		cfg.StatisticsCapacity < 0 || cfg.StatisticsLogInterval < 0 {
+		return fmt.Errorf("statistics settings must not be negative")
+	}
+	if cfg.StatisticsTopN == 0 {
+		cfg.StatisticsTopN = 20
+	}
+	if cfg.StatisticsWindow == 0 {
+		cfg.StatisticsWindow = 3600 // 1 hour in seconds
+	}
+	if cfg.StatisticsBuckets == 0 {
+		cfg.StatisticsBuckets = 12
+	}
+	if cfg.StatisticsCapacity == 0 {
+		cfg.StatisticsCapacity = 1000
+	}
+	if cfg.StatisticsLogInterval == 0 {
+		cfg.StatisticsLogInterval = 300
+	}
+
+	// Set recommendation defaults
+	if cfg.RecommendationLearningPeriod < 0 || cfg.RecommendationMaxSuggestions < 0 {
+		return fmt.Errorf("recommendation_learning_period and recommendation_max_suggestions must not be negative")
+	}
+	if cfg.RecommendationMinShare < 0 || cfg.RecommendationMinShare > 1 {
+		return fmt.Errorf("recommendation_min_share must be between 0 and 1, got %v", cfg.RecommendationMinShare)
+	}
+	if cfg.RecommendationLearningPeriod == 0 {
+		cfg.RecommendationLearningPeriod = 86400 // 24 hours in seconds
+	}
+	if cfg.RecommendationMinShare == 0 {
+		cfg.RecommendationMinShare = 0.01
+	}
+	if cfg.RecommendationMaxSuggestions == 0 {
+		cfg.RecommendationMaxSuggestions = 20
+	}
+
+	// Set load shedding defaults
+	if cfg.SheddingQueueSize < 0 || cfg.SheddingRefusalHold < 0 || cfg.SheddingSummaryInterval < 0 {
+		return fmt.Errorf("shedding_queue_size, shedding_refusal_hold and shedding_summary_interval must not be negative")
+	}
+	if cfg.SheddingQueueSize == 0 {
+		cfg.SheddingQueueSize = 10000
+	}
+	if cfg.SheddingLowThreshold == nil {
+		low := 0.5
+		cfg.SheddingLowThreshold = &low
+	}
+	if cfg.SheddingNormalThreshold == 0 {
+		cfg.SheddingNormalThreshold = 0.8
+	}
+	if *cfg.SheddingLowThreshold < 0 || cfg.SheddingNormalThreshold > 1 ||
+		*cfg.SheddingLowThreshold > cfg.SheddingNormalThreshold {
+		return fmt.Errorf("shedding thresholds must satisfy 0 <= shedding_low_threshold <= shedding_normal_threshold <= 1")
+	}
+	if cfg.SheddingRefusalHold == 0 {
+		cfg.SheddingRefusalHold = 30
+	}
+	if cfg.SheddingSummaryInterval == 0 {
+		cfg.SheddingSummaryInterval = 60
+	}
+	if len(cfg.SheddingTiers) == 0 {
+		cfg.SheddingTiers = shedding.DefaultTiers
+	}
+	if _, err := shedding.NewClassifier(cfg.SheddingTiers); err != nil {
+		return err
+	}
+	
+	// Set severity policy defaults; response codes are merged over the defaults
+	if cfg.SeverityFailure == "" {
+		cfg.SeverityFailure = severity.DefaultSettings.Failure
+	}
+	if cfg.SeverityThreatMatch == "" {
+		cfg.SeverityThreatMatch = severity.DefaultSettings.ThreatMatch
+	}
+	if cfg.SeverityDGA == "" {
+		cfg.SeverityDGA = severity.DefaultSettings.DGA
+	}
+	if cfg.SeverityPolicyBlock == "" {
+		cfg.SeverityPolicyBlock = severity.DefaultSettings.PolicyBlock
+	}
+	if _, err := severity.NewPolicy(cfg.severitySettings()); err != nil {
+		return err
+	}
+	
+	// Set raw event preservation defaults
+	if cfg.RawEventMode == "" {
+		cfg.RawEventMode = rawevent.ModeNone
+	}
+	if cfg.RawEventContent == "" {
+		cfg.RawEventContent = rawevent.ContentEvent
+	}
+	if cfg.RawEventMaxSize == 0 {
+		cfg.RawEventMaxSize = rawevent.DefaultMaxSize
+	}
+	if _, err := rawevent.NewPreserver(cfg.rawEventSettings()); err != nil {
+		return err
+	}
+
+	// Set default snapshot interval when state persistence is enabled
+	if cfg.StateSnapshotInterval < 0 {
+		return fmt.Errorf("state_snapshot_interval must not be negative")
+	}
+	if cfg.StateFile != "" && cfg.StateSnapshotInterval == 0 {
+		cfg.StateSnapshotInterval = 60
+	}
+
 	return nil
 }
 
+// severitySettings returns the severity policy settings of the configuration
+func (cfg *Config) severitySettings() severity.Settings {
+	return severity.Settings{
+		ResponseCodes: cfg.SeverityResponseCodes,
+		Failure:       cfg.SeverityFailure,
+		ThreatMatch:   cfg.SeverityThreatMatch,
+		DGA:           cfg.SeverityDGA,
+		PolicyBlock:   cfg.SeverityPolicyBlock,
+		Overrides:     cfg.SeverityOverrides,
+	}
+}
+
+// rawEventSettings returns the raw event preservation settings of the configuration
+func (cfg *Config) rawEventSettings() rawevent.Settings {
+	return rawevent.Settings{
+		Mode:       cfg.RawEventMode,
+		Content:    cfg.RawEventContent,
+		MaxSize:    cfg.RawEventMaxSize,
+		EventTypes: cfg.RawEventTypes,
+	}
+}
+
 // Unmarshal provides custom unmarshaling logic
 func (cfg *Config) Unmarshal(conf *confmap.Conf) error {
 	// Default implementation, can be expanded if needed
@@ -158,13 +563,42 @@ func createDefaultConfig() component.Config {
 		ProviderGUID: DNSClientProviderGUID, // Default to DNS Client provider
 		EnableFlags:  0x8000000000000FFF,    // All DNS Client events
 		EnableLevel:  5,                      // Verbose level
+		AsimSchemaVersion: asim.DefaultVersion,
 		// Default filtering settings
 		IncludeInfoEvents:    false,
 		ExcludedEventIDs:     []uint16{1001, 1015, 1016, 1019},
 		ExcludedDomains:      []string{},
 		EnableDeduplication:  true,
 		DeduplicationWindow:  300, // 5 minutes in seconds
+		DeduplicationMode:    "drop",
+		AggregationWindow:    300,
+		MaxOpenAggregates:    10000,
 		ExcludeAAAARecords:   false,
+		EnableAuditEvents:    false,
+		StateSnapshotInterval: 60,
+		ThreatIntelReloadInterval: 60,
+		EnableStatistics:      false,
+		StatisticsTopN:        20,
+		StatisticsWindow:      3600,
+		StatisticsBuckets:     12,
+		StatisticsCapacity:    1000,
+		StatisticsLogInterval: 300,
+		EnableRecommendations:        false,
+		RecommendationLearningPeriod: 86400,
+		RecommendationMinShare:       0.01,
+		RecommendationMaxSuggestions: 20,
+		EnableLoadShedding:      false,
+		SheddingQueueSize:       10000,
+		SheddingNormalThreshold: 0.8,
+		SheddingRefusalHold:     30,
+		SheddingSummaryInterval: 60,
+		SeverityFailure:         severity.DefaultSettings.Failure,
+		SeverityThreatMatch:     severity.DefaultSettings.ThreatMatch,
+		SeverityDGA:             severity.DefaultSettings.DGA,
+		SeverityPolicyBlock:     severity.DefaultSettings.PolicyBlock,
+		RawEventMode:            rawevent.ModeNone,
+		RawEventContent:         rawevent.ContentEvent,
+		RawEventMaxSize:         rawevent.DefaultMaxSize,
 	}
 }
 
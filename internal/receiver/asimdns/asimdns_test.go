@@ -2,14 +2,16 @@ package asimdns
 
 import (
 	"context"
+	"strings"
 	"testing"
 	"time"
 
-	"go.opentelemetry.io/collector/component"
 	"go.opentelemetry.io/collector/component/componenttest"
 	"go.opentelemetry.io/collector/consumer/consumertest"
 	"go.opentelemetry.io/collector/receiver/receivertest"
 	"go.uber.org/zap"
+
+	"github.com/LaurieRhodes/asim-dns-collector/internal/receiver/asimdns/rules"
 )
 
 func TestCreateDefaultConfig(t *testing.T) {
@@ -18,8 +20,95 @@ func TestCreateDefaultConfig(t *testing.T) {
 	if cfg == nil {
 		t.Fatalf("failed to create default config")
 	}
-	if cfg.Type() != typeStr {
-		t.Fatalf("factory should create config with type %q, got %q", typeStr, cfg.Type())
+	if factory.Type() != typeStr {
+		t.Fatalf("factory should create config with type %q, got %q", typeStr, factory.Type())
+	}
+	if cfg.(*Config).EnableAuditEvents {
+		t.Error("audit events must be opt-in")
+	}
+}
+
+func TestSheddingLowThreshold(t *testing.T) {
+	cfg := NewFactory().CreateDefaultConfig().(*Config)
+	if err := cfg.Validate(); err != nil {
+		t.Fatal(err)
+	}
+	if cfg.SheddingLowThreshold == nil || *cfg.SheddingLowThreshold != 0.5 {
+		t.Errorf("unset shedding_low_threshold must default to 0.5")
+	}
+
+	low := 0.0
+	cfg = NewFactory().CreateDefaultConfig().(*Config)
+	cfg.SheddingLowThreshold = &low
+	if err := cfg.Validate(); err != nil {
+		t.Fatal(err)
+	}
+	if *cfg.SheddingLowThreshold != 0 {
+		t.Errorf("explicit shedding_low_threshold 0 was replaced by %v", *cfg.SheddingLowThreshold)
+	}
+}
+
+func TestDGAThreshold(t *testing.T) {
+	cfg := NewFactory().CreateDefaultConfig().(*Config)
+	if err := cfg.Validate(); err != nil {
+		t.Fatal(err)
+	}
+	if cfg.DGAThreshold == nil || *cfg.DGAThreshold != 0.65 {
+		t.Errorf("unset dga_threshold must default to 0.65")
+	}
+
+	threshold := 0.0
+	cfg = NewFactory().CreateDefaultConfig().(*Config)
+	cfg.DGAThreshold = &threshold
+	if err := cfg.Validate(); err != nil {
+		t.Fatal(err)
+	}
+	if *cfg.DGAThreshold != 0 {
+		t.Errorf("explicit dga_threshold 0 was replaced by %v", *cfg.DGAThreshold)
+	}
+
+	threshold = 1.5
+	cfg = NewFactory().CreateDefaultConfig().(*Config)
+	cfg.DGAThreshold = &threshold
+	if err := cfg.Validate(); err == nil {
+		t.Error("expected dga_threshold above 1 to be rejected")
+	}
+}
+
+func TestAggregationKeyFields(t *testing.T) {
+	for provider, want := range map[string]string{
+		DNSClientProviderGUID: "query_name query_type",
+		DNSServerProviderGUID: "query_name query_type client_ip",
+	} {
+		cfg := NewFactory().CreateDefaultConfig().(*Config)
+		cfg.ProviderGUID = provider
+		if err := cfg.Validate(); err != nil {
+			t.Fatal(err)
+		}
+		if got := strings.Join(cfg.AggregationKeyFields, " "); got != want {
+			t.Errorf("%s: default aggregation_key_fields %q, want %q", provider, got, want)
+		}
+	}
+
+	cfg := NewFactory().CreateDefaultConfig().(*Config)
+	cfg.AggregationKeyFields = []string{"query_name", "client"}
+	if err := cfg.Validate(); err == nil {
+		t.Error("unsupported aggregation_key_fields entry accepted")
+	}
+}
+
+func TestFilterRuleFields(t *testing.T) {
+	cfg := NewFactory().CreateDefaultConfig().(*Config)
+	cfg.FilterRules = []rules.Config{{Name: "typo", Expression: `DnsQuerry != "x"`, Action: rules.ActionDrop}}
+	err := cfg.Validate()
+	if err == nil || !strings.Contains(err.Error(), `unknown field "DnsQuerry"`) {
+		t.Errorf("misspelt field: %v", err)
+	}
+
+	cfg = NewFactory().CreateDefaultConfig().(*Config)
+	cfg.FilterRules = []rules.Config{{Expression: `DnsQueryRegisteredDomain == "x" and SrcGeoCountry == "NZ"`, Action: rules.ActionDrop}}
+	if err := cfg.Validate(); err != nil {
+		t.Errorf("enrichment fields rejected: %v", err)
 	}
 }
 
@@ -5,9 +5,15 @@ package asimdns
 
 import (
 	"context"
+	"encoding/hex"
 	"fmt"
+	"net/http"
+	"net/netip"
+	"os"
 	"strconv"
+	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/0xrawsec/golang-etw/etw"
@@ -18,7 +24,23 @@ import (
 	"go.opentelemetry.io/collector/receiver"
 	"go.uber.org/zap"
 
+	"github.com/LaurieRhodes/asim-dns-collector/internal/receiver/asimdns/catalog"
+	"github.com/LaurieRhodes/asim-dns-collector/internal/receiver/asimdns/dga"
+	"github.com/LaurieRhodes/asim-dns-collector/internal/receiver/asimdns/dnsname"
+	"github.com/LaurieRhodes/asim-dns-collector/internal/receiver/asimdns/dnswire"
 	"github.com/LaurieRhodes/asim-dns-collector/internal/receiver/asimdns/filtering"
+	"github.com/LaurieRhodes/asim-dns-collector/internal/receiver/asimdns/geoip"
+	"github.com/LaurieRhodes/asim-dns-collector/internal/receiver/asimdns/nod"
+	"github.com/LaurieRhodes/asim-dns-collector/internal/receiver/asimdns/psl"
+	"github.com/LaurieRhodes/asim-dns-collector/internal/receiver/asimdns/rawevent"
+	"github.com/LaurieRhodes/asim-dns-collector/internal/receiver/asimdns/recommend"
+	"github.com/LaurieRhodes/asim-dns-collector/internal/receiver/asimdns/rules"
+	"github.com/LaurieRhodes/asim-dns-collector/internal/receiver/asimdns/severity"
+	"github.com/LaurieRhodes/asim-dns-collector/internal/receiver/asimdns/shedding"
+	"github.com/LaurieRhodes/asim-dns-collector/internal/receiver/asimdns/stats"
+	"github.com/LaurieRhodes/asim-dns-collector/internal/receiver/asimdns/taxii"
+	"github.com/LaurieRhodes/asim-dns-collector/internal/receiver/asimdns/threatintel"
+	"github.com/LaurieRhodes/asim-dns-collector/internal/receiver/asimdns/tunnel"
 )
 
 // DNSEtwReceiver is the Windows-specific implementation using golang-etw
@@ -28,9 +50,36 @@ type DNSEtwReceiver struct {
 	consumer       consumer.Logs
 	session        *etw.RealTimeSession
 	etwConsumer    *etw.Consumer
+	// wg tracks the ETW consumer and every background goroutine; Shutdown
+	// waits for them before the final flush
 	wg             sync.WaitGroup
 	cancelFunc     context.CancelFunc
 	filterManager  *filtering.FilterManager
+	suffixes       *psl.Resolver
+	filterRules    *rules.RuleSet
+	ruleFiltered   int64
+	statsTracker   *stats.Tracker
+	statsServer    *stats.Server
+	learnTracker   *stats.Tracker
+	recommender    *recommend.Recommender
+	recommendMux   sync.Mutex
+	recommendation *recommend.Recommendation
+	classifier     *shedding.Classifier
+	shedder        *shedding.Shedder
+	queue          chan plog.Logs
+	queueDone      chan struct{}
+	queueWg        sync.WaitGroup
+	threatStore    *threatintel.Store
+	threatMatches  int64
+	dgaScorer      *dga.Scorer
+	tunnelDetector *tunnel.Detector
+	tunnelDetects  int64
+	nodTracker     *nod.Tracker
+	geoResolver    *geoip.Resolver
+	localNetworks  []netip.Prefix
+	severityPolicy *severity.Policy
+	rawPreserver   *rawevent.Preserver
+	processNames   *processNames
 }
 
 // Start implements receiver.Logs for Windows
@@ -38,27 +87,90 @@ func (r *DNSEtwReceiver) Start(ctx context.Context, host component.Host) error {
 	ctx, cancel := context.WithCancel(ctx)
 	r.cancelFunc = cancel
 
-	// Create ETW session
-	r.session = etw.NewRealTimeSession(r.config.SessionName)
-
+	// Restore deduplication and aggregation state from the previous run
+	if r.config.StateFile != "" {
+		if err := r.filterManager.LoadState(r.config.StateFile); err != nil {
+			r.logger.Warn("Filter state not restored", zap.Error(err))
+		}
+	}
+	
+	// Load the Public Suffix List file; the embedded list is used until it loads
+	if r.config.PublicSuffixListFile != "" {
+		if err := r.suffixes.Reload(); err != nil {
+			r.logger.Warn("Public suffix list not loaded, using embedded list", zap.Error(err))
+		}
+		r.goBackground(ctx, func(ctx context.Context) {
+			r.suffixes.Watch(ctx, time.Duration(r.config.PublicSuffixListReloadInterval)*time.Second)
+		})
+	}
+	
+	// Load the GeoIP databases; addresses are only labelled by scope until they load
+	if r.geoResolver != nil {
+		if err := r.geoResolver.Reload(); err != nil {
+			r.logger.Warn("GeoIP databases not fully loaded", zap.Error(err))
+		}
+		r.goBackground(ctx, func(ctx context.Context) {
+			r.geoResolver.Watch(ctx, time.Duration(r.config.GeoIPReloadInterval)*time.Second)
+		})
+	}
+	
+	// Restore the domain history and save it periodically
+	if r.nodTracker != nil {
+		if err := r.nodTracker.Load(); err != nil {
+			r.logger.Warn("Domain history not restored", zap.Error(err))
+		}
+		r.goBackground(ctx, r.saveDomainHistory)
+	}
+	
+	// Load threat indicators; sources that fail are retried on each reload
+	if r.threatStore != nil {
+		if err := r.threatStore.Reload(); err != nil {
+			r.logger.Warn("Threat indicators not fully loaded", zap.Error(err))
+		}
+		r.goBackground(ctx, func(ctx context.Context) {
+			r.threatStore.Watch(ctx, time.Duration(r.config.ThreatIntelReloadInterval)*time.Second)
+		})
+		
+		// Poll TAXII collections into the same store
+		for _, collection := range r.config.TAXIICollections {
+			poller := taxii.NewPoller(r.logger, collection, nil, r.threatStore.SetIndicators)
+			r.goBackground(ctx, poller.Run)
+		}
+	}
+	
+	// Start the local statistics endpoint
+	if (r.statsTracker != nil || r.recommender != nil) && r.config.StatisticsEndpoint != "" {
+		r.statsServer = stats.NewServer(r.logger, r.config.StatisticsEndpoint, r.statsTracker, r.config.StatisticsTopN)
+		if r.recommender != nil {
+			r.statsServer.Handle("/recommendations", http.HandlerFunc(r.serveRecommendation))
+		}
+		if err := r.statsServer.Listen(); err != nil {
+			r.statsServer = nil
+			return r.abortStart(fmt.Errorf("failed to start statistics endpoint: %w", err))
+		}
+		r.goBackground(ctx, func(context.Context) { r.statsServer.Serve() })
+	}
+	
 	// Parse provider GUID and enable it in the session
 	provider, err := etw.ParseProvider(r.config.ProviderGUID)
 	if err != nil {
-		return fmt.Errorf("failed to parse provider GUID: %w", err)
+		return r.abortStart(fmt.Errorf("failed to parse provider GUID: %w", err))
 	}
 
 	// Set provider parameters from config
 	provider.EnableLevel = uint8(r.config.EnableLevel)
 	provider.MatchAnyKeyword = r.config.EnableFlags
 
-	// Start session and enable provider
-	if err := r.session.Start(); err != nil {
-		return fmt.Errorf("failed to start ETW session: %w", err)
+	// Create and start the ETW session
+	session := etw.NewRealTimeSession(r.config.SessionName)
+	if err := session.Start(); err != nil {
+		return r.abortStart(fmt.Errorf("failed to start ETW session: %w", err))
 	}
+	r.session = session
 
 	// Enable provider to collect events
 	if err := r.session.EnableProvider(provider); err != nil {
-		return fmt.Errorf("failed to enable provider: %w", err)
+		return r.abortStart(fmt.Errorf("failed to enable provider: %w", err))
 	}
 
 	// Create ETW consumer
@@ -66,7 +178,7 @@ func (r *DNSEtwReceiver) Start(ctx context.Context, host component.Host) error {
 	r.etwConsumer.FromSessions(r.session)
 
 	// Start periodic logger to monitor event processing
-	go r.logEventStats(ctx)
+	r.goBackground(ctx, r.logEventStats)
 
 	// Set up the event callback to process events
 	r.etwConsumer.EventCallback = func(event *etw.Event) error {
@@ -75,18 +187,46 @@ func (r *DNSEtwReceiver) Start(ctx context.Context, host component.Host) error {
 			return nil
 		}
 
-		logs := r.convertEventToLogs(event)
+		// Audit records bypass DNS filtering and load shedding
+		if r.config.EnableAuditEvents && isDnsServerAuditEvent(event) {
+			r.consumeLogs(ctx, r.convertAuditEventToLogs(event))
+			return nil
+		}
 		
-		// Check if logs have any records before sending
-		if logs.ResourceLogs().Len() > 0 && 
-           logs.ResourceLogs().At(0).ScopeLogs().Len() > 0 && 
-           logs.ResourceLogs().At(0).ScopeLogs().At(0).LogRecords().Len() > 0 {
-			if err := r.consumer.ConsumeLogs(ctx, logs); err != nil {
-				r.logger.Error("Failed to consume logs", zap.Error(err))
-			}
+		r.emit(ctx, r.convertEventToLogs(event))
+		if detection, ok := r.detectTunnel(event); ok {
+			r.emit(ctx, r.convertTunnelDetectionToLogs(detection))
 		}
 		return nil
 	}
+	
+	// Export queued records and report what was shed under load
+	if r.shedder != nil {
+		r.queueDone = make(chan struct{})
+		r.queueWg.Add(1)
+		go r.processQueue(r.queueDone)
+		r.goBackground(ctx, r.summariseShedding)
+	}
+	
+	// Emit summarised records as aggregation windows close
+	if r.config.EnableDeduplication && r.config.DeduplicationMode == filtering.DeduplicationModeAggregate {
+		r.goBackground(ctx, r.flushAggregates)
+	}
+	
+	// Periodically log heavy hitters for tuning exclusions
+	if r.statsTracker != nil {
+		r.goBackground(ctx, r.logHeavyHitters)
+	}
+	
+	// Recommend exclusions at the end of each learning period
+	if r.recommender != nil {
+		r.goBackground(ctx, r.recommendExclusions)
+	}
+	
+	// Periodically snapshot filter state so a crash loses at most one interval
+	if r.config.StateFile != "" {
+		r.goBackground(ctx, r.snapshotState)
+	}
 
 	// Start consumer in a separate goroutine
 	r.wg.Add(1)
@@ -118,6 +258,506 @@ func (r *DNSEtwReceiver) Start(ctx context.Context, host component.Host) error {
 	return nil
 }
 
+// goBackground runs fn in a goroutine that Shutdown waits for
+func (r *DNSEtwReceiver) goBackground(ctx context.Context, fn func(context.Context)) {
+	r.wg.Add(1)
+	go func() {
+		defer r.wg.Done()
+		fn(ctx)
+	}()
+}
+
+// abortStart releases what Start acquired before it failed and returns err.
+// Shutdown may still be called afterwards.
+func (r *DNSEtwReceiver) abortStart(err error) error {
+	r.cancelFunc()
+	if r.statsServer != nil {
+		if shutdownErr := r.statsServer.Shutdown(context.Background()); shutdownErr != nil {
+			r.logger.Warn("Error stopping statistics endpoint", zap.Error(shutdownErr))
+		}
+		r.statsServer = nil
+	}
+	if r.session != nil {
+		if stopErr := r.session.Stop(); stopErr != nil {
+			r.logger.Warn("Error stopping ETW session", zap.Error(stopErr))
+		}
+		r.session = nil
+	}
+	r.wg.Wait()
+	return err
+}
+
+// consumeLogs forwards logs to the next consumer if they contain any records
+func (r *DNSEtwReceiver) consumeLogs(ctx context.Context, logs plog.Logs) {
+	if logs.LogRecordCount() == 0 {
+		return
+	}
+	if err := r.consumer.ConsumeLogs(ctx, logs); err != nil {
+		r.logger.Error("Failed to consume logs", zap.Error(err))
+	}
+}
+
+// emit forwards logs to the next consumer, or queues them by priority when load shedding is enabled
+func (r *DNSEtwReceiver) emit(ctx context.Context, logs plog.Logs) {
+	if r.shedder == nil {
+		r.consumeLogs(ctx, logs)
+		return
+	}
+	if logs.LogRecordCount() == 0 {
+		return
+	}
+	
+	logRecord := logs.ResourceLogs().At(0).ScopeLogs().At(0).LogRecords().At(0)
+	tier := r.classifier.Classify(attributeFields(logRecord.Attributes()))
+	eventID := ""
+	if value, ok := logRecord.Attributes().Get("EventOriginalType"); ok {
+		eventID = value.AsString()
+	}
+	
+	now := time.Now()
+	if !r.shedder.Admit(tier, eventID, len(r.queue), cap(r.queue), now) {
+		return
+	}
+	select {
+	case r.queue <- logs:
+	default:
+		r.shedder.Overflow(tier, eventID, now)
+	}
+}
+
+// processQueue exports queued records and reports refusals to the shedder.
+// It runs until Shutdown closes done, which happens once nothing can
+// emit any more, so every queued record is exported.
+func (r *DNSEtwReceiver) processQueue(done <-chan struct{}) {
+	defer r.queueWg.Done()
+	
+	for {
+		select {
+		case <-done:
+			// Export whatever is still queued before shutting down
+			for {
+				select {
+				case logs := <-r.queue:
+					r.exportQueued(context.Background(), logs)
+				default:
+					return
+				}
+			}
+		case logs := <-r.queue:
+			r.exportQueued(context.Background(), logs)
+		}
+	}
+}
+
+// exportQueued forwards queued logs to the next consumer
+func (r *DNSEtwReceiver) exportQueued(ctx context.Context, logs plog.Logs) {
+	if err := r.consumer.ConsumeLogs(ctx, logs); err != nil {
+		r.shedder.Refused(time.Now())
+		r.logger.Debug("Next consumer refused logs", zap.Error(err))
+	}
+}
+
+// summariseShedding periodically emits a summary record of the events shed
+func (r *DNSEtwReceiver) summariseShedding(ctx context.Context) {
+	ticker := time.NewTicker(time.Duration(r.config.SheddingSummaryInterval) * time.Second)
+	defer ticker.Stop()
+	
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			summary, ok := r.shedder.Summary(time.Now())
+			if !ok {
+				continue
+			}
+			r.logger.Warn("Shedding DNS events under load",
+				zap.Int64("shed_count", summary.Total),
+				zap.Any("shed_by_tier", summary.ByTier),
+				zap.Int64("queue_overflow", summary.Overflow),
+				zap.Int64("consumer_refusals", summary.Refusals))
+			r.consumeLogs(ctx, r.convertShedSummaryToLogs(summary))
+		}
+	}
+}
+
+// newReceiverRecord creates an Info record generated by the receiver itself
+// rather than from an ETW event
+func (r *DNSEtwReceiver) newReceiverRecord(subType string) (plog.Logs, plog.LogRecord) {
+	logs := plog.NewLogs()
+	resourceLogs := logs.ResourceLogs().AppendEmpty()
+	
+	serviceName, product := "windows_dns_client", "DNS Client"
+	if r.config.ProviderGUID == DNSServerProviderGUID {
+		serviceName, product = "windows_dns_server", "DNS Server"
+	}
+	resourceLogs.Resource().Attributes().PutStr("service.name", serviceName)
+	resourceLogs.Resource().Attributes().PutStr("service.namespace", "asim_dns")
+	
+	scopeLogs := resourceLogs.ScopeLogs().AppendEmpty()
+	scopeLogs.Scope().SetName("asim.dns.events")
+	
+	logRecord := scopeLogs.LogRecords().AppendEmpty()
+	now := time.Now()
+	logRecord.SetTimestamp(pcommon.NewTimestampFromTime(now))
+	logRecord.SetObservedTimestamp(pcommon.NewTimestampFromTime(now))
+	
+	attrs := logRecord.Attributes()
+	attrs.PutStr("EventType", "Info")
+	attrs.PutStr("EventSubType", subType)
+	attrs.PutStr("EventProduct", product)
+	attrs.PutStr("EventVendor", "Microsoft")
+	attrs.PutStr("EventResult", "NA")
+	setDeviceFields(logRecord)
+	
+	return logs, logRecord
+}
+
+// convertShedSummaryToLogs creates a record describing the events shed during an interval
+func (r *DNSEtwReceiver) convertShedSummaryToLogs(summary shedding.Summary) plog.Logs {
+	logs, logRecord := r.newReceiverRecord("load_shedding")
+	logRecord.Body().SetStr(fmt.Sprintf("DNS load shedding: %d events shed", summary.Total))
+	
+	attrs := logRecord.Attributes()
+	attrs.PutInt("EventCount", summary.Total)
+	attrs.PutStr("EventStartTime", summary.StartTime.UTC().Format(time.RFC3339Nano))
+	attrs.PutStr("EventEndTime", summary.EndTime.UTC().Format(time.RFC3339Nano))
+	
+	byTier := attrs.PutEmptyMap("ShedEventsByTier")
+	for tier, count := range summary.ByTier {
+		byTier.PutInt(tier, count)
+	}
+	byEventID := attrs.PutEmptyMap("ShedEventsByEventId")
+	for eventID, count := range summary.ByEventID {
+		byEventID.PutInt(eventID, count)
+	}
+	attrs.PutInt("ShedQueueOverflow", summary.Overflow)
+	attrs.PutInt("ConsumerRefusals", summary.Refusals)
+	completeRecord(logRecord, r.config.AsimSchemaVersion)
+	applySeverity(logRecord, r.severityPolicy)
+	
+	return logs
+}
+
+// flushAggregates periodically emits aggregates whose window has closed
+func (r *DNSEtwReceiver) flushAggregates(ctx context.Context) {
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+	
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			for _, agg := range r.filterManager.FlushAggregates(false) {
+				r.emit(ctx, r.convertAggregateToLogs(agg))
+			}
+		}
+	}
+}
+
+// logHeavyHitters periodically logs the top query domains, processes and clients
+func (r *DNSEtwReceiver) logHeavyHitters(ctx context.Context) {
+	ticker := time.NewTicker(time.Duration(r.config.StatisticsLogInterval) * time.Second)
+	defer ticker.Stop()
+	
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			report := r.statsTracker.Report(r.config.StatisticsTopN)
+			for _, stage := range stats.Stages {
+				stageReport := report.Stages[stage]
+				fields := []zap.Field{
+					zap.String("stage", stage),
+					zap.Int64("total", stageReport.Total),
+				}
+				for _, dim := range stats.Dimensions {
+					fields = append(fields, zap.Any(dim, stageReport.Dimensions[dim]))
+				}
+				r.logger.Info("DNS heavy hitters", fields...)
+			}
+		}
+	}
+}
+
+// observe records an event in the heavy-hitter statistics and the
+// recommendation learning period
+func (r *DNSEtwReceiver) observe(stage string, event *etw.Event, weight int64) {
+	if r.statsTracker == nil && r.learnTracker == nil {
+		return
+	}
+	
+	// Processes are counted by image name, which survives a restart
+	obs := stats.Observation{
+		stats.DimensionProcess: r.processNames.Name(event.System.Execution.ProcessID),
+		stats.DimensionEventID: strconv.Itoa(int(event.System.EventID)),
+	}
+	fields := r.filterManager.Fields()
+	if queryName, ok := fields.QueryName(event); ok {
+		obs[stats.DimensionQueryDomain] = strings.ToLower(queryName)
+		obs[stats.DimensionRegisteredDomain] = r.suffixes.RegisteredDomain(queryName)
+	}
+	if clientIP, ok := fields.Client(event); ok {
+		obs[stats.DimensionClientIP] = clientIP
+	}
+	
+	if r.statsTracker != nil {
+		r.statsTracker.Observe(stage, obs, weight)
+	}
+	if r.learnTracker != nil {
+		r.learnTracker.Observe(stage, obs, weight)
+	}
+}
+
+// detectTunnel feeds query requests to the tunnel detector, before any filtering
+func (r *DNSEtwReceiver) detectTunnel(event *etw.Event) (tunnel.Detection, bool) {
+	fields := r.filterManager.Fields()
+	if r.tunnelDetector == nil || !fields.IsRequestEvent(event) {
+		return tunnel.Detection{}, false
+	}
+	// The detector needs the original case to recognise base64 labels
+	queryName, ok := fields.RawQueryName(event)
+	if !ok {
+		return tunnel.Detection{}, false
+	}
+	
+	// DNS Server events identify the client by address, DNS Client events by process
+	source, ok := fields.Client(event)
+	if !ok {
+		source = strconv.FormatUint(uint64(event.System.Execution.ProcessID), 10)
+	}
+	queryType := 0
+	if value, ok := fields.QueryType(event); ok {
+		queryType, _ = strconv.Atoi(value)
+	}
+	
+	detection, ok := r.tunnelDetector.Observe(tunnel.Query{
+		Time:      event.System.TimeCreated.SystemTime,
+		Source:    source,
+		Name:      queryName,
+		QueryType: queryType,
+	})
+	if ok {
+		atomic.AddInt64(&r.tunnelDetects, 1)
+		r.logger.Warn("Possible DNS tunnel detected",
+			zap.String("source", detection.Source),
+			zap.String("domain", detection.Domain),
+			zap.Int("unique_subdomains", detection.UniqueSubdomains),
+			zap.Strings("reasons", detection.Reasons))
+	}
+	return detection, ok
+}
+
+// convertTunnelDetectionToLogs creates a record with the evidence for a suspected tunnel
+func (r *DNSEtwReceiver) convertTunnelDetectionToLogs(detection tunnel.Detection) plog.Logs {
+	logs, logRecord := r.newReceiverRecord("tunnel_detection")
+	logRecord.Body().SetStr(fmt.Sprintf("Possible DNS tunnel: %s to %s", detection.Source, detection.Domain))
+	
+	attrs := logRecord.Attributes()
+	attrs.PutInt("EventCount", detection.Queries)
+	attrs.PutStr("EventStartTime", detection.WindowStart.UTC().Format(time.RFC3339Nano))
+	attrs.PutStr("EventEndTime", detection.WindowEnd.UTC().Format(time.RFC3339Nano))
+	if r.config.ProviderGUID == DNSServerProviderGUID {
+		attrs.PutStr("SrcIpAddr", detection.Source)
+	} else {
+		attrs.PutStr("SrcProcessId", detection.Source)
+	}
+	attrs.PutStr("DnsQuery", detection.Domain)
+	
+	attrs.PutStr("ThreatIndicatorType", threatintel.TypeDomain)
+	attrs.PutStr("ThreatField", "DnsQuery")
+	attrs.PutStr("ThreatCategory", "DnsTunnel")
+	attrs.PutStr("ThreatName", "DNS tunnelling to "+detection.Domain)
+	attrs.PutInt("ThreatRiskLevel", int64(detection.RiskLevel))
+	
+	attrs.PutInt("TunnelUniqueSubdomains", int64(detection.UniqueSubdomains))
+	attrs.PutDouble("TunnelMeanSubdomainLength", detection.MeanSubdomainLength)
+	attrs.PutInt("TunnelMaxLabelLength", int64(detection.MaxLabelLength))
+	attrs.PutDouble("TunnelMeanEntropy", detection.MeanEntropy)
+	attrs.PutInt("TunnelEncodedQueries", detection.EncodedQueries)
+	attrs.PutInt("TunnelTxtQueries", detection.TXTQueries)
+	reasons := attrs.PutEmptySlice("TunnelReasons")
+	for _, reason := range detection.Reasons {
+		reasons.AppendEmpty().SetStr(reason)
+	}
+	samples := attrs.PutEmptySlice("TunnelSampleQueries")
+	for _, sample := range detection.Samples {
+		samples.AppendEmpty().SetStr(sample)
+	}
+	completeRecord(logRecord, r.config.AsimSchemaVersion)
+	applySeverity(logRecord, r.severityPolicy)
+	
+	return logs
+}
+
+// convertAuditEventToLogs converts a DNS Server audit event to an ASIM Audit
+// record. Audit records use their own scope so they can be routed apart from
+// DNS activity.
+func (r *DNSEtwReceiver) convertAuditEventToLogs(event *etw.Event) plog.Logs {
+	logs := plog.NewLogs()
+	resourceLogs := logs.ResourceLogs().AppendEmpty()
+	resourceLogs.Resource().Attributes().PutStr("service.name", "windows_dns_server")
+	resourceLogs.Resource().Attributes().PutStr("service.namespace", "asim_dns")
+	
+	scopeLogs := resourceLogs.ScopeLogs().AppendEmpty()
+	scopeLogs.Scope().SetName("asim.audit.events")
+	
+	logRecord := scopeLogs.LogRecords().AppendEmpty()
+	logRecord.SetTimestamp(pcommon.NewTimestampFromTime(event.System.TimeCreated.SystemTime))
+	logRecord.SetObservedTimestamp(pcommon.NewTimestampFromTime(time.Now()))
+	
+	handleDnsServerAuditEvent(event, logRecord)
+	
+	operation, _ := logRecord.Attributes().Get("Operation")
+	object, _ := logRecord.Attributes().Get("Object")
+	logRecord.Body().SetStr(fmt.Sprintf("DNS Server Audit: %s %s (ID: %d)",
+		operation.Str(), object.Str(), event.System.EventID))
+	applySeverity(logRecord, r.severityPolicy)
+	r.preserveRawEvent(event, logRecord)
+	
+	return logs
+}
+
+// preserveRawEvent keeps the raw ETW event of a record, or the DNS packet it
+// carries, when its event type is selected. In body mode the body becomes a
+// map of the message and the raw event; otherwise the raw event is encoded in
+// the EventOriginal attribute.
+func (r *DNSEtwReceiver) preserveRawEvent(event *etw.Event, logRecord plog.LogRecord) {
+	attrs := logRecord.Attributes()
+	eventType, _ := attrs.Get("EventType")
+	if !r.rawPreserver.Preserves(eventType.Str()) {
+		return
+	}
+	
+	var packet []byte
+	if packetData, ok := getEventDataString(event, "PacketData"); ok {
+		packetData = strings.TrimPrefix(strings.TrimPrefix(packetData, "0x"), "0X")
+		packet, _ = hex.DecodeString(packetData)
+	}
+	original, err := r.rawPreserver.Preserve(event, packet)
+	if err != nil {
+		r.logger.Debug("Failed to preserve raw event",
+			zap.Uint16("event_id", event.System.EventID),
+			zap.Error(err))
+		return
+	}
+	
+	attrs.PutInt("EventOriginalSize", int64(original.Size))
+	if original.Truncated {
+		attrs.PutBool("EventOriginalTruncated", true)
+	}
+	if r.rawPreserver.Mode() != rawevent.ModeBody {
+		if original.Encoded != "" {
+			attrs.PutStr("EventOriginal", original.Encoded)
+		}
+		return
+	}
+	
+	message := logRecord.Body().AsString()
+	body := logRecord.Body().SetEmptyMap()
+	if original.Value != nil {
+		if err := body.FromRaw(original.Value); err != nil {
+			r.logger.Debug("Failed to preserve raw event",
+				zap.Uint16("event_id", event.System.EventID),
+				zap.Error(err))
+		}
+	}
+	if original.Packet != nil {
+		body.PutEmptyBytes("PacketData").FromRaw(original.Packet)
+	}
+	body.PutStr("Message", message)
+}
+
+// recommendExclusions generates exclusion recommendations at the end of each learning period
+func (r *DNSEtwReceiver) recommendExclusions(ctx context.Context) {
+	ticker := time.NewTicker(time.Duration(r.config.RecommendationLearningPeriod) * time.Second)
+	defer ticker.Stop()
+	
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			rec := r.recommender.Recommend(r.learnTracker.Report(r.config.StatisticsCapacity), recommend.Current{
+				ExcludedDomains:           r.config.ExcludedDomains,
+				ExcludedRegisteredDomains: r.config.ExcludedRegisteredDomains,
+				ExcludedEventIDs:          r.config.ExcludedEventIDs,
+			})
+			
+			r.recommendMux.Lock()
+			r.recommendation = &rec
+			r.recommendMux.Unlock()
+			
+			snippet := rec.YAML()
+			r.logger.Info("Exclusion recommendations",
+				zap.Int("suggestions", len(rec.Suggestions)),
+				zap.Float64("estimated_reduction", rec.EstimatedReduction),
+				zap.String("config", snippet))
+			
+			if r.config.RecommendationOutputFile != "" {
+				if err := os.WriteFile(r.config.RecommendationOutputFile, []byte(snippet), 0o644); err != nil {
+					r.logger.Warn("Failed to write recommendations", zap.Error(err))
+				}
+			}
+		}
+	}
+}
+
+// serveRecommendation serves the latest recommendation as JSON, or as a
+// configuration snippet with ?format=yaml
+func (r *DNSEtwReceiver) serveRecommendation(w http.ResponseWriter, req *http.Request) {
+	r.recommendMux.Lock()
+	rec := r.recommendation
+	r.recommendMux.Unlock()
+	
+	if rec == nil {
+		http.Error(w, "learning period not complete", http.StatusServiceUnavailable)
+		return
+	}
+	if req.URL.Query().Get("format") == "yaml" {
+		w.Header().Set("Content-Type", "application/yaml")
+		_, _ = w.Write([]byte(rec.YAML()))
+		return
+	}
+	stats.WriteJSON(w, rec)
+}
+
+// snapshotState periodically persists deduplication and aggregation state
+func (r *DNSEtwReceiver) snapshotState(ctx context.Context) {
+	ticker := time.NewTicker(time.Duration(r.config.StateSnapshotInterval) * time.Second)
+	defer ticker.Stop()
+	
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := r.filterManager.SaveState(r.config.StateFile); err != nil {
+				r.logger.Warn("Failed to snapshot filter state", zap.Error(err))
+			}
+		}
+	}
+}
+
+// saveDomainHistory periodically persists the newly observed domain history
+func (r *DNSEtwReceiver) saveDomainHistory(ctx context.Context) {
+	ticker := time.NewTicker(time.Duration(r.config.NODSaveInterval) * time.Second)
+	defer ticker.Stop()
+	
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := r.nodTracker.Save(time.Now()); err != nil {
+				r.logger.Warn("Failed to save domain history", zap.Error(err))
+			}
+		}
+	}
+}
+
 // logEventStats logs event processing statistics periodically
 func (r *DNSEtwReceiver) logEventStats(ctx context.Context) {
 	ticker := time.NewTicker(10 * time.Second)
@@ -132,10 +772,17 @@ func (r *DNSEtwReceiver) logEventStats(ctx context.Context) {
 			filteredEvents := r.filterManager.GetFilteredEvents()
 			filterPercentage := r.filterManager.GetFilterPercentage()
 			
+			aggregatedEvents := r.filterManager.GetAggregatedEvents()
+			ruleFiltered := atomic.LoadInt64(&r.ruleFiltered)
+			
 			r.logger.Info("DNS event statistics", 
 				zap.Int64("total_received", totalEvents),
 				zap.Int64("filtered_count", filteredEvents),
-				zap.Int64("passed_filters", totalEvents - filteredEvents),
+				zap.Int64("aggregated_count", aggregatedEvents),
+				zap.Int64("rule_filtered_count", ruleFiltered),
+				zap.Int64("threat_match_count", atomic.LoadInt64(&r.threatMatches)),
+				zap.Int64("tunnel_detection_count", atomic.LoadInt64(&r.tunnelDetects)),
+				zap.Int64("passed_filters", totalEvents - filteredEvents - aggregatedEvents - ruleFiltered),
 				zap.Float64("filter_percentage", filterPercentage))
 		}
 	}
@@ -157,6 +804,13 @@ func (r *DNSEtwReceiver) Shutdown(ctx context.Context) error {
 		}
 	}
 
+	// Stop the statistics endpoint
+	if r.statsServer != nil {
+		if err := r.statsServer.Shutdown(ctx); err != nil {
+			r.logger.Warn("Error stopping statistics endpoint", zap.Error(err))
+		}
+	}
+	
 	// Stop the ETW session
 	if r.session != nil {
 		r.logger.Info("Stopping ETW session")
@@ -165,8 +819,43 @@ func (r *DNSEtwReceiver) Shutdown(ctx context.Context) error {
 		}
 	}
 
-	// Wait for event processing to complete
+	// Wait for event processing and the background goroutines to complete;
+	// only then can the queue be drained, as they emit into it
 	r.wg.Wait()
+	if r.queueDone != nil {
+		close(r.queueDone)
+		r.queueDone = nil
+	}
+	r.queueWg.Wait()
+	
+	// Report anything shed since the last summary
+	if r.shedder != nil {
+		if summary, ok := r.shedder.Summary(time.Now()); ok {
+			r.consumeLogs(ctx, r.convertShedSummaryToLogs(summary))
+		}
+	}
+	
+	if r.config.StateFile != "" {
+		// Emit windows that have already closed, then persist the open ones
+		// so they continue after restart
+		for _, agg := range r.filterManager.FlushAggregates(false) {
+			r.consumeLogs(ctx, r.convertAggregateToLogs(agg))
+		}
+		if err := r.filterManager.SaveState(r.config.StateFile); err != nil {
+			r.logger.Warn("Failed to save filter state", zap.Error(err))
+		}
+	} else {
+		// Emit any aggregation windows that are still open
+		for _, agg := range r.filterManager.FlushAggregates(true) {
+			r.consumeLogs(ctx, r.convertAggregateToLogs(agg))
+		}
+	}
+	
+	if r.nodTracker != nil {
+		if err := r.nodTracker.Save(time.Now()); err != nil {
+			r.logger.Warn("Failed to save domain history", zap.Error(err))
+		}
+	}
 	
 	// Log final statistics
 	totalEvents := r.filterManager.GetTotalEvents()
@@ -182,12 +871,99 @@ func (r *DNSEtwReceiver) Shutdown(ctx context.Context) error {
 
 // convertEventToLogs converts ETW events to OpenTelemetry logs with ASIM DNS schema
 func (r *DNSEtwReceiver) convertEventToLogs(event *etw.Event) plog.Logs {
+	r.observe(stats.StageBeforeFiltering, event, 1)
+	packet := decodePacket(event)
+	
+	// Threat intelligence matches bypass every volume filter
+	if match, ok := r.matchThreat(event, packet); ok {
+		r.filterManager.RecordBypass()
+		atomic.AddInt64(&r.threatMatches, 1)
+		
+		logs, logRecord := r.buildLogs(event, packet)
+		setThreatFields(logRecord, match)
+		applySeverity(logRecord, r.severityPolicy)
+		r.observe(stats.StageAfterFiltering, event, 1)
+		return logs
+	}
+	
 	// Apply filtering via filter manager
 	if r.filterManager.ShouldFilter(event) {
 		return plog.NewLogs()
 	}
 	
 	// If we reach here, the event should be processed
+	logs, logRecord := r.buildLogs(event, packet)
+	
+	// Apply expression rules to the transformed ASIM attributes
+	if !r.applyFilterRules(logRecord) {
+		return plog.NewLogs()
+	}
+	
+	r.observe(stats.StageAfterFiltering, event, 1)
+	return logs
+}
+
+// matchThreat matches the query name and resolved addresses of an event against threat indicators
+func (r *DNSEtwReceiver) matchThreat(event *etw.Event, packet eventPacket) (threatintel.Match, bool) {
+	if r.threatStore == nil {
+		return threatintel.Match{}, false
+	}
+	
+	queryName, _ := r.filterManager.Fields().QueryName(event)
+	return r.threatStore.Match(queryName, answerAddrs(event, packet))
+}
+
+// applyFilterRules evaluates the configured filter rules against a transformed
+// record and reports whether the record should be kept
+func (r *DNSEtwReceiver) applyFilterRules(logRecord plog.LogRecord) bool {
+	if r.filterRules.Len() == 0 {
+		return true
+	}
+	
+	result := r.filterRules.Evaluate(attributeFields(logRecord.Attributes()))
+	if result.Drop {
+		atomic.AddInt64(&r.ruleFiltered, 1)
+		return false
+	}
+	
+	if len(result.Tags) > 0 {
+		tags := logRecord.Attributes().PutEmptySlice("FilterRuleTags")
+		for _, tag := range result.Tags {
+			tags.AppendEmpty().SetStr(tag)
+		}
+	}
+	
+	return true
+}
+
+// convertAggregateToLogs converts a closed aggregation window into a summarised
+// ASIM record using the first event of the window as the template
+func (r *DNSEtwReceiver) convertAggregateToLogs(agg *filtering.Aggregate) plog.Logs {
+	logs, logRecord := r.buildLogs(agg.Event, decodePacket(agg.Event))
+	
+	logRecord.SetTimestamp(pcommon.NewTimestampFromTime(agg.StartTime))
+	logRecord.Attributes().PutInt("EventCount", agg.Count)
+	logRecord.Attributes().PutStr("EventStartTime", agg.StartTime.UTC().Format(time.RFC3339Nano))
+	logRecord.Attributes().PutStr("EventEndTime", agg.EndTime.UTC().Format(time.RFC3339Nano))
+	
+	if len(agg.ResponseCodes) > 0 {
+		codes := logRecord.Attributes().PutEmptySlice("DnsResponseCodes")
+		for _, code := range agg.ResponseCodes {
+			codes.AppendEmpty().SetInt(int64(code))
+		}
+	}
+	
+	if !r.applyFilterRules(logRecord) {
+		return plog.NewLogs()
+	}
+	
+	r.observe(stats.StageAfterFiltering, agg.Event, agg.Count)
+	return logs
+}
+
+// buildLogs transforms an ETW event and its decoded packet into a single ASIM
+// DNS log record
+func (r *DNSEtwReceiver) buildLogs(event *etw.Event, packet eventPacket) (plog.Logs, plog.LogRecord) {
 	logs := plog.NewLogs()
 	resourceLogs := logs.ResourceLogs().AppendEmpty()
 	
@@ -215,15 +991,23 @@ func (r *DNSEtwReceiver) convertEventToLogs(event *etw.Event) plog.Logs {
 	// Process based on provider type
 	if isDnsServerEvent(event) {
 		// Handle DNS Server events
-		handleDnsServerEvent(event, logRecord)
+		handleDnsServerEvent(event, packet, logRecord)
 		
 		// Set body for context using DNS Server specific naming
 		eventType, eventSubType := getAsimDnsServerEventType(event.System.EventID)
 		logRecord.Body().SetStr(fmt.Sprintf("DNS Server Event: %s %s (ID: %d)", 
 			eventType, eventSubType, event.System.EventID))
 	} else {
-		// Handle DNS Client events using existing code
+		// Classify the event from the DNS Client event catalogue
 		eventType, eventSubType := getAsimEventType(event.System.EventID)
+		clientEvent, known := catalog.Client(event.System.EventID)
+		if !known {
+			clientEvent = catalog.Event{Type: eventType, SubType: eventSubType, Result: catalog.ResultNA,
+				Dst: []string{"ServerList", "Address"}}
+		}
+		fields := clientEvent.Map(func(key string) (string, bool) {
+			return getEventDataString(event, key)
+		})
 		
 		// Set body for context
 		logRecord.Body().SetStr(fmt.Sprintf("DNS Client Event: %s %s (ID: %d)", 
@@ -236,6 +1020,9 @@ func (r *DNSEtwReceiver) convertEventToLogs(event *etw.Event) plog.Logs {
 		logRecord.Attributes().PutStr("EventProduct", "DNS Client")
 		logRecord.Attributes().PutStr("EventVendor", "Microsoft")
 		logRecord.Attributes().PutStr("EventOriginalType", fmt.Sprintf("%d", event.System.EventID))
+		if known {
+			logRecord.Attributes().PutStr("EventOriginalSubType", clientEvent.Name)
+		}
 		
 		// Set device information fields
 		setDeviceFields(logRecord)
@@ -253,8 +1040,15 @@ func (r *DNSEtwReceiver) convertEventToLogs(event *etw.Event) plog.Logs {
 			}
 		}
 		
+		// The DNS Client API only resolves Internet class names
+		setQueryClassFields(logRecord, dnswire.ClassIN)
+		
 		// Set network fields
 		setNetworkFields(event, logRecord)
+		setClientAddressFields(logRecord, fields)
+		if name := r.processNames.Name(event.System.Execution.ProcessID); name != "" {
+			logRecord.Attributes().PutStr("SrcProcessName", name)
+		}
 		
 		// Add DNS flags if available
 		if queryOptions, ok := getEventDataString(event, "QueryOptions"); ok {
@@ -270,19 +1064,24 @@ func (r *DNSEtwReceiver) convertEventToLogs(event *etw.Event) plog.Logs {
 			event.System.TimeCreated.SystemTime.UnixNano())
 		logRecord.Attributes().PutStr("DnsSessionId", sessionID)
 		
-		// Handle event result based on event type
-		if eventType == "Query" && eventSubType == "response" {
-			setResponseFields(event, logRecord)
-		} else {
-			// For non-response events (requests, cache operations)
-			logRecord.Attributes().PutStr("EventResult", "NA")
-			logRecord.Attributes().PutStr("EventResultDetails", "NA")
-		}
+		// Set the event result from the status code, when the event has one
+		setResponseFields(event, logRecord, fields)
 		
 		// Add any remaining fields as additional fields
 		setAdditionalFields(event, logRecord)
 	}
 	
+	// Add enrichments derived from the transformed fields
+	r.enrichAddresses(event, packet, logRecord)
+	r.enrichRecord(logRecord)
+	
+	// Bring the record to the configured ASIM schema version
+	completeRecord(logRecord, r.config.AsimSchemaVersion)
+	applySeverity(logRecord, r.severityPolicy)
+	
+	// Keep the raw event for re-processing
+	r.preserveRawEvent(event, logRecord)
+	
 	// Log the transformation for debugging - safely check for DnsQuery
 	dnsQuery := "not_set"
 	if val, ok := logRecord.Attributes().Get("DnsQuery"); ok {
@@ -297,7 +1096,89 @@ func (r *DNSEtwReceiver) convertEventToLogs(event *etw.Event) plog.Logs {
 			zap.String("DnsQuery", dnsQuery))
 	}
 	
-	return logs
+	return logs, logRecord
+}
+
+// enrichRecord normalises the query name of a transformed record and adds
+// the attributes derived from it
+func (r *DNSEtwReceiver) enrichRecord(logRecord plog.LogRecord) {
+	raw, ok := logRecord.Attributes().Get("DnsQuery")
+	if !ok {
+		return
+	}
+	name := dnsname.Normalize(raw.Str())
+	if name.ASCII == "" {
+		return
+	}
+	setQueryNameFields(logRecord, name)
+	query := name.ASCII
+	
+	setDomainPartFields(logRecord, r.suffixes.Split(query))
+	if rev, ok := dnsname.ParseReverse(query); ok {
+		setReverseFields(logRecord, rev, r.localNetworks)
+	}
+	
+	if r.dgaScorer != nil {
+		result := r.dgaScorer.Score(query)
+		logRecord.Attributes().PutStr("DnsQueryDgaVerdict", result.Verdict)
+		if result.Verdict != dga.VerdictSkipped {
+			logRecord.Attributes().PutDouble("DnsQueryDgaScore", result.Score)
+		}
+		if r.config.DGAThreatMapping && result.Verdict == dga.VerdictLikelyDGA {
+			setDGAThreatFields(logRecord, result)
+		}
+	}
+	
+	if r.nodTracker != nil {
+		// DNS Server records identify the querying client, DNS Client records the device
+		host, ok := logRecord.Attributes().Get("SrcIpAddr")
+		if !ok {
+			host, _ = logRecord.Attributes().Get("DvcHostname")
+		}
+		result := r.nodTracker.Observe(host.AsString(), r.suffixes.RegisteredDomain(query), time.Now())
+		if !result.HostWarmingUp {
+			logRecord.Attributes().PutBool("first_seen_host", result.FirstSeenHost)
+		}
+		if !result.GlobalWarmingUp {
+			logRecord.Attributes().PutBool("first_seen_global", result.FirstSeenGlobal)
+		}
+	}
+}
+
+// enrichAddresses adds the location and autonomous system of the client,
+// server and first answer addresses of a transformed record
+func (r *DNSEtwReceiver) enrichAddresses(event *etw.Event, packet eventPacket, logRecord plog.LogRecord) {
+	if r.geoResolver == nil {
+		return
+	}
+	
+	if src, ok := logRecord.Attributes().Get("SrcIpAddr"); ok {
+		if addr, ok := firstAddr(src.Str()); ok {
+			setGeoFields(logRecord, srcGeoFields, r.geoResolver.Lookup(addr))
+		}
+	}
+	if dst, ok := logRecord.Attributes().Get("DstIpAddr"); ok {
+		if addr, ok := firstAddr(dst.Str()); ok {
+			setGeoFields(logRecord, dstGeoFields, r.geoResolver.Lookup(addr))
+		}
+	}
+	
+	// The ASIM response fields describe a single address; prefer a public one
+	if addrs := answerAddrs(event, packet); len(addrs) > 0 {
+		var answer geoip.Location
+		for i, addr := range addrs {
+			loc := r.geoResolver.Lookup(addr)
+			if i == 0 || loc.Scope == geoip.ScopePublic {
+				answer = loc
+			}
+			if loc.Scope == geoip.ScopePublic {
+				break
+			}
+		}
+		if answer.Scope != "" {
+			setGeoFields(logRecord, answerGeoFields, answer)
+		}
+	}
 }
 
 // newDNSEtwReceiver creates a new Windows-specific ETW receiver
@@ -312,24 +1193,151 @@ func newDNSEtwReceiver(
 		getEventTypeFunc = getAsimDnsServerEventType
 	}
 	
+	// Create the Public Suffix List resolver shared by filtering and enrichment
+	suffixes := psl.NewResolver(settings.Logger, cfg.PublicSuffixListFile)
+	
 	// Create the filter manager
 	filterManager := filtering.NewFilterManager(
 		settings.Logger,
+		cfg.ProviderGUID,
 		cfg.IncludeInfoEvents,
 		cfg.ExcludedEventIDs,
 		cfg.ExcludedDomains,
+		cfg.ExcludedRegisteredDomains,
+		cfg.ExcludedPTRNetworks,
 		cfg.ExcludeAAAARecords,
 		cfg.EnableDeduplication,
 		cfg.DeduplicationWindow,
+		cfg.DeduplicationMode,
+		cfg.AggregationWindow,
+		cfg.AggregationKeyFields,
+		cfg.MaxOpenAggregates,
 		getEventDataString,
 		getEventTypeFunc,
+		suffixes.RegisteredDomain,
 	)
 	
+	// Compile expression-based filter rules
+	filterRules, err := rules.Compile(cfg.FilterRules)
+	if err != nil {
+		return nil, err
+	}
+	
 	r := &DNSEtwReceiver{
 		logger:        settings.Logger,
 		config:        cfg,
 		consumer:      consumer,
 		filterManager: filterManager,
+		suffixes:      suffixes,
+		filterRules:   filterRules,
+		localNetworks: localNetworks(cfg.PTRLocalNetworks),
+	}
+	
+	// Compile the severity policy
+	r.severityPolicy, err = severity.NewPolicy(cfg.severitySettings())
+	if err != nil {
+		return nil, err
+	}
+	
+	// Create the raw event preserver
+	r.rawPreserver, err = rawevent.NewPreserver(cfg.rawEventSettings())
+	if err != nil {
+		return nil, err
+	}
+	r.processNames = newProcessNames()
+	
+	// Create the heavy-hitter statistics tracker
+	if cfg.EnableStatistics {
+		r.statsTracker = stats.NewTracker(
+			time.Duration(cfg.StatisticsWindow)*time.Second,
+			cfg.StatisticsBuckets,
+			cfg.StatisticsCapacity)
+	}
+	
+	// Create the priority classifier and load shedder
+	if cfg.EnableLoadShedding {
+		classifier, err := shedding.NewClassifier(cfg.SheddingTiers)
+		if err != nil {
+			return nil, err
+		}
+		r.classifier = classifier
+		r.shedder = shedding.NewShedder(shedding.Thresholds{
+			LowQueueFraction:    *cfg.SheddingLowThreshold,
+			NormalQueueFraction: cfg.SheddingNormalThreshold,
+			RefusalHold:         time.Duration(cfg.SheddingRefusalHold) * time.Second,
+		})
+		r.queue = make(chan plog.Logs, cfg.SheddingQueueSize)
+	}
+	
+	// Create the threat intelligence store
+	if len(cfg.ThreatIntelSources) > 0 || len(cfg.TAXIICollections) > 0 {
+		r.threatStore = threatintel.NewStore(settings.Logger, cfg.ThreatIntelSources)
+	}
+	
+	// Create the DGA scorer
+	if cfg.EnableDGAScoring {
+		r.dgaScorer = dga.NewScorer(dga.Options{
+			Threshold:        cfg.DGAThreshold,
+			AllowDomains:     cfg.DGAAllowDomains,
+			RegisteredDomain: suffixes.RegisteredDomain,
+		})
+	}
+	
+	// Create the tunnel detector
+	if cfg.EnableTunnelDetection {
+		r.tunnelDetector = tunnel.NewDetector(tunnel.Options{
+			Window:              time.Duration(cfg.TunnelWindow) * time.Second,
+			MaxTracked:          cfg.TunnelMaxTracked,
+			MinUniqueSubdomains: cfg.TunnelMinUniqueSubdomains,
+			MinTXTQueries:       cfg.TunnelMinTXTQueries,
+			AllowDomains:        cfg.TunnelAllowDomains,
+			RegisteredDomain:    suffixes.RegisteredDomain,
+		})
+	}
+	
+	// Create the newly observed domain tracker
+	if cfg.EnableNewlyObservedDomains {
+		r.nodTracker = nod.NewTracker(nod.Options{
+			Days:       cfg.NODHistoryDays,
+			Capacity:   cfg.NODCapacity,
+			WarmUp:     time.Duration(cfg.NODWarmupPeriod) * time.Second,
+			HostFile:   cfg.NODHistoryFile,
+			GlobalFile: cfg.NODGlobalHistoryFile,
+		}, time.Now())
+	}
+	
+	// Create the GeoIP resolver
+	if cfg.GeoIPCityDatabase != "" || cfg.GeoIPASNDatabase != "" {
+		r.geoResolver = geoip.NewResolver(settings.Logger, geoip.Options{
+			CityFile:  cfg.GeoIPCityDatabase,
+			ASNFile:   cfg.GeoIPASNDatabase,
+			CacheSize: cfg.GeoIPCacheSize,
+		})
+	}
+	
+	// Create the exclusion recommender and its learning period tracker
+	if cfg.EnableRecommendations {
+		r.learnTracker = stats.NewTracker(
+			time.Duration(cfg.RecommendationLearningPeriod)*time.Second,
+			24,
+			cfg.StatisticsCapacity)
+		r.recommender = recommend.New(recommend.Options{
+			MinShare:          cfg.RecommendationMinShare,
+			MaxSuggestions:    cfg.RecommendationMaxSuggestions,
+			ProtectedDomains:  cfg.RecommendationProtectedDomains,
+			ProtectedEventIDs: filtering.QueryEventIDs(cfg.ProviderGUID),
+			// Every DNS Server event comes from the DNS service process
+			IncludeProcesses: cfg.ProviderGUID != DNSServerProviderGUID,
+		})
+		
+		// Never recommend excluding domains listed as threats
+		if r.threatStore != nil {
+			store := r.threatStore
+			r.recommender.AddProtector(func(domain string) bool {
+				_, ok := store.MatchDomain(domain)
+				return ok
+			})
+		}
 	}
 	
 	// Determine provider type for logging
@@ -346,7 +1354,9 @@ func newDNSEtwReceiver(
 		zap.Int("excluded_domains_count", len(cfg.ExcludedDomains)),
 		zap.Bool("deduplication_enabled", cfg.EnableDeduplication),
 		zap.Int("deduplication_window", cfg.DeduplicationWindow),
-		zap.Bool("exclude_aaaa_records", cfg.ExcludeAAAARecords))
+		zap.String("deduplication_mode", cfg.DeduplicationMode),
+		zap.Bool("exclude_aaaa_records", cfg.ExcludeAAAARecords),
+		zap.Int("filter_rules_count", filterRules.Len()))
 	
 	return r, nil
 }
@@ -0,0 +1,339 @@
+//go:build windows
+// +build windows
+
+package asimdns
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/0xrawsec/golang-etw/etw"
+	"go.opentelemetry.io/collector/consumer/consumertest"
+	"go.opentelemetry.io/collector/pdata/pcommon"
+	"go.opentelemetry.io/collector/pdata/plog"
+	"go.opentelemetry.io/collector/receiver/receivertest"
+
+	"github.com/LaurieRhodes/asim-dns-collector/internal/receiver/asimdns/asim"
+	"github.com/LaurieRhodes/asim-dns-collector/internal/receiver/asimdns/severity"
+	"github.com/LaurieRhodes/asim-dns-collector/internal/receiver/asimdns/shedding"
+	"github.com/LaurieRhodes/asim-dns-collector/internal/receiver/asimdns/tunnel"
+)
+
+// newTestReceiver creates a DNS Server receiver from the default configuration
+func newTestReceiver(t *testing.T, configure func(*Config)) *DNSEtwReceiver {
+	t.Helper()
+	cfg := createDefaultConfig().(*Config)
+	cfg.ProviderGUID = DNSServerProviderGUID
+	if configure != nil {
+		configure(cfg)
+	}
+	if err := cfg.Validate(); err != nil {
+		t.Fatalf("invalid configuration: %v", err)
+	}
+	r, err := newDNSEtwReceiver(receivertest.NewNopCreateSettings(), cfg, consumertest.NewNop())
+	if err != nil {
+		t.Fatalf("failed to create receiver: %v", err)
+	}
+	return r.(*DNSEtwReceiver)
+}
+
+// serverEvent creates a DNS Server event with the given event data
+func serverEvent(id uint16, at time.Time, data map[string]interface{}) *etw.Event {
+	event := &etw.Event{EventData: data}
+	event.System.EventID = id
+	event.System.Provider.Guid = DNSServerProviderGUID
+	event.System.TimeCreated.SystemTime = at
+	return event
+}
+
+func TestDetectTunnelKeepsLabelCase(t *testing.T) {
+	r := newTestReceiver(t, func(cfg *Config) {
+		cfg.EnableTunnelDetection = true
+	})
+
+	start := time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)
+	var detection tunnel.Detection
+	detected := false
+	for i := 0; i < 80 && !detected; i++ {
+		// Mixed-case base64 labels that are neither hex nor base32
+		label := fmt.Sprintf("Zm9vYmFyQmF6%04dQw", i)
+		event := serverEvent(256, start.Add(time.Duration(i)*time.Second), map[string]interface{}{
+			"QNAME":  label + ".Tunnel.Example.com.",
+			"QTYPE":  "1",
+			"Source": "192.0.2.44",
+		})
+		detection, detected = r.detectTunnel(event)
+	}
+	if !detected {
+		t.Fatal("no tunnel detected")
+	}
+	if detection.Domain != "example.com" || detection.EncodedQueries != detection.Queries {
+		t.Errorf("detection %s with %d of %d encoded queries", detection.Domain, detection.EncodedQueries, detection.Queries)
+	}
+	encoded := false
+	for _, reason := range detection.Reasons {
+		encoded = encoded || reason == tunnel.ReasonEncodedPayload
+	}
+	if !encoded {
+		t.Errorf("reasons %v lack %s", detection.Reasons, tunnel.ReasonEncodedPayload)
+	}
+}
+
+func TestSetDnsFlags(t *testing.T) {
+	tests := []struct {
+		name    string
+		options uint64
+		names   string
+		set     []string
+		// flags is the DnsFlags value, or "-" when the header flags are unset
+		flags            string
+		recursion, check bool
+	}{
+		{"standard", 0, "STANDARD", nil, "RD", true, false},
+		{"no recursion", 0x4, "NO_RECURSION", []string{"DnsQueryOptionNoRecursion"}, "", false, false},
+		{"checking disabled", 0x02000008, "BYPASS_CACHE DNSSEC_CHECKING_DISABLED",
+			[]string{"DnsQueryOptionBypassCache", "DnsQueryOptionDnssecCheckingDisabled"}, "RD CD", true, true},
+		{"unknown bits", 0x40008001, "ACCEPT_TRUNCATED_RESPONSE 0x40008000",
+			[]string{"DnsQueryOptionAcceptTruncatedResponse"}, "RD", true, false},
+		{"no wire query", 0x02000014, "NO_RECURSION NO_WIRE_QUERY DNSSEC_CHECKING_DISABLED",
+			[]string{"DnsQueryOptionNoRecursion", "DnsQueryOptionNoWireQuery", "DnsQueryOptionDnssecCheckingDisabled"}, "-", false, false},
+	}
+	for _, tt := range tests {
+		logRecord := plog.NewLogRecord()
+		setDnsFlags(tt.options, logRecord)
+		attrs := logRecord.Attributes()
+
+		if v, _ := attrs.Get("DnsQueryOptions"); v.Int() != int64(tt.options) {
+			t.Errorf("%s: DnsQueryOptions = %d", tt.name, v.Int())
+		}
+		if v, _ := attrs.Get("DnsQueryOptionNames"); v.Str() != tt.names {
+			t.Errorf("%s: DnsQueryOptionNames = %q, want %q", tt.name, v.Str(), tt.names)
+		}
+		options := 0
+		attrs.Range(func(k string, v pcommon.Value) bool {
+			if strings.HasPrefix(k, "DnsQueryOption") && k != "DnsQueryOptions" && k != "DnsQueryOptionNames" {
+				options++
+			}
+			return true
+		})
+		if options != len(tt.set) {
+			t.Errorf("%s: %d option attributes, want %d", tt.name, options, len(tt.set))
+		}
+		for _, attribute := range tt.set {
+			if v, ok := attrs.Get(attribute); !ok || !v.Bool() {
+				t.Errorf("%s: %s not set", tt.name, attribute)
+			}
+		}
+
+		flags, ok := attrs.Get("DnsFlags")
+		if tt.flags == "" && ok {
+			t.Errorf("%s: DnsFlags = %q without header flags", tt.name, flags.Str())
+		}
+		if tt.flags == "-" {
+			for _, key := range []string{"DnsFlags", "DnsFlagsRecursionDesired", "DnsFlagsCheckingDisabled"} {
+				if _, ok := attrs.Get(key); ok {
+					t.Errorf("%s: %s set without a query on the wire", tt.name, key)
+				}
+			}
+			continue
+		}
+		if tt.flags != "" && (!ok || flags.Str() != tt.flags) {
+			t.Errorf("%s: DnsFlags = %q, want %q", tt.name, flags.Str(), tt.flags)
+		}
+		if v, _ := attrs.Get("DnsFlagsRecursionDesired"); v.Bool() != tt.recursion {
+			t.Errorf("%s: DnsFlagsRecursionDesired = %t", tt.name, v.Bool())
+		}
+		if v, _ := attrs.Get("DnsFlagsCheckingDisabled"); v.Bool() != tt.check {
+			t.Errorf("%s: DnsFlagsCheckingDisabled = %t", tt.name, v.Bool())
+		}
+	}
+}
+
+// queryRecords transforms a DNS Server response and a DNS Client query
+// completed event for the same lookup
+func queryRecords(t *testing.T) (serverRecord, clientRecord plog.LogRecord) {
+	t.Helper()
+	at := time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)
+	server := newTestReceiver(t, nil)
+	_, serverRecord = server.buildLogs(decodeTestEvent(serverEvent(257, at, map[string]interface{}{
+		"QNAME":       "www.contoso.com.",
+		"QTYPE":       "1",
+		"RCODE":       "0",
+		"RD":          "1",
+		"Destination": "192.0.2.10",
+		"InterfaceIP": "192.0.2.53",
+		// Response with the flags QR RD RA and one A record, 192.0.2.80
+		"PacketData": "0x1234818000010001000000000377777707636f6e746f736f03636f6d0000010001" +
+			"c00c000100010000012c0004c0000250",
+	})))
+
+	client := newTestReceiver(t, func(cfg *Config) {
+		cfg.ProviderGUID = DNSClientProviderGUID
+	})
+	event := &etw.Event{EventData: map[string]interface{}{
+		"QueryName":    "www.contoso.com",
+		"QueryType":    "1",
+		"QueryOptions": "0",
+		"QueryStatus":  "0",
+		"QueryResults": "192.0.2.80;",
+		"ServerList":   "192.0.2.53;",
+	}}
+	event.System.EventID = 3008
+	event.System.Provider.Guid = DNSClientProviderGUID
+	event.System.TimeCreated.SystemTime = at
+	_, clientRecord = client.buildLogs(decodeTestEvent(event))
+	return serverRecord, clientRecord
+}
+
+func TestClientAndServerRecordsShareFields(t *testing.T) {
+	serverRecord, clientRecord := queryRecords(t)
+
+	// Fields whose value depends only on the query and its response
+	same := map[string]bool{
+		"EventType": true, "EventSubType": true, "EventResult": true, "EventResultDetails": true,
+		"EventSchema": true, "EventSchemaVersion": true, "DnsQuery": true, "Domain": true,
+		"DnsQueryType": true, "DnsQueryTypeName": true, "DnsQueryClass": true, "DnsQueryClassName": true,
+		"DnsResponseCode": true, "DnsResponseCodeName": true, "DnsResponseName": true,
+		"DnsFlagsRecursionDesired": true, "DnsFlagsCheckingDisabled": true,
+	}
+	fields := append(append([]string{}, asim.Mandatory...), asim.QueryMandatory...)
+	fields = append(fields, "EventSubType", "EventResultDetails", "EventOriginalType", "EventOriginalSubType",
+		"DnsQueryType", "DnsQueryTypeName", "DnsQueryClass", "DnsQueryClassName", "DnsResponseCode",
+		"DnsResponseCodeName", "DnsResponseName", "DnsFlags", "DnsFlagsRecursionDesired",
+		"DnsFlagsCheckingDisabled", "DstIpAddr", "Dst", "NetworkProtocol", "DnsSessionId")
+	for _, field := range fields {
+		serverValue, inServer := serverRecord.Attributes().Get(field)
+		clientValue, inClient := clientRecord.Attributes().Get(field)
+		switch {
+		case inServer != inClient:
+			t.Errorf("%s: in server record %t, in client record %t", field, inServer, inClient)
+		case !inServer:
+		case serverValue.Type() != clientValue.Type():
+			t.Errorf("%s: server %s, client %s", field, serverValue.Type(), clientValue.Type())
+		case same[field] && serverValue.AsString() != clientValue.AsString():
+			t.Errorf("%s: server %q, client %q", field, serverValue.AsString(), clientValue.AsString())
+		}
+	}
+
+	// The request and the response differ in flags, but not in their format
+	for provider, want := range map[string]string{"server": "QR RD RA", "client": "RD"} {
+		record := serverRecord
+		if provider == "client" {
+			record = clientRecord
+		}
+		if flags, _ := record.Attributes().Get("DnsFlags"); flags.Str() != want {
+			t.Errorf("%s DnsFlags = %q, want %q", provider, flags.Str(), want)
+		}
+	}
+}
+
+func TestRecordAttributesAreKnown(t *testing.T) {
+	serverRecord, clientRecord := queryRecords(t)
+	r := newTestReceiver(t, func(cfg *Config) {
+		cfg.EnableAuditEvents = true
+	})
+	audit := r.convertAuditEventToLogs(serverEvent(513, time.Now(), map[string]interface{}{"Zone": "contoso.com"}))
+	records := []plog.LogRecord{serverRecord, clientRecord, audit.ResourceLogs().At(0).ScopeLogs().At(0).LogRecords().At(0)}
+	for _, record := range records {
+		record.Attributes().Range(func(k string, _ pcommon.Value) bool {
+			if !knownAttribute(k) {
+				t.Errorf("attribute %s is not known to filter rules", k)
+			}
+			return true
+		})
+	}
+	for _, option := range dnsQueryOptions {
+		if !knownAttribute(option.attribute) {
+			t.Errorf("attribute %s is not known to filter rules", option.attribute)
+		}
+	}
+}
+
+func TestCacheLookupsAreLowTier(t *testing.T) {
+	r := newTestReceiver(t, func(cfg *Config) {
+		cfg.ProviderGUID = DNSClientProviderGUID
+		cfg.EnableLoadShedding = true
+	})
+	// A hit, and a miss reported as ERROR_NOT_FOUND
+	for _, status := range []string{"0", "1168"} {
+		event := &etw.Event{EventData: map[string]interface{}{
+			"QueryName":    "www.contoso.com",
+			"QueryType":    "1",
+			"QueryOptions": "0",
+			"Status":       status,
+		}}
+		event.System.EventID = 3018
+		event.System.Provider.Guid = DNSClientProviderGUID
+		event.System.TimeCreated.SystemTime = time.Now()
+		_, logRecord := r.buildLogs(decodeTestEvent(event))
+		if got := r.classifier.Classify(attributeFields(logRecord.Attributes())); got != shedding.TierLow {
+			t.Errorf("cache lookup with status %s classified %s, want low", status, got)
+		}
+	}
+}
+
+// decodeTestEvent returns an event with its decoded packet, as conversion does
+func decodeTestEvent(event *etw.Event) (*etw.Event, eventPacket) {
+	return event, decodePacket(event)
+}
+
+func TestAuditSeverity(t *testing.T) {
+	r := newTestReceiver(t, func(cfg *Config) {
+		cfg.EnableAuditEvents = true
+		cfg.SeverityOverrides = []severity.OverrideConfig{
+			{Severity: "High", Expression: `EventType == "Delete" and DnsZone == "contoso.com"`},
+		}
+	})
+
+	at := time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)
+	for zone, want := range map[string]severity.Level{"contoso.com": severity.High, "fabrikam.com": severity.Informational} {
+		logs := r.convertAuditEventToLogs(serverEvent(513, at, map[string]interface{}{"Zone": zone}))
+		logRecord := logs.ResourceLogs().At(0).ScopeLogs().At(0).LogRecords().At(0)
+		eventSeverity, _ := logRecord.Attributes().Get("EventSeverity")
+		if eventSeverity.Str() != want.String() || logRecord.SeverityText() != want.String() ||
+			logRecord.SeverityNumber() != plog.SeverityNumber(want.Number()) {
+			t.Errorf("%s: severity %s (%s, %d), want %s", zone, eventSeverity.Str(),
+				logRecord.SeverityText(), logRecord.SeverityNumber(), want)
+		}
+	}
+}
+
+func TestShutdownExportsRecordsEmittedWhileStopping(t *testing.T) {
+	cfg := createDefaultConfig().(*Config)
+	cfg.ProviderGUID = DNSServerProviderGUID
+	cfg.EnableLoadShedding = true
+	if err := cfg.Validate(); err != nil {
+		t.Fatalf("invalid configuration: %v", err)
+	}
+	sink := new(consumertest.LogsSink)
+	created, err := newDNSEtwReceiver(receivertest.NewNopCreateSettings(), cfg, sink)
+	if err != nil {
+		t.Fatalf("failed to create receiver: %v", err)
+	}
+	r := created.(*DNSEtwReceiver)
+
+	// Start the export queue without an ETW session
+	ctx, cancel := context.WithCancel(context.Background())
+	r.cancelFunc = cancel
+	r.queueDone = make(chan struct{})
+	r.queueWg.Add(1)
+	go r.processQueue(r.queueDone)
+
+	// A background goroutine that emits as it stops, as flushAggregates may
+	r.goBackground(ctx, func(ctx context.Context) {
+		<-ctx.Done()
+		time.Sleep(20 * time.Millisecond)
+		logs, _ := r.newReceiverRecord("test")
+		r.emit(ctx, logs)
+	})
+
+	if err := r.Shutdown(context.Background()); err != nil {
+		t.Fatalf("shutdown failed: %v", err)
+	}
+	if got := sink.LogRecordCount(); got != 1 {
+		t.Errorf("%d records exported, want the record emitted while stopping", got)
+	}
+}
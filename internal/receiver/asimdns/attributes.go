@@ -0,0 +1,72 @@
+package asimdns
+
+// recordAttributes are the attributes a transformed record can carry: the ASIM
+// fields and aliases, and the attributes added by decoding and enrichment.
+// Filter rules may only refer to these.
+var recordAttributes = map[string]bool{}
+
+func init() {
+	for _, group := range [][]string{
+		// ASIM common and DNS schema fields, and their aliases
+		{"EventCount", "EventStartTime", "EventEndTime", "EventType", "EventSubType", "EventResult",
+			"EventResultDetails", "EventOriginalType", "EventOriginalSubType", "EventOriginalResultDetails",
+			"EventProduct", "EventVendor", "EventSchema", "EventSchemaVersion", "EventSeverity", "Duration",
+			"Dvc", "DvcHostname", "DvcIpAddr", "DvcId", "DvcOs", "DvcOsVersion", "DvcDomainType", "DvcScopeId",
+			"DvcInterface", "DvcAction", "SrcIpAddr", "SrcPortNumber", "SrcHostname", "SrcProcessId",
+			"SrcProcessName", "ActingProcessId", "DstIpAddr", "DstPortNumber", "DstHostname", "NetworkProtocol",
+			"Src", "Dst", "IpAddr", "Domain", "SessionId", "Rule", "RuleName", "Process"},
+		// Query and response
+		{"DnsQuery", "DnsQueryType", "DnsQueryTypeName", "DnsQueryClass", "DnsQueryClassName",
+			"DnsResponseCode", "DnsResponseCodeName", "DnsResponseCodes", "DnsResponseName", "DnsResponseTtl",
+			"DnsResponseIpAddresses", "DnsAnswers", "DnsAuthorityCount", "DnsAdditionalCount", "DnsSessionId",
+			"DnsNetworkDuration", "DnsServerAddresses", "DnsZone", "DnsZoneScope", "DnsServerScope",
+			"DnsCacheScope", "DnsPacketData", "DnsPacketError", "AdditionalFields"},
+		// Header flags and EDNS
+		{"DnsFlags", "DnsFlagsAuthoritative", "DnsFlagsTruncated", "DnsFlagsRecursionDesired",
+			"DnsFlagsRecursionAvailable", "DnsFlagsZ", "DnsFlagsAuthenticated", "DnsFlagsCheckingDisabled",
+			"DnsEdnsUdpSize", "DnsEdnsVersion", "DnsEdnsDnssecOk", "DnsEdnsClientSubnet",
+			"DnsEdnsClientSubnetScope", "DnsEdnsClientCookie", "DnsEdnsServerCookie"},
+		// DNS Client query options
+		{"DnsQueryOptions", "DnsQueryOptionNames", "DnsQueryOptionAcceptTruncatedResponse",
+			"DnsQueryOptionUseTcpOnly", "DnsQueryOptionNoRecursion", "DnsQueryOptionBypassCache",
+			"DnsQueryOptionNoWireQuery", "DnsQueryOptionNoLocalName", "DnsQueryOptionNoHostsFile",
+			"DnsQueryOptionNoNetbt", "DnsQueryOptionWireOnly", "DnsQueryOptionReturnMessage",
+			"DnsQueryOptionMulticastOnly", "DnsQueryOptionNoMulticast", "DnsQueryOptionTreatAsFqdn",
+			"DnsQueryOptionAddrConfig", "DnsQueryOptionDualAddr", "DnsQueryOptionMulticastWait",
+			"DnsQueryOptionMulticastVerify", "DnsQueryOptionDontResetTtlValues",
+			"DnsQueryOptionDisableIdnEncoding", "DnsQueryOptionAppendMultilabel", "DnsQueryOptionDnssecOk",
+			"DnsQueryOptionDnssecCheckingDisabled"},
+		// Query name enrichment
+		{"DnsQueryUnicode", "DnsQueryInvalidReason", "DnsQueryMixedScript", "DnsQueryTld",
+			"DnsQueryPublicSuffix", "DnsQueryPrivateSuffix", "DnsQueryRegisteredDomain", "DnsQuerySubdomain",
+			"DnsQueryLabelCount", "DnsQueryPtrAddr", "DnsQueryPtrNetwork", "DnsQueryPtrScope",
+			"DnsQueryPtrInvalidReason", "DnsQueryDgaScore", "DnsQueryDgaVerdict",
+			"first_seen_host", "first_seen_global"},
+		// Threat intelligence
+		{"ThreatId", "ThreatName", "ThreatCategory", "ThreatRiskLevel", "ThreatConfidence",
+			"ThreatOriginalConfidence", "ThreatField", "ThreatIndicatorType", "ThreatIpAddr"},
+		// Audit records
+		{"Operation", "Object", "ObjectType", "OldValue", "NewValue", "DnsRecordType", "ActorUsername"},
+		// Raw event preservation
+		{"EventOriginal", "EventOriginalSize", "EventOriginalTruncated"},
+	} {
+		for _, field := range group {
+			recordAttributes[field] = true
+		}
+	}
+
+	// Location and autonomous system of the client, server and answer addresses
+	for _, names := range []geoFieldNames{srcGeoFields, dstGeoFields, answerGeoFields} {
+		recordAttributes[names.scope] = true
+		for _, suffix := range []string{"Country", "Region", "City", "Latitude", "Longitude"} {
+			recordAttributes[names.geo+suffix] = true
+		}
+		recordAttributes[names.asn+"Asn"] = true
+		recordAttributes[names.asn+"AsnOrganization"] = true
+	}
+}
+
+// knownAttribute reports whether a record can carry an attribute
+func knownAttribute(name string) bool {
+	return recordAttributes[name]
+}
@@ -0,0 +1,201 @@
+package catalog
+
+import (
+	"strconv"
+
+	"github.com/LaurieRhodes/asim-dns-collector/internal/receiver/asimdns/dnswire"
+)
+
+// ASIM Audit event types
+const (
+	AuditCreate  = "Create"
+	AuditDelete  = "Delete"
+	AuditSet     = "Set"
+	AuditClear   = "Clear"
+	AuditExecute = "Execute"
+	AuditOther   = "Other"
+)
+
+// ASIM Audit object types
+const (
+	ObjectConfiguration = "Configuration Atom"
+	ObjectPolicy        = "Policy Rule"
+	ObjectOther         = "Other"
+)
+
+// DNS Server audit events use IDs 513 to 582 of the provider's audit channel
+const (
+	firstAuditID uint16 = 513
+	lastAuditID  uint16 = 582
+)
+
+// Audit event data fields holding the changed object and its value
+var (
+	recordObject  = []string{"NAME", "Name", "NodeName"}
+	recordValue   = []string{"RDATA"}
+	zoneObject    = []string{"Zone", "ZoneName"}
+	scopeObject   = []string{"ZoneScope", "ServerScope", "Scope", "Name"}
+	settingObject = []string{"PropertyKey", "Setting", "SettingName"}
+	settingValue  = []string{"PropertyValue", "NewValue", "Value"}
+	policyObject  = []string{"PolicyName", "Name"}
+	trustObject   = []string{"TrustPointName", "Name", "Zone"}
+	keyObject     = []string{"KeyId", "KeyTag", "Zone"}
+	subnetObject  = []string{"ClientSubnetName", "Name"}
+)
+
+// AuditEvent describes a DNS Server audit event
+type AuditEvent struct {
+	ID   uint16
+	Name string
+	// Type is the ASIM Audit event type and Operation describes the change
+	Type       string
+	Operation  string
+	ObjectType string
+	// Object and Value list the fields tried for the changed object and its
+	// value. The value is the old value of deletions and the new value otherwise.
+	Object []string
+	Value  []string
+}
+
+// AuditFields are the ASIM Audit attributes derived from an audit event
+type AuditFields struct {
+	EventType  string
+	Operation  string
+	Object     string
+	ObjectType string
+	OldValue   string
+	NewValue   string
+	Zone       string
+	ZoneScope  string
+	// RecordType is the mnemonic of the resource record type changed
+	RecordType string
+	// SrcIpAddr is the client of a dynamic update
+	SrcIpAddr string
+	// ActorUsername is set when the event data names the user
+	ActorUsername string
+}
+
+// auditEvents are the Microsoft-Windows-DNSServer audit channel events
+var auditEvents = []AuditEvent{
+	{513, "ZONE_DELETE", AuditDelete, "Delete zone", ObjectConfiguration, zoneObject, nil},
+	{514, "ZONE_UPDATED", AuditSet, "Update zone property", ObjectConfiguration, settingObject, settingValue},
+	{515, "RECORD_CREATE", AuditCreate, "Create resource record", ObjectConfiguration, recordObject, recordValue},
+	{516, "RECORD_DELETE", AuditDelete, "Delete resource record", ObjectConfiguration, recordObject, recordValue},
+	{517, "RRSET_DELETE", AuditDelete, "Delete resource record set", ObjectConfiguration, recordObject, nil},
+	{518, "NODE_DELETE", AuditDelete, "Delete node", ObjectConfiguration, recordObject, nil},
+	{519, "RECORD_CREATE_DYNAMIC_UPDATE", AuditCreate, "Create resource record by dynamic update", ObjectConfiguration, recordObject, recordValue},
+	{520, "RECORD_DELETE_DYNAMIC_UPDATE", AuditDelete, "Delete resource record by dynamic update", ObjectConfiguration, recordObject, recordValue},
+	{521, "RECORD_SCAVENGE", AuditDelete, "Scavenge resource record", ObjectConfiguration, recordObject, recordValue},
+	{522, "ZONE_SCOPE_CREATE", AuditCreate, "Create zone scope", ObjectConfiguration, scopeObject, nil},
+	{523, "ZONE_SCOPE_DELETE", AuditDelete, "Delete zone scope", ObjectConfiguration, scopeObject, nil},
+	{525, "ZONE_SIGN", AuditExecute, "Sign zone", ObjectConfiguration, zoneObject, nil},
+	{526, "ZONE_UNSIGN", AuditExecute, "Unsign zone", ObjectConfiguration, zoneObject, nil},
+	{527, "ZONE_RESIGN", AuditExecute, "Re-sign zone", ObjectConfiguration, zoneObject, nil},
+	{528, "KEY_ROLLOVER_QUEUED", AuditExecute, "Queue key rollover", ObjectConfiguration, keyObject, nil},
+	{529, "KEY_ROLLOVER_START", AuditExecute, "Start key rollover", ObjectConfiguration, keyObject, nil},
+	{530, "KEY_ROLLOVER_END", AuditExecute, "Complete key rollover", ObjectConfiguration, keyObject, nil},
+	{536, "CACHE_PURGE", AuditClear, "Purge cache", ObjectOther, zoneObject, nil},
+	{537, "FORWARDER_RESET", AuditSet, "Reset forwarders", ObjectConfiguration, settingObject, settingValue},
+	{541, "SERVER_SETTING", AuditSet, "Update server setting", ObjectConfiguration, settingObject, settingValue},
+	{542, "SERVER_SCOPE_CREATE", AuditCreate, "Create server scope", ObjectConfiguration, scopeObject, nil},
+	{543, "SERVER_SCOPE_DELETE", AuditDelete, "Delete server scope", ObjectConfiguration, scopeObject, nil},
+	{544, "ADD_TRUST_POINT_DNSKEY", AuditCreate, "Add DNSKEY trust point", ObjectConfiguration, trustObject, recordValue},
+	{545, "ADD_TRUST_POINT_DS", AuditCreate, "Add DS trust point", ObjectConfiguration, trustObject, recordValue},
+	{546, "REMOVE_TRUST_POINT", AuditDelete, "Remove trust point", ObjectConfiguration, trustObject, nil},
+	{547, "ADD_TRUST_ANCHOR_ROOT", AuditCreate, "Add root trust anchor", ObjectConfiguration, trustObject, nil},
+	{548, "RESTART_SERVER", AuditExecute, "Restart server", ObjectOther, nil, nil},
+	{549, "CLEAR_DEBUG_LOGS", AuditClear, "Clear debug logs", ObjectOther, nil, nil},
+	{550, "WRITE_DIRTY_ZONES", AuditExecute, "Write dirty zones", ObjectOther, nil, nil},
+	{551, "CLEAR_STATISTICS", AuditClear, "Clear statistics", ObjectOther, nil, nil},
+	{552, "START_SCAVENGING", AuditExecute, "Start scavenging", ObjectOther, nil, nil},
+	{553, "ENLIST_DIRECTORY_PARTITION", AuditSet, "Enlist directory partition", ObjectConfiguration, settingObject, nil},
+	{554, "ABORT_SCAVENGING", AuditExecute, "Abort scavenging", ObjectOther, nil, nil},
+	{555, "PREPARE_FOR_DEMOTION", AuditExecute, "Prepare for demotion", ObjectOther, nil, nil},
+	{556, "WRITE_ROOT_HINTS", AuditExecute, "Write root hints", ObjectConfiguration, nil, nil},
+	{557, "LISTEN_ADDRESSES", AuditSet, "Update listen addresses", ObjectConfiguration, settingObject, settingValue},
+	{558, "ACTIVE_REFRESH_ALL_TRUSTPOINTS", AuditExecute, "Refresh trust points", ObjectConfiguration, nil, nil},
+	{559, "PAUSE_ZONE", AuditExecute, "Pause zone", ObjectConfiguration, zoneObject, nil},
+	{560, "RESUME_ZONE", AuditExecute, "Resume zone", ObjectConfiguration, zoneObject, nil},
+	{561, "RELOAD_ZONE", AuditExecute, "Reload zone", ObjectConfiguration, zoneObject, nil},
+	{562, "REFRESH_ZONE", AuditExecute, "Refresh zone", ObjectConfiguration, zoneObject, nil},
+	{563, "EXPIRE_ZONE", AuditExecute, "Expire zone", ObjectConfiguration, zoneObject, nil},
+	{564, "UPDATE_FROM_DS", AuditExecute, "Update zone from directory", ObjectConfiguration, zoneObject, nil},
+	{565, "WRITE_AND_NOTIFY", AuditExecute, "Write zone and notify", ObjectConfiguration, zoneObject, nil},
+	{566, "FORCE_AGING", AuditSet, "Force aging", ObjectConfiguration, recordObject, nil},
+	{567, "SCAVENGE_SERVERS", AuditSet, "Update scavenging servers", ObjectConfiguration, zoneObject, settingValue},
+	{568, "TRANSFER_KEYMASTER", AuditSet, "Transfer key master", ObjectConfiguration, zoneObject, settingValue},
+	{569, "ADD_SKD", AuditCreate, "Add signing key descriptor", ObjectConfiguration, keyObject, nil},
+	{570, "MODIFY_SKD", AuditSet, "Modify signing key descriptor", ObjectConfiguration, keyObject, settingValue},
+	{571, "DELETE_SKD", AuditDelete, "Delete signing key descriptor", ObjectConfiguration, keyObject, nil},
+	{572, "MODIFY_SKD_STATE", AuditSet, "Modify signing key descriptor state", ObjectConfiguration, keyObject, settingValue},
+	{573, "ADD_DELEGATION", AuditCreate, "Add delegation", ObjectConfiguration, recordObject, nil},
+	{574, "CREATE_CLIENT_SUBNET_RECORD", AuditCreate, "Create client subnet", ObjectConfiguration, subnetObject, settingValue},
+	{575, "DELETE_CLIENT_SUBNET_RECORD", AuditDelete, "Delete client subnet", ObjectConfiguration, subnetObject, nil},
+	{576, "UPDATE_CLIENT_SUBNET_RECORD", AuditSet, "Update client subnet", ObjectConfiguration, subnetObject, settingValue},
+	{577, "CREATE_SERVER_LEVEL_POLICY", AuditCreate, "Create server policy", ObjectPolicy, policyObject, nil},
+	{578, "CREATE_ZONE_LEVEL_POLICY", AuditCreate, "Create zone policy", ObjectPolicy, policyObject, nil},
+	{579, "CREATE_FORWARDING_POLICY", AuditCreate, "Create forwarding policy", ObjectPolicy, policyObject, nil},
+	{580, "DELETE_SERVER_LEVEL_POLICY", AuditDelete, "Delete server policy", ObjectPolicy, policyObject, nil},
+	{581, "DELETE_ZONE_LEVEL_POLICY", AuditDelete, "Delete zone policy", ObjectPolicy, policyObject, nil},
+	{582, "DELETE_FORWARDING_POLICY", AuditDelete, "Delete forwarding policy", ObjectPolicy, policyObject, nil},
+}
+
+// IsAudit reports whether an event ID belongs to the DNS Server audit channel
+func IsAudit(id uint16) bool {
+	return id >= firstAuditID && id <= lastAuditID
+}
+
+// Audit returns the description of a DNS Server audit event. Audit channel
+// IDs without a description are returned as Other operations.
+func Audit(id uint16) (AuditEvent, bool) {
+	for _, e := range auditEvents {
+		if e.ID == id {
+			return e, true
+		}
+	}
+	if IsAudit(id) {
+		return AuditEvent{ID: id, Name: "AUDIT_" + strconv.Itoa(int(id)), Type: AuditOther,
+			Operation: "DNS Server audit event " + strconv.Itoa(int(id)), ObjectType: ObjectOther,
+			Object: zoneObject}, true
+	}
+	return AuditEvent{}, false
+}
+
+// AuditEvents returns all described DNS Server audit events
+func AuditEvents() []AuditEvent {
+	return append([]AuditEvent(nil), auditEvents...)
+}
+
+// Map derives the ASIM Audit fields of an event from its event data
+func (e AuditEvent) Map(get func(string) (string, bool)) AuditFields {
+	f := AuditFields{
+		EventType:     e.Type,
+		Operation:     e.Operation,
+		Object:        first(get, e.Object),
+		ObjectType:    e.ObjectType,
+		Zone:          first(get, zoneObject),
+		ZoneScope:     first(get, []string{"ZoneScope", "Scope"}),
+		SrcIpAddr:     firstAddress(get, []string{"Source", "ClientIP"}),
+		ActorUsername: first(get, []string{"UserName", "User"}),
+	}
+	if value := first(get, e.Value); value != "" {
+		if e.Type == AuditDelete {
+			f.OldValue = value
+		} else {
+			f.NewValue = value
+		}
+	}
+	if value, ok := get("Type"); ok {
+		if t, err := strconv.Atoi(value); err == nil && t >= 0 && t <= 0xffff {
+			f.RecordType = dnswire.TypeName(uint16(t))
+		}
+	}
+	// ASIM requires an object; fall back to the zone or the server itself
+	if f.Object == "" {
+		f.Object = f.Zone
+	}
+	if f.Object == "" {
+		f.Object = "DNS Server"
+	}
+	return f
+}
@@ -0,0 +1,186 @@
+// Package catalog describes the Windows DNS ETW events the collector
+// understands: their symbolic names, ASIM classification, how the event
+// result is derived and which event data fields hold the addresses of the
+// client and server.
+package catalog
+
+import (
+	"strconv"
+
+	"github.com/LaurieRhodes/asim-dns-collector/internal/receiver/asimdns/dnswire"
+)
+
+// ASIM event types. The ASIM DNS schema only defines Query; other activity is
+// classified as Info and only forwarded when info events are included.
+const (
+	TypeQuery = "Query"
+	TypeInfo  = "Info"
+)
+
+// ASIM event results
+const (
+	ResultSuccess = "Success"
+	ResultFailure = "Failure"
+	ResultNA      = "NA"
+)
+
+// ASIM device actions
+const (
+	ActionAllow = "Allow"
+	ActionDeny  = "Deny"
+	ActionDrop  = "Drop"
+)
+
+// Event describes one ETW event ID
+type Event struct {
+	ID uint16
+	// Name is the symbolic name from the provider manifest
+	Name    string
+	Type    string
+	SubType string
+	// Result is used when the event carries no response code, and
+	// ResultDetails explains it
+	Result        string
+	ResultDetails string
+	// Rcode is set for events carrying a response code that decides the result
+	Rcode bool
+	// Status lists the fields tried for a DNS Client status code that decides
+	// the result
+	Status []string
+	// Action is the device action of the event
+	Action string
+	// Policy is set for responses that a DNS policy can decide. When a policy
+	// matched, the action is Allow for a successful result and Deny otherwise.
+	Policy bool
+	// Src and Dst list the event data fields tried for the client and server
+	// addresses, in order
+	Src []string
+	Dst []string
+}
+
+// ServerIsClient reports whether the collecting server made the request, as
+// for recursion, so that its own address is the source
+func (e Event) ServerIsClient() bool {
+	return len(e.Src) > 0 && e.Src[0] == "InterfaceIP"
+}
+
+// Fields are the ASIM attributes derived from an event
+type Fields struct {
+	EventType          string
+	EventSubType       string
+	EventResult        string
+	EventResultDetails string
+	// OriginalResultDetails is the DNS Client status name
+	OriginalResultDetails string
+	// HasResponseCode is set when ResponseCode was read from the event
+	HasResponseCode bool
+	ResponseCode    int
+	DvcAction       string
+	// RuleName is the DNS policy that matched
+	RuleName    string
+	Zone        string
+	ZoneScope   string
+	ServerScope string
+	CacheScope  string
+	SrcIpAddr   string
+	DstIpAddr   string
+	// ServerList is the list of resolvers of a DNS Client query
+	ServerList string
+	// Interface and InterfaceIndex identify the network interface, when known
+	Interface      string
+	InterfaceIndex int
+}
+
+// Map derives the ASIM fields of an event from its event data
+func (e Event) Map(get func(string) (string, bool)) Fields {
+	f := Fields{
+		EventType:          e.Type,
+		EventSubType:       e.SubType,
+		EventResult:        e.Result,
+		EventResultDetails: e.ResultDetails,
+		DvcAction:          e.Action,
+		SrcIpAddr:          firstAddress(get, e.Src),
+		DstIpAddr:          firstAddress(get, e.Dst),
+		ServerList:         first(get, []string{"ServerList"}),
+		Interface:          first(get, []string{"Interface", "InterfaceName", "AdapterName"}),
+		Zone:               first(get, []string{"Zone"}),
+		ZoneScope:          first(get, []string{"ZoneScope", "Scope"}),
+		ServerScope:        first(get, []string{"ServerScope"}),
+		CacheScope:         first(get, []string{"CacheScope"}),
+		RuleName:           first(get, []string{"PolicyName"}),
+	}
+	if f.EventResultDetails == "" {
+		f.EventResultDetails = f.EventResult
+	}
+	if e.Rcode {
+		if value, ok := get("RCODE"); ok {
+			if rcode, err := strconv.Atoi(value); err == nil && rcode >= 0 && rcode <= 0xffff {
+				f.HasResponseCode, f.ResponseCode = true, rcode
+				f.EventResult = ResultSuccess
+				if rcode != 0 {
+					f.EventResult = ResultFailure
+				}
+				f.EventResultDetails = dnswire.RcodeName(uint16(rcode))
+			}
+		}
+	}
+	if index, err := strconv.Atoi(first(get, []string{"InterfaceIndex"})); err == nil && index > 0 {
+		f.InterfaceIndex = index
+	}
+	if value := first(get, e.Status); value != "" {
+		if code, err := strconv.Atoi(value); err == nil {
+			status := ClientStatus(code)
+			f.OriginalResultDetails = status.Name
+			f.EventResult, f.EventResultDetails = ResultFailure, status.Name
+			if code == 0 {
+				f.EventResult = ResultSuccess
+			}
+			if status.HasRcode {
+				f.HasResponseCode, f.ResponseCode = true, int(status.Rcode)
+				f.EventResultDetails = dnswire.RcodeName(status.Rcode)
+			}
+		}
+	}
+	if !f.HasResponseCode && e.Result == ResultFailure {
+		if reason, ok := get("Reason"); ok && reason != "" {
+			f.EventResultDetails = reason
+		}
+	}
+	if f.RuleName != "" && e.Policy {
+		f.DvcAction = ActionDeny
+		if f.EventResult == ResultSuccess {
+			f.DvcAction = ActionAllow
+		}
+	}
+	return f
+}
+
+// first returns the first non-empty field
+func first(get func(string) (string, bool), fields []string) string {
+	for _, field := range fields {
+		if value, ok := get(field); ok && value != "" {
+			return value
+		}
+	}
+	return ""
+}
+
+// firstAddress returns the first non-empty field, reduced to its first
+// address when it holds a list
+func firstAddress(get func(string) (string, bool), fields []string) string {
+	value := first(get, fields)
+	if addrs := ServerAddresses(value); len(addrs) > 0 {
+		return addrs[0].String()
+	}
+	return value
+}
+
+// lookup finds an event in a catalogue
+func lookup(events []Event, id uint16) (Event, bool) {
+	for _, e := range events {
+		if e.ID == id {
+			return e, true
+		}
+	}
+	return Event{}, false
+}
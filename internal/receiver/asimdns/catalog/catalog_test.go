@@ -0,0 +1,209 @@
+package catalog
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// fixture is a recorded event and the fields expected from it
+type fixture struct {
+	ID   uint16            `json:"id"`
+	Name string            `json:"name"`
+	Data map[string]string `json:"data"`
+	Want Fields            `json:"want"`
+}
+
+// loadFixtures reads the fixtures of a catalogue, keyed by event ID
+func loadFixtures(t *testing.T, dir string) map[uint16]fixture {
+	t.Helper()
+	paths, err := filepath.Glob(filepath.Join("testdata", dir, "*.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	fixtures := make(map[uint16]fixture)
+	for _, path := range paths {
+		raw, err := os.ReadFile(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var f fixture
+		if err := json.Unmarshal(raw, &f); err != nil {
+			t.Fatalf("%s: %v", path, err)
+		}
+		if _, ok := fixtures[f.ID]; ok {
+			t.Fatalf("%s: duplicate fixture for event %d", path, f.ID)
+		}
+		fixtures[f.ID] = f
+	}
+	return fixtures
+}
+
+// checkCatalogue maps every fixture and requires one fixture per event
+func checkCatalogue(t *testing.T, dir string, events []Event, find func(uint16) (Event, bool)) {
+	fixtures := loadFixtures(t, dir)
+	for _, e := range events {
+		f, ok := fixtures[e.ID]
+		if !ok {
+			t.Errorf("event %d %s has no fixture", e.ID, e.Name)
+			continue
+		}
+		if f.Name != e.Name {
+			t.Errorf("fixture %d is named %s, catalogue has %s", e.ID, f.Name, e.Name)
+		}
+		got := e.Map(func(key string) (string, bool) {
+			value, ok := f.Data[key]
+			return value, ok
+		})
+		if got != f.Want {
+			t.Errorf("event %d %s:\n got  %+v\n want %+v", e.ID, e.Name, got, f.Want)
+		}
+	}
+	for id := range fixtures {
+		if _, ok := find(id); !ok {
+			t.Errorf("fixture for event %d is not in the catalogue", id)
+		}
+	}
+}
+
+func TestServerEvents(t *testing.T) {
+	checkCatalogue(t, "server", ServerEvents(), Server)
+}
+
+func TestServerCatalogueIsComplete(t *testing.T) {
+	for id := uint16(256); id <= 282; id++ {
+		if _, ok := Server(id); !ok {
+			t.Errorf("analytic event %d is not mapped", id)
+		}
+	}
+	seen := make(map[uint16]bool)
+	for _, e := range ServerEvents() {
+		if seen[e.ID] {
+			t.Errorf("event %d listed twice", e.ID)
+		}
+		seen[e.ID] = true
+		if len(e.Src) == 0 || len(e.Dst) == 0 {
+			t.Errorf("event %d has no address fields", e.ID)
+		}
+	}
+}
+
+func TestResponseCodeOverridesDefaultResult(t *testing.T) {
+	e, _ := Server(257)
+	data := map[string]string{"RCODE": "3", "PolicyName": "Sinkhole"}
+	got := e.Map(func(key string) (string, bool) {
+		value, ok := data[key]
+		return value, ok
+	})
+	if got.EventResult != ResultFailure || got.EventResultDetails != "NXDOMAIN" || got.DvcAction != ActionDeny {
+		t.Errorf("unexpected fields %+v", got)
+	}
+
+	// A failure without a response code keeps its default details
+	e, _ = Server(258)
+	got = e.Map(func(string) (string, bool) { return "", false })
+	if got.EventResult != ResultFailure || got.EventResultDetails != ResultFailure || got.HasResponseCode {
+		t.Errorf("unexpected fields %+v", got)
+	}
+}
+
+func TestClientEvents(t *testing.T) {
+	checkCatalogue(t, "client", ClientEvents(), Client)
+}
+
+func TestClientStatus(t *testing.T) {
+	if s := ClientStatus(9003); !s.HasRcode || s.Rcode != 3 || s.Name != "DNS_ERROR_RCODE_NAME_ERROR" {
+		t.Errorf("ClientStatus(9003) = %+v", s)
+	}
+	if s := ClientStatus(1460); s.HasRcode || s.Name != "ERROR_TIMEOUT" {
+		t.Errorf("ClientStatus(1460) = %+v", s)
+	}
+	if s := ClientStatus(424242); s.Name != "424242" {
+		t.Errorf("ClientStatus(424242) = %+v", s)
+	}
+	for code, s := range clientStatuses {
+		if s.HasRcode && code != 0 && code != 9000+int(s.Rcode) {
+			t.Errorf("status %d reports rcode %d", code, s.Rcode)
+		}
+	}
+}
+
+func TestServerAddresses(t *testing.T) {
+	got := ServerAddresses("10.0.0.53;2001:db8::53; 10.0.0.53,[2001:db8::54]:53;::ffff:192.0.2.1;bogus;")
+	want := []string{"10.0.0.53", "2001:db8::53", "2001:db8::54", "192.0.2.1"}
+	if len(got) != len(want) {
+		t.Fatalf("got %v, want %v", got, want)
+	}
+	for i := range want {
+		if got[i].String() != want[i] {
+			t.Errorf("address %d = %s, want %s", i, got[i], want[i])
+		}
+	}
+	if addrs := ServerAddresses(""); len(addrs) != 0 {
+		t.Errorf("empty list gave %v", addrs)
+	}
+}
+
+// auditFixture is a recorded audit event and the fields expected from it
+type auditFixture struct {
+	ID   uint16            `json:"id"`
+	Name string            `json:"name"`
+	Data map[string]string `json:"data"`
+	Want AuditFields       `json:"want"`
+}
+
+func TestAuditEvents(t *testing.T) {
+	paths, err := filepath.Glob(filepath.Join("testdata", "audit", "*.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(paths) == 0 {
+		t.Fatal("no audit fixtures")
+	}
+	for _, path := range paths {
+		raw, err := os.ReadFile(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var f auditFixture
+		if err := json.Unmarshal(raw, &f); err != nil {
+			t.Fatalf("%s: %v", path, err)
+		}
+		e, ok := Audit(f.ID)
+		if !ok || e.Name != f.Name {
+			t.Errorf("%s: catalogue has %q for event %d", path, e.Name, f.ID)
+			continue
+		}
+		got := e.Map(func(key string) (string, bool) {
+			value, ok := f.Data[key]
+			return value, ok
+		})
+		if got != f.Want {
+			t.Errorf("event %d %s:\n got  %+v\n want %+v", e.ID, e.Name, got, f.Want)
+		}
+	}
+}
+
+func TestAuditCatalogue(t *testing.T) {
+	types := map[string]bool{AuditCreate: true, AuditDelete: true, AuditSet: true, AuditClear: true, AuditExecute: true, AuditOther: true}
+	seen := make(map[uint16]bool)
+	for _, e := range AuditEvents() {
+		if seen[e.ID] {
+			t.Errorf("event %d listed twice", e.ID)
+		}
+		seen[e.ID] = true
+		if !IsAudit(e.ID) {
+			t.Errorf("event %d is outside the audit range", e.ID)
+		}
+		if !types[e.Type] || e.Operation == "" || e.ObjectType == "" {
+			t.Errorf("event %d is incomplete: %+v", e.ID, e)
+		}
+	}
+	if e, ok := Audit(524); !ok || e.Type != AuditOther {
+		t.Errorf("unlisted audit event gave %+v, %v", e, ok)
+	}
+	if _, ok := Audit(256); ok {
+		t.Error("analytic event reported as audit")
+	}
+}
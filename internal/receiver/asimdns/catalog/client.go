@@ -0,0 +1,94 @@
+package catalog
+
+import (
+	"net/netip"
+	"strings"
+)
+
+// Fields of DNS Client events holding the resolver queried and the status
+var (
+	clientServers = []string{"DnsServerIpAddress", "ServerList", "Address"}
+	clientStatus  = []string{"QueryStatus", "Status", "ResponseStatus"}
+)
+
+// clientEvents are the Microsoft-Windows-DNS-Client events. Only the query
+// called and completed events describe an application's lookup; the others
+// trace the resolver's internal steps and are classified as Info.
+var clientEvents = []Event{
+	{ID: 1001, Name: "DNS_SERVER_CONFIGURED", Type: TypeInfo, SubType: "configuration", Result: ResultNA,
+		Dst: []string{"Address"}},
+	{ID: 1015, Name: "DNS_SERVER_LIST_CHANGED", Type: TypeInfo, SubType: "configuration", Result: ResultNA,
+		Dst: []string{"ServerList", "Address"}},
+	{ID: 1016, Name: "DNS_SERVER_REMOVED", Type: TypeInfo, SubType: "configuration", Result: ResultNA,
+		Dst: []string{"Address"}},
+	{ID: 1019, Name: "DOH_SERVER_CONFIGURED", Type: TypeInfo, SubType: "configuration", Result: ResultNA,
+		Dst: []string{"ServerAddress", "Address"}},
+	{ID: 3006, Name: "DNS_QUERY_CALLED", Type: TypeQuery, SubType: "request", Result: ResultNA,
+		Dst: clientServers},
+	{ID: 3008, Name: "DNS_QUERY_COMPLETED", Type: TypeQuery, SubType: "response", Result: ResultNA, Status: clientStatus,
+		Dst: clientServers},
+	{ID: 3009, Name: "NETWORK_QUERY_INITIATED", Type: TypeInfo, SubType: "network_query", Result: ResultNA,
+		Dst: []string{"DNSServerAddress", "DnsServerIpAddress"}},
+	{ID: 3010, Name: "DNS_QUERY_SENT_TO_SERVER", Type: TypeInfo, SubType: "server_request", Result: ResultNA,
+		Dst: clientServers},
+	{ID: 3011, Name: "DNS_RESPONSE_FROM_SERVER", Type: TypeInfo, SubType: "server_response", Result: ResultNA, Status: clientStatus,
+		Dst: clientServers},
+	{ID: 3016, Name: "CACHE_LOOKUP_CALLED", Type: TypeInfo, SubType: "cache_lookup", Result: ResultNA},
+	{ID: 3018, Name: "CACHE_LOOKUP_COMPLETED", Type: TypeInfo, SubType: "cache_lookup", Result: ResultNA, Status: clientStatus},
+	{ID: 3019, Name: "WIRE_QUERY_CALLED", Type: TypeInfo, SubType: "wire_request", Result: ResultNA},
+	{ID: 3020, Name: "WIRE_QUERY_COMPLETED", Type: TypeInfo, SubType: "wire_response", Result: ResultNA, Status: clientStatus},
+	// DNS over HTTPS requests to an encrypted resolver
+	{ID: 3030, Name: "DOH_QUERY_SENT", Type: TypeInfo, SubType: "doh_request", Result: ResultNA,
+		Dst: clientServers},
+	{ID: 3031, Name: "DOH_RESPONSE_RECEIVED", Type: TypeInfo, SubType: "doh_response", Result: ResultNA, Status: clientStatus,
+		Dst: clientServers},
+	// Fallbacks when unicast DNS cannot resolve a name
+	{ID: 3040, Name: "MDNS_QUERY_SENT", Type: TypeInfo, SubType: "multicast_request", Result: ResultNA,
+		Dst: []string{"Address"}},
+	{ID: 3041, Name: "MDNS_RESPONSE_RECEIVED", Type: TypeInfo, SubType: "multicast_response", Result: ResultNA, Status: clientStatus,
+		Dst: []string{"Address"}},
+	{ID: 3042, Name: "LLMNR_QUERY_SENT", Type: TypeInfo, SubType: "llmnr_request", Result: ResultNA,
+		Dst: []string{"Address"}},
+	{ID: 3043, Name: "LLMNR_RESPONSE_RECEIVED", Type: TypeInfo, SubType: "llmnr_response", Result: ResultNA, Status: clientStatus,
+		Dst: []string{"Address"}},
+	{ID: 3044, Name: "NETBIOS_QUERY_SENT", Type: TypeInfo, SubType: "netbios_request", Result: ResultNA,
+		Dst: []string{"Address"}},
+	{ID: 3045, Name: "NETBIOS_RESPONSE_RECEIVED", Type: TypeInfo, SubType: "netbios_response", Result: ResultNA, Status: clientStatus,
+		Dst: []string{"Address"}},
+}
+
+// Client returns the description of a DNS Client event
+func Client(id uint16) (Event, bool) {
+	return lookup(clientEvents, id)
+}
+
+// ClientEvents returns all DNS Client events
+func ClientEvents() []Event {
+	return append([]Event(nil), clientEvents...)
+}
+
+// ServerAddresses splits a DNS Client resolver list such as
+// "192.0.2.53;2001:db8::53;" into its addresses, skipping duplicates and
+// anything that is not an address. Ports are dropped.
+func ServerAddresses(list string) []netip.Addr {
+	var addrs []netip.Addr
+	seen := make(map[netip.Addr]bool)
+	for _, part := range strings.FieldsFunc(list, func(r rune) bool {
+		return r == ';' || r == ',' || r == ' '
+	}) {
+		addr, err := netip.ParseAddr(part)
+		if err != nil {
+			addrPort, err := netip.ParseAddrPort(part)
+			if err != nil {
+				continue
+			}
+			addr = addrPort.Addr()
+		}
+		addr = addr.Unmap()
+		if !seen[addr] {
+			seen[addr] = true
+			addrs = append(addrs, addr)
+		}
+	}
+	return addrs
+}
@@ -0,0 +1,81 @@
+package catalog
+
+// Address fields of DNS Server events. InterfaceIP is the server's own
+// address; Source and Destination are the remote party of the packet.
+var (
+	remoteSource      = []string{"Source"}
+	remoteDestination = []string{"Destination"}
+	remoteEither      = []string{"Destination", "Source"}
+	serverInterface   = []string{"InterfaceIP"}
+)
+
+// serverEvents are the Microsoft-Windows-DNSServer analytic channel events
+var serverEvents = []Event{
+	{ID: 256, Name: "QUERY_RECEIVED", Type: TypeQuery, SubType: "request", Result: ResultNA,
+		Src: remoteSource, Dst: serverInterface},
+	{ID: 257, Name: "RESPONSE_SUCCESS", Type: TypeQuery, SubType: "response", Result: ResultSuccess, Rcode: true,
+		Policy: true, Src: remoteDestination, Dst: serverInterface},
+	{ID: 258, Name: "RESPONSE_FAILURE", Type: TypeQuery, SubType: "response", Result: ResultFailure, Rcode: true,
+		Policy: true, Src: remoteDestination, Dst: serverInterface},
+	{ID: 259, Name: "IGNORED_QUERY", Type: TypeQuery, SubType: "request", Result: ResultFailure, ResultDetails: "Ignored",
+		Action: ActionDrop, Src: remoteSource, Dst: serverInterface},
+	// Recursion events are queries made by the server, so it is the client
+	{ID: 260, Name: "RECURSE_QUERY_OUT", Type: TypeQuery, SubType: "recursive_request", Result: ResultNA,
+		Src: serverInterface, Dst: remoteDestination},
+	{ID: 261, Name: "RECURSE_RESPONSE_IN", Type: TypeQuery, SubType: "recursive_response", Result: ResultNA, Rcode: true,
+		Src: serverInterface, Dst: remoteSource},
+	{ID: 262, Name: "RECURSE_QUERY_TIMEOUT", Type: TypeQuery, SubType: "recursive_response", Result: ResultFailure, ResultDetails: "Timeout",
+		Src: serverInterface, Dst: remoteDestination},
+	{ID: 263, Name: "DYN_UPDATE_RECV", Type: TypeInfo, SubType: "dynamic_update_request", Result: ResultNA,
+		Src: remoteSource, Dst: serverInterface},
+	{ID: 264, Name: "DYN_UPDATE_RESPONSE", Type: TypeInfo, SubType: "dynamic_update_response", Result: ResultNA, Rcode: true,
+		Policy: true, Src: remoteDestination, Dst: serverInterface},
+	{ID: 265, Name: "IXFR_REQ_OUT", Type: TypeInfo, SubType: "zone_transfer_request", Result: ResultNA,
+		Src: serverInterface, Dst: remoteEither},
+	{ID: 266, Name: "IXFR_REQ_RECV", Type: TypeInfo, SubType: "zone_transfer_request", Result: ResultNA,
+		Src: remoteSource, Dst: serverInterface},
+	{ID: 267, Name: "IXFR_RESP_OUT", Type: TypeInfo, SubType: "zone_transfer_response", Result: ResultNA, Rcode: true,
+		Src: remoteDestination, Dst: serverInterface},
+	{ID: 268, Name: "IXFR_RESP_RECV", Type: TypeInfo, SubType: "zone_transfer_response", Result: ResultNA, Rcode: true,
+		Src: serverInterface, Dst: remoteEither},
+	{ID: 269, Name: "AXFR_REQ_OUT", Type: TypeInfo, SubType: "zone_transfer_request", Result: ResultNA,
+		Src: serverInterface, Dst: remoteEither},
+	{ID: 270, Name: "AXFR_REQ_RECV", Type: TypeInfo, SubType: "zone_transfer_request", Result: ResultNA,
+		Src: remoteSource, Dst: serverInterface},
+	{ID: 271, Name: "AXFR_RESP_OUT", Type: TypeInfo, SubType: "zone_transfer_response", Result: ResultNA, Rcode: true,
+		Src: remoteDestination, Dst: serverInterface},
+	{ID: 272, Name: "AXFR_RESP_RECV", Type: TypeInfo, SubType: "zone_transfer_response", Result: ResultNA, Rcode: true,
+		Src: serverInterface, Dst: remoteEither},
+	{ID: 273, Name: "XFR_NOTIFY_RECV", Type: TypeInfo, SubType: "notify_request", Result: ResultNA,
+		Src: remoteSource, Dst: serverInterface},
+	{ID: 274, Name: "XFR_NOTIFY_OUT", Type: TypeInfo, SubType: "notify_request", Result: ResultNA,
+		Src: serverInterface, Dst: remoteDestination},
+	{ID: 275, Name: "XFR_NOTIFY_ACK_IN", Type: TypeInfo, SubType: "notify_response", Result: ResultNA,
+		Src: serverInterface, Dst: remoteSource},
+	{ID: 276, Name: "DYN_UPDATE_FORWARD", Type: TypeInfo, SubType: "dynamic_update_request", Result: ResultNA,
+		Src: serverInterface, Dst: remoteDestination},
+	{ID: 277, Name: "DYN_UPDATE_RESPONSE_IN", Type: TypeInfo, SubType: "dynamic_update_response", Result: ResultNA, Rcode: true,
+		Src: serverInterface, Dst: remoteSource},
+	// Internal lookups are made by the server while answering a client query
+	{ID: 278, Name: "INTERNAL_LOOKUP_CNAME", Type: TypeInfo, SubType: "internal_lookup", Result: ResultNA,
+		Src: remoteSource, Dst: serverInterface},
+	{ID: 279, Name: "INTERNAL_LOOKUP_ADDITIONAL", Type: TypeInfo, SubType: "internal_lookup", Result: ResultNA,
+		Src: remoteSource, Dst: serverInterface},
+	// Response rate limiting decisions, logged for the response they affect
+	{ID: 280, Name: "RRL_TO_BE_DROPPED_RESPONSE", Type: TypeQuery, SubType: "response", Result: ResultFailure, ResultDetails: "RateLimitDropped",
+		Action: ActionDrop, Src: remoteEither, Dst: serverInterface},
+	{ID: 281, Name: "RRL_TO_BE_TRUNCATED_RESPONSE", Type: TypeQuery, SubType: "response", Result: ResultFailure, ResultDetails: "RateLimitTruncated",
+		Src: remoteEither, Dst: serverInterface},
+	{ID: 282, Name: "RRL_TO_BE_LEAKED_RESPONSE", Type: TypeQuery, SubType: "response", Result: ResultSuccess, ResultDetails: "RateLimitLeaked", Rcode: true,
+		Action: ActionAllow, Src: remoteEither, Dst: serverInterface},
+}
+
+// Server returns the description of a DNS Server analytic event
+func Server(id uint16) (Event, bool) {
+	return lookup(serverEvents, id)
+}
+
+// ServerEvents returns all DNS Server analytic events
+func ServerEvents() []Event {
+	return append([]Event(nil), serverEvents...)
+}
@@ -0,0 +1,62 @@
+package catalog
+
+import "strconv"
+
+// Status is a Win32 status code reported by the DNS Client
+type Status struct {
+	// Name is the symbolic name of the code, such as DNS_ERROR_RCODE_NAME_ERROR
+	Name string
+	// Rcode is the DNS response code the status stands for, if any
+	Rcode    uint16
+	HasRcode bool
+}
+
+// rcodeStatus describes a status that reports a DNS response code
+func rcodeStatus(name string, rcode uint16) Status {
+	return Status{Name: name, Rcode: rcode, HasRcode: true}
+}
+
+// clientStatuses are the Win32 and DNS status codes seen in DNS Client
+// events. The DNS_ERROR_RCODE_* codes are 9000 plus the response code.
+var clientStatuses = map[int]Status{
+	0:     rcodeStatus("ERROR_SUCCESS", 0),
+	87:    {Name: "ERROR_INVALID_PARAMETER"},
+	123:   {Name: "ERROR_INVALID_NAME"},
+	1168:  {Name: "ERROR_NOT_FOUND"},
+	1214:  {Name: "ERROR_INVALID_NETNAME"},
+	1223:  {Name: "ERROR_CANCELLED"},
+	1460:  {Name: "ERROR_TIMEOUT"},
+	9001:  rcodeStatus("DNS_ERROR_RCODE_FORMAT_ERROR", 1),
+	9002:  rcodeStatus("DNS_ERROR_RCODE_SERVER_FAILURE", 2),
+	9003:  rcodeStatus("DNS_ERROR_RCODE_NAME_ERROR", 3),
+	9004:  rcodeStatus("DNS_ERROR_RCODE_NOT_IMPLEMENTED", 4),
+	9005:  rcodeStatus("DNS_ERROR_RCODE_REFUSED", 5),
+	9006:  rcodeStatus("DNS_ERROR_RCODE_YXDOMAIN", 6),
+	9007:  rcodeStatus("DNS_ERROR_RCODE_YXRRSET", 7),
+	9008:  rcodeStatus("DNS_ERROR_RCODE_NXRRSET", 8),
+	9009:  rcodeStatus("DNS_ERROR_RCODE_NOTAUTH", 9),
+	9010:  rcodeStatus("DNS_ERROR_RCODE_NOTZONE", 10),
+	9016:  rcodeStatus("DNS_ERROR_RCODE_BADSIG", 16),
+	9017:  rcodeStatus("DNS_ERROR_RCODE_BADKEY", 17),
+	9018:  rcodeStatus("DNS_ERROR_RCODE_BADTIME", 18),
+	9501:  {Name: "DNS_INFO_NO_RECORDS"},
+	9502:  {Name: "DNS_ERROR_BAD_PACKET"},
+	9503:  {Name: "DNS_ERROR_NO_PACKET"},
+	9504:  {Name: "DNS_ERROR_RCODE"},
+	9505:  {Name: "DNS_ERROR_UNSECURE_PACKET"},
+	9560:  {Name: "DNS_ERROR_INVALID_NAME_CHAR"},
+	9701:  {Name: "DNS_ERROR_RECORD_DOES_NOT_EXIST"},
+	11001: {Name: "WSAHOST_NOT_FOUND"},
+	11002: {Name: "WSATRY_AGAIN"},
+	11003: {Name: "WSANO_RECOVERY"},
+	11004: {Name: "WSANO_DATA"},
+}
+
+// ClientStatus describes a DNS Client status code. Unknown codes are named by
+// their number.
+func ClientStatus(code int) Status {
+	if status, ok := clientStatuses[code]; ok {
+		return status
+	}
+	return Status{Name: strconv.Itoa(code)}
+}
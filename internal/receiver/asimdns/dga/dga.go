@@ -0,0 +1,231 @@
+// Package dga scores domain names for the likelihood that they were produced
+// by a domain generation algorithm, using offline character statistics of the
+// registered domain label.
+package dga
+
+import (
+	"bufio"
+	_ "embed"
+	"math"
+	"strings"
+)
+
+//go:embed popular.txt
+var popularList string
+
+// Verdicts
+const (
+	VerdictLikelyDGA  = "likely_dga"
+	VerdictSuspicious = "suspicious"
+	VerdictBenign     = "benign"
+	// VerdictSkipped is given to names that are not scored, such as popular
+	// domains, local names and labels too short to judge
+	VerdictSkipped = "skipped"
+)
+
+// DefaultThreshold is the score at or above which a name is likely generated
+// when no threshold is given
+const DefaultThreshold = 0.65
+
+// suspiciousMargin is how far below the threshold a score is still suspicious
+const suspiciousMargin = 0.15
+
+// Feature weights; they sum to one so the score is between 0 and 1
+const (
+	weightBigram    = 0.4
+	weightEntropy   = 0.2
+	weightConsonant = 0.15
+	weightDigits    = 0.15
+	weightLength    = 0.1
+)
+
+// skippedTLDs are suffixes of local and reverse lookup names
+var skippedTLDs = map[string]bool{
+	"arpa":        true,
+	"local":       true,
+	"localdomain": true,
+	"localhost":   true,
+	"internal":    true,
+	"lan":         true,
+	"home":        true,
+	"corp":        true,
+}
+
+// Options controls scoring
+type Options struct {
+	// Threshold is the score at or above which a name is likely generated;
+	// nil uses DefaultThreshold
+	Threshold *float64
+	// MinLength is the shortest label that is scored
+	MinLength int
+	// AllowDomains are registered domains excluded from scoring in addition
+	// to the embedded popular domains
+	AllowDomains []string
+	// RegisteredDomain returns the registered domain of a name; defaults to
+	// the last two labels
+	RegisteredDomain func(name string) string
+}
+
+// Features are the per-feature suspicions between 0 and 1
+type Features struct {
+	Bigram    float64 `json:"bigram"`
+	Entropy   float64 `json:"entropy"`
+	Consonant float64 `json:"consonant"`
+	Digits    float64 `json:"digits"`
+	Length    float64 `json:"length"`
+}
+
+// Result is the outcome of scoring a name
+type Result struct {
+	// Domain is the registered domain and Label the part of it that was scored
+	Domain   string
+	Label    string
+	Score    float64
+	Verdict  string
+	Features Features
+}
+
+// Scorer scores domain names
+type Scorer struct {
+	opts    Options
+	allowed map[string]bool
+}
+
+// NewScorer creates a scorer
+func NewScorer(opts Options) *Scorer {
+	if opts.Threshold == nil {
+		threshold := DefaultThreshold
+		opts.Threshold = &threshold
+	}
+	if opts.MinLength <= 0 {
+		opts.MinLength = 6
+	}
+	if opts.RegisteredDomain == nil {
+		opts.RegisteredDomain = lastTwoLabels
+	}
+
+	s := &Scorer{opts: opts, allowed: make(map[string]bool)}
+	scanner := bufio.NewScanner(strings.NewReader(popularList))
+	for scanner.Scan() {
+		if line := strings.TrimSpace(scanner.Text()); line != "" && !strings.HasPrefix(line, "#") {
+			s.allowed[line] = true
+		}
+	}
+	for _, domain := range opts.AllowDomains {
+		s.allowed[normalise(domain)] = true
+	}
+	return s
+}
+
+// Threshold returns the score at or above which a name is likely generated
+func (s *Scorer) Threshold() float64 {
+	return *s.opts.Threshold
+}
+
+// Score scores the registered domain label of a query name
+func (s *Scorer) Score(name string) Result {
+	name = normalise(name)
+	labels := strings.Split(name, ".")
+	if name == "" || len(labels) < 2 || skippedTLDs[labels[len(labels)-1]] {
+		return Result{Verdict: VerdictSkipped}
+	}
+
+	domain := s.opts.RegisteredDomain(name)
+	result := Result{Domain: domain, Verdict: VerdictSkipped}
+	if s.isAllowed(name) {
+		return result
+	}
+
+	result.Label = strings.SplitN(domain, ".", 2)[0]
+	if len(result.Label) < s.opts.MinLength || strings.HasPrefix(result.Label, "xn--") {
+		return result
+	}
+
+	result.Features = features(result.Label)
+	result.Score = weightBigram*result.Features.Bigram +
+		weightEntropy*result.Features.Entropy +
+		weightConsonant*result.Features.Consonant +
+		weightDigits*result.Features.Digits +
+		weightLength*result.Features.Length
+	result.Score = math.Round(result.Score*1000) / 1000
+
+	switch {
+	case result.Score >= *s.opts.Threshold:
+		result.Verdict = VerdictLikelyDGA
+	case result.Score >= *s.opts.Threshold-suspiciousMargin:
+		result.Verdict = VerdictSuspicious
+	default:
+		result.Verdict = VerdictBenign
+	}
+	return result
+}
+
+// isAllowed reports whether the name or one of its parent domains is allowed
+func (s *Scorer) isAllowed(name string) bool {
+	for {
+		if s.allowed[name] {
+			return true
+		}
+		i := strings.IndexByte(name, '.')
+		if i < 0 {
+			return false
+		}
+		name = name[i+1:]
+	}
+}
+
+// features computes the suspicion of each feature of a label
+func features(label string) Features {
+	var digits, run, longestRun int
+	freq := make(map[byte]int)
+	for i := 0; i < len(label); i++ {
+		c := label[i]
+		freq[c]++
+		switch {
+		case c >= '0' && c <= '9':
+			digits++
+			run = 0
+		case c >= 'a' && c <= 'z' && !strings.ContainsRune("aeiouy", rune(c)):
+			run++
+			if run > longestRun {
+				longestRun = run
+			}
+		default:
+			run = 0
+		}
+	}
+
+	var entropy float64
+	for _, n := range freq {
+		p := float64(n) / float64(len(label))
+		entropy -= p * math.Log2(p)
+	}
+
+	return Features{
+		// Readable labels average about -3.5 bits per transition, random ones -5.5
+		Bigram:    clamp((-model.meanLogProb(label) - 3.6) / 1.6),
+		Entropy:   clamp((entropy - 2.8) / 0.8),
+		Consonant: clamp(float64(longestRun-3) / 3),
+		Digits:    clamp(float64(digits) / float64(len(label)) / 0.5),
+		Length:    clamp(float64(len(label)-8) / 12),
+	}
+}
+
+// clamp limits a value to the range 0 to 1
+func clamp(v float64) float64 {
+	return math.Max(0, math.Min(1, v))
+}
+
+// normalise lowercases a name and removes the trailing dot
+func normalise(name string) string {
+	return strings.TrimSuffix(strings.ToLower(strings.TrimSpace(name)), ".")
+}
+
+// lastTwoLabels approximates the registered domain of a name
+func lastTwoLabels(name string) string {
+	labels := strings.Split(name, ".")
+	if len(labels) <= 2 {
+		return name
+	}
+	return strings.Join(labels[len(labels)-2:], ".")
+}
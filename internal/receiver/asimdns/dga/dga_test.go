@@ -0,0 +1,78 @@
+package dga
+
+import "testing"
+
+func TestScoreSeparatesGeneratedNames(t *testing.T) {
+	s := NewScorer(Options{})
+
+	benign := []string{
+		"stackoverflow.com", "weatherforecast.com", "mybankonline.com", "theguardian.com",
+		"kubernetes.io", "crowdstrike.com", "service-now.com", "bitbucket.org",
+	}
+	for _, name := range benign {
+		if r := s.Score(name); r.Verdict != VerdictBenign {
+			t.Errorf("Score(%q) = %.3f %s, want benign", name, r.Score, r.Verdict)
+		}
+	}
+
+	generated := []string{
+		"kqgbdyfynjwhlr.com", "nwvbgwyrmhpxa.org", "xjvqzpmw9k3.com",
+		"a8f3k2l9xq7b.info", "vrkjbtlszqmx.biz", "www.hdyrejlgwpxz.ru",
+	}
+	for _, name := range generated {
+		if r := s.Score(name); r.Verdict != VerdictLikelyDGA {
+			t.Errorf("Score(%q) = %.3f %s, want likely_dga", name, r.Score, r.Verdict)
+		}
+	}
+}
+
+func TestScoreUsesRegisteredDomainLabel(t *testing.T) {
+	s := NewScorer(Options{})
+
+	r := s.Score("kqgbdyfynjwhlr.example.com.")
+	if r.Domain != "example.com" || r.Label != "example" || r.Verdict != VerdictBenign {
+		t.Errorf("expected the registered domain label to be scored, got %+v", r)
+	}
+}
+
+func TestScoreSkipsPopularAndLocalNames(t *testing.T) {
+	s := NewScorer(Options{AllowDomains: []string{"Kqgbdyfynjwhlr.com"}})
+
+	for _, name := range []string{
+		"r3---sn-4g5e6nzz.googlevideo.com",
+		"x9f8k2qz.cloudfront.net",
+		"cdn.kqgbdyfynjwhlr.com",
+		"10.2.0.192.in-addr.arpa",
+		"xjvqzpmw9k3.corp",
+		"wpad",
+		"bbc.com",
+		"",
+	} {
+		if r := s.Score(name); r.Verdict != VerdictSkipped || r.Score != 0 {
+			t.Errorf("Score(%q) = %+v, want skipped", name, r)
+		}
+	}
+}
+
+func TestThreshold(t *testing.T) {
+	high := 0.95
+	s := NewScorer(Options{Threshold: &high})
+
+	if r := s.Score("kqgbdyfynjwhlr.com"); r.Verdict != VerdictSuspicious && r.Verdict != VerdictBenign {
+		t.Errorf("expected a higher threshold to lower the verdict, got %+v", r)
+	}
+
+	custom := NewScorer(Options{RegisteredDomain: func(string) string { return "kqgbdyfynjwhlr.co.uk" }})
+	if r := custom.Score("www.kqgbdyfynjwhlr.co.uk"); r.Label != "kqgbdyfynjwhlr" || r.Verdict != VerdictLikelyDGA {
+		t.Errorf("expected the registered domain function to be used, got %+v", r)
+	}
+
+	zero := 0.0
+	all := NewScorer(Options{Threshold: &zero})
+	if all.Threshold() != 0 {
+		t.Errorf("explicit threshold 0 was replaced by %v", all.Threshold())
+	}
+	if r := all.Score("wikipedia-example.org"); r.Verdict != VerdictLikelyDGA {
+		t.Errorf("expected every scored name to be likely_dga at threshold 0, got %+v", r)
+	}
+}
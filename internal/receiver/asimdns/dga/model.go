@@ -0,0 +1,90 @@
+package dga
+
+import (
+	"bufio"
+	_ "embed"
+	"math"
+	"strings"
+)
+
+//go:embed words.txt
+var corpus string
+
+// Symbols of the bigram model: letters, one class for all digits, one for
+// the hyphen and one for the start and end of a label
+const (
+	symDigit    = 26
+	symHyphen   = 27
+	symBoundary = 28
+	numSymbols  = 29
+)
+
+// bigramModel holds the log probability of each symbol following another
+type bigramModel [numSymbols][numSymbols]float64
+
+// model is trained once from the embedded corpus
+var model = trainModel(corpus)
+
+// symbol maps a label character to its model symbol
+func symbol(c byte) int {
+	switch {
+	case c >= 'a' && c <= 'z':
+		return int(c - 'a')
+	case c >= '0' && c <= '9':
+		return symDigit
+	default:
+		return symHyphen
+	}
+}
+
+// trainModel counts bigrams in the corpus words with add-one smoothing
+func trainModel(text string) *bigramModel {
+	var counts [numSymbols][numSymbols]float64
+	for i := range counts {
+		for j := range counts[i] {
+			counts[i][j] = 1
+		}
+	}
+
+	scanner := bufio.NewScanner(strings.NewReader(text))
+	for scanner.Scan() {
+		line := scanner.Text()
+		if strings.HasPrefix(line, "#") {
+			continue
+		}
+		for _, word := range strings.Fields(strings.ToLower(line)) {
+			prev := symBoundary
+			for i := 0; i < len(word); i++ {
+				cur := symbol(word[i])
+				counts[prev][cur]++
+				prev = cur
+			}
+			counts[prev][symBoundary]++
+		}
+	}
+
+	m := new(bigramModel)
+	for i := range counts {
+		var total float64
+		for _, n := range counts[i] {
+			total += n
+		}
+		for j, n := range counts[i] {
+			m[i][j] = math.Log2(n / total)
+		}
+	}
+	return m
+}
+
+// meanLogProb returns the average log probability of the transitions in a label
+func (m *bigramModel) meanLogProb(label string) float64 {
+	var sum float64
+	prev := symBoundary
+	for i := 0; i < len(label); i++ {
+		cur := symbol(label[i])
+		sum += m[prev][cur]
+		prev = cur
+	}
+	sum += m[prev][symBoundary]
+	return sum / float64(len(label)+1)
+}
@@ -8,55 +8,35 @@ import (
 	"fmt"
 	"github.com/0xrawsec/golang-etw/etw"
 	"go.opentelemetry.io/collector/pdata/plog"
+	"math"
+	"net"
+	"net/netip"
 	"strconv"
+	"strings"
+
+	"github.com/LaurieRhodes/asim-dns-collector/internal/receiver/asimdns/catalog"
+	"github.com/LaurieRhodes/asim-dns-collector/internal/receiver/asimdns/dnswire"
 )
 
-// setResponseFields sets fields specific to DNS response events
-func setResponseFields(event *etw.Event, logRecord plog.LogRecord) {
-	// Extract status code
-	if status, ok := getEventDataString(event, "Status"); ok {
-		if statusInt, err := strconv.Atoi(status); err == nil {
-			// Set response code
-			logRecord.Attributes().PutInt("DnsResponseCode", int64(statusInt))
-			
-			// Set response name
-			responseName := getDnsResponseName(statusInt)
-			logRecord.Attributes().PutStr("DnsResponseName", responseName)
-			
-			// Set event result based on status
-			if statusInt == 0 {
-				logRecord.Attributes().PutStr("EventResult", "Success")
-			} else {
-				logRecord.Attributes().PutStr("EventResult", "Failure")
-			}
-			
-			// Set result details to the response name
-			logRecord.Attributes().PutStr("EventResultDetails", responseName)
-		}
-	} else if status, ok := getEventDataString(event, "QueryStatus"); ok {
-		// Alternative field name for status
-		if statusInt, err := strconv.Atoi(status); err == nil {
-			// Set response code
-			logRecord.Attributes().PutInt("DnsResponseCode", int64(statusInt))
-			
-			// Set response name
-			responseName := getDnsResponseName(statusInt)
-			logRecord.Attributes().PutStr("DnsResponseName", responseName)
-			
-			// Set event result based on status
-			if statusInt == 0 {
-				logRecord.Attributes().PutStr("EventResult", "Success")
-			} else {
-				logRecord.Attributes().PutStr("EventResult", "Failure")
-			}
-			
-			// Set result details to the response name
-			logRecord.Attributes().PutStr("EventResultDetails", responseName)
-		}
-	} else {
-		// Default values if status is not available
-		logRecord.Attributes().PutStr("EventResult", "Unknown")
-		logRecord.Attributes().PutStr("EventResultDetails", "NoStatusCode")
+// setResponseFields sets the result of a DNS Client event from its catalogue fields
+func setResponseFields(event *etw.Event, logRecord plog.LogRecord, fields catalog.Fields) {
+	logRecord.Attributes().PutStr("EventResult", fields.EventResult)
+	logRecord.Attributes().PutStr("EventResultDetails", fields.EventResultDetails)
+	
+	// Keep the Win32 status the result was derived from
+	if fields.OriginalResultDetails != "" {
+		logRecord.Attributes().PutStr("EventOriginalResultDetails", fields.OriginalResultDetails)
+	}
+	
+	// Status codes that report a DNS response code are set as the response code
+	if fields.HasResponseCode {
+		logRecord.Attributes().PutInt("DnsResponseCode", int64(fields.ResponseCode))
+		logRecord.Attributes().PutStr("DnsResponseCodeName", getDnsResponseName(fields.ResponseCode))
+	}
+	
+	// The resolved records are the content of the response
+	if results, ok := getEventDataString(event, "QueryResults"); ok && results != "" {
+		logRecord.Attributes().PutStr("DnsResponseName", strings.TrimSuffix(results, ";"))
 	}
 	
 	// Add query duration if available
@@ -67,30 +47,87 @@ func setResponseFields(event *etw.Event, logRecord plog.LogRecord) {
 	}
 }
 
-// setDnsFlags adds DNS flags to the log record attributes
+// Windows DNS Client API query options (DNS_QUERY_* in windns.h)
+const (
+	dnsQueryNoRecursion            uint64 = 0x4
+	dnsQueryNoWireQuery            uint64 = 0x10
+	dnsQueryDnssecCheckingDisabled uint64 = 0x02000000
+)
+
+// dnsQueryOptions names each DNS_QUERY_* option bit of the QueryOptions field
+var dnsQueryOptions = []struct {
+	bit       uint64
+	name      string
+	attribute string
+}{
+	{0x1, "ACCEPT_TRUNCATED_RESPONSE", "DnsQueryOptionAcceptTruncatedResponse"},
+	{0x2, "USE_TCP_ONLY", "DnsQueryOptionUseTcpOnly"},
+	{dnsQueryNoRecursion, "NO_RECURSION", "DnsQueryOptionNoRecursion"},
+	{0x8, "BYPASS_CACHE", "DnsQueryOptionBypassCache"},
+	{dnsQueryNoWireQuery, "NO_WIRE_QUERY", "DnsQueryOptionNoWireQuery"},
+	{0x20, "NO_LOCAL_NAME", "DnsQueryOptionNoLocalName"},
+	{0x40, "NO_HOSTS_FILE", "DnsQueryOptionNoHostsFile"},
+	{0x80, "NO_NETBT", "DnsQueryOptionNoNetbt"},
+	{0x100, "WIRE_ONLY", "DnsQueryOptionWireOnly"},
+	{0x200, "RETURN_MESSAGE", "DnsQueryOptionReturnMessage"},
+	{0x400, "MULTICAST_ONLY", "DnsQueryOptionMulticastOnly"},
+	{0x800, "NO_MULTICAST", "DnsQueryOptionNoMulticast"},
+	{0x1000, "TREAT_AS_FQDN", "DnsQueryOptionTreatAsFqdn"},
+	{0x2000, "ADDRCONFIG", "DnsQueryOptionAddrConfig"},
+	{0x4000, "DUAL_ADDR", "DnsQueryOptionDualAddr"},
+	{0x20000, "MULTICAST_WAIT", "DnsQueryOptionMulticastWait"},
+	{0x40000, "MULTICAST_VERIFY", "DnsQueryOptionMulticastVerify"},
+	{0x100000, "DONT_RESET_TTL_VALUES", "DnsQueryOptionDontResetTtlValues"},
+	{0x200000, "DISABLE_IDN_ENCODING", "DnsQueryOptionDisableIdnEncoding"},
+	{0x800000, "APPEND_MULTILABEL", "DnsQueryOptionAppendMultilabel"},
+	{0x01000000, "DNSSEC_OK", "DnsQueryOptionDnssecOk"},
+	{dnsQueryDnssecCheckingDisabled, "DNSSEC_CHECKING_DISABLED", "DnsQueryOptionDnssecCheckingDisabled"},
+}
+
+// setDnsFlags decodes the DNS Client QueryOptions bitmask. Each option set is
+// added as a DnsQueryOption* attribute and listed in DnsQueryOptionNames;
+// unnamed bits are listed in hex. Only the options that control header bits
+// of the query sent are mapped to the ASIM DnsFlags* fields, and only when a
+// query is sent: a NO_WIRE_QUERY lookup is answered from the cache and hosts
+// file, so it has no header and leaves the DnsFlags* fields unset.
 func setDnsFlags(flags uint64, logRecord plog.LogRecord) {
-	// Extract individual flags based on DNS standard flags
-	recursionDesired := (flags & 0x100) != 0
-	checkingDisabled := (flags & 0x10) != 0
+	logRecord.Attributes().PutInt("DnsQueryOptions", int64(flags))
+	
+	names := make([]string, 0, 4)
+	remaining := flags
+	for _, option := range dnsQueryOptions {
+		if flags&option.bit != 0 {
+			names = append(names, option.name)
+			logRecord.Attributes().PutBool(option.attribute, true)
+			remaining &^= option.bit
+		}
+	}
+	if remaining != 0 {
+		names = append(names, fmt.Sprintf("0x%x", remaining))
+	}
+	if len(names) == 0 {
+		names = append(names, "STANDARD")
+	}
+	logRecord.Attributes().PutStr("DnsQueryOptionNames", strings.Join(names, " "))
+	
+	if flags&dnsQueryNoWireQuery != 0 {
+		return
+	}
 	
-	// Set individual flag fields
+	// The client sets RD unless recursion is disabled and CD on request
+	recursionDesired := flags&dnsQueryNoRecursion == 0
+	checkingDisabled := flags&dnsQueryDnssecCheckingDisabled != 0
 	logRecord.Attributes().PutBool("DnsFlagsRecursionDesired", recursionDesired)
 	logRecord.Attributes().PutBool("DnsFlagsCheckingDisabled", checkingDisabled)
 	
-	// Build flags string representation
-	var flagsStr string
-	if recursionDesired && checkingDisabled {
-		flagsStr = "RD CD"
-	} else if recursionDesired {
-		flagsStr = "RD"
-	} else if checkingDisabled {
-		flagsStr = "CD"
-	} else {
-		flagsStr = ""
+	var headerFlags []string
+	if recursionDesired {
+		headerFlags = append(headerFlags, "RD")
 	}
-	
-	// Set the combined flags string
-	logRecord.Attributes().PutStr("DnsFlags", flagsStr)
+	if checkingDisabled {
+		headerFlags = append(headerFlags, "CD")
+	}
+	setHeaderFlags(logRecord, headerFlags)
 }
 
 // setAdditionalFields adds any remaining ETW fields as a JSON object in AdditionalFields
@@ -107,76 +144,70 @@ func setAdditionalFields(event *etw.Event, logRecord plog.LogRecord) {
 
 // getAsimEventType determines ASIM event type and subtype based on ETW event ID
 func getAsimEventType(eventID uint16) (string, string) {
-	switch eventID {
-	case 3006:
-		return "Query", "request"
-	case 3008:
-		return "Query", "response"
-	case 3020:
-		return "DnsCache", "add"
-	case 3019:
-		return "DnsCache", "remove"
-	default:
-		return "Info", "status"
+	if e, ok := catalog.Client(eventID); ok {
+		return e.Type, e.SubType
 	}
+	return "Info", "status"
 }
 
-// getDnsQueryTypeName maps DNS query type number to name
+// setClientAddressFields sets the resolvers and network interface of a DNS
+// Client event. DstIpAddr is the first resolver; all of them are listed in
+// DnsServerAddresses.
+func setClientAddressFields(logRecord plog.LogRecord, fields catalog.Fields) {
+	if fields.DstIpAddr != "" {
+		logRecord.Attributes().PutStr("DstIpAddr", fields.DstIpAddr)
+	}
+	if servers := catalog.ServerAddresses(fields.ServerList); len(servers) > 0 {
+		list := logRecord.Attributes().PutEmptySlice("DnsServerAddresses")
+		for _, server := range servers {
+			list.AppendEmpty().SetStr(server.String())
+		}
+	}
+	
+	name := fields.Interface
+	if name == "" && fields.InterfaceIndex > 0 {
+		if iface, err := net.InterfaceByIndex(fields.InterfaceIndex); err == nil {
+			name = iface.Name
+		}
+	}
+	if name != "" {
+		logRecord.Attributes().PutStr("DvcInterface", name)
+	}
+}
+
+// getDnsQueryTypeName maps DNS query type number to its IANA mnemonic,
+// or the RFC 3597 TYPEnn form for unassigned types
 func getDnsQueryTypeName(queryType int) string {
-	switch queryType {
-	case 1:
-		return "A"
-	case 2:
-		return "NS"
-	case 5:
-		return "CNAME"
-	case 6:
-		return "SOA"
-	case 12:
-		return "PTR"
-	case 15:
-		return "MX"
-	case 16:
-		return "TXT"
-	case 28:
-		return "AAAA"
-	case 33:
-		return "SRV"
-	case 65:
-		return "HTTPS"
-	default:
+	if queryType < 0 || queryType > math.MaxUint16 {
 		return fmt.Sprintf("TYPE%d", queryType)
 	}
+	return dnswire.TypeName(uint16(queryType))
 }
 
-// getDnsResponseName maps DNS response code to name
+// getDnsResponseName maps DNS response code, including extended codes, to name
 func getDnsResponseName(responseCode int) string {
-	switch responseCode {
-	case 0:
-		return "NOERROR"
-	case 1:
-		return "FORMERR"
-	case 2:
-		return "SERVFAIL"
-	case 3:
-		return "NXDOMAIN"
-	case 4:
-		return "NOTIMP"
-	case 5:
-		return "REFUSED"
-	case 6:
-		return "YXDOMAIN"
-	case 7:
-		return "YXRRSET"
-	case 8:
-		return "NXRRSET"
-	case 9:
-		return "NOTAUTH"
-	case 10:
-		return "NOTZONE"
-	default:
+	if responseCode < 0 || responseCode > math.MaxUint16 {
 		return fmt.Sprintf("RCODE%d", responseCode)
 	}
+	return dnswire.RcodeName(uint16(responseCode))
+}
+
+// setQueryClassFields sets the query class and its mnemonic
+func setQueryClassFields(logRecord plog.LogRecord, class uint16) {
+	logRecord.Attributes().PutInt("DnsQueryClass", int64(class))
+	logRecord.Attributes().PutStr("DnsQueryClassName", dnswire.ClassName(class))
+}
+
+// answerAddrs returns the addresses answered in an event, from the DNS Client
+// query results or the DNS message logged by the DNS Server
+func answerAddrs(event *etw.Event, packet eventPacket) []netip.Addr {
+	if results, ok := getEventDataString(event, "QueryResults"); ok {
+		return parseQueryResultAddrs(results)
+	}
+	if packet.message != nil {
+		return packet.message.AnswerAddrs()
+	}
+	return nil
 }
 
 // getEventDataString safely extracts a string value from event data
@@ -203,6 +234,7 @@ func extractAdditionalFields(event *etw.Event) map[string]interface{} {
 		"SourcePort":    true,
 		"QueryOptions":  true,
 		"QueryDuration": true,
+		"QueryResults":  true,
 		// DNS Server specific fields
 		"QNAME":         true,
 		"QTYPE":         true,
@@ -215,6 +247,16 @@ func extractAdditionalFields(event *etw.Event) map[string]interface{} {
 		"RD":            true,
 		"AA":            true,
 		"AD":            true,
+		"Interface":     true,
+		"AdapterName":   true,
+		"InterfaceIP":   true,
+		"PolicyName":    true,
+		"Scope":         true,
+		"ZoneScope":     true,
+		"ServerScope":   true,
+		"CacheScope":    true,
+		"PacketData":    true,
+		"BufferSize":    true,
 	}
 	
 	// Add any fields not already mapped to standard ASIM fields
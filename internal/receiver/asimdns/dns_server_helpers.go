@@ -4,34 +4,30 @@
 package asimdns
 
 import (
+	"encoding/hex"
 	"fmt"
 	"github.com/0xrawsec/golang-etw/etw"
 	"go.opentelemetry.io/collector/pdata/pcommon"
 	"go.opentelemetry.io/collector/pdata/plog"
 	"strconv"
+	"strings"
 	"time"
+
+	"github.com/LaurieRhodes/asim-dns-collector/internal/receiver/asimdns/catalog"
+	"github.com/LaurieRhodes/asim-dns-collector/internal/receiver/asimdns/dnswire"
 )
 
 // getAsimDnsServerEventType determines ASIM event type and subtype based on DNS Server ETW event ID
 func getAsimDnsServerEventType(eventID uint16) (string, string) {
-	// DNS Server event IDs have different semantics than DNS Client
-	// Map to ASIM schema types
-	switch eventID {
-	// These are the main event IDs from the DNS Server provider
-	case 256, 257: // Query received events
-		return "Query", "request"
-	case 258, 259: // Response events
-		return "Query", "response"
-	case 260, 261: // Recursion events
-		return "Query", "recursive"
-	default:
-		return "Info", "status"
+	if e, ok := catalog.Server(eventID); ok {
+		return e.Type, e.SubType
 	}
+	return "Info", "status"
 }
 
 // handleDnsServerEvent processes events from the DNS Server provider
 // and ensures they are correctly mapped to ASIM schema
-func handleDnsServerEvent(event *etw.Event, logRecord plog.LogRecord) {
+func handleDnsServerEvent(event *etw.Event, packet eventPacket, logRecord plog.LogRecord) {
 	// Set proper timestamps using the Unix nano format expected by ADX
 	eventTime := event.System.TimeCreated.SystemTime
 	logRecord.SetTimestamp(pcommon.NewTimestampFromTime(eventTime))
@@ -53,15 +49,25 @@ func handleDnsServerEvent(event *etw.Event, logRecord plog.LogRecord) {
 	logRecord.Attributes().PutStr("DnsSessionId", sessionID)
 	
 	// Set process information
-	logRecord.Attributes().PutStr("SrcProcessId", strconv.Itoa(int(event.System.Execution.ProcessID)))
+	logRecord.Attributes().PutInt("SrcProcessId", int64(event.System.Execution.ProcessID))
 	
 	// Set device information fields
 	setDeviceFields(logRecord)
 	
-	// Determine event type and subtype based on DNS Server event ID
-	eventType, eventSubType := getAsimDnsServerEventType(event.System.EventID)
-	logRecord.Attributes().PutStr("EventType", eventType)
-	logRecord.Attributes().PutStr("EventSubType", eventSubType)
+	// Classify the event from the analytic event catalogue
+	serverEvent, known := catalog.Server(event.System.EventID)
+	if !known {
+		serverEvent = catalog.Event{Type: "Info", SubType: "status", Result: catalog.ResultNA,
+			Src: []string{"Source"}, Dst: []string{"InterfaceIP", "Destination"}}
+	}
+	fields := serverEvent.Map(func(key string) (string, bool) {
+		return getEventDataString(event, key)
+	})
+	logRecord.Attributes().PutStr("EventType", fields.EventType)
+	logRecord.Attributes().PutStr("EventSubType", fields.EventSubType)
+	if known {
+		logRecord.Attributes().PutStr("EventOriginalSubType", serverEvent.Name)
+	}
 	
 	// Set standard query information if available
 	if queryName, ok := getEventDataString(event, "QNAME"); ok {
@@ -76,40 +82,32 @@ func handleDnsServerEvent(event *etw.Event, logRecord plog.LogRecord) {
 		}
 	}
 	
-	// Extract client IP - try multiple field names that may contain source IP
-	srcIP := ""
-	for _, field := range []string{"CLIENT_IP", "Source", "InterfaceIP"} {
-		if value, ok := getEventDataString(event, field); ok && value != "" {
-			srcIP = value
-			break
-		}
+	// Client and server addresses depend on the direction of the event
+	if fields.SrcIpAddr != "" {
+		logRecord.Attributes().PutStr("SrcIpAddr", fields.SrcIpAddr)
 	}
-	if srcIP != "" {
-		logRecord.Attributes().PutStr("SrcIpAddr", srcIP)
+	if fields.DstIpAddr != "" {
+		logRecord.Attributes().PutStr("DstIpAddr", fields.DstIpAddr)
 	}
 	
-	// Extract server IP - try multiple field names that may contain destination IP
-	dstIP := ""
-	for _, field := range []string{"SERVER_IP", "Destination"} {
-		if value, ok := getEventDataString(event, field); ok && value != "" {
-			dstIP = value
-			break
+	// Port is the port of the remote party
+	port, hasPort := getEventDataString(event, "Port")
+	portInt, err := strconv.Atoi(port)
+	hasPort = hasPort && err == nil
+	if serverEvent.ServerIsClient() {
+		if hasPort {
+			logRecord.Attributes().PutInt("DstPortNumber", int64(portInt))
+		} else {
+			logRecord.Attributes().PutInt("DstPortNumber", 53)
 		}
-	}
-	if dstIP != "" {
-		logRecord.Attributes().PutStr("DstIpAddr", dstIP)
-	}
-	
-	// Extract port information if available
-	if port, ok := getEventDataString(event, "Port"); ok {
-		if portInt, err := strconv.Atoi(port); err == nil {
+	} else {
+		if hasPort {
 			logRecord.Attributes().PutInt("SrcPortNumber", int64(portInt))
 		}
+		// Set destination port - always 53 for DNS
+		logRecord.Attributes().PutInt("DstPortNumber", 53)
 	}
 	
-	// Set destination port - always 53 for DNS
-	logRecord.Attributes().PutInt("DstPortNumber", 53)
-	
 	// Set network protocol (UDP/TCP)
 	if tcp, ok := getEventDataString(event, "TCP"); ok {
 		protocol := "UDP"
@@ -151,47 +149,188 @@ func handleDnsServerEvent(event *etw.Event, logRecord plog.LogRecord) {
 		dnsFlags = append(dnsFlags, "AD")
 	}
 	
-	// Set combined flags string
-	if len(dnsFlags) > 0 {
-		logRecord.Attributes().PutStr("DnsFlags", fmt.Sprintf("%v", dnsFlags))
-	} else {
-		// Ensure the field exists even if empty
-		logRecord.Attributes().PutStr("DnsFlags", "")
-	}
-	
-	// Process response code for response events
-	if eventSubType == "response" {
-		if rcode, ok := getEventDataString(event, "RCODE"); ok {
-			if rcodeInt, err := strconv.Atoi(rcode); err == nil {
-				logRecord.Attributes().PutInt("DnsResponseCode", int64(rcodeInt))
-				responseName := getDnsResponseName(rcodeInt)
-				logRecord.Attributes().PutStr("DnsResponseName", responseName)
-				
-				// Set EventResult based on response code
-				if rcodeInt == 0 {
-					logRecord.Attributes().PutStr("EventResult", "Success")
-				} else {
-					logRecord.Attributes().PutStr("EventResult", "Failure")
-				}
-				logRecord.Attributes().PutStr("EventResultDetails", responseName)
-			}
+	setHeaderFlags(logRecord, dnsFlags)
+	
+	// Set the response code and result
+	if fields.HasResponseCode {
+		logRecord.Attributes().PutInt("DnsResponseCode", int64(fields.ResponseCode))
+		logRecord.Attributes().PutStr("DnsResponseCodeName", getDnsResponseName(fields.ResponseCode))
+	}
+	logRecord.Attributes().PutStr("EventResult", fields.EventResult)
+	logRecord.Attributes().PutStr("EventResultDetails", fields.EventResultDetails)
+	
+	// Policy decisions and rate limiting
+	if fields.DvcAction != "" {
+		logRecord.Attributes().PutStr("DvcAction", fields.DvcAction)
+	}
+	if fields.RuleName != "" {
+		logRecord.Attributes().PutStr("RuleName", fields.RuleName)
+	}
+	
+	// Zone and scope names
+	for attribute, value := range map[string]string{
+		"DnsZone":        fields.Zone,
+		"DnsZoneScope":   fields.ZoneScope,
+		"DnsServerScope": fields.ServerScope,
+		"DnsCacheScope":  fields.CacheScope,
+	} {
+		if value != "" {
+			logRecord.Attributes().PutStr(attribute, value)
 		}
-	} else {
-		// For non-response events
-		logRecord.Attributes().PutStr("EventResult", "NA")
-		logRecord.Attributes().PutStr("EventResultDetails", "NA")
 	}
-
-	// Additional DNS Server specific fields
-	if zone, ok := getEventDataString(event, "Zone"); ok {
-		logRecord.Attributes().PutStr("DnsZone", zone)
+	
+	// Add the DNS message logged with the event, if any
+	if packet.err != nil {
+		logRecord.Attributes().PutStr("DnsPacketError", packet.err.Error())
+		packetData, _ := getEventDataString(event, "PacketData")
+		logRecord.Attributes().PutStr("DnsPacketData", packetData)
+	} else if packet.message != nil {
+		setPacketFields(logRecord, packet.message)
 	}
 	
 	// Add all other fields as additional fields
 	setAdditionalFields(event, logRecord)
 }
 
+// eventPacket is the DNS message logged in the PacketData field of DNS
+// Server events. It is decoded once per event and shared by threat matching,
+// enrichment and the packet fields.
+type eventPacket struct {
+	message *dnswire.Message
+	err     error
+}
+
+// decodePacket decodes the PacketData field of an event. An event without
+// one has neither a message nor an error.
+func decodePacket(event *etw.Event) eventPacket {
+	packetData, ok := getEventDataString(event, "PacketData")
+	if !ok || packetData == "" || packetData == "0x" {
+		return eventPacket{}
+	}
+	message, err := dnswire.ParseHex(packetData)
+	return eventPacket{message: message, err: err}
+}
+
+// setPacketFields sets the header flags, question, answers and EDNS options
+// of a decoded DNS message. Header flags replace those reported in the event
+// data; the question only fills in what the event data lacks.
+func setPacketFields(logRecord plog.LogRecord, packet *dnswire.Message) {
+	attrs := logRecord.Attributes()
+	attrs.PutBool("DnsFlagsAuthoritative", packet.Authoritative)
+	attrs.PutBool("DnsFlagsTruncated", packet.Truncated)
+	attrs.PutBool("DnsFlagsRecursionDesired", packet.RecursionDesired)
+	attrs.PutBool("DnsFlagsRecursionAvailable", packet.RecursionAvailable)
+	attrs.PutBool("DnsFlagsZ", packet.Z)
+	attrs.PutBool("DnsFlagsAuthenticated", packet.AuthenticData)
+	attrs.PutBool("DnsFlagsCheckingDisabled", packet.CheckingDisabled)
+	setHeaderFlags(logRecord, packet.Flags())
+	
+	if len(packet.Questions) > 0 {
+		question := packet.Questions[0]
+		if _, ok := attrs.Get("DnsQuery"); !ok {
+			attrs.PutStr("DnsQuery", question.Name)
+		}
+		if _, ok := attrs.Get("DnsQueryType"); !ok {
+			attrs.PutInt("DnsQueryType", int64(question.Type))
+			attrs.PutStr("DnsQueryTypeName", dnswire.TypeName(question.Type))
+		}
+		setQueryClassFields(logRecord, question.Class)
+	}
+	
+	// DnsResponseName holds the answer data
+	if len(packet.Answers) > 0 {
+		answers := attrs.PutEmptySlice("DnsAnswers")
+		values := make([]string, 0, len(packet.Answers))
+		minTTL := packet.Answers[0].TTL
+		for _, rr := range packet.Answers {
+			answers.AppendEmpty().SetStr(rr.String())
+			values = append(values, rr.Text)
+			if rr.TTL < minTTL {
+				minTTL = rr.TTL
+			}
+		}
+		attrs.PutStr("DnsResponseName", strings.Join(values, ";"))
+		attrs.PutInt("DnsResponseTtl", int64(minTTL))
+		
+		if addrs := packet.AnswerAddrs(); len(addrs) > 0 {
+			ips := attrs.PutEmptySlice("DnsResponseIpAddresses")
+			for _, addr := range addrs {
+				ips.AppendEmpty().SetStr(addr.String())
+			}
+		}
+	}
+	attrs.PutInt("DnsAuthorityCount", int64(len(packet.Authorities)))
+	attrs.PutInt("DnsAdditionalCount", int64(len(packet.Additionals)))
+	
+	if edns := packet.EDNS; edns != nil {
+		attrs.PutInt("DnsEdnsUdpSize", int64(edns.UDPSize))
+		attrs.PutInt("DnsEdnsVersion", int64(edns.Version))
+		attrs.PutBool("DnsEdnsDnssecOk", edns.DNSSECOK)
+		if edns.ClientSubnet.IsValid() {
+			attrs.PutStr("DnsEdnsClientSubnet", edns.ClientSubnet.String())
+			attrs.PutInt("DnsEdnsClientSubnetScope", int64(edns.ClientSubnetScope))
+		}
+		if len(edns.ClientCookie) > 0 {
+			attrs.PutStr("DnsEdnsClientCookie", hex.EncodeToString(edns.ClientCookie))
+		}
+		if len(edns.ServerCookie) > 0 {
+			attrs.PutStr("DnsEdnsServerCookie", hex.EncodeToString(edns.ServerCookie))
+		}
+	}
+}
+
 // isDnsServerEvent checks if an event is from the DNS Server provider
 func isDnsServerEvent(event *etw.Event) bool {
 	return event.System.Provider.Guid == DNSServerProviderGUID
 }
+
+// isDnsServerAuditEvent checks if an event is from the DNS Server audit channel
+func isDnsServerAuditEvent(event *etw.Event) bool {
+	return isDnsServerEvent(event) && catalog.IsAudit(event.System.EventID)
+}
+
+// handleDnsServerAuditEvent maps a DNS Server audit event, such as a zone or
+// record change, to the ASIM Audit Event schema
+func handleDnsServerAuditEvent(event *etw.Event, logRecord plog.LogRecord) {
+	auditEvent, _ := catalog.Audit(event.System.EventID)
+	fields := auditEvent.Map(func(key string) (string, bool) {
+		return getEventDataString(event, key)
+	})
+	
+	attrs := logRecord.Attributes()
+	attrs.PutStr("EventSchema", "AuditEvent")
+	attrs.PutStr("EventSchemaVersion", "0.1")
+	attrs.PutStr("EventType", fields.EventType)
+	attrs.PutStr("EventResult", "Success")
+	attrs.PutInt("EventCount", 1)
+	attrs.PutStr("EventProduct", "DNS Server")
+	attrs.PutStr("EventVendor", "Microsoft")
+	attrs.PutStr("EventOriginalType", strconv.Itoa(int(event.System.EventID)))
+	attrs.PutStr("EventOriginalSubType", auditEvent.Name)
+	
+	attrs.PutStr("Operation", fields.Operation)
+	attrs.PutStr("Object", fields.Object)
+	attrs.PutStr("ObjectType", fields.ObjectType)
+	for attribute, value := range map[string]string{
+		"OldValue":      fields.OldValue,
+		"NewValue":      fields.NewValue,
+		"DnsZone":       fields.Zone,
+		"DnsZoneScope":  fields.ZoneScope,
+		"DnsRecordType": fields.RecordType,
+		"SrcIpAddr":     fields.SrcIpAddr,
+		"ActorUsername": fields.ActorUsername,
+	} {
+		if value != "" {
+			attrs.PutStr(attribute, value)
+		}
+	}
+	
+	// The ETW consumer does not expose the security identifier of the caller,
+	// so the actor is only known when the event data names it
+	if process := event.System.Execution.ProcessID; process != 0 {
+		attrs.PutInt("ActingProcessId", int64(process))
+	}
+	
+	setDeviceFields(logRecord)
+	setAdditionalFields(event, logRecord)
+}
@@ -0,0 +1,235 @@
+// Package dnsname normalises DNS query names: lower case, no trailing dots
+// or stray NUL characters, internationalised names in both their ASCII
+// (punycode) and Unicode forms, and label syntax checks including labels
+// that mix scripts.
+package dnsname
+
+import (
+	"errors"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"golang.org/x/net/idna"
+)
+
+// Reasons a name fails validation
+const (
+	InvalidEmptyLabel  = "empty_label"
+	InvalidLabelLength = "label_too_long"
+	InvalidNameLength  = "name_too_long"
+	InvalidCharacter   = "invalid_character"
+	InvalidHyphen      = "hyphen_position"
+	InvalidPunycode    = "invalid_punycode"
+)
+
+// errNotCanonical marks an A-label that does not round-trip
+var errNotCanonical = errors.New("A-label is not in canonical form")
+
+// Length limits of RFC 1035 for names in presentation form
+const (
+	maxLabelLength = 63
+	maxNameLength  = 253
+)
+
+// profile maps Unicode names for lookup but, unlike idna.Lookup, accepts the
+// underscores used by SRV and other service names
+var profile = idna.New(idna.MapForLookup(), idna.StrictDomainName(false), idna.Transitional(false))
+
+// allowedScriptSets are the script combinations of the "highly restrictive"
+// level of Unicode Technical Standard #39. Labels using scripts outside any
+// one of them are mixed-script.
+var allowedScriptSets = []map[string]bool{
+	{"Latin": true, "Han": true, "Hiragana": true, "Katakana": true},
+	{"Latin": true, "Han": true, "Bopomofo": true},
+	{"Latin": true, "Han": true, "Hangul": true},
+}
+
+// Name is a normalised query name
+type Name struct {
+	// ASCII is the lower-case punycode form without trailing dots
+	ASCII string
+	// Unicode is the display form, with punycode labels decoded
+	Unicode string
+	// Invalid is the first syntax problem found, or empty for a valid name
+	Invalid string
+	// MixedScript is set when a label mixes scripts, as in homograph attacks
+	MixedScript bool
+}
+
+// Valid reports whether the name passed the syntax checks
+func (n Name) Valid() bool {
+	return n.Invalid == ""
+}
+
+// IDN reports whether the name has internationalised labels
+func (n Name) IDN() bool {
+	return n.Unicode != n.ASCII
+}
+
+// clean removes NUL characters, surrounding space and trailing dots
+func clean(name string) string {
+	if strings.IndexByte(name, 0) >= 0 {
+		name = strings.ReplaceAll(name, "\x00", "")
+	}
+	return strings.TrimRight(strings.TrimSpace(name), ".")
+}
+
+// isASCII reports whether a string has only ASCII characters
+func isASCII(s string) bool {
+	for i := 0; i < len(s); i++ {
+		if s[i] >= utf8.RuneSelf {
+			return false
+		}
+	}
+	return true
+}
+
+// ToASCII returns the normalised ASCII form of a name without validating it.
+// It is the key used wherever names are compared.
+func ToASCII(name string) string {
+	name = clean(name)
+	if isASCII(name) {
+		return strings.ToLower(name)
+	}
+	if ascii, err := profile.ToASCII(name); err == nil {
+		return ascii
+	}
+	return strings.ToLower(name)
+}
+
+// Normalize returns the ASCII and Unicode forms of a name and the result of
+// the syntax checks
+func Normalize(raw string) Name {
+	cleaned := clean(raw)
+	var n Name
+	if isASCII(cleaned) {
+		n.ASCII = strings.ToLower(cleaned)
+	} else if ascii, err := profile.ToASCII(cleaned); err == nil {
+		n.ASCII = ascii
+	} else {
+		n.ASCII = strings.ToLower(cleaned)
+		n.Invalid = InvalidCharacter
+	}
+	if n.ASCII == "" {
+		return n
+	}
+
+	if n.Invalid == "" && len(n.ASCII) > maxNameLength {
+		n.Invalid = InvalidNameLength
+	}
+
+	labels := strings.Split(n.ASCII, ".")
+	unicodeLabels := make([]string, len(labels))
+	for i, label := range labels {
+		unicodeLabels[i] = label
+		if n.Invalid == "" {
+			n.Invalid = checkLabel(label)
+		}
+		if !strings.HasPrefix(label, "xn--") {
+			continue
+		}
+		// Genuine A-labels decode to valid non-ASCII labels that encode back
+		// to the same form
+		decoded, err := idna.Punycode.ToUnicode(label)
+		if err == nil && !isASCII(decoded) {
+			var encoded string
+			if encoded, err = profile.ToASCII(decoded); err == nil && encoded != label {
+				err = errNotCanonical
+			}
+		}
+		if err != nil || isASCII(decoded) {
+			if n.Invalid == "" {
+				n.Invalid = InvalidPunycode
+			}
+			continue
+		}
+		unicodeLabels[i] = decoded
+		if mixedScript(decoded) {
+			n.MixedScript = true
+		}
+	}
+	n.Unicode = strings.Join(unicodeLabels, ".")
+	return n
+}
+
+// checkLabel validates an ASCII label. Underscores are accepted anywhere for
+// service names such as _ldap._tcp.
+func checkLabel(label string) string {
+	switch {
+	case label == "":
+		return InvalidEmptyLabel
+	case len(label) > maxLabelLength:
+		return InvalidLabelLength
+	case label[0] == '-' || label[len(label)-1] == '-':
+		return InvalidHyphen
+	}
+	for i := 0; i < len(label); i++ {
+		c := label[i]
+		if !(c >= 'a' && c <= 'z' || c >= '0' && c <= '9' || c == '-' || c == '_') {
+			return InvalidCharacter
+		}
+	}
+	return ""
+}
+
+// mixedScript reports whether a label uses letters from scripts that do not
+// belong together. Digits, hyphens and combining marks belong to every script.
+func mixedScript(label string) bool {
+	scripts := make(map[string]bool)
+	for _, r := range label {
+		if script := scriptOf(r); script != "" {
+			scripts[script] = true
+		}
+	}
+	if len(scripts) < 2 {
+		return false
+	}
+	for _, allowed := range allowedScriptSets {
+		subset := true
+		for script := range scripts {
+			if !allowed[script] {
+				subset = false
+				break
+			}
+		}
+		if subset {
+			return false
+		}
+	}
+	return true
+}
+
+// scriptOf returns the Unicode script of a rune, or empty for characters
+// shared between scripts
+func scriptOf(r rune) string {
+	if r < utf8.RuneSelf {
+		if r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' {
+			return "Latin"
+		}
+		return ""
+	}
+	for name, table := range unicode.Scripts {
+		if name == "Common" || name == "Inherited" {
+			continue
+		}
+		if unicode.Is(table, r) {
+			return name
+		}
+	}
+	return ""
+}
+
+// PatternToASCII converts the literal labels of a wildcard pattern such as
+// "*.bücher.de" to their normalised ASCII form
+func PatternToASCII(pattern string) string {
+	labels := strings.Split(clean(pattern), ".")
+	for i, label := range labels {
+		if !strings.Contains(label, "*") {
+			labels[i] = ToASCII(label)
+		} else {
+			labels[i] = strings.ToLower(label)
+		}
+	}
+	return strings.Join(labels, ".")
+}
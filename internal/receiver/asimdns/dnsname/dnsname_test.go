@@ -0,0 +1,141 @@
+package dnsname
+
+import (
+	"net/netip"
+	"strings"
+	"testing"
+)
+
+func TestNormalize(t *testing.T) {
+	tests := []struct {
+		raw     string
+		ascii   string
+		unicode string
+		invalid string
+		mixed   bool
+	}{
+		{raw: "WWW.Example.COM.", ascii: "www.example.com", unicode: "www.example.com"},
+		{raw: "example.com\x00", ascii: "example.com", unicode: "example.com"},
+		{raw: "example.com..", ascii: "example.com", unicode: "example.com"},
+		{raw: "_ldap._tcp.dc._msdcs.Contoso.local", ascii: "_ldap._tcp.dc._msdcs.contoso.local", unicode: "_ldap._tcp.dc._msdcs.contoso.local"},
+		{raw: "www.Bücher.de", ascii: "www.xn--bcher-kva.de", unicode: "www.bücher.de"},
+		{raw: "xn--bcher-kva.de.", ascii: "xn--bcher-kva.de", unicode: "bücher.de"},
+		{raw: "東京.jp", ascii: "xn--1lqs71d.jp", unicode: "東京.jp"},
+		// Cyrillic "а" in an otherwise Latin label
+		{raw: "xn--pple-43d.com", ascii: "xn--pple-43d.com", unicode: "аpple.com", mixed: true},
+		// Japanese mixes Han and Kana by design
+		{raw: "ひらがな漢字カタカナ.jp", ascii: "xn--v8j0cwa6gzha3lrd7410cymwb.jp", unicode: "ひらがな漢字カタカナ.jp"},
+		{raw: "a..example.com", ascii: "a..example.com", unicode: "a..example.com", invalid: InvalidEmptyLabel},
+		{raw: "-bad.example.com", ascii: "-bad.example.com", unicode: "-bad.example.com", invalid: InvalidHyphen},
+		{raw: "bad!.example.com", ascii: "bad!.example.com", unicode: "bad!.example.com", invalid: InvalidCharacter},
+		{raw: strings.Repeat("a", 64) + ".com", ascii: strings.Repeat("a", 64) + ".com", unicode: strings.Repeat("a", 64) + ".com", invalid: InvalidLabelLength},
+		{raw: "xn--zz-.com", ascii: "xn--zz-.com", unicode: "xn--zz-.com", invalid: InvalidHyphen},
+		{raw: "xn--a.com", ascii: "xn--a.com", unicode: "xn--a.com", invalid: InvalidPunycode},
+		{raw: ".", ascii: "", unicode: ""},
+	}
+	for _, tt := range tests {
+		n := Normalize(tt.raw)
+		if n.ASCII != tt.ascii || n.Unicode != tt.unicode || n.Invalid != tt.invalid || n.MixedScript != tt.mixed {
+			t.Errorf("Normalize(%q) = %+v, want ascii=%q unicode=%q invalid=%q mixed=%v",
+				tt.raw, n, tt.ascii, tt.unicode, tt.invalid, tt.mixed)
+		}
+		if tt.invalid == "" && !n.Valid() {
+			t.Errorf("Normalize(%q) is not valid", tt.raw)
+		}
+	}
+
+	long := strings.Repeat(strings.Repeat("a", 60)+".", 5) + "com"
+	if n := Normalize(long); n.Invalid != InvalidNameLength {
+		t.Errorf("Normalize(%d characters) invalid = %q, want %q", len(long), n.Invalid, InvalidNameLength)
+	}
+}
+
+func TestToASCIIMatchesNormalize(t *testing.T) {
+	for _, raw := range []string{"WWW.Example.COM.", "www.Bücher.de", "example.com\x00", "ÉCOLE.fr"} {
+		if got, want := ToASCII(raw), Normalize(raw).ASCII; got != want {
+			t.Errorf("ToASCII(%q) = %q, Normalize = %q", raw, got, want)
+		}
+	}
+}
+
+func TestPatternToASCII(t *testing.T) {
+	tests := map[string]string{
+		"*.Bücher.de":      "*.xn--bcher-kva.de",
+		"WPAD.*":           "wpad.*",
+		"*.microsoft.com.": "*.microsoft.com",
+		"_ldap._tcp.dc.*":  "_ldap._tcp.dc.*",
+	}
+	for pattern, want := range tests {
+		if got := PatternToASCII(pattern); got != want {
+			t.Errorf("PatternToASCII(%q) = %q, want %q", pattern, got, want)
+		}
+	}
+}
+
+func TestParseReverse(t *testing.T) {
+	tests := []struct {
+		name    string
+		prefix  string
+		invalid string
+	}{
+		{name: "7.113.0.203.in-addr.arpa", prefix: "203.0.113.7/32"},
+		{name: "7.113.0.203.IN-ADDR.ARPA.", prefix: "203.0.113.7/32"},
+		{name: "113.0.203.in-addr.arpa", prefix: "203.0.113.0/24"},
+		{name: "in-addr.arpa", prefix: ""},
+		{name: "b.a.9.8.7.6.5.0.4.0.0.0.3.0.0.0.2.0.0.0.1.0.0.0.0.0.0.0.1.2.3.4.ip6.arpa", prefix: "4321:0:1:2:3:4:567:89ab/128"},
+		{name: "8.b.d.0.1.0.0.2.ip6.arpa", prefix: "2001:db8::/32"},
+		{name: "300.113.0.203.in-addr.arpa", invalid: InvalidReverseOctet},
+		{name: "07.113.0.203.in-addr.arpa", invalid: InvalidReverseOctet},
+		{name: "0/25.2.0.192.in-addr.arpa", invalid: InvalidReverseOctet},
+		{name: "1.7.113.0.203.in-addr.arpa", invalid: InvalidReverseLength},
+		{name: "ab.8.b.d.0.1.0.0.2.ip6.arpa", invalid: InvalidReverseNibble},
+	}
+	for _, tt := range tests {
+		rev, ok := ParseReverse(tt.name)
+		if !ok {
+			t.Errorf("ParseReverse(%q) is not a reverse name", tt.name)
+			continue
+		}
+		prefix := ""
+		if rev.Prefix.IsValid() {
+			prefix = rev.Prefix.String()
+		}
+		if prefix != tt.prefix || rev.Invalid != tt.invalid {
+			t.Errorf("ParseReverse(%q) = %q %q, want %q %q", tt.name, prefix, rev.Invalid, tt.prefix, tt.invalid)
+		}
+	}
+
+	if _, ok := ParseReverse("arpa.example.com"); ok {
+		t.Error("ordinary name decoded as a reverse name")
+	}
+	if addr, ok := (Reverse{Prefix: netip.MustParsePrefix("203.0.113.0/24")}).Addr(); ok {
+		t.Errorf("partial name has address %s", addr)
+	}
+}
+
+func TestReverseWithin(t *testing.T) {
+	networks, err := ParseNetworks([]string{"10.0.0.0/8", "192.168.1.5", "2001:db8::/32"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := map[string]bool{
+		"4.3.2.10.in-addr.arpa":            true,
+		"2.10.in-addr.arpa":                true,
+		"10.in-addr.arpa":                  true,
+		"in-addr.arpa":                     false,
+		"5.1.168.192.in-addr.arpa":         true,
+		"1.168.192.in-addr.arpa":           false,
+		"1.0.0.0.8.b.d.0.1.0.0.2.ip6.arpa": true,
+		"7.113.0.203.in-addr.arpa":         false,
+	}
+	for name, want := range tests {
+		rev, _ := ParseReverse(name)
+		if got := rev.Within(networks); got != want {
+			t.Errorf("%s within = %v, want %v", name, got, want)
+		}
+	}
+
+	if _, err := ParseNetworks([]string{"10.0.0.0/33"}); err == nil {
+		t.Error("expected an error for an invalid network")
+	}
+}
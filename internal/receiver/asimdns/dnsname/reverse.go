@@ -0,0 +1,126 @@
+package dnsname
+
+import (
+	"fmt"
+	"net/netip"
+	"strconv"
+	"strings"
+)
+
+// Reverse lookup zones
+const (
+	reverseZone4 = "in-addr.arpa"
+	reverseZone6 = "ip6.arpa"
+)
+
+// Reasons a reverse lookup name cannot be decoded
+const (
+	InvalidReverseOctet  = "invalid_octet"
+	InvalidReverseNibble = "invalid_nibble"
+	InvalidReverseLength = "too_many_labels"
+)
+
+// Reverse is a decoded reverse lookup (PTR) name
+type Reverse struct {
+	// Prefix is the address looked up, or the network for names with fewer
+	// labels than a full address, such as reverse zone SOA queries. It is
+	// not valid for the zone apex or a malformed name.
+	Prefix netip.Prefix
+	// Invalid is the reason a malformed name could not be decoded
+	Invalid string
+}
+
+// Addr returns the looked-up address when the name holds a full address
+func (r Reverse) Addr() (netip.Addr, bool) {
+	if !r.Prefix.IsValid() || !r.Prefix.IsSingleIP() {
+		return netip.Addr{}, false
+	}
+	return r.Prefix.Addr(), true
+}
+
+// ParseReverse decodes a name under in-addr.arpa or ip6.arpa. It reports
+// false for names outside the reverse zones.
+func ParseReverse(name string) (Reverse, bool) {
+	name = ToASCII(name)
+	switch {
+	case name == reverseZone4 || name == reverseZone6:
+		return Reverse{}, true
+	case strings.HasSuffix(name, "."+reverseZone4):
+		return parseReverse4(strings.Split(strings.TrimSuffix(name, "."+reverseZone4), ".")), true
+	case strings.HasSuffix(name, "."+reverseZone6):
+		return parseReverse6(strings.Split(strings.TrimSuffix(name, "."+reverseZone6), ".")), true
+	}
+	return Reverse{}, false
+}
+
+// parseReverse4 decodes the octet labels of an in-addr.arpa name, least
+// significant first. Leading zeros are rejected since no resolver writes them.
+func parseReverse4(labels []string) Reverse {
+	if len(labels) > 4 {
+		return Reverse{Invalid: InvalidReverseLength}
+	}
+	var octets [4]byte
+	for i, label := range labels {
+		value, err := strconv.ParseUint(label, 10, 8)
+		if err != nil || len(label) > 1 && label[0] == '0' {
+			return Reverse{Invalid: InvalidReverseOctet}
+		}
+		octets[len(labels)-1-i] = byte(value)
+	}
+	return Reverse{Prefix: netip.PrefixFrom(netip.AddrFrom4(octets), 8*len(labels))}
+}
+
+// parseReverse6 decodes the nibble labels of an ip6.arpa name, least
+// significant first
+func parseReverse6(labels []string) Reverse {
+	if len(labels) > 32 {
+		return Reverse{Invalid: InvalidReverseLength}
+	}
+	var addr [16]byte
+	for i, label := range labels {
+		value, err := strconv.ParseUint(label, 16, 8)
+		if err != nil || len(label) != 1 {
+			return Reverse{Invalid: InvalidReverseNibble}
+		}
+		nibble := len(labels) - 1 - i
+		if nibble%2 == 0 {
+			addr[nibble/2] |= byte(value) << 4
+		} else {
+			addr[nibble/2] |= byte(value)
+		}
+	}
+	return Reverse{Prefix: netip.PrefixFrom(netip.AddrFrom16(addr), 4*len(labels))}
+}
+
+// ParseNetworks parses CIDR ranges and single addresses that reverse lookup
+// targets are matched against
+func ParseNetworks(values []string) ([]netip.Prefix, error) {
+	networks := make([]netip.Prefix, 0, len(values))
+	for _, value := range values {
+		value = strings.TrimSpace(value)
+		if addr, err := netip.ParseAddr(value); err == nil {
+			networks = append(networks, netip.PrefixFrom(addr.Unmap(), addr.Unmap().BitLen()))
+			continue
+		}
+		prefix, err := netip.ParsePrefix(value)
+		if err != nil {
+			return nil, fmt.Errorf("invalid network %q: %w", value, err)
+		}
+		networks = append(networks, prefix.Masked())
+	}
+	return networks, nil
+}
+
+// Within reports whether a reverse lookup target lies inside one of the
+// networks. Partial names match networks that contain their whole range.
+func (r Reverse) Within(networks []netip.Prefix) bool {
+	if !r.Prefix.IsValid() {
+		return false
+	}
+	for _, network := range networks {
+		if network.Bits() <= r.Prefix.Bits() && network.Contains(r.Prefix.Addr()) {
+			return true
+		}
+	}
+	return false
+}
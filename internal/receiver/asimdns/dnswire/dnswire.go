@@ -0,0 +1,97 @@
+// Package dnswire holds DNS protocol constants and their presentation names.
+// Names come from tables generated from the IANA registries; values without
+// a name use the RFC 3597 TYPEnn and CLASSnn forms, and RCODEnn for response
+// codes. Parse decodes DNS messages in wire format, such as the packets
+// logged by the DNS Server, into records in presentation format.
+package dnswire
+
+//go:generate go run gen.go
+
+import (
+	"strconv"
+	"strings"
+)
+
+// Common values referred to by the collector
+const (
+	TypeA        uint16 = 1
+	TypeNULL     uint16 = 10
+	TypePTR      uint16 = 12
+	TypeTXT      uint16 = 16
+	TypeAAAA     uint16 = 28
+	ClassIN      uint16 = 1
+	RcodeNoError uint16 = 0
+)
+
+// valuesByName inverts a name table
+func valuesByName(names map[uint16]string) map[string]uint16 {
+	values := make(map[string]uint16, len(names))
+	for value, name := range names {
+		values[name] = value
+	}
+	return values
+}
+
+var (
+	typeValues  = valuesByName(typeNames)
+	classValues = valuesByName(classNames)
+	rcodeValues = valuesByName(rcodeNames)
+)
+
+// Additional names accepted when parsing
+func init() {
+	classValues["CS"] = 2      // CSNET, obsolete but still recognised by resolvers
+	rcodeValues["BADSIG"] = 16 // shares its value with BADVERS
+}
+
+// name returns the table name of a value or prefix followed by the number
+func name(names map[uint16]string, prefix string, value uint16) string {
+	if n, ok := names[value]; ok {
+		return n
+	}
+	return prefix + strconv.Itoa(int(value))
+}
+
+// parse accepts a table name or the generic prefix-number form, in any case
+func parse(values map[string]uint16, prefix, s string) (uint16, bool) {
+	s = strings.ToUpper(strings.TrimSpace(s))
+	if value, ok := values[s]; ok {
+		return value, true
+	}
+	if !strings.HasPrefix(s, prefix) {
+		return 0, false
+	}
+	value, err := strconv.ParseUint(s[len(prefix):], 10, 16)
+	return uint16(value), err == nil
+}
+
+// TypeName returns the mnemonic of a resource record type, such as "AAAA" or "TYPE65280"
+func TypeName(t uint16) string {
+	return name(typeNames, "TYPE", t)
+}
+
+// ParseType returns the value of a type mnemonic or TYPEnn name
+func ParseType(s string) (uint16, bool) {
+	return parse(typeValues, "TYPE", s)
+}
+
+// ClassName returns the mnemonic of a class, such as "IN" or "CLASS42"
+func ClassName(c uint16) string {
+	return name(classNames, "CLASS", c)
+}
+
+// ParseClass returns the value of a class mnemonic or CLASSnn name
+func ParseClass(s string) (uint16, bool) {
+	return parse(classValues, "CLASS", s)
+}
+
+// RcodeName returns the name of a response code, such as "NXDOMAIN" or "RCODE24".
+// Values above 15 are extended codes carried in the EDNS OPT record or TSIG.
+func RcodeName(r uint16) string {
+	return name(rcodeNames, "RCODE", r)
+}
+
+// ParseRcode returns the value of a response code name or RCODEnn name
+func ParseRcode(s string) (uint16, bool) {
+	return parse(rcodeValues, "RCODE", s)
+}
@@ -0,0 +1,325 @@
+package dnswire
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/hex"
+	"net/netip"
+	"strings"
+	"testing"
+)
+
+func TestTableRoundTrip(t *testing.T) {
+	tables := []struct {
+		name   string
+		names  map[uint16]string
+		format func(uint16) string
+		parse  func(string) (uint16, bool)
+	}{
+		{"type", typeNames, TypeName, ParseType},
+		{"class", classNames, ClassName, ParseClass},
+		{"rcode", rcodeNames, RcodeName, ParseRcode},
+	}
+	for _, table := range tables {
+		seen := make(map[string]uint16)
+		for value, name := range table.names {
+			if other, ok := seen[name]; ok {
+				t.Errorf("%s name %q used for %d and %d", table.name, name, other, value)
+			}
+			seen[name] = value
+			if got := table.format(value); got != name {
+				t.Errorf("%s %d: name %q, want %q", table.name, value, got, name)
+			}
+			if got, ok := table.parse(name); !ok || got != value {
+				t.Errorf("%s %q: parsed %d %v, want %d", table.name, name, got, ok, value)
+			}
+			if got, ok := table.parse(strings.ToLower(name)); !ok || got != value {
+				t.Errorf("%s %q: lower case parsed %d %v, want %d", table.name, name, got, ok, value)
+			}
+		}
+	}
+}
+
+func TestKnownValues(t *testing.T) {
+	cases := []struct {
+		got, want string
+	}{
+		{TypeName(1), "A"},
+		{TypeName(10), "NULL"},
+		{TypeName(43), "DS"},
+		{TypeName(48), "DNSKEY"},
+		{TypeName(64), "SVCB"},
+		{TypeName(251), "IXFR"},
+		{TypeName(252), "AXFR"},
+		{TypeName(255), "ANY"},
+		{TypeName(257), "CAA"},
+		{ClassName(1), "IN"},
+		{ClassName(3), "CH"},
+		{ClassName(255), "ANY"},
+		{RcodeName(3), "NXDOMAIN"},
+		{RcodeName(16), "BADVERS"},
+		{RcodeName(23), "BADCOOKIE"},
+	}
+	for _, c := range cases {
+		if c.got != c.want {
+			t.Errorf("got %q, want %q", c.got, c.want)
+		}
+	}
+}
+
+func TestUnknownValues(t *testing.T) {
+	if got := TypeName(65280); got != "TYPE65280" {
+		t.Errorf("TypeName(65280) = %q", got)
+	}
+	if got := ClassName(42); got != "CLASS42" {
+		t.Errorf("ClassName(42) = %q", got)
+	}
+	if got := RcodeName(24); got != "RCODE24" {
+		t.Errorf("RcodeName(24) = %q", got)
+	}
+	for value := 0; value <= 0xffff; value++ {
+		v := uint16(value)
+		if got, ok := ParseType(TypeName(v)); !ok || got != v {
+			t.Fatalf("type %d did not round-trip: %d %v", v, got, ok)
+		}
+		if got, ok := ParseClass(ClassName(v)); !ok || got != v {
+			t.Fatalf("class %d did not round-trip: %d %v", v, got, ok)
+		}
+		if got, ok := ParseRcode(RcodeName(v)); !ok || got != v {
+			t.Fatalf("rcode %d did not round-trip: %d %v", v, got, ok)
+		}
+	}
+}
+
+func TestParseAliasesAndErrors(t *testing.T) {
+	if v, ok := ParseType("type1"); !ok || v != 1 {
+		t.Errorf("ParseType(type1) = %d %v", v, ok)
+	}
+	if v, ok := ParseRcode("BADSIG"); !ok || v != 16 {
+		t.Errorf("ParseRcode(BADSIG) = %d %v", v, ok)
+	}
+	if v, ok := ParseClass("CS"); !ok || v != 2 {
+		t.Errorf("ParseClass(CS) = %d %v", v, ok)
+	}
+	for _, s := range []string{"", "TYPE", "TYPE65536", "TYPE-1", "BOGUS", "CLASSX"} {
+		if _, ok := ParseType(s); ok {
+			t.Errorf("ParseType(%q) succeeded", s)
+		}
+	}
+}
+
+// wireName encodes a name without compression
+func wireName(name string) []byte {
+	var b []byte
+	for _, label := range strings.Split(strings.TrimSuffix(name, "."), ".") {
+		if label != "" {
+			b = append(b, byte(len(label)))
+			b = append(b, label...)
+		}
+	}
+	return append(b, 0)
+}
+
+// wireRecord encodes a resource record
+func wireRecord(name []byte, rrtype, class uint16, ttl uint32, data []byte) []byte {
+	b := append([]byte(nil), name...)
+	b = binary.BigEndian.AppendUint16(b, rrtype)
+	b = binary.BigEndian.AppendUint16(b, class)
+	b = binary.BigEndian.AppendUint32(b, ttl)
+	b = binary.BigEndian.AppendUint16(b, uint16(len(data)))
+	return append(b, data...)
+}
+
+// wireMessage encodes a header and the sections that follow it
+func wireMessage(flags uint16, counts [4]uint16, sections ...[]byte) []byte {
+	b := []byte{0x12, 0x34}
+	b = binary.BigEndian.AppendUint16(b, flags)
+	for _, c := range counts {
+		b = binary.BigEndian.AppendUint16(b, c)
+	}
+	for _, s := range sections {
+		b = append(b, s...)
+	}
+	return b
+}
+
+// pointer is a compression pointer to the question name
+var pointer = []byte{0xc0, 12}
+
+// sampleResponse is an answer to www.example.com A with a CNAME chain,
+// compressed names and an OPT record carrying a client subnet and cookie
+func sampleResponse() []byte {
+	question := append(wireName("www.example.com"), 0, 1, 0, 1)
+	cname := wireRecord(pointer, TypeCNAME, ClassIN, 300, append([]byte{3, 'c', 'd', 'n'}, 0xc0, 16))
+	a := wireRecord([]byte{0xc0, 0x2d}, TypeA, ClassIN, 60, []byte{192, 0, 2, 10})
+	aaaa := wireRecord([]byte{0xc0, 0x2d}, TypeAAAA, ClassIN, 60, netip.MustParseAddr("2001:db8::10").AsSlice())
+	ecs := []byte{0, 8, 0, 7, 0, 1, 24, 0, 198, 51, 100}
+	cookie := append([]byte{0, 10, 0, 24}, bytes.Repeat([]byte{0xab}, 24)...)
+	opt := wireRecord([]byte{0}, TypeOPT, 1232, 0x00008000, append(ecs, cookie...))
+	return wireMessage(0x8580, [4]uint16{1, 3, 0, 1}, question, cname, a, aaaa, opt)
+}
+
+func TestParseResponse(t *testing.T) {
+	m, err := Parse(sampleResponse())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if m.ID != 0x1234 || !m.Response || !m.Authoritative || !m.RecursionDesired || !m.RecursionAvailable ||
+		m.Truncated || m.Rcode != RcodeNoError {
+		t.Errorf("unexpected header %+v", m.Header)
+	}
+	if got := strings.Join(m.Flags(), " "); got != "QR AA RD RA" {
+		t.Errorf("flags %q", got)
+	}
+	if len(m.Questions) != 1 || m.Questions[0] != (Question{"www.example.com.", TypeA, ClassIN}) {
+		t.Errorf("questions %+v", m.Questions)
+	}
+	want := []string{
+		"www.example.com. 300 IN CNAME cdn.example.com.",
+		"cdn.example.com. 60 IN A 192.0.2.10",
+		"cdn.example.com. 60 IN AAAA 2001:db8::10",
+	}
+	if len(m.Answers) != len(want) {
+		t.Fatalf("answers %+v", m.Answers)
+	}
+	for i, rr := range m.Answers {
+		if rr.String() != want[i] {
+			t.Errorf("answer %d = %q, want %q", i, rr, want[i])
+		}
+	}
+	if addrs := m.AnswerAddrs(); len(addrs) != 2 || addrs[0].String() != "192.0.2.10" {
+		t.Errorf("addresses %v", addrs)
+	}
+	if len(m.Additionals) != 0 || m.EDNS == nil {
+		t.Fatalf("OPT not parsed: %+v", m.Additionals)
+	}
+	e := m.EDNS
+	if e.UDPSize != 1232 || !e.DNSSECOK || e.ClientSubnet.String() != "198.51.100.0/24" || len(e.Options) != 2 {
+		t.Errorf("unexpected EDNS %+v", e)
+	}
+	if len(e.ClientCookie) != 8 || len(e.ServerCookie) != 16 {
+		t.Errorf("cookies %x %x", e.ClientCookie, e.ServerCookie)
+	}
+}
+
+func TestParseHex(t *testing.T) {
+	m, err := ParseHex("0x" + strings.ToUpper(hex.EncodeToString(sampleResponse())))
+	if err != nil || len(m.Answers) != 3 {
+		t.Fatalf("ParseHex: %v %+v", err, m)
+	}
+	if _, err := ParseHex("0xZZ"); err == nil {
+		t.Error("invalid hex accepted")
+	}
+}
+
+func TestExtendedRcode(t *testing.T) {
+	opt := wireRecord([]byte{0}, TypeOPT, 512, 0x01000000, nil)
+	m, err := Parse(wireMessage(0x8000, [4]uint16{0, 0, 0, 1}, opt))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if m.Rcode != 16 || RcodeName(m.Rcode) != "BADVERS" {
+		t.Errorf("rcode %d", m.Rcode)
+	}
+	if _, err := Parse(wireMessage(0x8000, [4]uint16{0, 0, 0, 2}, opt, opt)); err != ErrOPT {
+		t.Errorf("two OPT records: %v", err)
+	}
+}
+
+func TestRecordData(t *testing.T) {
+	name := wireName("example.com")
+	u16 := func(v uint16) []byte { return binary.BigEndian.AppendUint16(nil, v) }
+	u32 := func(v uint32) []byte { return binary.BigEndian.AppendUint32(nil, v) }
+	join := func(parts ...[]byte) []byte { return bytes.Join(parts, nil) }
+	cases := []struct {
+		rrtype uint16
+		data   []byte
+		want   string
+	}{
+		{TypeMX, join(u16(10), wireName("mail.example.com")), "10 mail.example.com."},
+		{TypeSOA, join(wireName("ns1.example.com"), wireName("hostmaster.example.com"),
+			u32(2024010101), u32(3600), u32(600), u32(86400), u32(300)),
+			"ns1.example.com. hostmaster.example.com. 2024010101 3600 600 86400 300"},
+		{TypeTXT, []byte("\x0bv=spf1 -all\x04a\"b\x00"), `"v=spf1 -all" "a\"b\000"`},
+		{TypeSRV, join(u16(0), u16(5), u16(5060), wireName("sip.example.com")), "0 5 5060 sip.example.com."},
+		{TypeCAA, join([]byte{0, 5}, []byte("issue"), []byte("ca.example")), `0 issue "ca.example"`},
+		{TypeDS, join(u16(12345), []byte{13, 2}, []byte{0xde, 0xad}), "12345 13 2 DEAD"},
+		{TypeDNSKEY, join(u16(257), []byte{3, 13}, []byte{1, 2, 3}), "257 3 13 AQID"},
+		{TypeRRSIG, join(u16(TypeA), []byte{13, 2}, u32(300), u32(1704067200), u32(1703462400), u16(12345),
+			wireName("example.com"), []byte{1, 2, 3}),
+			"A 13 2 300 20240101000000 20231225000000 12345 example.com. AQID"},
+		{TypeNSEC, join(wireName("b.example.com"), []byte{0, 6, 0x40, 0x01, 0, 0, 0, 0x03}),
+			"b.example.com. A MX RRSIG NSEC"},
+		{TypeNSEC3, join([]byte{1, 0}, u16(0), []byte{0}, []byte{2, 0xff, 0xff}, []byte{0, 1, 0x40}),
+			"1 0 0 - VVVG A"},
+		{TypeHTTPS, join(u16(1), []byte{0}, u16(1), u16(6), []byte{2, 'h', '2', 2, 'h', '3'},
+			u16(4), u16(4), []byte{192, 0, 2, 1}),
+			`1 . alpn="h2,h3" ipv4hint=192.0.2.1`},
+		{TypeNULL, []byte{1, 2}, `\# 2 0102`},
+		{TypeA, []byte{192, 0, 2}, `\# 3 C00002`},
+		{TypeMX, join(u16(10), []byte{4, 'm'}), `\# 4 000A046D`},
+		{TypeTXT, nil, `\# 0`},
+	}
+	for _, c := range cases {
+		rr := wireRecord(name, c.rrtype, ClassIN, 60, c.data)
+		m, err := Parse(wireMessage(0x8000, [4]uint16{0, 1, 0, 0}, rr))
+		if err != nil {
+			t.Errorf("%s: %v", TypeName(c.rrtype), err)
+			continue
+		}
+		if got := m.Answers[0].Text; got != c.want {
+			t.Errorf("%s: got %q, want %q", TypeName(c.rrtype), got, c.want)
+		}
+	}
+}
+
+func TestMalformedMessages(t *testing.T) {
+	question := append(wireName("example.com"), 0, 1, 0, 1)
+	cases := map[string][]byte{
+		"short header":      {0, 1, 2},
+		"missing question":  wireMessage(0, [4]uint16{1, 0, 0, 0}),
+		"pointer to itself": wireMessage(0, [4]uint16{1, 0, 0, 0}, []byte{0xc0, 12, 0, 1, 0, 1}),
+		"forward pointer":   wireMessage(0, [4]uint16{1, 0, 0, 0}, []byte{0xc0, 14, 0, 0, 1, 0, 1}),
+		"pointer loop":      wireMessage(0, [4]uint16{2, 0, 0, 0}, question, []byte{1, 'a', 0xc0, 29, 0, 1, 0, 1}),
+		"extended label":    wireMessage(0, [4]uint16{1, 0, 0, 0}, []byte{0x41, 0, 0, 1, 0, 1}),
+		"long name":         wireMessage(0, [4]uint16{1, 0, 0, 0}, bytes.Repeat([]byte{1, 'a'}, 128), []byte{0, 0, 1, 0, 1}),
+		"record overrun":    wireMessage(0, [4]uint16{0, 1, 0, 0}, []byte{0, 0, 1, 0, 1, 0, 0, 0, 1, 0, 9, 1, 2}),
+		"counts overstated": wireMessage(0, [4]uint16{0xffff, 0xffff, 0xffff, 0xffff}, question),
+	}
+	for name, msg := range cases {
+		if m, err := Parse(msg); err == nil {
+			t.Errorf("%s: parsed %+v", name, m)
+		}
+	}
+}
+
+func FuzzParse(f *testing.F) {
+	f.Add(sampleResponse())
+	f.Add(wireMessage(0x0100, [4]uint16{1, 0, 0, 0}, append(wireName("example.com"), 0, 1, 0, 1)))
+	f.Add(wireMessage(0, [4]uint16{2, 0, 0, 0}, []byte{1, 'a', 0, 0, 1, 0, 1}, []byte{1, 'b', 0xc0, 12, 0, 1, 0, 1}))
+	f.Fuzz(func(t *testing.T, msg []byte) {
+		m, err := Parse(msg)
+		if err != nil {
+			return
+		}
+		records := len(m.Answers) + len(m.Authorities) + len(m.Additionals)
+		if len(m.Questions)*5+records*11 > len(msg) {
+			t.Fatalf("%d questions and %d records from %d bytes", len(m.Questions), records, len(msg))
+		}
+		for _, q := range m.Questions {
+			if len(q.Name) > 4*maxNameLength {
+				t.Fatalf("name of %d characters", len(q.Name))
+			}
+		}
+		for _, section := range [][]Record{m.Answers, m.Authorities, m.Additionals} {
+			for _, rr := range section {
+				if rr.Text == "" && rr.Type != TypeOPT {
+					t.Fatalf("record %+v has no text", rr)
+				}
+				if rr.Addr.IsValid() && rr.Type != TypeA && rr.Type != TypeAAAA {
+					t.Fatalf("record %+v address %v", rr, rr.Addr)
+				}
+			}
+		}
+	})
+}
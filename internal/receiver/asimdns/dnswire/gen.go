@@ -0,0 +1,112 @@
+//go:build ignore
+
+// gen.go writes iana.go from the IANA DNS parameters registries.
+// Run with: go generate ./dnswire
+package main
+
+import (
+	"bytes"
+	"encoding/csv"
+	"fmt"
+	"go/format"
+	"log"
+	"net/http"
+	"os"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Registry exports of https://www.iana.org/assignments/dns-parameters
+const (
+	classURL = "https://www.iana.org/assignments/dns-parameters/dns-parameters-2.csv"
+	rcodeURL = "https://www.iana.org/assignments/dns-parameters/dns-parameters-6.csv"
+	typeURL  = "https://www.iana.org/assignments/dns-parameters/dns-parameters-4.csv"
+)
+
+// aliases replace registry names that are not usable as mnemonics
+var aliases = map[string]string{
+	"*": "ANY",
+}
+
+// mnemonic extracts the parenthesised mnemonic of class names such as "Internet (IN)"
+var mnemonic = regexp.MustCompile(`\(([A-Z*]+)\)\s*$`)
+
+// entry is one registry value
+type entry struct {
+	value uint16
+	name  string
+}
+
+func main() {
+	types := read(typeURL, 1, func(row []string) string { return row[0] })
+	classes := read(classURL, 0, func(row []string) string {
+		if m := mnemonic.FindStringSubmatch(row[2]); m != nil {
+			return m[1]
+		}
+		return ""
+	})
+	rcodes := read(rcodeURL, 0, func(row []string) string { return strings.ToUpper(row[1]) })
+
+	var b bytes.Buffer
+	b.WriteString("// Code generated by gen.go from the IANA DNS parameters registries; DO NOT EDIT.\n\n")
+	b.WriteString("package dnswire\n\n")
+	write(&b, "typeNames", "typeNames are the assigned resource record types", types)
+	write(&b, "classNames", "classNames are the assigned classes", classes)
+	write(&b, "rcodeNames", "rcodeNames are the assigned response codes, including extended codes", rcodes)
+
+	src, err := format.Source(b.Bytes())
+	if err != nil {
+		log.Fatal(err)
+	}
+	if err := os.WriteFile("iana.go", src, 0o644); err != nil {
+		log.Fatal(err)
+	}
+}
+
+// read downloads a registry and returns its single-value entries. Ranges,
+// unassigned and reserved values are skipped; for values listed twice the
+// first name is kept.
+func read(url string, valueColumn int, name func([]string) string) []entry {
+	resp, err := http.Get(url)
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer resp.Body.Close()
+
+	rows, err := csv.NewReader(resp.Body).ReadAll()
+	if err != nil {
+		log.Fatal(err)
+	}
+	seen := make(map[uint16]bool)
+	var entries []entry
+	for _, row := range rows[1:] {
+		value, err := strconv.ParseUint(strings.TrimSpace(row[valueColumn]), 10, 16)
+		if err != nil {
+			continue
+		}
+		n := strings.TrimSpace(name(row))
+		if alias, ok := aliases[n]; ok {
+			n = alias
+		}
+		lower := strings.ToLower(n)
+		if n == "" || seen[uint16(value)] || strings.Contains(lower, "unassigned") ||
+			strings.Contains(lower, "reserved") || strings.Contains(lower, "private") {
+			continue
+		}
+		seen[uint16(value)] = true
+		entries = append(entries, entry{uint16(value), n})
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].value < entries[j].value })
+	return entries
+}
+
+// write emits a value to name map
+func write(b *bytes.Buffer, variable, comment string, entries []entry) {
+	fmt.Fprintf(b, "// %s\nvar %s = map[uint16]string{\n", comment, variable)
+	for _, e := range entries {
+		fmt.Fprintf(b, "\t%d: %q,\n", e.value, e.name)
+	}
+	b.WriteString("}\n\n")
+}
@@ -0,0 +1,387 @@
+package dnswire
+
+import (
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"net/netip"
+	"strings"
+)
+
+// Errors returned for malformed messages
+var (
+	ErrShort   = errors.New("dnswire: message truncated")
+	ErrName    = errors.New("dnswire: invalid name")
+	ErrPointer = errors.New("dnswire: invalid compression pointer")
+	ErrOPT     = errors.New("dnswire: invalid OPT record")
+)
+
+// TypeOPT is the EDNS pseudo record type
+const TypeOPT uint16 = 41
+
+// EDNS option codes
+const (
+	OptionClientSubnet uint16 = 8
+	OptionCookie       uint16 = 10
+)
+
+// maxNameLength is the longest name in wire format, including the root
+// label, and maxPointers bounds the compression pointers followed in a name
+const (
+	maxNameLength = 255
+	maxPointers   = 126
+)
+
+// Header is the fixed header of a DNS message
+type Header struct {
+	ID                 uint16
+	Response           bool
+	Opcode             uint8
+	Authoritative      bool
+	Truncated          bool
+	RecursionDesired   bool
+	RecursionAvailable bool
+	Z                  bool
+	AuthenticData      bool
+	CheckingDisabled   bool
+	// Rcode includes the extended bits carried in the OPT record
+	Rcode uint16
+}
+
+// Flags returns the mnemonics of the flags set, such as "QR RD RA"
+func (h Header) Flags() []string {
+	var flags []string
+	for _, f := range []struct {
+		set  bool
+		name string
+	}{
+		{h.Response, "QR"},
+		{h.Authoritative, "AA"},
+		{h.Truncated, "TC"},
+		{h.RecursionDesired, "RD"},
+		{h.RecursionAvailable, "RA"},
+		{h.Z, "Z"},
+		{h.AuthenticData, "AD"},
+		{h.CheckingDisabled, "CD"},
+	} {
+		if f.set {
+			flags = append(flags, f.name)
+		}
+	}
+	return flags
+}
+
+// Question is an entry of the question section
+type Question struct {
+	Name  string
+	Type  uint16
+	Class uint16
+}
+
+// Record is a resource record
+type Record struct {
+	Name  string
+	Type  uint16
+	Class uint16
+	TTL   uint32
+	// Data is the raw record data and Text its presentation format. Data
+	// that does not match its type is shown in the RFC 3597 generic format.
+	Data []byte
+	Text string
+	// Addr is the address of A and AAAA records
+	Addr netip.Addr
+}
+
+// String returns the record in zone file format
+func (r Record) String() string {
+	return r.Name + " " + itoa(uint64(r.TTL)) + " " + ClassName(r.Class) + " " + TypeName(r.Type) + " " + r.Text
+}
+
+// Option is an EDNS option
+type Option struct {
+	Code uint16
+	Data []byte
+}
+
+// EDNS holds the OPT pseudo record of a message
+type EDNS struct {
+	UDPSize  uint16
+	Version  uint8
+	DNSSECOK bool
+	Options  []Option
+	// ClientSubnet is the EDNS Client Subnet source prefix, if sent, and
+	// ClientSubnetScope the scope prefix length returned by the server
+	ClientSubnet      netip.Prefix
+	ClientSubnetScope uint8
+	// ClientCookie and ServerCookie are the DNS cookies, if sent
+	ClientCookie []byte
+	ServerCookie []byte
+}
+
+// Message is a parsed DNS message
+type Message struct {
+	Header
+	Questions   []Question
+	Answers     []Record
+	Authorities []Record
+	// Additionals excludes the OPT record, which is parsed into EDNS
+	Additionals []Record
+	EDNS        *EDNS
+}
+
+// AnswerAddrs returns the addresses of the A and AAAA answers
+func (m *Message) AnswerAddrs() []netip.Addr {
+	var addrs []netip.Addr
+	for _, rr := range m.Answers {
+		if rr.Addr.IsValid() {
+			addrs = append(addrs, rr.Addr)
+		}
+	}
+	return addrs
+}
+
+// ParseHex parses a message given as hexadecimal, as ETW formats binary
+// event data. An optional 0x prefix and white space are ignored.
+func ParseHex(s string) (*Message, error) {
+	s = strings.Join(strings.Fields(s), "")
+	if len(s) > 1 && s[0] == '0' && (s[1] == 'x' || s[1] == 'X') {
+		s = s[2:]
+	}
+	b, err := hex.DecodeString(s)
+	if err != nil {
+		return nil, err
+	}
+	return Parse(b)
+}
+
+// Parse parses a DNS message. Bytes after the last record are ignored.
+func Parse(msg []byte) (*Message, error) {
+	if len(msg) < 12 {
+		return nil, ErrShort
+	}
+	flags := binary.BigEndian.Uint16(msg[2:])
+	m := &Message{Header: Header{
+		ID:                 binary.BigEndian.Uint16(msg),
+		Response:           flags&0x8000 != 0,
+		Opcode:             uint8(flags>>11) & 0xf,
+		Authoritative:      flags&0x0400 != 0,
+		Truncated:          flags&0x0200 != 0,
+		RecursionDesired:   flags&0x0100 != 0,
+		RecursionAvailable: flags&0x0080 != 0,
+		Z:                  flags&0x0040 != 0,
+		AuthenticData:      flags&0x0020 != 0,
+		CheckingDisabled:   flags&0x0010 != 0,
+		Rcode:              flags & 0xf,
+	}}
+	qdcount := int(binary.BigEndian.Uint16(msg[4:]))
+	ancount := int(binary.BigEndian.Uint16(msg[6:]))
+	nscount := int(binary.BigEndian.Uint16(msg[8:]))
+	arcount := int(binary.BigEndian.Uint16(msg[10:]))
+
+	off := 12
+	for i := 0; i < qdcount; i++ {
+		name, next, err := readName(msg, off)
+		if err != nil {
+			return nil, err
+		}
+		if next+4 > len(msg) {
+			return nil, ErrShort
+		}
+		m.Questions = append(m.Questions, Question{
+			Name:  name,
+			Type:  binary.BigEndian.Uint16(msg[next:]),
+			Class: binary.BigEndian.Uint16(msg[next+2:]),
+		})
+		off = next + 4
+	}
+
+	var err error
+	if m.Answers, off, err = readRecords(msg, off, ancount); err != nil {
+		return nil, err
+	}
+	if m.Authorities, off, err = readRecords(msg, off, nscount); err != nil {
+		return nil, err
+	}
+	additionals, _, err := readRecords(msg, off, arcount)
+	if err != nil {
+		return nil, err
+	}
+	for _, rr := range additionals {
+		if rr.Type != TypeOPT {
+			m.Additionals = append(m.Additionals, rr)
+			continue
+		}
+		if m.EDNS != nil || rr.Name != "." {
+			return nil, ErrOPT
+		}
+		m.EDNS = parseEDNS(rr)
+		m.Rcode |= uint16(rr.TTL>>24) << 4
+	}
+	return m, nil
+}
+
+// readRecords reads count resource records starting at off
+func readRecords(msg []byte, off, count int) ([]Record, int, error) {
+	var records []Record
+	for i := 0; i < count; i++ {
+		name, next, err := readName(msg, off)
+		if err != nil {
+			return nil, off, err
+		}
+		if next+10 > len(msg) {
+			return nil, off, ErrShort
+		}
+		rr := Record{
+			Name:  name,
+			Type:  binary.BigEndian.Uint16(msg[next:]),
+			Class: binary.BigEndian.Uint16(msg[next+2:]),
+			TTL:   binary.BigEndian.Uint32(msg[next+4:]),
+		}
+		length := int(binary.BigEndian.Uint16(msg[next+8:]))
+		start := next + 10
+		if start+length > len(msg) {
+			return nil, off, ErrShort
+		}
+		rr.Data = msg[start : start+length]
+		if rr.Type != TypeOPT {
+			rr.Text, rr.Addr = formatData(msg[:start+length], start, rr.Type)
+		}
+		records = append(records, rr)
+		off = start + length
+	}
+	return records, off, nil
+}
+
+// parseEDNS decodes an OPT record. Malformed options are kept undecoded.
+func parseEDNS(rr Record) *EDNS {
+	e := &EDNS{
+		UDPSize:  rr.Class,
+		Version:  uint8(rr.TTL >> 16),
+		DNSSECOK: rr.TTL&0x8000 != 0,
+	}
+	data := rr.Data
+	for len(data) >= 4 {
+		code := binary.BigEndian.Uint16(data)
+		length := int(binary.BigEndian.Uint16(data[2:]))
+		if 4+length > len(data) {
+			break
+		}
+		value := data[4 : 4+length]
+		e.Options = append(e.Options, Option{Code: code, Data: value})
+		switch code {
+		case OptionClientSubnet:
+			e.ClientSubnet, e.ClientSubnetScope = parseClientSubnet(value)
+		case OptionCookie:
+			if len(value) == 8 || len(value) >= 16 && len(value) <= 40 {
+				e.ClientCookie, e.ServerCookie = value[:8], value[8:]
+			}
+		}
+		data = data[4+length:]
+	}
+	return e
+}
+
+// parseClientSubnet decodes an EDNS Client Subnet option (RFC 7871)
+func parseClientSubnet(b []byte) (netip.Prefix, uint8) {
+	if len(b) < 4 {
+		return netip.Prefix{}, 0
+	}
+	family, source, scope := binary.BigEndian.Uint16(b), int(b[2]), b[3]
+	var full [16]byte
+	var addr netip.Addr
+	switch {
+	case family == 1 && source <= 32 && len(b)-4 == (source+7)/8:
+		copy(full[:4], b[4:])
+		addr = netip.AddrFrom4([4]byte(full[:4]))
+	case family == 2 && source <= 128 && len(b)-4 == (source+7)/8:
+		copy(full[:], b[4:])
+		addr = netip.AddrFrom16(full)
+	default:
+		return netip.Prefix{}, 0
+	}
+	prefix, err := addr.Prefix(source)
+	if err != nil {
+		return netip.Prefix{}, 0
+	}
+	return prefix, scope
+}
+
+// readName reads a possibly compressed name at off. It returns the name in
+// presentation format with a trailing dot and the offset after the name.
+// Each compression pointer must point before the labels read since the
+// previous one, which rules out loops.
+func readName(msg []byte, off int) (string, int, error) {
+	var sb strings.Builder
+	next := -1
+	start := off
+	pointers := 0
+	length := 0
+	for {
+		if off >= len(msg) {
+			return "", 0, ErrShort
+		}
+		c := int(msg[off])
+		switch c & 0xc0 {
+		case 0x00:
+			if c == 0 {
+				if next < 0 {
+					next = off + 1
+				}
+				if sb.Len() == 0 {
+					return ".", next, nil
+				}
+				return sb.String(), next, nil
+			}
+			if off+1+c > len(msg) {
+				return "", 0, ErrShort
+			}
+			length += c + 1
+			if length+1 > maxNameLength {
+				return "", 0, ErrName
+			}
+			writeLabel(&sb, msg[off+1:off+1+c])
+			sb.WriteByte('.')
+			off += 1 + c
+		case 0xc0:
+			if off+1 >= len(msg) {
+				return "", 0, ErrShort
+			}
+			ptr := (c&0x3f)<<8 | int(msg[off+1])
+			pointers++
+			if ptr >= start || pointers > maxPointers {
+				return "", 0, ErrPointer
+			}
+			if next < 0 {
+				next = off + 2
+			}
+			off, start = ptr, ptr
+		default:
+			// Extended label types (RFC 6891) are obsolete
+			return "", 0, ErrName
+		}
+	}
+}
+
+// writeLabel writes a label in presentation format, escaping dots,
+// backslashes, quotes and unprintable bytes
+func writeLabel(sb *strings.Builder, label []byte) {
+	for _, b := range label {
+		switch {
+		case b == '.' || b == '\\' || b == '"' || b == '(' || b == ')' || b == ';' || b == '@' || b == '$':
+			sb.WriteByte('\\')
+			sb.WriteByte(b)
+		case b < 0x21 || b > 0x7e:
+			writeDecimalEscape(sb, b)
+		default:
+			sb.WriteByte(b)
+		}
+	}
+}
+
+// writeDecimalEscape writes a byte as \DDD
+func writeDecimalEscape(sb *strings.Builder, b byte) {
+	sb.WriteByte('\\')
+	sb.WriteByte('0' + b/100)
+	sb.WriteByte('0' + b/10%10)
+	sb.WriteByte('0' + b%10)
+}
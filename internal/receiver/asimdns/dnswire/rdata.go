@@ -0,0 +1,341 @@
+package dnswire
+
+import (
+	"encoding/base32"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"net/netip"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// errData reports record data that does not match its type
+var errData = errors.New("dnswire: invalid record data")
+
+// Record types with a decoded presentation format
+const (
+	TypeNS         uint16 = 2
+	TypeCNAME      uint16 = 5
+	TypeSOA        uint16 = 6
+	TypeMX         uint16 = 15
+	TypeSRV        uint16 = 33
+	TypeDNAME      uint16 = 39
+	TypeDS         uint16 = 43
+	TypeRRSIG      uint16 = 46
+	TypeNSEC       uint16 = 47
+	TypeDNSKEY     uint16 = 48
+	TypeNSEC3      uint16 = 50
+	TypeNSEC3PARAM uint16 = 51
+	TypeCDS        uint16 = 59
+	TypeCDNSKEY    uint16 = 60
+	TypeSVCB       uint16 = 64
+	TypeHTTPS      uint16 = 65
+	TypeSPF        uint16 = 99
+	TypeCAA        uint16 = 257
+)
+
+// svcParamKeys are the SVCB and HTTPS parameter names (RFC 9460)
+var svcParamKeys = map[uint16]string{
+	0: "mandatory",
+	1: "alpn",
+	2: "no-default-alpn",
+	3: "port",
+	4: "ipv4hint",
+	5: "ech",
+	6: "ipv6hint",
+}
+
+// base32hex encodes NSEC3 hashes (RFC 5155)
+var base32hex = base32.HexEncoding.WithPadding(base32.NoPadding)
+
+// rdata reads the fields of record data. Names may use compression pointers
+// into the rest of the message, which ends with the record data.
+type rdata struct {
+	msg []byte
+	off int
+	err error
+}
+
+func (r *rdata) remaining() int { return len(r.msg) - r.off }
+
+func (r *rdata) bytes(n int) []byte {
+	if r.err != nil || n < 0 || n > r.remaining() {
+		r.err = errData
+		return nil
+	}
+	b := r.msg[r.off : r.off+n]
+	r.off += n
+	return b
+}
+
+func (r *rdata) rest() []byte { return r.bytes(r.remaining()) }
+
+func (r *rdata) uint8() uint8 {
+	if b := r.bytes(1); b != nil {
+		return b[0]
+	}
+	return 0
+}
+
+func (r *rdata) uint16() uint16 {
+	if b := r.bytes(2); b != nil {
+		return binary.BigEndian.Uint16(b)
+	}
+	return 0
+}
+
+func (r *rdata) uint32() uint32 {
+	if b := r.bytes(4); b != nil {
+		return binary.BigEndian.Uint32(b)
+	}
+	return 0
+}
+
+func (r *rdata) name() string {
+	if r.err != nil {
+		return ""
+	}
+	name, next, err := readName(r.msg, r.off)
+	if err != nil {
+		r.err = err
+		return ""
+	}
+	r.off = next
+	return name
+}
+
+// characterString reads a length-prefixed string and quotes it
+func (r *rdata) characterString() string {
+	return quote(r.bytes(int(r.uint8())))
+}
+
+// formatData returns the presentation format of the record data starting at
+// off, and the address of A and AAAA records
+func formatData(msg []byte, off int, rrtype uint16) (string, netip.Addr) {
+	r := &rdata{msg: msg, off: off}
+	var text string
+	var addr netip.Addr
+	switch rrtype {
+	case TypeA:
+		if b := r.bytes(4); b != nil {
+			addr = netip.AddrFrom4([4]byte(b))
+			text = addr.String()
+		}
+	case TypeAAAA:
+		if b := r.bytes(16); b != nil {
+			addr = netip.AddrFrom16([16]byte(b))
+			text = addr.String()
+		}
+	case TypeNS, TypeCNAME, TypePTR, TypeDNAME:
+		text = r.name()
+	case TypeMX:
+		text = itoa(uint64(r.uint16())) + " " + r.name()
+	case TypeSOA:
+		text = r.name() + " " + r.name()
+		for i := 0; i < 5; i++ {
+			text += " " + itoa(uint64(r.uint32()))
+		}
+	case TypeTXT, TypeSPF:
+		var parts []string
+		for r.err == nil && r.remaining() > 0 {
+			parts = append(parts, r.characterString())
+		}
+		text = strings.Join(parts, " ")
+		if len(parts) == 0 {
+			r.err = errData
+		}
+	case TypeSRV:
+		text = itoa(uint64(r.uint16())) + " " + itoa(uint64(r.uint16())) + " " + itoa(uint64(r.uint16())) + " " + r.name()
+	case TypeCAA:
+		flags := r.uint8()
+		tag := r.bytes(int(r.uint8()))
+		text = itoa(uint64(flags)) + " " + string(tag) + " " + quote(r.rest())
+		if len(tag) == 0 || strings.IndexFunc(string(tag), func(c rune) bool {
+			return !(c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9')
+		}) >= 0 {
+			r.err = errData
+		}
+	case TypeDS, TypeCDS:
+		text = itoa(uint64(r.uint16())) + " " + itoa(uint64(r.uint8())) + " " + itoa(uint64(r.uint8())) +
+			" " + strings.ToUpper(hex.EncodeToString(r.rest()))
+	case TypeDNSKEY, TypeCDNSKEY:
+		text = itoa(uint64(r.uint16())) + " " + itoa(uint64(r.uint8())) + " " + itoa(uint64(r.uint8())) +
+			" " + base64.StdEncoding.EncodeToString(r.rest())
+	case TypeRRSIG:
+		covered, alg, labels, ttl := r.uint16(), r.uint8(), r.uint8(), r.uint32()
+		expiration, inception, tag := r.uint32(), r.uint32(), r.uint16()
+		signer := r.name()
+		text = TypeName(covered) + " " + itoa(uint64(alg)) + " " + itoa(uint64(labels)) + " " + itoa(uint64(ttl)) +
+			" " + formatTime(expiration) + " " + formatTime(inception) + " " + itoa(uint64(tag)) + " " + signer +
+			" " + base64.StdEncoding.EncodeToString(r.rest())
+	case TypeNSEC:
+		text = r.name()
+		if types := r.typeBitmap(); types != "" {
+			text += " " + types
+		}
+	case TypeNSEC3:
+		text = r.nsec3Params()
+		next := base32hex.EncodeToString(r.bytes(int(r.uint8())))
+		text += " " + next
+		if types := r.typeBitmap(); types != "" {
+			text += " " + types
+		}
+	case TypeNSEC3PARAM:
+		text = r.nsec3Params()
+	case TypeSVCB, TypeHTTPS:
+		text = itoa(uint64(r.uint16())) + " " + r.name() + r.svcParams()
+	default:
+		return generic(msg[off:]), addr
+	}
+	if r.err != nil || r.remaining() != 0 {
+		return generic(msg[off:]), netip.Addr{}
+	}
+	return text, addr
+}
+
+// nsec3Params reads the hash algorithm, flags, iterations and salt
+func (r *rdata) nsec3Params() string {
+	text := itoa(uint64(r.uint8())) + " " + itoa(uint64(r.uint8())) + " " + itoa(uint64(r.uint16()))
+	salt := r.bytes(int(r.uint8()))
+	if len(salt) == 0 {
+		return text + " -"
+	}
+	return text + " " + strings.ToUpper(hex.EncodeToString(salt))
+}
+
+// typeBitmap reads the type bitmap of NSEC and NSEC3 records (RFC 4034)
+func (r *rdata) typeBitmap() string {
+	var types []string
+	last := -1
+	for r.err == nil && r.remaining() > 0 {
+		window, length := int(r.uint8()), int(r.uint8())
+		if window <= last || length == 0 || length > 32 {
+			r.err = errData
+			break
+		}
+		last = window
+		for i, b := range r.bytes(length) {
+			for bit := 0; bit < 8; bit++ {
+				if b&(0x80>>bit) != 0 {
+					types = append(types, TypeName(uint16(window<<8|i<<3|bit)))
+				}
+			}
+		}
+	}
+	return strings.Join(types, " ")
+}
+
+// svcParams reads the SVCB and HTTPS service parameters (RFC 9460)
+func (r *rdata) svcParams() string {
+	var sb strings.Builder
+	for r.err == nil && r.remaining() > 0 {
+		key := r.uint16()
+		value := r.bytes(int(r.uint16()))
+		if r.err != nil {
+			break
+		}
+		name, ok := svcParamKeys[key]
+		if !ok {
+			name = "key" + itoa(uint64(key))
+		}
+		sb.WriteString(" " + name)
+		switch key {
+		case 0:
+			if len(value)%2 != 0 {
+				r.err = errData
+				break
+			}
+			var keys []string
+			for i := 0; i+1 < len(value); i += 2 {
+				k := binary.BigEndian.Uint16(value[i:])
+				if n, ok := svcParamKeys[k]; ok {
+					keys = append(keys, n)
+				} else {
+					keys = append(keys, "key"+itoa(uint64(k)))
+				}
+			}
+			sb.WriteString("=" + strings.Join(keys, ","))
+		case 1:
+			var ids []string
+			for rest := value; len(rest) > 0; {
+				n := int(rest[0])
+				if 1+n > len(rest) {
+					r.err = errData
+					break
+				}
+				ids = append(ids, string(rest[1:1+n]))
+				rest = rest[1+n:]
+			}
+			sb.WriteString("=" + quote([]byte(strings.Join(ids, ","))))
+		case 2:
+		case 3:
+			if len(value) != 2 {
+				r.err = errData
+				break
+			}
+			sb.WriteString("=" + itoa(uint64(binary.BigEndian.Uint16(value))))
+		case 4, 6:
+			size := 4
+			if key == 6 {
+				size = 16
+			}
+			if len(value) == 0 || len(value)%size != 0 {
+				r.err = errData
+				break
+			}
+			var addrs []string
+			for i := 0; i < len(value); i += size {
+				a, _ := netip.AddrFromSlice(value[i : i+size])
+				addrs = append(addrs, a.String())
+			}
+			sb.WriteString("=" + strings.Join(addrs, ","))
+		case 5:
+			sb.WriteString("=" + base64.StdEncoding.EncodeToString(value))
+		default:
+			if len(value) > 0 {
+				sb.WriteString("=" + quote(value))
+			}
+		}
+	}
+	return sb.String()
+}
+
+// generic returns record data in the RFC 3597 unknown type format
+func generic(data []byte) string {
+	if len(data) == 0 {
+		return `\# 0`
+	}
+	return `\# ` + itoa(uint64(len(data))) + " " + strings.ToUpper(hex.EncodeToString(data))
+}
+
+// quote returns a character string in quotes, escaping quotes, backslashes
+// and unprintable bytes
+func quote(b []byte) string {
+	var sb strings.Builder
+	sb.WriteByte('"')
+	for _, c := range b {
+		switch {
+		case c == '"' || c == '\\':
+			sb.WriteByte('\\')
+			sb.WriteByte(c)
+		case c < 0x20 || c > 0x7e:
+			writeDecimalEscape(&sb, c)
+		default:
+			sb.WriteByte(c)
+		}
+	}
+	sb.WriteByte('"')
+	return sb.String()
+}
+
+// formatTime formats an RRSIG time as YYYYMMDDHHmmSS
+func formatTime(t uint32) string {
+	return time.Unix(int64(t), 0).UTC().Format("20060102150405")
+}
+
+func itoa(n uint64) string {
+	return strconv.FormatUint(n, 10)
+}
@@ -0,0 +1,331 @@
+//go:build windows
+// +build windows
+
+package filtering
+
+import (
+	"container/list"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/0xrawsec/golang-etw/etw"
+	"go.uber.org/zap"
+)
+
+// Deduplication modes
+const (
+	// DeduplicationModeDrop silently drops repeated queries within the window
+	DeduplicationModeDrop = "drop"
+	// DeduplicationModeAggregate summarises repeated queries into one record per window
+	DeduplicationModeAggregate = "aggregate"
+)
+
+// Aggregate is a summary of all events sharing a key within one window
+type Aggregate struct {
+	Key           string
+	Event         *etw.Event // first event of the window, used as the record template
+	Count         int64
+	StartTime     time.Time
+	EndTime       time.Time
+	ResponseCodes []int
+	opened        time.Time
+	element       *list.Element
+}
+
+// AggregationFilter replaces repeated queries with one summarised record per key and window
+type AggregationFilter struct {
+	logger     *zap.Logger
+	enabled    bool
+	window     time.Duration
+	keyFields  []string
+	maxOpen    int
+	aggregates map[string]*Aggregate
+	// order holds the open aggregates from the oldest opened to the newest,
+	// so expiry and eviction never scan every open aggregate
+	order  *list.List
+	closed []*Aggregate
+	mux    sync.Mutex
+}
+
+// NewAggregationFilter creates a new AggregationFilter
+func NewAggregationFilter(logger *zap.Logger, enabled bool, windowSeconds int, keyFields []string, maxOpen int) *AggregationFilter {
+	if len(keyFields) == 0 {
+		keyFields = DefaultAggregationKeyFields
+	}
+
+	filter := &AggregationFilter{
+		logger:     logger,
+		enabled:    enabled,
+		window:     time.Duration(windowSeconds) * time.Second,
+		keyFields:  keyFields,
+		maxOpen:    maxOpen,
+		aggregates: make(map[string]*Aggregate),
+		order:      list.New(),
+	}
+
+	logger.Info("Aggregation filter initialized",
+		zap.Bool("enabled", enabled),
+		zap.Int("windowSeconds", windowSeconds),
+		zap.Strings("keyFields", keyFields),
+		zap.Int("maxOpenAggregates", maxOpen))
+
+	return filter
+}
+
+// ShouldFilter absorbs a query event into its aggregate. It returns true when the
+// event has been absorbed and must not be emitted individually.
+func (f *AggregationFilter) ShouldFilter(event *etw.Event, fields *FieldResolver) bool {
+	if !f.enabled {
+		return false
+	}
+
+	// Only aggregate query request and response events
+	if !fields.IsQueryEvent(event) {
+		return false
+	}
+
+	if _, ok := fields.QueryName(event); !ok {
+		return false
+	}
+
+	key := f.buildKey(event, fields)
+	eventTime := event.System.TimeCreated.SystemTime
+	now := time.Now()
+
+	f.mux.Lock()
+	defer f.mux.Unlock()
+
+	agg, exists := f.aggregates[key]
+	if exists && now.Sub(agg.opened) >= f.window {
+		// The window has elapsed but has not been flushed yet
+		f.close(agg)
+		exists = false
+	}
+
+	if !exists {
+		if f.maxOpen > 0 && len(f.aggregates) >= f.maxOpen {
+			f.evictOldest()
+		}
+		agg = &Aggregate{
+			Key:       key,
+			Event:     event,
+			StartTime: eventTime,
+			EndTime:   eventTime,
+			opened:    now,
+		}
+		f.open(agg)
+	}
+
+	agg.Count++
+	if eventTime.Before(agg.StartTime) {
+		agg.StartTime = eventTime
+	}
+	if eventTime.After(agg.EndTime) {
+		agg.EndTime = eventTime
+	}
+	if result, ok := fields.Result(event); ok {
+		if code, err := strconv.Atoi(result); err == nil {
+			agg.addResponseCode(code)
+		}
+	}
+
+	return true
+}
+
+// Flush returns all aggregates whose window has closed. When force is true every
+// open aggregate is returned, which is used on shutdown.
+func (f *AggregationFilter) Flush(force bool) []*Aggregate {
+	f.mux.Lock()
+	defer f.mux.Unlock()
+
+	now := time.Now()
+	result := f.closed
+	f.closed = nil
+
+	for e := f.order.Front(); e != nil; {
+		agg := e.Value.(*Aggregate)
+		if !force && now.Sub(agg.opened) < f.window {
+			break
+		}
+		e = e.Next()
+		f.remove(agg)
+		result = append(result, agg)
+	}
+
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].StartTime.Before(result[j].StartTime)
+	})
+
+	return result
+}
+
+// GetOpenAggregates returns the number of aggregation windows currently open
+func (f *AggregationFilter) GetOpenAggregates() int {
+	f.mux.Lock()
+	defer f.mux.Unlock()
+
+	return len(f.aggregates)
+}
+
+// AggregateState is the persisted form of an open aggregate
+type AggregateState struct {
+	Key           string     `json:"key"`
+	Event         *etw.Event `json:"event"`
+	Count         int64      `json:"count"`
+	StartTime     time.Time  `json:"start_time"`
+	EndTime       time.Time  `json:"end_time"`
+	ResponseCodes []int      `json:"response_codes,omitempty"`
+	Opened        time.Time  `json:"opened"`
+}
+
+// Snapshot returns the open aggregates, including closed ones not yet flushed
+func (f *AggregationFilter) Snapshot() []AggregateState {
+	f.mux.Lock()
+	defer f.mux.Unlock()
+
+	states := make([]AggregateState, 0, len(f.aggregates)+len(f.closed))
+	for _, agg := range f.closed {
+		states = append(states, agg.state())
+	}
+	for _, agg := range f.aggregates {
+		states = append(states, agg.state())
+	}
+	return states
+}
+
+// Restore reopens persisted aggregates whose window has not yet elapsed.
+// Aggregates that cannot be reopened, because their window elapsed while the
+// receiver was stopped or the open aggregate limit is reached, are closed so
+// the next flush emits them with their counts. It returns the number of
+// aggregates reopened and closed.
+func (f *AggregationFilter) Restore(states []AggregateState) (int, int) {
+	if !f.enabled {
+		return 0, 0
+	}
+
+	f.mux.Lock()
+	defer f.mux.Unlock()
+
+	now := time.Now()
+	reopened, closed := 0, 0
+	for _, state := range states {
+		if state.Event == nil || state.Key == "" || state.Count <= 0 {
+			continue
+		}
+		agg := &Aggregate{
+			Key:           state.Key,
+			Event:         state.Event,
+			Count:         state.Count,
+			StartTime:     state.StartTime,
+			EndTime:       state.EndTime,
+			ResponseCodes: state.ResponseCodes,
+			opened:        state.Opened,
+		}
+		_, exists := f.aggregates[state.Key]
+		if exists || now.Sub(state.Opened) >= f.window || state.Opened.After(now) ||
+			(f.maxOpen > 0 && len(f.aggregates) >= f.maxOpen) {
+			f.closed = append(f.closed, agg)
+			closed++
+			continue
+		}
+		f.open(agg)
+		reopened++
+	}
+	return reopened, closed
+}
+
+// state converts an aggregate to its persisted form
+func (a *Aggregate) state() AggregateState {
+	return AggregateState{
+		Key:           a.Key,
+		Event:         a.Event,
+		Count:         a.Count,
+		StartTime:     a.StartTime,
+		EndTime:       a.EndTime,
+		ResponseCodes: append([]int(nil), a.ResponseCodes...),
+		Opened:        a.opened,
+	}
+}
+
+// open adds an aggregate, keeping the order by opened time. New aggregates
+// are the newest; restored ones may be older. Callers must hold the lock.
+func (f *AggregationFilter) open(agg *Aggregate) {
+	f.aggregates[agg.Key] = agg
+	for e := f.order.Back(); e != nil; e = e.Prev() {
+		if !e.Value.(*Aggregate).opened.After(agg.opened) {
+			agg.element = f.order.InsertAfter(agg, e)
+			return
+		}
+	}
+	agg.element = f.order.PushFront(agg)
+}
+
+// remove drops an open aggregate. Callers must hold the lock.
+func (f *AggregationFilter) remove(agg *Aggregate) {
+	f.order.Remove(agg.element)
+	agg.element = nil
+	delete(f.aggregates, agg.Key)
+}
+
+// close moves an open aggregate to the closed list for the next flush.
+// Callers must hold the lock.
+func (f *AggregationFilter) close(agg *Aggregate) {
+	f.remove(agg)
+	f.closed = append(f.closed, agg)
+}
+
+// evictOldest closes the oldest open aggregate early to respect the limit.
+// Callers must hold the lock.
+func (f *AggregationFilter) evictOldest() {
+	front := f.order.Front()
+	if front == nil {
+		return
+	}
+	oldest := front.Value.(*Aggregate)
+
+	f.logger.Debug("Closing aggregate early, open aggregate limit reached",
+		zap.String("key", oldest.Key),
+		zap.Int("maxOpenAggregates", f.maxOpen))
+
+	f.close(oldest)
+}
+
+// buildKey combines the configured key fields into an aggregation key
+func (f *AggregationFilter) buildKey(event *etw.Event, fields *FieldResolver) string {
+	// Requests and responses are always summarised separately
+	parts := []string{strconv.Itoa(int(event.System.EventID))}
+
+	for _, field := range f.keyFields {
+		switch field {
+		case AggregationKeyQueryName:
+			value, _ := fields.QueryName(event)
+			parts = append(parts, strings.ToLower(value))
+		case AggregationKeyQueryType:
+			value, _ := fields.QueryType(event)
+			parts = append(parts, value)
+		case AggregationKeyProcessID:
+			parts = append(parts, strconv.FormatUint(uint64(event.System.Execution.ProcessID), 10))
+		case AggregationKeyClientIP:
+			value, _ := fields.Client(event)
+			parts = append(parts, value)
+		case AggregationKeyRegisteredDomain:
+			value, _ := fields.RegisteredDomain(event)
+			parts = append(parts, value)
+		}
+	}
+
+	return strings.Join(parts, "|")
+}
+
+// addResponseCode records a distinct response code
+func (a *Aggregate) addResponseCode(code int) {
+	for _, existing := range a.ResponseCodes {
+		if existing == code {
+			return
+		}
+	}
+	a.ResponseCodes = append(a.ResponseCodes, code)
+}
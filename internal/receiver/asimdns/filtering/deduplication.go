@@ -37,27 +37,31 @@ func NewDeduplicationFilter(logger *zap.Logger, enabled bool, windowSeconds int)
 }
 
 // ShouldFilter checks if a query should be filtered due to deduplication
-func (f *DeduplicationFilter) ShouldFilter(event *etw.Event, getEventDataString func(*etw.Event, string) (string, bool)) bool {
+func (f *DeduplicationFilter) ShouldFilter(event *etw.Event, fields *FieldResolver) bool {
 	// If deduplication is disabled, don't filter
 	if !f.enabled {
 		return false
 	}
 	
-	// Only deduplicate query events
-	if event.System.EventID != 3006 {
+	// Only deduplicate query request events
+	if !fields.IsRequestEvent(event) {
 		return false
 	}
 	
 	// Extract the query name and type
-	queryName, nameOk := getEventDataString(event, "QueryName")
-	queryType, typeOk := getEventDataString(event, "QueryType")
+	queryName, nameOk := fields.QueryName(event)
+	queryType, typeOk := fields.QueryType(event)
 	
-	if !nameOk || !typeOk || queryName == "" {
+	if !nameOk || !typeOk {
 		return false
 	}
 	
-	// Create a cache key combining name and type
+	// Create a cache key combining name and type. A DNS Server sees many
+	// clients, so each is deduplicated separately.
 	cacheKey := fmt.Sprintf("%s:%s", queryName, queryType)
+	if client, ok := fields.Client(event); ok {
+		cacheKey += ":" + client
+	}
 	
 	// Check if this query exists in the cache
 	f.recentQueriesMux.RLock()
@@ -99,6 +103,40 @@ func (f *DeduplicationFilter) GetCacheSize() int {
 	return len(f.recentQueries)
 }
 
+// Snapshot returns a copy of the deduplication cache for persistence
+func (f *DeduplicationFilter) Snapshot() map[string]time.Time {
+	f.recentQueriesMux.RLock()
+	defer f.recentQueriesMux.RUnlock()
+	
+	entries := make(map[string]time.Time, len(f.recentQueries))
+	for k, t := range f.recentQueries {
+		entries[k] = t
+	}
+	return entries
+}
+
+// Restore loads persisted cache entries, discarding those older than the window.
+// It returns the number of entries restored.
+func (f *DeduplicationFilter) Restore(entries map[string]time.Time) int {
+	if !f.enabled {
+		return 0
+	}
+	
+	f.recentQueriesMux.Lock()
+	defer f.recentQueriesMux.Unlock()
+	
+	now := time.Now()
+	restored := 0
+	for k, t := range entries {
+		if now.Sub(t) >= f.window || t.After(now) {
+			continue
+		}
+		f.recentQueries[k] = t
+		restored++
+	}
+	return restored
+}
+
 // Cleanup performs maintenance on the deduplication cache
 func (f *DeduplicationFilter) Cleanup() {
 	f.recentQueriesMux.Lock()
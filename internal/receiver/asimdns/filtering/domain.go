@@ -6,27 +6,49 @@ package filtering
 import (
 	"github.com/0xrawsec/golang-etw/etw"
 	"go.uber.org/zap"
+	"net/netip"
 	"regexp"
 	"strings"
+
+	"github.com/LaurieRhodes/asim-dns-collector/internal/receiver/asimdns/dnsname"
 )
 
 // DomainFilter handles filtering based on domain patterns
 type DomainFilter struct {
 	logger        *zap.Logger
 	domainRegexes []*regexp.Regexp
+	// registeredDomains excludes every name under these registered domains
+	registeredDomains map[string]bool
+	// ptrNetworks excludes reverse lookups of addresses in these networks
+	ptrNetworks []netip.Prefix
 }
 
 // NewDomainFilter creates a new DomainFilter
-func NewDomainFilter(logger *zap.Logger, excludedDomains []string) *DomainFilter {
+func NewDomainFilter(logger *zap.Logger, excludedDomains []string, excludedRegisteredDomains []string, excludedPTRNetworks []string) *DomainFilter {
 	filter := &DomainFilter{
-		logger:        logger,
-		domainRegexes: make([]*regexp.Regexp, 0, len(excludedDomains)),
+		logger:            logger,
+		domainRegexes:     make([]*regexp.Regexp, 0, len(excludedDomains)),
+		registeredDomains: make(map[string]bool, len(excludedRegisteredDomains)),
+	}
+	
+	for _, domain := range excludedRegisteredDomains {
+		filter.registeredDomains[dnsname.ToASCII(domain)] = true
+	}
+	
+	// Networks are validated with the configuration; skip any that still fail
+	for _, value := range excludedPTRNetworks {
+		networks, err := dnsname.ParseNetworks([]string{value})
+		if err != nil {
+			logger.Warn("Failed to parse reverse lookup network", zap.String("network", value), zap.Error(err))
+			continue
+		}
+		filter.ptrNetworks = append(filter.ptrNetworks, networks...)
 	}
 	
 	// Compile the domain pattern regexes for efficient matching
 	for _, pattern := range excludedDomains {
-		// Convert glob pattern to regex
-		regexPattern := strings.Replace(pattern, ".", "\\.", -1)
+		// Convert glob pattern to regex, matching the normalised query name
+		regexPattern := strings.Replace(dnsname.PatternToASCII(pattern), ".", "\\.", -1)
 		regexPattern = strings.Replace(regexPattern, "*", ".*", -1)
 		regexPattern = "^" + regexPattern + "$"
 		
@@ -45,24 +67,46 @@ func NewDomainFilter(logger *zap.Logger, excludedDomains []string) *DomainFilter
 	}
 	
 	logger.Info("Domain filter initialized", 
-		zap.Int("patternCount", len(filter.domainRegexes)))
+		zap.Int("patternCount", len(filter.domainRegexes)),
+		zap.Int("registeredDomainCount", len(filter.registeredDomains)),
+		zap.Int("ptrNetworkCount", len(filter.ptrNetworks)))
 	
 	return filter
 }
 
 // ShouldFilter checks if a domain should be filtered
-func (f *DomainFilter) ShouldFilter(event *etw.Event, getEventDataString func(*etw.Event, string) (string, bool)) bool {
+func (f *DomainFilter) ShouldFilter(event *etw.Event, fields *FieldResolver) bool {
 	// If no domain regex patterns are configured, don't filter
-	if len(f.domainRegexes) == 0 {
+	if len(f.domainRegexes) == 0 && len(f.registeredDomains) == 0 && len(f.ptrNetworks) == 0 {
 		return false
 	}
 	
-	// Extract the query name from the event
-	queryName, ok := getEventDataString(event, "QueryName")
-	if !ok || queryName == "" {
+	// Extract the query name from the event (QueryName or QNAME)
+	queryName, ok := fields.QueryName(event)
+	if !ok {
 		return false
 	}
 	
+	// Check the registered domain against the excluded registered domains
+	if len(f.registeredDomains) > 0 {
+		if domain, ok := fields.RegisteredDomain(event); ok && f.registeredDomains[domain] {
+			f.logger.Debug("Filtering domain based on registered domain", 
+				zap.String("domain", queryName),
+				zap.String("registered_domain", domain))
+			return true
+		}
+	}
+	
+	// Check reverse lookup targets against the excluded networks
+	if len(f.ptrNetworks) > 0 {
+		if rev, ok := dnsname.ParseReverse(queryName); ok && rev.Within(f.ptrNetworks) {
+			f.logger.Debug("Filtering reverse lookup based on target network", 
+				zap.String("domain", queryName),
+				zap.String("target", rev.Prefix.String()))
+			return true
+		}
+	}
+	
 	// Check the domain against all regex patterns
 	for _, regex := range f.domainRegexes {
 		if regex.MatchString(queryName) {
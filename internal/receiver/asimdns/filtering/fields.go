@@ -0,0 +1,190 @@
+//go:build windows
+// +build windows
+
+package filtering
+
+import (
+	"strings"
+
+	"github.com/0xrawsec/golang-etw/etw"
+
+	"github.com/LaurieRhodes/asim-dns-collector/internal/receiver/asimdns/dnsname"
+)
+
+// Provider GUIDs recognised by the field resolver
+const (
+	DNSClientProviderGUID = "{1C95126E-7EEA-49A9-A3FE-A378B03DDB4D}"
+	DNSServerProviderGUID = "{EB79061A-A566-4698-9119-3ED2807060E7}"
+)
+
+// providerFields describes where the logical DNS fields live in a provider's event data
+type providerFields struct {
+	queryName []string
+	queryType []string
+	result    []string
+	// client holds the client address field per event ID; events not listed have no client
+	client map[uint16]string
+	// requestEvents and responseEvents identify query lifecycle events
+	requestEvents  map[uint16]bool
+	responseEvents map[uint16]bool
+	// queryTypeEvents are the events query type filtering applies to
+	queryTypeEvents map[uint16]bool
+}
+
+var clientProviderFields = providerFields{
+	queryName:      []string{"QueryName"},
+	queryType:      []string{"QueryType"},
+	result:         []string{"QueryStatus", "Status"},
+	client:         map[uint16]string{},
+	requestEvents:  map[uint16]bool{3006: true},
+	responseEvents: map[uint16]bool{3008: true},
+	// Client responses are kept so a filtered lookup still shows its outcome
+	queryTypeEvents: map[uint16]bool{3006: true},
+}
+
+var serverProviderFields = providerFields{
+	queryName: []string{"QNAME"},
+	queryType: []string{"QTYPE"},
+	result:    []string{"RCODE"},
+	client: map[uint16]string{
+		256: "Source",      // QUERY_RECEIVED
+		257: "Destination", // RESPONSE_SUCCESS
+		258: "Destination", // RESPONSE_FAILURE
+		259: "Source",      // IGNORED_QUERY
+	},
+	requestEvents:   map[uint16]bool{256: true},
+	responseEvents:  map[uint16]bool{257: true, 258: true},
+	queryTypeEvents: map[uint16]bool{256: true, 257: true, 258: true},
+}
+
+// FieldResolver resolves logical DNS fields (query name, type, client and result)
+// from an event regardless of which provider produced it
+type FieldResolver struct {
+	defaultFields        *providerFields
+	getEventDataFunc     func(*etw.Event, string) (string, bool)
+	registeredDomainFunc func(string) string
+}
+
+// NewFieldResolver creates a resolver for the configured provider. Events that
+// carry their own provider GUID are resolved using that provider's fields.
+// registeredDomainFunc returns the registered domain of a query name; when nil
+// the query name itself is used.
+func NewFieldResolver(providerGUID string, getEventDataFunc func(*etw.Event, string) (string, bool), registeredDomainFunc func(string) string) *FieldResolver {
+	resolver := &FieldResolver{
+		defaultFields:        &clientProviderFields,
+		getEventDataFunc:     getEventDataFunc,
+		registeredDomainFunc: registeredDomainFunc,
+	}
+	if strings.EqualFold(providerGUID, DNSServerProviderGUID) {
+		resolver.defaultFields = &serverProviderFields
+	}
+	return resolver
+}
+
+// fields returns the field layout for an event
+func (r *FieldResolver) fields(event *etw.Event) *providerFields {
+	switch {
+	case strings.EqualFold(event.System.Provider.Guid, DNSServerProviderGUID):
+		return &serverProviderFields
+	case strings.EqualFold(event.System.Provider.Guid, DNSClientProviderGUID):
+		return &clientProviderFields
+	default:
+		return r.defaultFields
+	}
+}
+
+// first returns the first non-empty value among candidate fields
+func (r *FieldResolver) first(event *etw.Event, candidates []string) (string, bool) {
+	for _, field := range candidates {
+		if value, ok := r.getEventDataFunc(event, field); ok && value != "" {
+			return value, true
+		}
+	}
+	return "", false
+}
+
+// QueryName returns the normalised queried name: lower case, in its ASCII
+// form and without trailing dots
+func (r *FieldResolver) QueryName(event *etw.Event) (string, bool) {
+	name, ok := r.first(event, r.fields(event).queryName)
+	if !ok {
+		return "", false
+	}
+	name = dnsname.ToASCII(name)
+	return name, name != ""
+}
+
+// RawQueryName returns the queried name as reported by the provider, before
+// normalisation, keeping the case that encoded payloads depend on
+func (r *FieldResolver) RawQueryName(event *etw.Event) (string, bool) {
+	return r.first(event, r.fields(event).queryName)
+}
+
+// RegisteredDomain returns the registered domain of the queried name
+func (r *FieldResolver) RegisteredDomain(event *etw.Event) (string, bool) {
+	name, ok := r.QueryName(event)
+	if !ok {
+		return "", false
+	}
+	if r.registeredDomainFunc == nil {
+		return name, true
+	}
+	return r.registeredDomainFunc(name), true
+}
+
+// QueryType returns the numeric query type as reported by the provider
+func (r *FieldResolver) QueryType(event *etw.Event) (string, bool) {
+	return r.first(event, r.fields(event).queryType)
+}
+
+// Client returns the client address of the query, if the event carries one
+func (r *FieldResolver) Client(event *etw.Event) (string, bool) {
+	field, ok := r.fields(event).client[event.System.EventID]
+	if !ok {
+		return "", false
+	}
+	return r.first(event, []string{field})
+}
+
+// Result returns the response status or RCODE of the event
+func (r *FieldResolver) Result(event *etw.Event) (string, bool) {
+	return r.first(event, r.fields(event).result)
+}
+
+// IsRequestEvent reports whether the event is a query request
+func (r *FieldResolver) IsRequestEvent(event *etw.Event) bool {
+	return r.fields(event).requestEvents[event.System.EventID]
+}
+
+// IsResponseEvent reports whether the event is a query response
+func (r *FieldResolver) IsResponseEvent(event *etw.Event) bool {
+	return r.fields(event).responseEvents[event.System.EventID]
+}
+
+// IsQueryEvent reports whether the event is a query request or response
+func (r *FieldResolver) IsQueryEvent(event *etw.Event) bool {
+	return r.IsRequestEvent(event) || r.IsResponseEvent(event)
+}
+
+// IsQueryTypeEvent reports whether query type filtering applies to the event:
+// DNS Client query requests, and DNS Server query requests and responses
+func (r *FieldResolver) IsQueryTypeEvent(event *etw.Event) bool {
+	return r.fields(event).queryTypeEvents[event.System.EventID]
+}
+
+// QueryEventIDs returns the request and response event IDs of a provider
+func QueryEventIDs(providerGUID string) []uint16 {
+	layout := &clientProviderFields
+	if strings.EqualFold(providerGUID, DNSServerProviderGUID) {
+		layout = &serverProviderFields
+	}
+	
+	ids := make([]uint16, 0, len(layout.requestEvents)+len(layout.responseEvents))
+	for id := range layout.requestEvents {
+		ids = append(ids, id)
+	}
+	for id := range layout.responseEvents {
+		ids = append(ids, id)
+	}
+	return ids
+}
@@ -24,13 +24,15 @@ type FilterManager struct {
 	domainFilter       *DomainFilter
 	queryTypeFilter    *QueryTypeFilter
 	deduplicationFilter *DeduplicationFilter
+	aggregationFilter  *AggregationFilter
 	
 	// Counters for monitoring
 	totalEvents        int64
 	filteredEvents     int64
+	aggregatedEvents   int64
 	
-	// Function for accessing event data
-	getEventDataFunc   func(*etw.Event, string) (string, bool)
+	// Resolves logical DNS fields for the configured provider
+	fields             *FieldResolver
 	
 	// Function for getting event type and subtype
 	getEventTypeFunc   func(uint16) (string, string)
@@ -43,24 +45,39 @@ type FilterManager struct {
 // NewFilterManager creates a new filter manager
 func NewFilterManager(
 	logger *zap.Logger, 
+	providerGUID string,
 	includeInfoEvents bool, 
 	excludedEventIDs []uint16,
 	excludedDomains []string,
+	excludedRegisteredDomains []string,
+	excludedPTRNetworks []string,
 	excludeAAAARecords bool,
 	enableDeduplication bool,
 	deduplicationWindow int,
+	deduplicationMode string,
+	aggregationWindow int,
+	aggregationKeyFields []string,
+	maxOpenAggregates int,
 	getEventDataFunc func(*etw.Event, string) (string, bool),
-	getEventTypeFunc func(uint16) (string, string)) *FilterManager {
+	getEventTypeFunc func(uint16) (string, string),
+	registeredDomainFunc func(string) string) *FilterManager {
+	
+	// In aggregate mode repeated queries are summarised instead of dropped
+	enableAggregation := enableDeduplication && deduplicationMode == DeduplicationModeAggregate
+	if enableAggregation {
+		enableDeduplication = false
+	}
 	
 	manager := &FilterManager{
 		logger:             logger,
 		eventTypeFilter:    NewEventTypeFilter(logger, includeInfoEvents, excludedEventIDs),
-		domainFilter:       NewDomainFilter(logger, excludedDomains),
+		domainFilter:       NewDomainFilter(logger, excludedDomains, excludedRegisteredDomains, excludedPTRNetworks),
 		queryTypeFilter:    NewQueryTypeFilter(logger, excludeAAAARecords),
 		deduplicationFilter: NewDeduplicationFilter(logger, enableDeduplication, deduplicationWindow),
+		aggregationFilter:  NewAggregationFilter(logger, enableAggregation, aggregationWindow, aggregationKeyFields, maxOpenAggregates),
 		totalEvents:        0,
 		filteredEvents:     0,
-		getEventDataFunc:   getEventDataFunc,
+		fields:             NewFieldResolver(providerGUID, getEventDataFunc, registeredDomainFunc),
 		getEventTypeFunc:   getEventTypeFunc,
 		eventTypeCache:     make(map[uint16]EventTypeMapping),
 	}
@@ -101,28 +118,39 @@ func (fm *FilterManager) ShouldFilter(event *etw.Event) bool {
 		return true
 	}
 	
-	// 2. Domain Filtering for query events
-	if (eventID == 3006 || eventID == 3008) && fm.domainFilter.ShouldFilter(event, fm.getEventDataFunc) {
+	// 2. Domain Filtering for any event carrying a query name
+	if fm.domainFilter.ShouldFilter(event, fm.fields) {
 		atomic.AddInt64(&fm.filteredEvents, 1)
 		return true
 	}
 	
 	// 3. AAAA Record Filtering
-	if fm.queryTypeFilter.ShouldFilter(event, fm.getEventDataFunc) {
+	if fm.queryTypeFilter.ShouldFilter(event, fm.fields) {
 		atomic.AddInt64(&fm.filteredEvents, 1)
 		return true
 	}
 	
 	// 4. Query Deduplication
-	if fm.deduplicationFilter.ShouldFilter(event, fm.getEventDataFunc) {
+	if fm.deduplicationFilter.ShouldFilter(event, fm.fields) {
 		atomic.AddInt64(&fm.filteredEvents, 1)
 		return true
 	}
 	
+	// 5. Query Aggregation - absorbed events are emitted later as summaries
+	if fm.aggregationFilter.ShouldFilter(event, fm.fields) {
+		atomic.AddInt64(&fm.aggregatedEvents, 1)
+		return true
+	}
+	
 	// If we reach here, the event should not be filtered
 	return false
 }
 
+// RecordBypass counts an event that skipped filtering, such as a threat intelligence match
+func (fm *FilterManager) RecordBypass() {
+	atomic.AddInt64(&fm.totalEvents, 1)
+}
+
 // getEventTypeWithCache retrieves event type with caching
 func (fm *FilterManager) getEventTypeWithCache(eventID uint16) (string, string) {
 	// Try to get from cache first
@@ -148,6 +176,11 @@ func (fm *FilterManager) getEventTypeWithCache(eventID uint16) (string, string)
 	return eventType, eventSubType
 }
 
+// Fields returns the resolver used to read logical DNS fields from events
+func (fm *FilterManager) Fields() *FieldResolver {
+	return fm.fields
+}
+
 // GetTotalEvents returns the total number of events processed
 func (fm *FilterManager) GetTotalEvents() int64 {
 	return atomic.LoadInt64(&fm.totalEvents)
@@ -158,6 +191,17 @@ func (fm *FilterManager) GetFilteredEvents() int64 {
 	return atomic.LoadInt64(&fm.filteredEvents)
 }
 
+// GetAggregatedEvents returns the number of events absorbed into aggregates
+func (fm *FilterManager) GetAggregatedEvents() int64 {
+	return atomic.LoadInt64(&fm.aggregatedEvents)
+}
+
+// FlushAggregates returns aggregates whose window has closed, or all open
+// aggregates when force is true
+func (fm *FilterManager) FlushAggregates(force bool) []*Aggregate {
+	return fm.aggregationFilter.Flush(force)
+}
+
 // GetFilterPercentage returns the percentage of events filtered
 func (fm *FilterManager) GetFilterPercentage() float64 {
 	total := atomic.LoadInt64(&fm.totalEvents)
@@ -0,0 +1,436 @@
+//go:build windows
+// +build windows
+
+package filtering
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/0xrawsec/golang-etw/etw"
+	"go.uber.org/zap"
+)
+
+func getTestEventData(event *etw.Event, key string) (string, bool) {
+	value, ok := event.EventData[key].(string)
+	return value, ok
+}
+
+func getTestEventType(eventID uint16) (string, string) {
+	switch eventID {
+	case 256, 3006:
+		return "Query", "request"
+	case 257, 258, 3008:
+		return "Query", "response"
+	default:
+		return "Info", "status"
+	}
+}
+
+func newTestEvent(providerGUID string, eventID uint16, data map[string]string) *etw.Event {
+	event := etw.NewEvent()
+	event.System.Provider.Guid = providerGUID
+	event.System.EventID = eventID
+	event.System.TimeCreated.SystemTime = time.Now()
+	for k, v := range data {
+		event.EventData[k] = v
+	}
+	return event
+}
+
+func newTestManager(providerGUID string, excludedDomains []string, excludeAAAA bool, dedup bool, mode string, keyFields []string) *FilterManager {
+	return NewFilterManager(zap.NewNop(), providerGUID, true, nil, excludedDomains, nil, nil, excludeAAAA,
+		dedup, 300, mode, 300, keyFields, 100, getTestEventData, getTestEventType, nil)
+}
+
+func TestServerDomainExclusion(t *testing.T) {
+	fm := newTestManager(DNSServerProviderGUID, []string{"*.opinsights.azure.com", "wpad.*"}, false, false, DeduplicationModeDrop, nil)
+
+	tests := []struct {
+		eventID uint16
+		qname   string
+		want    bool
+	}{
+		{256, "abc.ods.opinsights.azure.com.", true},
+		{257, "abc.ods.opinsights.azure.com.", true},
+		{260, "wpad.corp.local.", true},
+		{256, "example.com.", false},
+	}
+
+	for _, tt := range tests {
+		event := newTestEvent(DNSServerProviderGUID, tt.eventID, map[string]string{"QNAME": tt.qname, "QTYPE": "1"})
+		if got := fm.ShouldFilter(event); got != tt.want {
+			t.Errorf("event %d %q: ShouldFilter = %v, want %v", tt.eventID, tt.qname, got, tt.want)
+		}
+	}
+}
+
+func TestServerRegisteredDomainExclusion(t *testing.T) {
+	lastTwo := func(name string) string {
+		labels := strings.Split(strings.ToLower(name), ".")
+		if len(labels) <= 2 {
+			return strings.Join(labels, ".")
+		}
+		return strings.Join(labels[len(labels)-2:], ".")
+	}
+	fm := NewFilterManager(zap.NewNop(), DNSServerProviderGUID, true, nil, nil, []string{"Contoso.com"}, nil, false,
+		false, 300, DeduplicationModeDrop, 300, nil, 100, getTestEventData, getTestEventType, lastTwo)
+
+	tests := []struct {
+		qname string
+		want  bool
+	}{
+		{"contoso.com.", true},
+		{"a.b.CONTOSO.com.", true},
+		{"notcontoso.com.", false},
+		{"contoso.com.example.", false},
+	}
+
+	for _, tt := range tests {
+		event := newTestEvent(DNSServerProviderGUID, 256, map[string]string{"QNAME": tt.qname, "QTYPE": "1"})
+		if got := fm.ShouldFilter(event); got != tt.want {
+			t.Errorf("%q: ShouldFilter = %v, want %v", tt.qname, got, tt.want)
+		}
+	}
+}
+
+func TestServerPTRNetworkExclusion(t *testing.T) {
+	fm := NewFilterManager(zap.NewNop(), DNSServerProviderGUID, true, nil, nil, nil, []string{"10.0.0.0/8", "fd00::/8"}, false,
+		false, 300, DeduplicationModeDrop, 300, nil, 100, getTestEventData, getTestEventType, nil)
+
+	tests := []struct {
+		qname string
+		want  bool
+	}{
+		{"4.3.2.10.in-addr.arpa.", true},
+		{"3.2.10.IN-ADDR.ARPA.", true},
+		{"1.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.d.f.ip6.arpa.", true},
+		{"7.113.0.203.in-addr.arpa.", false},
+		{"300.2.10.in-addr.arpa.", false},
+		{"10.example.com.", false},
+	}
+
+	for _, tt := range tests {
+		event := newTestEvent(DNSServerProviderGUID, 256, map[string]string{"QNAME": tt.qname, "QTYPE": "12"})
+		if got := fm.ShouldFilter(event); got != tt.want {
+			t.Errorf("%q: ShouldFilter = %v, want %v", tt.qname, got, tt.want)
+		}
+	}
+}
+
+func TestServerDeduplication(t *testing.T) {
+	fm := newTestManager(DNSServerProviderGUID, nil, false, true, DeduplicationModeDrop, nil)
+
+	query := map[string]string{"QNAME": "example.com.", "QTYPE": "1", "Source": "10.0.0.5"}
+	if fm.ShouldFilter(newTestEvent(DNSServerProviderGUID, 256, query)) {
+		t.Fatal("first query must not be filtered")
+	}
+	if !fm.ShouldFilter(newTestEvent(DNSServerProviderGUID, 256, query)) {
+		t.Error("repeated query within the window must be filtered")
+	}
+
+	other := map[string]string{"QNAME": "example.com.", "QTYPE": "28", "Source": "10.0.0.5"}
+	if fm.ShouldFilter(newTestEvent(DNSServerProviderGUID, 256, other)) {
+		t.Error("query with a different type must not be filtered")
+	}
+
+	response := map[string]string{"QNAME": "example.com.", "QTYPE": "1", "RCODE": "0", "Destination": "10.0.0.5"}
+	if fm.ShouldFilter(newTestEvent(DNSServerProviderGUID, 257, response)) {
+		t.Error("responses must not be deduplicated")
+	}
+}
+
+func TestServerDeduplicationPerClient(t *testing.T) {
+	fm := newTestManager(DNSServerProviderGUID, nil, false, true, DeduplicationModeDrop, nil)
+
+	for _, client := range []string{"10.0.0.5", "10.0.0.6"} {
+		query := map[string]string{"QNAME": "example.com.", "QTYPE": "1", "Source": client}
+		if fm.ShouldFilter(newTestEvent(DNSServerProviderGUID, 256, query)) {
+			t.Errorf("first query from %s must not be filtered", client)
+		}
+	}
+	query := map[string]string{"QNAME": "example.com.", "QTYPE": "1", "Source": "10.0.0.6"}
+	if !fm.ShouldFilter(newTestEvent(DNSServerProviderGUID, 256, query)) {
+		t.Error("repeated query from the same client must be filtered")
+	}
+}
+
+func TestQueryNameNormalisation(t *testing.T) {
+	fm := newTestManager(DNSServerProviderGUID, []string{"*.Microsoft.com", "*.bücher.de"}, false, true, DeduplicationModeDrop, nil)
+
+	excluded := []string{"WWW.MICROSOFT.COM.", "shop.xn--bcher-kva.de.", "shop.Bücher.de"}
+	for _, qname := range excluded {
+		event := newTestEvent(DNSServerProviderGUID, 256, map[string]string{"QNAME": qname, "QTYPE": "1"})
+		if !fm.ShouldFilter(event) {
+			t.Errorf("%q: not excluded", qname)
+		}
+	}
+
+	// Case, trailing dots and NULs do not make a query distinct
+	if fm.ShouldFilter(newTestEvent(DNSServerProviderGUID, 256, map[string]string{"QNAME": "Example.com.", "QTYPE": "1"})) {
+		t.Fatal("first query must not be filtered")
+	}
+	for _, qname := range []string{"example.com", "EXAMPLE.COM.", "example.com\x00"} {
+		if !fm.ShouldFilter(newTestEvent(DNSServerProviderGUID, 256, map[string]string{"QNAME": qname, "QTYPE": "1"})) {
+			t.Errorf("%q: not deduplicated with Example.com.", qname)
+		}
+	}
+}
+
+func TestServerAAAAFiltering(t *testing.T) {
+	fm := newTestManager(DNSServerProviderGUID, nil, true, false, DeduplicationModeDrop, nil)
+
+	if !fm.ShouldFilter(newTestEvent(DNSServerProviderGUID, 256, map[string]string{"QNAME": "example.com.", "QTYPE": "28"})) {
+		t.Error("AAAA query must be filtered")
+	}
+	if fm.ShouldFilter(newTestEvent(DNSServerProviderGUID, 256, map[string]string{"QNAME": "example.com.", "QTYPE": "1"})) {
+		t.Error("A query must not be filtered")
+	}
+	if !fm.ShouldFilter(newTestEvent(DNSServerProviderGUID, 257, map[string]string{"QNAME": "example.com.", "QTYPE": "28"})) {
+		t.Error("AAAA response must be filtered")
+	}
+}
+
+func TestClientAAAAFiltering(t *testing.T) {
+	fm := newTestManager(DNSClientProviderGUID, nil, true, false, DeduplicationModeDrop, nil)
+
+	if !fm.ShouldFilter(newTestEvent(DNSClientProviderGUID, 3006, map[string]string{"QueryName": "example.com", "QueryType": "28"})) {
+		t.Error("AAAA query must be filtered")
+	}
+	if fm.ShouldFilter(newTestEvent(DNSClientProviderGUID, 3008, map[string]string{"QueryName": "example.com", "QueryType": "28", "QueryStatus": "0"})) {
+		t.Error("AAAA query completion must not be filtered")
+	}
+}
+
+func TestServerAggregationByClient(t *testing.T) {
+	fm := newTestManager(DNSServerProviderGUID, nil, false, true, DeduplicationModeAggregate,
+		[]string{AggregationKeyQueryName, AggregationKeyClientIP})
+
+	for _, client := range []string{"10.0.0.5", "10.0.0.5", "10.0.0.6"} {
+		event := newTestEvent(DNSServerProviderGUID, 256, map[string]string{"QNAME": "Example.com.", "QTYPE": "1", "Source": client})
+		if !fm.ShouldFilter(event) {
+			t.Fatalf("query from %s must be absorbed into an aggregate", client)
+		}
+	}
+	for _, rcode := range []string{"0", "3"} {
+		event := newTestEvent(DNSServerProviderGUID, 257, map[string]string{"QNAME": "example.com.", "QTYPE": "1", "RCODE": rcode, "Destination": "10.0.0.5"})
+		fm.ShouldFilter(event)
+	}
+
+	aggregates := fm.FlushAggregates(true)
+	if len(aggregates) != 3 {
+		t.Fatalf("expected 3 aggregates, got %d", len(aggregates))
+	}
+
+	counts := map[string]int64{}
+	for _, agg := range aggregates {
+		counts[agg.Key] = agg.Count
+		if agg.Key == "257|example.com|10.0.0.5" && len(agg.ResponseCodes) != 2 {
+			t.Errorf("expected 2 distinct response codes, got %v", agg.ResponseCodes)
+		}
+	}
+	if counts["256|example.com|10.0.0.5"] != 2 || counts["256|example.com|10.0.0.6"] != 1 {
+		t.Errorf("unexpected aggregate counts: %v", counts)
+	}
+}
+
+func TestClientFilteringUnchanged(t *testing.T) {
+	fm := newTestManager(DNSClientProviderGUID, []string{"*.windows.com"}, false, true, DeduplicationModeDrop, nil)
+
+	if !fm.ShouldFilter(newTestEvent(DNSClientProviderGUID, 3008, map[string]string{"QueryName": "update.windows.com", "QueryType": "1"})) {
+		t.Error("excluded client domain must be filtered")
+	}
+
+	query := map[string]string{"QueryName": "example.com", "QueryType": "1"}
+	if fm.ShouldFilter(newTestEvent(DNSClientProviderGUID, 3006, query)) {
+		t.Fatal("first client query must not be filtered")
+	}
+	if !fm.ShouldFilter(newTestEvent(DNSClientProviderGUID, 3006, query)) {
+		t.Error("repeated client query must be filtered")
+	}
+}
+
+// newStateManager creates a manager that aggregates DNS Server queries
+func newStateManager() *FilterManager {
+	return newTestManager(DNSServerProviderGUID, nil, false, true, DeduplicationModeAggregate, nil)
+}
+
+func TestStateRoundTrip(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "state", "filter_state.json")
+	saved := newStateManager()
+	for i := 0; i < 3; i++ {
+		saved.ShouldFilter(newTestEvent(DNSServerProviderGUID, 256, map[string]string{"QNAME": "example.com.", "QTYPE": "1"}))
+	}
+	if err := saved.SaveState(path); err != nil {
+		t.Fatalf("SaveState: %v", err)
+	}
+
+	loaded := newStateManager()
+	if err := loaded.LoadState(path); err != nil {
+		t.Fatalf("LoadState: %v", err)
+	}
+	if got := loaded.aggregationFilter.GetOpenAggregates(); got != 1 {
+		t.Fatalf("expected the open aggregate to be reopened, got %d", got)
+	}
+	loaded.ShouldFilter(newTestEvent(DNSServerProviderGUID, 256, map[string]string{"QNAME": "example.com.", "QTYPE": "1"}))
+	aggregates := loaded.FlushAggregates(true)
+	if len(aggregates) != 1 || aggregates[0].Count != 4 {
+		t.Errorf("restored aggregate must continue counting, got %+v", aggregates)
+	}
+
+	if err := newStateManager().LoadState(filepath.Join(t.TempDir(), "missing.json")); err != nil {
+		t.Errorf("a missing state file must not be an error: %v", err)
+	}
+}
+
+func TestStateRejectsBadSnapshots(t *testing.T) {
+	dir := t.TempDir()
+	valid := filepath.Join(dir, "valid.json")
+	saved := newStateManager()
+	saved.ShouldFilter(newTestEvent(DNSServerProviderGUID, 256, map[string]string{"QNAME": "example.com.", "QTYPE": "1"}))
+	if err := saved.SaveState(valid); err != nil {
+		t.Fatalf("SaveState: %v", err)
+	}
+	data, err := os.ReadFile(valid)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var state filterState
+	if err := json.Unmarshal(data, &state); err != nil {
+		t.Fatal(err)
+	}
+	state.Version = stateVersion + 1
+	wrongVersion, _ := json.Marshal(state)
+
+	for name, content := range map[string][]byte{
+		"truncated":     data[:len(data)/2],
+		"garbage":       []byte("\x00\x01not json"),
+		"wrong version": wrongVersion,
+	} {
+		path := filepath.Join(dir, strings.ReplaceAll(name, " ", "_")+".json")
+		if err := os.WriteFile(path, content, 0o644); err != nil {
+			t.Fatal(err)
+		}
+		fm := newStateManager()
+		if err := fm.LoadState(path); err == nil {
+			t.Errorf("%s: expected an error", name)
+		}
+		if open := fm.aggregationFilter.GetOpenAggregates(); open != 0 || len(fm.FlushAggregates(true)) != 0 {
+			t.Errorf("%s: state modified by a rejected snapshot", name)
+		}
+	}
+}
+
+func TestStateEmitsWindowsClosedDuringDowntime(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "filter_state.json")
+	saved := newStateManager()
+	for _, rcode := range []string{"0", "0", "3"} {
+		saved.ShouldFilter(newTestEvent(DNSServerProviderGUID, 257, map[string]string{"QNAME": "example.com.", "QTYPE": "1", "RCODE": rcode}))
+	}
+	if err := saved.SaveState(path); err != nil {
+		t.Fatalf("SaveState: %v", err)
+	}
+
+	// Age the snapshot as if the collector had been stopped for two windows
+	data, _ := os.ReadFile(path)
+	var state filterState
+	if err := json.Unmarshal(data, &state); err != nil {
+		t.Fatal(err)
+	}
+	for i := range state.Aggregates {
+		state.Aggregates[i].Opened = state.Aggregates[i].Opened.Add(-600 * time.Second)
+	}
+	data, _ = json.Marshal(state)
+	if err := os.WriteFile(path, data, 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	loaded := newStateManager()
+	if err := loaded.LoadState(path); err != nil {
+		t.Fatalf("LoadState: %v", err)
+	}
+	if open := loaded.aggregationFilter.GetOpenAggregates(); open != 0 {
+		t.Errorf("an elapsed window must not be reopened, %d open", open)
+	}
+	aggregates := loaded.FlushAggregates(false)
+	if len(aggregates) != 1 || aggregates[0].Count != 3 || len(aggregates[0].ResponseCodes) != 2 {
+		t.Errorf("elapsed window must be emitted with its counts, got %+v", aggregates)
+	}
+}
+
+func serverQuery(name, rcode string) *etw.Event {
+	data := map[string]string{"QNAME": name, "QTYPE": "1"}
+	eventID := uint16(256)
+	if rcode != "" {
+		data["RCODE"] = rcode
+		eventID = 257
+	}
+	return newTestEvent(DNSServerProviderGUID, eventID, data)
+}
+
+func TestAggregationWindowExpiry(t *testing.T) {
+	fields := NewFieldResolver(DNSServerProviderGUID, getTestEventData, nil)
+	f := NewAggregationFilter(zap.NewNop(), true, 300, nil, 100)
+
+	f.ShouldFilter(serverQuery("old.example.", ""), fields)
+	f.ShouldFilter(serverQuery("old.example.", ""), fields)
+	f.ShouldFilter(serverQuery("new.example.", ""), fields)
+	if flushed := f.Flush(false); len(flushed) != 0 {
+		t.Fatalf("open windows must not be flushed, got %d", len(flushed))
+	}
+
+	// Age the first window past its end
+	f.aggregates["256|old.example|1"].opened = time.Now().Add(-301 * time.Second)
+	flushed := f.Flush(false)
+	if len(flushed) != 1 || flushed[0].Key != "256|old.example|1" || flushed[0].Count != 2 {
+		t.Fatalf("expected the elapsed window with 2 events, got %+v", flushed)
+	}
+
+	// A query arriving after the window closed opens a new one
+	f.aggregates["256|new.example|1"].opened = time.Now().Add(-301 * time.Second)
+	f.ShouldFilter(serverQuery("new.example.", ""), fields)
+	flushed = f.Flush(false)
+	if len(flushed) != 1 || flushed[0].Count != 1 || f.GetOpenAggregates() != 1 {
+		t.Errorf("expected the elapsed window closed and a new one open, got %+v", flushed)
+	}
+}
+
+func TestAggregationMaxOpenEviction(t *testing.T) {
+	fields := NewFieldResolver(DNSServerProviderGUID, getTestEventData, nil)
+	f := NewAggregationFilter(zap.NewNop(), true, 300, nil, 2)
+
+	for _, name := range []string{"a.example.", "b.example.", "a.example.", "c.example."} {
+		f.ShouldFilter(serverQuery(name, ""), fields)
+	}
+	if open := f.GetOpenAggregates(); open != 2 {
+		t.Fatalf("expected 2 open aggregates, got %d", open)
+	}
+	flushed := f.Flush(false)
+	if len(flushed) != 1 || flushed[0].Key != "256|a.example|1" || flushed[0].Count != 2 {
+		t.Errorf("expected the oldest aggregate closed early, got %+v", flushed)
+	}
+	if _, ok := f.aggregates["256|c.example|1"]; !ok {
+		t.Error("the newest aggregate must stay open")
+	}
+}
+
+func TestAggregationResponseCodes(t *testing.T) {
+	fields := NewFieldResolver(DNSServerProviderGUID, getTestEventData, nil)
+	f := NewAggregationFilter(zap.NewNop(), true, 300, nil, 100)
+
+	for _, rcode := range []string{"0", "3", "0", "2", "3"} {
+		f.ShouldFilter(serverQuery("example.com.", rcode), fields)
+	}
+	flushed := f.Flush(true)
+	if len(flushed) != 1 || flushed[0].Count != 5 {
+		t.Fatalf("expected one aggregate of 5 responses, got %+v", flushed)
+	}
+	codes := flushed[0].ResponseCodes
+	if len(codes) != 3 || codes[0] != 0 || codes[1] != 3 || codes[2] != 2 {
+		t.Errorf("expected distinct response codes [0 3 2], got %v", codes)
+	}
+}
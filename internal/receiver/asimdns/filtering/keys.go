@@ -0,0 +1,31 @@
+package filtering
+
+// The aggregation key fields are defined without a build constraint so the
+// receiver configuration can validate them on every platform.
+
+// Aggregation key fields
+const (
+	AggregationKeyQueryName = "query_name"
+	AggregationKeyQueryType = "query_type"
+	AggregationKeyProcessID = "process_id"
+	AggregationKeyClientIP  = "client_ip"
+	// AggregationKeyRegisteredDomain summarises all names under one registered domain
+	AggregationKeyRegisteredDomain = "registered_domain"
+)
+
+// DefaultAggregationKeyFields are used when no key fields are configured
+var DefaultAggregationKeyFields = []string{AggregationKeyQueryName, AggregationKeyQueryType}
+
+// DefaultServerAggregationKeyFields are used for the DNS Server when no key
+// fields are configured. A server answers many clients, so each is summarised
+// separately.
+var DefaultServerAggregationKeyFields = []string{AggregationKeyQueryName, AggregationKeyQueryType, AggregationKeyClientIP}
+
+// ValidAggregationKeyField reports whether a key field name is supported
+func ValidAggregationKeyField(field string) bool {
+	switch field {
+	case AggregationKeyQueryName, AggregationKeyQueryType, AggregationKeyProcessID, AggregationKeyClientIP, AggregationKeyRegisteredDomain:
+		return true
+	}
+	return false
+}
@@ -8,6 +8,7 @@
 // 2. DomainFilter: Filters based on domain patterns
 // 3. QueryTypeFilter: Filters specific DNS query types (e.g., AAAA records)
 // 4. DeduplicationFilter: Deduplicates repeated queries in a time window
+// 5. AggregationFilter: Summarises repeated queries into one record per time window
 //
 // The FilterManager orchestrates these components and provides a unified interface.
 package filtering
@@ -28,19 +28,19 @@ func NewQueryTypeFilter(logger *zap.Logger, excludeAAAARecords bool) *QueryTypeF
 }
 
 // ShouldFilter checks if a query should be filtered based on type
-func (f *QueryTypeFilter) ShouldFilter(event *etw.Event, getEventDataString func(*etw.Event, string) (string, bool)) bool {
+func (f *QueryTypeFilter) ShouldFilter(event *etw.Event, fields *FieldResolver) bool {
 	// If AAAA record filtering is disabled, don't filter
 	if !f.excludeAAAARecords {
 		return false
 	}
 	
-	// Check if it's a query event
-	if event.System.EventID != 3006 {
+	// Only DNS Client requests and DNS Server requests and responses are filtered
+	if !fields.IsQueryTypeEvent(event) {
 		return false
 	}
 	
-	// Extract the query type from the event
-	queryType, ok := getEventDataString(event, "QueryType")
+	// Extract the query type from the event (QueryType or QTYPE)
+	queryType, ok := fields.QueryType(event)
 	if !ok {
 		return false
 	}
@@ -49,7 +49,7 @@ func (f *QueryTypeFilter) ShouldFilter(event *etw.Event, getEventDataString func
 	isAAAA := queryType == "28"
 	
 	if isAAAA {
-		queryName, nameOk := getEventDataString(event, "QueryName")
+		queryName, nameOk := fields.QueryName(event)
 		dnsName := "<unknown>"
 		if nameOk {
 			dnsName = queryName
@@ -0,0 +1,107 @@
+//go:build windows
+// +build windows
+
+package filtering
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// stateVersion is incremented whenever the snapshot format changes.
+// Snapshots written by a different version are ignored.
+const stateVersion = 1
+
+// filterState is the on-disk snapshot of deduplication and aggregation state
+type filterState struct {
+	Version       int                  `json:"version"`
+	SavedAt       time.Time            `json:"saved_at"`
+	Deduplication map[string]time.Time `json:"deduplication"`
+	Aggregates    []AggregateState     `json:"aggregates"`
+}
+
+// SaveState writes the deduplication and aggregation state to path. The file is
+// written to a temporary file first and renamed so a crash never leaves a partial snapshot.
+func (fm *FilterManager) SaveState(path string) error {
+	state := filterState{
+		Version:       stateVersion,
+		SavedAt:       time.Now().UTC(),
+		Deduplication: fm.deduplicationFilter.Snapshot(),
+		Aggregates:    fm.aggregationFilter.Snapshot(),
+	}
+
+	data, err := json.Marshal(state)
+	if err != nil {
+		return fmt.Errorf("failed to encode filter state: %w", err)
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return fmt.Errorf("failed to create state directory: %w", err)
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".tmp*")
+	if err != nil {
+		return fmt.Errorf("failed to create state file: %w", err)
+	}
+	tmpName := tmp.Name()
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		os.Remove(tmpName)
+		return fmt.Errorf("failed to write state file: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmpName)
+		return fmt.Errorf("failed to write state file: %w", err)
+	}
+	if err := os.Rename(tmpName, path); err != nil {
+		os.Remove(tmpName)
+		return fmt.Errorf("failed to replace state file: %w", err)
+	}
+
+	fm.logger.Debug("Saved filter state",
+		zap.String("path", path),
+		zap.Int("deduplicationEntries", len(state.Deduplication)),
+		zap.Int("aggregates", len(state.Aggregates)))
+
+	return nil
+}
+
+// LoadState restores deduplication and aggregation state from path. Aggregates
+// whose window elapsed while the receiver was stopped are emitted at the next
+// flush. A missing file is not an error. Corrupt or version-mismatched snapshots are rejected
+// without modifying the current state.
+func (fm *FilterManager) LoadState(path string) error {
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to read state file: %w", err)
+	}
+
+	var state filterState
+	if err := json.Unmarshal(data, &state); err != nil {
+		return fmt.Errorf("ignoring corrupt state file: %w", err)
+	}
+	if state.Version != stateVersion {
+		return fmt.Errorf("ignoring state file with version %d, expected %d", state.Version, stateVersion)
+	}
+
+	dedupRestored := fm.deduplicationFilter.Restore(state.Deduplication)
+	aggReopened, aggClosed := fm.aggregationFilter.Restore(state.Aggregates)
+
+	fm.logger.Info("Restored filter state",
+		zap.String("path", path),
+		zap.Time("savedAt", state.SavedAt),
+		zap.Int("deduplicationEntries", dedupRestored),
+		zap.Int("aggregates", aggReopened),
+		zap.Int("closedAggregates", aggClosed))
+
+	return nil
+}
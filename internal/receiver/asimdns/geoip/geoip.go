@@ -0,0 +1,143 @@
+// Package geoip enriches IP addresses with location and autonomous system
+// details from MaxMind-format City and ASN databases on local disk. Private
+// and reserved ranges are labelled by scope and never looked up.
+package geoip
+
+import (
+	"net/netip"
+)
+
+// Address scopes. Only public addresses are looked up in the databases.
+const (
+	ScopePublic        = "public"
+	ScopePrivate       = "private"
+	ScopeLoopback      = "loopback"
+	ScopeLinkLocal     = "link_local"
+	ScopeShared        = "shared"
+	ScopeMulticast     = "multicast"
+	ScopeDocumentation = "documentation"
+	ScopeReserved      = "reserved"
+)
+
+// scopeRanges are the special-purpose ranges checked in order
+var scopeRanges = []struct {
+	prefix netip.Prefix
+	scope  string
+}{
+	{netip.MustParsePrefix("10.0.0.0/8"), ScopePrivate},
+	{netip.MustParsePrefix("172.16.0.0/12"), ScopePrivate},
+	{netip.MustParsePrefix("192.168.0.0/16"), ScopePrivate},
+	{netip.MustParsePrefix("fc00::/7"), ScopePrivate},
+	{netip.MustParsePrefix("127.0.0.0/8"), ScopeLoopback},
+	{netip.MustParsePrefix("::1/128"), ScopeLoopback},
+	{netip.MustParsePrefix("169.254.0.0/16"), ScopeLinkLocal},
+	{netip.MustParsePrefix("fe80::/10"), ScopeLinkLocal},
+	{netip.MustParsePrefix("100.64.0.0/10"), ScopeShared},
+	{netip.MustParsePrefix("224.0.0.0/4"), ScopeMulticast},
+	{netip.MustParsePrefix("ff00::/8"), ScopeMulticast},
+	{netip.MustParsePrefix("192.0.2.0/24"), ScopeDocumentation},
+	{netip.MustParsePrefix("198.51.100.0/24"), ScopeDocumentation},
+	{netip.MustParsePrefix("203.0.113.0/24"), ScopeDocumentation},
+	{netip.MustParsePrefix("2001:db8::/32"), ScopeDocumentation},
+	{netip.MustParsePrefix("0.0.0.0/8"), ScopeReserved},
+	{netip.MustParsePrefix("192.0.0.0/24"), ScopeReserved},
+	{netip.MustParsePrefix("198.18.0.0/15"), ScopeReserved},
+	{netip.MustParsePrefix("240.0.0.0/4"), ScopeReserved},
+	{netip.MustParsePrefix("::/128"), ScopeReserved},
+	{netip.MustParsePrefix("100::/64"), ScopeReserved},
+}
+
+// Scope classifies an address as public or one of the special-purpose ranges
+func Scope(addr netip.Addr) string {
+	addr = addr.Unmap()
+	for _, r := range scopeRanges {
+		if r.prefix.Contains(addr) {
+			return r.scope
+		}
+	}
+	return ScopePublic
+}
+
+// PrefixScope classifies a network. It returns the scope of the special-purpose
+// range holding the whole network, ScopePublic when the network overlaps no
+// such range, and an empty string when it spans several scopes.
+func PrefixScope(prefix netip.Prefix) string {
+	prefix = prefix.Masked()
+	for _, r := range scopeRanges {
+		if r.prefix.Bits() <= prefix.Bits() && r.prefix.Contains(prefix.Addr()) {
+			return r.scope
+		}
+	}
+	for _, r := range scopeRanges {
+		if r.prefix.Overlaps(prefix) {
+			return ""
+		}
+	}
+	return ScopePublic
+}
+
+// Location is what is known about an address
+type Location struct {
+	// Scope is ScopePublic or the special-purpose range of the address
+	Scope string
+	// Country is the ISO 3166-1 country code
+	Country string
+	// Region is the name of the largest subdivision, such as a state
+	Region string
+	City   string
+	// HasCoordinates is set when Latitude and Longitude are known
+	HasCoordinates bool
+	Latitude       float64
+	Longitude      float64
+	// ASN and ASOrganization identify the autonomous system announcing the address
+	ASN            uint64
+	ASOrganization string
+}
+
+// Found reports whether either database had an entry for the address
+func (l Location) Found() bool {
+	return l.Country != "" || l.City != "" || l.HasCoordinates || l.ASN != 0
+}
+
+// cityLocation fills the location fields from a City database record
+func cityLocation(record interface{}, loc *Location) {
+	loc.Country, _ = path(record, "country", "iso_code").(string)
+	if loc.Country == "" {
+		loc.Country, _ = path(record, "registered_country", "iso_code").(string)
+	}
+	loc.Region, _ = path(record, "subdivisions", 0, "names", "en").(string)
+	loc.City, _ = path(record, "city", "names", "en").(string)
+	latitude, okLat := path(record, "location", "latitude").(float64)
+	longitude, okLon := path(record, "location", "longitude").(float64)
+	if okLat && okLon {
+		loc.HasCoordinates = true
+		loc.Latitude, loc.Longitude = latitude, longitude
+	}
+}
+
+// asnLocation fills the autonomous system fields from an ASN database record
+func asnLocation(record interface{}, loc *Location) {
+	loc.ASN, _ = path(record, "autonomous_system_number").(uint64)
+	loc.ASOrganization, _ = path(record, "autonomous_system_organization").(string)
+}
+
+// path walks decoded maps by key and arrays by index
+func path(value interface{}, keys ...interface{}) interface{} {
+	for _, key := range keys {
+		switch k := key.(type) {
+		case string:
+			m, ok := value.(map[string]interface{})
+			if !ok {
+				return nil
+			}
+			value = m[k]
+		case int:
+			a, ok := value.([]interface{})
+			if !ok || k >= len(a) {
+				return nil
+			}
+			value = a[k]
+		}
+	}
+	return value
+}
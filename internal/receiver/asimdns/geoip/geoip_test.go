@@ -0,0 +1,346 @@
+package geoip
+
+import (
+	"bytes"
+	"encoding/binary"
+	"math"
+	"net/netip"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// testDB builds an IPv6 database with 24-bit records in the MaxMind DB format
+type testDB struct {
+	nodes [][2]int64
+	data  bytes.Buffer
+}
+
+// Record markers used while building the tree
+const (
+	recordEmpty = -1
+	dataFlag    = int64(1) << 40
+)
+
+func newTestDB() *testDB {
+	return &testDB{nodes: [][2]int64{{recordEmpty, recordEmpty}}}
+}
+
+// insert maps a prefix to a value appended to the data section. A pointer
+// value refers to data already written.
+func (db *testDB) insert(prefix string, value interface{}) {
+	p := netip.MustParsePrefix(prefix)
+	bits := p.Bits()
+	addr := p.Addr().As16()
+	if p.Addr().Is4() {
+		// IPv4 networks live under ::/96
+		bits += 96
+		a4 := p.Addr().As4()
+		addr = [16]byte{12: a4[0], 13: a4[1], 14: a4[2], 15: a4[3]}
+	}
+
+	offset := int64(db.data.Len())
+	if ptr, ok := value.(pointer); ok {
+		offset = int64(ptr)
+	} else {
+		encode(&db.data, value)
+	}
+
+	node := 0
+	for i := 0; i < bits; i++ {
+		bit := (addr[i/8] >> (7 - uint(i%8))) & 1
+		if i == bits-1 {
+			db.nodes[node][bit] = dataFlag | offset
+			return
+		}
+		next := db.nodes[node][bit]
+		if next == recordEmpty {
+			db.nodes = append(db.nodes, [2]int64{recordEmpty, recordEmpty})
+			next = int64(len(db.nodes) - 1)
+			db.nodes[node][bit] = next
+		}
+		node = int(next)
+	}
+}
+
+// bytes serialises the tree, data section and metadata
+func (db *testDB) bytes() []byte {
+	var out bytes.Buffer
+	count := int64(len(db.nodes))
+	for _, node := range db.nodes {
+		for _, record := range node {
+			value := record
+			switch {
+			case record == recordEmpty:
+				value = count
+			case record&dataFlag != 0:
+				value = count + 16 + record&^dataFlag
+			}
+			out.Write([]byte{byte(value >> 16), byte(value >> 8), byte(value)})
+		}
+	}
+	out.Write(make([]byte, 16))
+	out.Write(db.data.Bytes())
+	out.Write(metadataMarker)
+	encode(&out, map[string]interface{}{
+		"node_count":    uint32(count),
+		"record_size":   uint32(24),
+		"ip_version":    uint32(6),
+		"database_type": "Test-City",
+		"build_epoch":   uint64(1700000000),
+	})
+	return out.Bytes()
+}
+
+// pointer is an offset into the data section
+type pointer uint32
+
+// encode writes a value in the MaxMind DB data format
+func encode(w *bytes.Buffer, value interface{}) {
+	control := func(kind, size int) {
+		sizeBits, extra := size, []byte(nil)
+		if size >= 29 {
+			// Test values stay below the 285 byte limit of one extra size byte
+			sizeBits, extra = 29, []byte{byte(size - 29)}
+		}
+		if kind > 7 {
+			w.Write([]byte{byte(sizeBits), byte(kind - 7)})
+		} else {
+			w.WriteByte(byte(kind<<5 | sizeBits))
+		}
+		w.Write(extra)
+	}
+	switch v := value.(type) {
+	case pointer:
+		w.Write([]byte{byte(typePointer<<5 | int(v>>8)&0x7), byte(v)})
+	case string:
+		control(typeString, len(v))
+		w.WriteString(v)
+	case float64:
+		control(typeDouble, 8)
+		binary.Write(w, binary.BigEndian, math.Float64bits(v))
+	case uint32:
+		control(typeUint32, 4)
+		binary.Write(w, binary.BigEndian, v)
+	case uint64:
+		control(typeUint64, 8)
+		binary.Write(w, binary.BigEndian, v)
+	case []interface{}:
+		control(typeArray, len(v))
+		for _, item := range v {
+			encode(w, item)
+		}
+	case map[string]interface{}:
+		control(typeMap, len(v))
+		for key, item := range v {
+			encode(w, key)
+			encode(w, item)
+		}
+	}
+}
+
+// names is a localised name map
+func names(en string) map[string]interface{} {
+	return map[string]interface{}{"names": map[string]interface{}{"en": en}}
+}
+
+func cityDB() []byte {
+	db := newTestDB()
+	db.insert("8.8.8.0/24", map[string]interface{}{
+		"country":      map[string]interface{}{"iso_code": "US"},
+		"subdivisions": []interface{}{names("California")},
+		"city":         names("Mountain View"),
+		"location":     map[string]interface{}{"latitude": 37.386, "longitude": -122.0838},
+	})
+	ireland := db.data.Len()
+	db.insert("2a00:1450::/32", map[string]interface{}{
+		"registered_country": map[string]interface{}{"iso_code": "IE"},
+	})
+	// A second range sharing the same record through a pointer
+	db.insert("2a00:1451::/32", pointer(ireland))
+	return db.bytes()
+}
+
+func asnDB() []byte {
+	db := newTestDB()
+	db.insert("8.8.0.0/16", map[string]interface{}{
+		"autonomous_system_number":       uint32(15169),
+		"autonomous_system_organization": "GOOGLE",
+	})
+	return db.bytes()
+}
+
+func TestScope(t *testing.T) {
+	tests := map[string]string{
+		"10.1.2.3":        ScopePrivate,
+		"172.31.255.1":    ScopePrivate,
+		"192.168.0.1":     ScopePrivate,
+		"fd12:3456::1":    ScopePrivate,
+		"127.0.0.1":       ScopeLoopback,
+		"::1":             ScopeLoopback,
+		"169.254.10.10":   ScopeLinkLocal,
+		"fe80::1":         ScopeLinkLocal,
+		"100.100.1.1":     ScopeShared,
+		"224.0.0.251":     ScopeMulticast,
+		"192.0.2.10":      ScopeDocumentation,
+		"2001:db8::5":     ScopeDocumentation,
+		"0.0.0.0":         ScopeReserved,
+		"255.255.255.255": ScopeReserved,
+		"::ffff:10.0.0.1": ScopePrivate,
+		"8.8.8.8":         ScopePublic,
+		"2606:4700::1111": ScopePublic,
+	}
+	for addr, want := range tests {
+		if got := Scope(netip.MustParseAddr(addr)); got != want {
+			t.Errorf("Scope(%s) = %s, want %s", addr, got, want)
+		}
+	}
+}
+
+func TestPrefixScope(t *testing.T) {
+	tests := map[string]string{
+		"10.1.0.0/16":    ScopePrivate,
+		"203.0.113.7/32": ScopeDocumentation,
+		"8.8.0.0/16":     ScopePublic,
+		"192.0.0.0/8":    "",
+		"2001:db8::/48":  ScopeDocumentation,
+	}
+	for prefix, want := range tests {
+		if got := PrefixScope(netip.MustParsePrefix(prefix)); got != want {
+			t.Errorf("PrefixScope(%s) = %q, want %q", prefix, got, want)
+		}
+	}
+}
+
+func TestReaderLookup(t *testing.T) {
+	r, err := NewReader(cityDB())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r.DatabaseType != "Test-City" || r.BuildEpoch != 1700000000 {
+		t.Errorf("metadata = %q %d", r.DatabaseType, r.BuildEpoch)
+	}
+
+	var loc Location
+	record, err := r.Lookup(netip.MustParseAddr("8.8.8.8"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	cityLocation(record, &loc)
+	if loc.Country != "US" || loc.Region != "California" || loc.City != "Mountain View" ||
+		!loc.HasCoordinates || loc.Latitude != 37.386 || loc.Longitude != -122.0838 {
+		t.Errorf("8.8.8.8 = %+v", loc)
+	}
+
+	for _, addr := range []string{"2a00:1450:4001::1", "2a00:1451::1"} {
+		loc = Location{}
+		record, err = r.Lookup(netip.MustParseAddr(addr))
+		if err != nil {
+			t.Fatal(err)
+		}
+		cityLocation(record, &loc)
+		if loc.Country != "IE" || loc.HasCoordinates {
+			t.Errorf("%s = %+v", addr, loc)
+		}
+	}
+
+	record, err = r.Lookup(netip.MustParseAddr("8.8.9.1"))
+	if err != nil || record != nil {
+		t.Errorf("8.8.9.1 = %v, %v, want no record", record, err)
+	}
+}
+
+func TestReaderRejectsCorruptFiles(t *testing.T) {
+	valid := cityDB()
+	for n := 0; n < len(valid); n++ {
+		// Truncated and bit-flipped files must fail or decode without panicking
+		if r, err := NewReader(valid[:n]); err == nil {
+			r.Lookup(netip.MustParseAddr("8.8.8.8"))
+		}
+		flipped := append([]byte(nil), valid...)
+		flipped[n] ^= 0xFF
+		if r, err := NewReader(flipped); err == nil {
+			r.Lookup(netip.MustParseAddr("8.8.8.8"))
+			r.Lookup(netip.MustParseAddr("2a00:1451::1"))
+		}
+	}
+	if _, err := NewReader([]byte("not a database")); err == nil {
+		t.Error("expected an error for a file without metadata")
+	}
+}
+
+func TestResolverLookupAndReload(t *testing.T) {
+	dir := t.TempDir()
+	cityFile := filepath.Join(dir, "city.mmdb")
+	asnFile := filepath.Join(dir, "asn.mmdb")
+	if err := os.WriteFile(cityFile, cityDB(), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(asnFile, asnDB(), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	r := NewResolver(zap.NewNop(), Options{CityFile: cityFile, ASNFile: asnFile, CacheSize: 2})
+	if err := r.Reload(); err != nil {
+		t.Fatal(err)
+	}
+
+	loc := r.Lookup(netip.MustParseAddr("::ffff:8.8.8.8"))
+	if loc.Scope != ScopePublic || loc.Country != "US" || loc.ASN != 15169 || loc.ASOrganization != "GOOGLE" {
+		t.Errorf("8.8.8.8 = %+v", loc)
+	}
+	if loc := r.Lookup(netip.MustParseAddr("10.0.0.1")); loc.Scope != ScopePrivate || loc.Found() {
+		t.Errorf("10.0.0.1 = %+v, want private without lookup", loc)
+	}
+	if loc := r.Lookup(netip.MustParseAddr("1.1.1.1")); loc.Scope != ScopePublic || loc.Found() {
+		t.Errorf("1.1.1.1 = %+v, want public without entry", loc)
+	}
+
+	// A replaced file is picked up and clears the cache
+	db := newTestDB()
+	db.insert("8.8.8.0/24", map[string]interface{}{
+		"country": map[string]interface{}{"iso_code": "CA"},
+	})
+	if err := os.WriteFile(cityFile, db.bytes(), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	later := time.Now().Add(time.Minute)
+	if err := os.Chtimes(cityFile, later, later); err != nil {
+		t.Fatal(err)
+	}
+	if err := r.Reload(); err != nil {
+		t.Fatal(err)
+	}
+	if loc := r.Lookup(netip.MustParseAddr("8.8.8.8")); loc.Country != "CA" || loc.ASN != 15169 {
+		t.Errorf("after reload 8.8.8.8 = %+v", loc)
+	}
+
+	// A corrupt file keeps the previous database in use
+	if err := os.WriteFile(cityFile, []byte("truncated download"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := r.Reload(); err == nil {
+		t.Error("expected an error reloading a corrupt file")
+	}
+	if loc := r.Lookup(netip.MustParseAddr("8.8.8.8")); loc.Country != "CA" {
+		t.Errorf("after failed reload 8.8.8.8 = %+v", loc)
+	}
+}
+
+func TestCacheEvictsLeastRecentlyUsed(t *testing.T) {
+	c := newCache(2)
+	a, b, d := netip.MustParseAddr("8.8.8.8"), netip.MustParseAddr("8.8.4.4"), netip.MustParseAddr("9.9.9.9")
+	c.put(a, Location{Country: "A"})
+	c.put(b, Location{Country: "B"})
+	c.get(a)
+	c.put(d, Location{Country: "D"})
+	if _, ok := c.get(b); ok {
+		t.Error("least recently used entry was not evicted")
+	}
+	if loc, ok := c.get(a); !ok || loc.Country != "A" {
+		t.Errorf("recently used entry = %+v, %v", loc, ok)
+	}
+}
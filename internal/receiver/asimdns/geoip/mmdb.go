@@ -0,0 +1,332 @@
+package geoip
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"math"
+	"net/netip"
+)
+
+// metadataMarker precedes the metadata section at the end of a database
+var metadataMarker = []byte("\xAB\xCD\xEFMaxMind.com")
+
+// metadataSearch is how far from the end of a file the marker may start
+const metadataSearch = 128 * 1024
+
+// maxDepth bounds the nesting of decoded values, guarding against pointer loops
+const maxDepth = 32
+
+// Reader looks addresses up in a MaxMind DB (.mmdb) file held in memory
+type Reader struct {
+	// DatabaseType is the database_type metadata value, such as "GeoLite2-City"
+	DatabaseType string
+	// BuildEpoch is when the database was built, in seconds since the epoch
+	BuildEpoch uint64
+
+	tree       []byte
+	data       []byte
+	nodeCount  uint32
+	recordSize uint32
+	ipVersion  uint16
+	ipv4Start  uint32
+}
+
+// NewReader parses a database from its file contents
+func NewReader(buf []byte) (*Reader, error) {
+	start := 0
+	if len(buf) > metadataSearch {
+		start = len(buf) - metadataSearch
+	}
+	i := bytes.LastIndex(buf[start:], metadataMarker)
+	if i < 0 {
+		return nil, fmt.Errorf("metadata marker not found")
+	}
+	metaStart := start + i + len(metadataMarker)
+
+	value, _, err := decoder{buf: buf[metaStart:]}.decode(0, 0)
+	if err != nil {
+		return nil, fmt.Errorf("decoding metadata: %w", err)
+	}
+	meta, ok := value.(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("metadata is not a map")
+	}
+
+	r := &Reader{
+		nodeCount:  uint32(toUint(meta["node_count"])),
+		recordSize: uint32(toUint(meta["record_size"])),
+		ipVersion:  uint16(toUint(meta["ip_version"])),
+		BuildEpoch: toUint(meta["build_epoch"]),
+	}
+	r.DatabaseType, _ = meta["database_type"].(string)
+
+	switch r.recordSize {
+	case 24, 28, 32:
+	default:
+		return nil, fmt.Errorf("unsupported record size %d", r.recordSize)
+	}
+	if r.ipVersion != 4 && r.ipVersion != 6 {
+		return nil, fmt.Errorf("unsupported IP version %d", r.ipVersion)
+	}
+	treeSize := uint64(r.nodeCount) * uint64(r.recordSize) / 4
+	if treeSize+16 > uint64(start+i) {
+		return nil, fmt.Errorf("search tree of %d nodes exceeds the file", r.nodeCount)
+	}
+	r.tree = buf[:treeSize]
+	r.data = buf[treeSize+16 : start+i]
+
+	// IPv4 addresses live under ::/96 in IPv6 databases
+	if r.ipVersion == 6 {
+		node := uint32(0)
+		for bit := 0; bit < 96 && node < r.nodeCount; bit++ {
+			node = r.record(node, 0)
+		}
+		r.ipv4Start = node
+	}
+	return r, nil
+}
+
+// record returns the left (0) or right (1) record of a search tree node
+func (r *Reader) record(node uint32, bit byte) uint32 {
+	switch r.recordSize {
+	case 24:
+		b := r.tree[node*6+uint32(bit)*3:]
+		return uint32(b[0])<<16 | uint32(b[1])<<8 | uint32(b[2])
+	case 28:
+		b := r.tree[node*7:]
+		if bit == 0 {
+			return uint32(b[3]&0xF0)<<20 | uint32(b[0])<<16 | uint32(b[1])<<8 | uint32(b[2])
+		}
+		return uint32(b[3]&0x0F)<<24 | uint32(b[4])<<16 | uint32(b[5])<<8 | uint32(b[6])
+	default:
+		return binary.BigEndian.Uint32(r.tree[node*8+uint32(bit)*4:])
+	}
+}
+
+// Lookup returns the decoded record for an address, or nil when the database
+// has no entry for it
+func (r *Reader) Lookup(addr netip.Addr) (interface{}, error) {
+	addr = addr.Unmap()
+	var ip []byte
+	node := uint32(0)
+	switch {
+	case addr.Is4():
+		b := addr.As4()
+		ip = b[:]
+		if r.ipVersion == 6 {
+			node = r.ipv4Start
+		}
+	case addr.Is6() && r.ipVersion == 6:
+		b := addr.As16()
+		ip = b[:]
+	default:
+		return nil, nil
+	}
+
+	for i := 0; i < len(ip)*8 && node < r.nodeCount; i++ {
+		node = r.record(node, (ip[i/8]>>(7-uint(i%8)))&1)
+	}
+	if node <= r.nodeCount {
+		return nil, nil
+	}
+
+	offset := node - r.nodeCount - 16
+	if uint64(offset) >= uint64(len(r.data)) {
+		return nil, fmt.Errorf("data pointer %d outside the data section", offset)
+	}
+	value, _, err := decoder{buf: r.data}.decode(offset, 0)
+	return value, err
+}
+
+// Data types of the MaxMind DB data section
+const (
+	typeExtended  = 0
+	typePointer   = 1
+	typeString    = 2
+	typeDouble    = 3
+	typeBytes     = 4
+	typeUint16    = 5
+	typeUint32    = 6
+	typeMap       = 7
+	typeInt32     = 8
+	typeUint64    = 9
+	typeUint128   = 10
+	typeArray     = 11
+	typeContainer = 12
+	typeEnd       = 13
+	typeBool      = 14
+	typeFloat     = 15
+)
+
+// decoder reads values from a data or metadata section. Pointers are offsets
+// from the start of buf.
+type decoder struct {
+	buf []byte
+}
+
+// take returns n bytes at offset
+func (d decoder) take(offset, n uint32) ([]byte, error) {
+	end := uint64(offset) + uint64(n)
+	if end > uint64(len(d.buf)) {
+		return nil, fmt.Errorf("value at %d runs past the section", offset)
+	}
+	return d.buf[offset:end], nil
+}
+
+// decode returns the value at offset and the offset following it
+func (d decoder) decode(offset uint32, depth int) (interface{}, uint32, error) {
+	if depth > maxDepth {
+		return nil, 0, fmt.Errorf("values nested deeper than %d", maxDepth)
+	}
+	b, err := d.take(offset, 1)
+	if err != nil {
+		return nil, 0, err
+	}
+	control := b[0]
+	offset++
+	kind := control >> 5
+
+	if kind == typePointer {
+		target, next, err := d.pointer(control, offset)
+		if err != nil {
+			return nil, 0, err
+		}
+		value, _, err := d.decode(target, depth+1)
+		return value, next, err
+	}
+
+	if kind == typeExtended {
+		b, err := d.take(offset, 1)
+		if err != nil {
+			return nil, 0, err
+		}
+		kind = 7 + b[0]
+		offset++
+	}
+
+	size := uint32(control & 0x1F)
+	if size >= 29 {
+		n := size - 28
+		b, err := d.take(offset, n)
+		if err != nil {
+			return nil, 0, err
+		}
+		offset += n
+		switch n {
+		case 1:
+			size = 29 + uint32(b[0])
+		case 2:
+			size = 285 + (uint32(b[0])<<8 | uint32(b[1]))
+		default:
+			size = 65821 + (uint32(b[0])<<16 | uint32(b[1])<<8 | uint32(b[2]))
+		}
+	}
+
+	switch kind {
+	case typeMap:
+		m := make(map[string]interface{}, min(size, 64))
+		for i := uint32(0); i < size; i++ {
+			key, next, err := d.decode(offset, depth+1)
+			if err != nil {
+				return nil, 0, err
+			}
+			name, ok := key.(string)
+			if !ok {
+				return nil, 0, fmt.Errorf("map key at %d is not a string", offset)
+			}
+			value, next, err := d.decode(next, depth+1)
+			if err != nil {
+				return nil, 0, err
+			}
+			m[name] = value
+			offset = next
+		}
+		return m, offset, nil
+	case typeArray:
+		a := make([]interface{}, 0, min(size, 64))
+		for i := uint32(0); i < size; i++ {
+			value, next, err := d.decode(offset, depth+1)
+			if err != nil {
+				return nil, 0, err
+			}
+			a = append(a, value)
+			offset = next
+		}
+		return a, offset, nil
+	case typeBool:
+		return size != 0, offset, nil
+	case typeContainer, typeEnd:
+		return nil, offset, nil
+	}
+
+	b, err = d.take(offset, size)
+	if err != nil {
+		return nil, 0, err
+	}
+	offset += size
+
+	switch kind {
+	case typeString:
+		return string(b), offset, nil
+	case typeBytes:
+		return append([]byte(nil), b...), offset, nil
+	case typeDouble:
+		if size != 8 {
+			return nil, 0, fmt.Errorf("double of %d bytes", size)
+		}
+		return math.Float64frombits(binary.BigEndian.Uint64(b)), offset, nil
+	case typeFloat:
+		if size != 4 {
+			return nil, 0, fmt.Errorf("float of %d bytes", size)
+		}
+		return float64(math.Float32frombits(binary.BigEndian.Uint32(b))), offset, nil
+	case typeUint16, typeUint32, typeUint64, typeUint128:
+		if size > 8 {
+			// 128-bit values are not used by the City and ASN databases
+			return b, offset, nil
+		}
+		var v uint64
+		for _, c := range b {
+			v = v<<8 | uint64(c)
+		}
+		return v, offset, nil
+	case typeInt32:
+		if size > 4 {
+			return nil, 0, fmt.Errorf("int32 of %d bytes", size)
+		}
+		var v uint32
+		for _, c := range b {
+			v = v<<8 | uint32(c)
+		}
+		return int64(int32(v)), offset, nil
+	}
+	return nil, 0, fmt.Errorf("unknown data type %d at %d", kind, offset)
+}
+
+// pointer decodes a pointer whose control byte has been read
+func (d decoder) pointer(control byte, offset uint32) (uint32, uint32, error) {
+	n := uint32(control>>3&0x3) + 1
+	b, err := d.take(offset, n)
+	if err != nil {
+		return 0, 0, err
+	}
+	v := uint32(control & 0x7)
+	switch n {
+	case 1:
+		v = v<<8 | uint32(b[0])
+	case 2:
+		v = (v<<16 | uint32(b[0])<<8 | uint32(b[1])) + 2048
+	case 3:
+		v = (v<<24 | uint32(b[0])<<16 | uint32(b[1])<<8 | uint32(b[2])) + 526336
+	default:
+		v = binary.BigEndian.Uint32(b)
+	}
+	return v, offset + n, nil
+}
+
+// toUint returns an unsigned metadata value, or 0 for other types
+func toUint(value interface{}) uint64 {
+	v, _ := value.(uint64)
+	return v
+}
@@ -0,0 +1,223 @@
+package geoip
+
+import (
+	"container/list"
+	"context"
+	"errors"
+	"fmt"
+	"net/netip"
+	"os"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// Options selects the database files and the lookup cache size
+type Options struct {
+	// CityFile is a GeoIP2/GeoLite2 City or Country database
+	CityFile string
+	// ASNFile is a GeoIP2/GeoLite2 ASN database
+	ASNFile string
+	// CacheSize is the number of public addresses whose locations are cached
+	CacheSize int
+}
+
+// database is a loaded database file
+type database struct {
+	path    string
+	reader  *Reader
+	modTime time.Time
+	size    int64
+}
+
+// Resolver looks addresses up in the configured databases. Database files
+// are reloaded when their size or modification time changes.
+type Resolver struct {
+	logger *zap.Logger
+	mux    sync.RWMutex
+	city   *database
+	asn    *database
+	cache  *cache
+}
+
+// NewResolver creates a resolver. Databases are read by Reload.
+func NewResolver(logger *zap.Logger, opts Options) *Resolver {
+	if opts.CacheSize <= 0 {
+		opts.CacheSize = 10000
+	}
+	r := &Resolver{logger: logger, cache: newCache(opts.CacheSize)}
+	if opts.CityFile != "" {
+		r.city = &database{path: opts.CityFile}
+	}
+	if opts.ASNFile != "" {
+		r.asn = &database{path: opts.ASNFile}
+	}
+	return r
+}
+
+// Reload reads the database files that changed. A file that fails to load
+// leaves its previous version in use.
+func (r *Resolver) Reload() error {
+	var errs []error
+	changed := false
+	for _, db := range []*database{r.city, r.asn} {
+		if db == nil {
+			continue
+		}
+		reloaded, err := r.reload(db)
+		if err != nil {
+			errs = append(errs, err)
+		}
+		changed = changed || reloaded
+	}
+	if changed {
+		r.cache.clear()
+	}
+	return errors.Join(errs...)
+}
+
+// reload reads one database file if it changed
+func (r *Resolver) reload(db *database) (bool, error) {
+	info, err := os.Stat(db.path)
+	if err != nil {
+		return false, err
+	}
+
+	r.mux.RLock()
+	unchanged := db.reader != nil && info.ModTime().Equal(db.modTime) && info.Size() == db.size
+	r.mux.RUnlock()
+	if unchanged {
+		return false, nil
+	}
+
+	buf, err := os.ReadFile(db.path)
+	if err != nil {
+		return false, err
+	}
+	reader, err := NewReader(buf)
+	if err != nil {
+		return false, fmt.Errorf("reading GeoIP database %s: %w", db.path, err)
+	}
+
+	r.mux.Lock()
+	db.reader, db.modTime, db.size = reader, info.ModTime(), info.Size()
+	r.mux.Unlock()
+	r.logger.Info("Loaded GeoIP database",
+		zap.String("path", db.path),
+		zap.String("type", reader.DatabaseType),
+		zap.Time("built", time.Unix(int64(reader.BuildEpoch), 0)))
+	return true, nil
+}
+
+// Watch reloads changed database files at the given interval until the context is done
+func (r *Resolver) Watch(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := r.Reload(); err != nil {
+				r.logger.Warn("GeoIP database reload failed", zap.Error(err))
+			}
+		}
+	}
+}
+
+// Lookup returns the location of an address. Addresses in special-purpose
+// ranges only have their Scope set.
+func (r *Resolver) Lookup(addr netip.Addr) Location {
+	addr = addr.Unmap()
+	loc := Location{Scope: Scope(addr)}
+	if loc.Scope != ScopePublic {
+		return loc
+	}
+	if cached, ok := r.cache.get(addr); ok {
+		return cached
+	}
+
+	r.mux.RLock()
+	var city, asn *Reader
+	if r.city != nil {
+		city = r.city.reader
+	}
+	if r.asn != nil {
+		asn = r.asn.reader
+	}
+	r.mux.RUnlock()
+
+	if city != nil {
+		if record, err := city.Lookup(addr); err == nil {
+			cityLocation(record, &loc)
+		}
+	}
+	if asn != nil {
+		if record, err := asn.Lookup(addr); err == nil {
+			asnLocation(record, &loc)
+		}
+	}
+	r.cache.put(addr, loc)
+	return loc
+}
+
+// cache is a least recently used cache of locations
+type cache struct {
+	mux      sync.Mutex
+	capacity int
+	order    *list.List
+	entries  map[netip.Addr]*list.Element
+}
+
+// cacheEntry is a cached location
+type cacheEntry struct {
+	addr netip.Addr
+	loc  Location
+}
+
+// newCache creates a cache holding up to capacity locations
+func newCache(capacity int) *cache {
+	return &cache{
+		capacity: capacity,
+		order:    list.New(),
+		entries:  make(map[netip.Addr]*list.Element),
+	}
+}
+
+// get returns a cached location and marks it recently used
+func (c *cache) get(addr netip.Addr) (Location, bool) {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+	if e, ok := c.entries[addr]; ok {
+		c.order.MoveToFront(e)
+		return e.Value.(*cacheEntry).loc, true
+	}
+	return Location{}, false
+}
+
+// put caches a location, evicting the least recently used one when full
+func (c *cache) put(addr netip.Addr, loc Location) {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+	if e, ok := c.entries[addr]; ok {
+		e.Value.(*cacheEntry).loc = loc
+		c.order.MoveToFront(e)
+		return
+	}
+	c.entries[addr] = c.order.PushFront(&cacheEntry{addr: addr, loc: loc})
+	if c.order.Len() > c.capacity {
+		oldest := c.order.Back()
+		c.order.Remove(oldest)
+		delete(c.entries, oldest.Value.(*cacheEntry).addr)
+	}
+}
+
+// clear empties the cache after a database changed
+func (c *cache) clear() {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+	c.order.Init()
+	c.entries = make(map[netip.Addr]*list.Element)
+}
@@ -10,4 +10,5 @@ require (
 	go.opentelemetry.io/collector/pdata v1.0.0-rcv0018
 	go.opentelemetry.io/collector/receiver v0.89.0
 	go.uber.org/zap v1.26.0
+	golang.org/x/net v0.17.0
 )
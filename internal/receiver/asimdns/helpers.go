@@ -2,10 +2,21 @@ package asimdns
 
 import (
 	"github.com/0xrawsec/golang-etw/etw"
+	"go.opentelemetry.io/collector/pdata/pcommon"
 	"go.opentelemetry.io/collector/pdata/plog"
 	"net"
+	"net/netip"
 	"os"
 	"strconv"
+	"strings"
+
+	"github.com/LaurieRhodes/asim-dns-collector/internal/receiver/asimdns/asim"
+	"github.com/LaurieRhodes/asim-dns-collector/internal/receiver/asimdns/dga"
+	"github.com/LaurieRhodes/asim-dns-collector/internal/receiver/asimdns/dnsname"
+	"github.com/LaurieRhodes/asim-dns-collector/internal/receiver/asimdns/geoip"
+	"github.com/LaurieRhodes/asim-dns-collector/internal/receiver/asimdns/psl"
+	"github.com/LaurieRhodes/asim-dns-collector/internal/receiver/asimdns/severity"
+	"github.com/LaurieRhodes/asim-dns-collector/internal/receiver/asimdns/threatintel"
 )
 
 // setDeviceFields adds device-related information to the ASIM log record
@@ -34,11 +45,6 @@ func setDeviceFields(logRecord plog.LogRecord) {
 
 // setNetworkFields extracts network information from the DNS Client event
 func setNetworkFields(event *etw.Event, logRecord plog.LogRecord) {
-	// Extract server list (for DNS Client events)
-	if serverList, ok := getEventDataString(event, "ServerList"); ok {
-		logRecord.Attributes().PutStr("DstIpAddr", serverList)
-	}
-	
 	// Extract source port if available
 	if sourcePort, ok := getEventDataString(event, "SourcePort"); ok {
 		if portInt, err := strconv.Atoi(sourcePort); err == nil {
@@ -53,7 +59,7 @@ func setNetworkFields(event *etw.Event, logRecord plog.LogRecord) {
 	logRecord.Attributes().PutStr("NetworkProtocol", "UDP")
 	
 	// Set process ID field that's required by ADX schema
-	logRecord.Attributes().PutStr("SrcProcessId", strconv.Itoa(int(event.System.Execution.ProcessID)))
+	logRecord.Attributes().PutInt("SrcProcessId", int64(event.System.Execution.ProcessID))
 }
 
 // getLocalIP returns the non-loopback IP address of the host
@@ -73,3 +79,255 @@ func getLocalIP() string {
 	}
 	return "127.0.0.1"
 }
+
+// attributeFields exposes log record attributes to filter rule expressions
+type attributeFields pcommon.Map
+
+// Get returns the string form of an attribute value
+func (a attributeFields) Get(name string) (string, bool) {
+	value, ok := pcommon.Map(a).Get(name)
+	if !ok {
+		return "", false
+	}
+	return value.AsString(), true
+}
+
+// attributeRecord exposes log record attributes to ASIM schema completion
+type attributeRecord pcommon.Map
+
+// Get returns the string form of an attribute value
+func (a attributeRecord) Get(name string) (string, bool) {
+	return attributeFields(a).Get(name)
+}
+
+// PutStr sets a string attribute
+func (a attributeRecord) PutStr(name, value string) {
+	pcommon.Map(a).PutStr(name, value)
+}
+
+// PutInt sets an integer attribute
+func (a attributeRecord) PutInt(name string, value int64) {
+	pcommon.Map(a).PutInt(name, value)
+}
+
+// completeRecord adds the mandatory fields and aliases of an ASIM schema
+// version to a transformed record
+func completeRecord(logRecord plog.LogRecord, version string) {
+	asim.Complete(attributeRecord(logRecord.Attributes()), version, logRecord.Timestamp().AsTime())
+}
+
+// applySeverity sets the ASIM EventSeverity and the OpenTelemetry severity of
+// a record from the severity policy
+func applySeverity(logRecord plog.LogRecord, policy *severity.Policy) {
+	level := policy.Evaluate(attributeFields(logRecord.Attributes()))
+	logRecord.Attributes().PutStr("EventSeverity", level.String())
+	logRecord.SetSeverityNumber(plog.SeverityNumber(level.Number()))
+	logRecord.SetSeverityText(level.String())
+}
+
+// setHeaderFlags sets DnsFlags to the header flags that are set, such as
+// "RD CD", and leaves it unset when there are none. Both providers use it so
+// their records carry the same field.
+func setHeaderFlags(logRecord plog.LogRecord, flags []string) {
+	if len(flags) == 0 {
+		logRecord.Attributes().Remove("DnsFlags")
+		return
+	}
+	logRecord.Attributes().PutStr("DnsFlags", strings.Join(flags, " "))
+}
+
+// setQueryNameFields replaces the query name with its normalised form and adds
+// the Unicode form of internationalised names and any syntax problems
+func setQueryNameFields(logRecord plog.LogRecord, name dnsname.Name) {
+	logRecord.Attributes().PutStr("DnsQuery", name.ASCII)
+	if name.IDN() {
+		logRecord.Attributes().PutStr("DnsQueryUnicode", name.Unicode)
+	}
+	if !name.Valid() {
+		logRecord.Attributes().PutStr("DnsQueryInvalidReason", name.Invalid)
+	}
+	if name.MixedScript {
+		logRecord.Attributes().PutBool("DnsQueryMixedScript", true)
+	}
+}
+
+// scopeOwnSubnet classifies reverse lookup targets on the collector's own networks
+const scopeOwnSubnet = "own_subnet"
+
+// localNetworks returns the configured networks and the subnets of the
+// host's non-loopback interfaces
+func localNetworks(configured []string) []netip.Prefix {
+	networks, _ := dnsname.ParseNetworks(configured)
+	addrs, err := net.InterfaceAddrs()
+	if err != nil {
+		return networks
+	}
+	for _, address := range addrs {
+		ipnet, ok := address.(*net.IPNet)
+		if !ok || ipnet.IP.IsLoopback() {
+			continue
+		}
+		addr, ok := netip.AddrFromSlice(ipnet.IP)
+		if !ok {
+			continue
+		}
+		bits, _ := ipnet.Mask.Size()
+		if addr.Is4In6() {
+			addr = addr.Unmap()
+			bits -= 96
+		}
+		networks = append(networks, netip.PrefixFrom(addr, bits).Masked())
+	}
+	return networks
+}
+
+// setReverseFields adds the decoded target of a reverse lookup (PTR) name
+func setReverseFields(logRecord plog.LogRecord, rev dnsname.Reverse, local []netip.Prefix) {
+	if rev.Invalid != "" {
+		logRecord.Attributes().PutStr("DnsQueryPtrInvalidReason", rev.Invalid)
+		return
+	}
+	if !rev.Prefix.IsValid() {
+		return
+	}
+	if addr, ok := rev.Addr(); ok {
+		logRecord.Attributes().PutStr("DnsQueryPtrAddr", addr.String())
+	} else {
+		logRecord.Attributes().PutStr("DnsQueryPtrNetwork", rev.Prefix.String())
+	}
+	
+	scope := geoip.PrefixScope(rev.Prefix)
+	if rev.Within(local) {
+		scope = scopeOwnSubnet
+	}
+	if scope != "" {
+		logRecord.Attributes().PutStr("DnsQueryPtrScope", scope)
+	}
+}
+
+// setDomainPartFields adds the Public Suffix List components of the query name
+func setDomainPartFields(logRecord plog.LogRecord, parts psl.Parts) {
+	if parts.RegisteredDomain != "" {
+		logRecord.Attributes().PutStr("DnsQueryRegisteredDomain", parts.RegisteredDomain)
+	}
+	if parts.Subdomain != "" {
+		logRecord.Attributes().PutStr("DnsQuerySubdomain", parts.Subdomain)
+	}
+	if parts.PublicSuffix != "" {
+		logRecord.Attributes().PutStr("DnsQueryPublicSuffix", parts.PublicSuffix)
+		logRecord.Attributes().PutBool("DnsQueryPrivateSuffix", parts.Private)
+	}
+	if parts.TLD != "" {
+		logRecord.Attributes().PutStr("DnsQueryTld", parts.TLD)
+	}
+	logRecord.Attributes().PutInt("DnsQueryLabelCount", int64(parts.Labels))
+}
+
+// parseQueryResultAddrs extracts the addresses from a DNS Client QueryResults
+// value such as "type:  5 cdn.example.net;::ffff:192.0.2.10;"
+func parseQueryResultAddrs(results string) []netip.Addr {
+	var addrs []netip.Addr
+	for _, part := range strings.Split(results, ";") {
+		if addr, err := netip.ParseAddr(strings.TrimSpace(part)); err == nil {
+			addrs = append(addrs, addr.Unmap())
+		}
+	}
+	return addrs
+}
+
+// firstAddr returns the first address in a field that may hold a list such
+// as a DNS Client ServerList
+func firstAddr(value string) (netip.Addr, bool) {
+	for _, part := range strings.FieldsFunc(value, func(r rune) bool {
+		return r == ';' || r == ',' || r == ' '
+	}) {
+		if addr, err := netip.ParseAddr(part); err == nil {
+			return addr.Unmap(), true
+		}
+		if addrPort, err := netip.ParseAddrPort(part); err == nil {
+			return addrPort.Addr().Unmap(), true
+		}
+	}
+	return netip.Addr{}, false
+}
+
+// geoFieldNames names the attributes filled for one enriched address
+type geoFieldNames struct {
+	// geo prefixes the Country, Region, City, Latitude and Longitude fields
+	geo string
+	// scope is the field holding the address scope
+	scope string
+	// asn prefixes the Asn and AsnOrganization fields
+	asn string
+}
+
+// Attribute names for the client, server and answer addresses
+var (
+	srcGeoFields    = geoFieldNames{geo: "SrcGeo", scope: "SrcIpScope", asn: "Src"}
+	dstGeoFields    = geoFieldNames{geo: "DstGeo", scope: "DstIpScope", asn: "Dst"}
+	answerGeoFields = geoFieldNames{geo: "DnsResponseIp", scope: "DnsResponseIpScope", asn: "DnsResponseIp"}
+)
+
+// setGeoFields adds the location and autonomous system of an address
+func setGeoFields(logRecord plog.LogRecord, names geoFieldNames, loc geoip.Location) {
+	logRecord.Attributes().PutStr(names.scope, loc.Scope)
+	if loc.Country != "" {
+		logRecord.Attributes().PutStr(names.geo+"Country", loc.Country)
+	}
+	if loc.Region != "" {
+		logRecord.Attributes().PutStr(names.geo+"Region", loc.Region)
+	}
+	if loc.City != "" {
+		logRecord.Attributes().PutStr(names.geo+"City", loc.City)
+	}
+	if loc.HasCoordinates {
+		logRecord.Attributes().PutDouble(names.geo+"Latitude", loc.Latitude)
+		logRecord.Attributes().PutDouble(names.geo+"Longitude", loc.Longitude)
+	}
+	if loc.ASN != 0 {
+		logRecord.Attributes().PutInt(names.asn+"Asn", int64(loc.ASN))
+	}
+	if loc.ASOrganization != "" {
+		logRecord.Attributes().PutStr(names.asn+"AsnOrganization", loc.ASOrganization)
+	}
+}
+
+// setThreatFields adds the ASIM threat fields for a threat intelligence match
+func setThreatFields(logRecord plog.LogRecord, match threatintel.Match) {
+	ind := match.Indicator
+	logRecord.Attributes().PutStr("ThreatIndicatorType", ind.Type)
+	logRecord.Attributes().PutStr("ThreatField", match.Field)
+	logRecord.Attributes().PutInt("ThreatRiskLevel", int64(ind.RiskLevel))
+	if ind.Category != "" {
+		logRecord.Attributes().PutStr("ThreatCategory", ind.Category)
+	} else {
+		// An indicator match replaces the fields set by DGA scoring
+		logRecord.Attributes().Remove("ThreatCategory")
+	}
+	if ind.Confidence != "" {
+		logRecord.Attributes().PutStr("ThreatOriginalConfidence", ind.Confidence)
+		if confidence, err := strconv.Atoi(ind.Confidence); err == nil {
+			logRecord.Attributes().PutInt("ThreatConfidence", int64(confidence))
+		}
+	}
+	if ind.Name != "" {
+		logRecord.Attributes().PutStr("ThreatName", ind.Name)
+	} else {
+		logRecord.Attributes().Remove("ThreatName")
+	}
+	if ind.ID != "" {
+		logRecord.Attributes().PutStr("ThreatId", ind.ID)
+	}
+	if ind.Type == threatintel.TypeIP {
+		logRecord.Attributes().PutStr("ThreatIpAddr", match.Value)
+	}
+}
+
+// setDGAThreatFields maps a likely generated query name into the ASIM threat fields
+func setDGAThreatFields(logRecord plog.LogRecord, result dga.Result) {
+	logRecord.Attributes().PutStr("ThreatIndicatorType", threatintel.TypeDomain)
+	logRecord.Attributes().PutStr("ThreatField", "DnsQuery")
+	logRecord.Attributes().PutStr("ThreatCategory", "DGA")
+	logRecord.Attributes().PutInt("ThreatRiskLevel", int64(result.Score*100))
+	logRecord.Attributes().PutStr("ThreatName", "Algorithmically generated domain "+result.Domain)
+}
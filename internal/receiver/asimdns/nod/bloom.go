@@ -0,0 +1,69 @@
+package nod
+
+import (
+	"hash/fnv"
+	"math"
+)
+
+// bloom is a Bloom filter sized for an expected number of items and false positive rate
+type bloom struct {
+	bits   []uint64
+	m      uint64
+	hashes uint64
+}
+
+// newBloom creates a filter for n items with false positive rate p
+func newBloom(n int, p float64) *bloom {
+	m := uint64(math.Ceil(-float64(n) * math.Log(p) / (math.Ln2 * math.Ln2)))
+	m = (m + 63) / 64 * 64
+	k := uint64(math.Round(float64(m) / float64(n) * math.Ln2))
+	if k < 1 {
+		k = 1
+	}
+	return &bloom{bits: make([]uint64, m/64), m: m, hashes: k}
+}
+
+// locations derives the bit positions of a key by double hashing
+func (b *bloom) locations(key string, fn func(uint64) bool) bool {
+	h := fnv.New128a()
+	h.Write([]byte(key))
+	sum := h.Sum(nil)
+	var h1, h2 uint64
+	for i := 0; i < 8; i++ {
+		h1 = h1<<8 | uint64(sum[i])
+		h2 = h2<<8 | uint64(sum[8+i])
+	}
+	h2 |= 1
+	for i := uint64(0); i < b.hashes; i++ {
+		if !fn((h1 + i*h2) % b.m) {
+			return false
+		}
+	}
+	return true
+}
+
+// add inserts a key
+func (b *bloom) add(key string) {
+	b.locations(key, func(bit uint64) bool {
+		b.bits[bit/64] |= 1 << (bit % 64)
+		return true
+	})
+}
+
+// test reports whether a key may have been added
+func (b *bloom) test(key string) bool {
+	return b.locations(key, func(bit uint64) bool {
+		return b.bits[bit/64]&(1<<(bit%64)) != 0
+	})
+}
+
+// merge adds every key of a filter with the same dimensions
+func (b *bloom) merge(other *bloom) bool {
+	if other.m != b.m || other.hashes != b.hashes {
+		return false
+	}
+	for i := range b.bits {
+		b.bits[i] |= other.bits[i]
+	}
+	return true
+}
@@ -0,0 +1,242 @@
+package nod
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+)
+
+// historyMagic identifies a history file and historyVersion its format
+const (
+	historyMagic   = "NODH"
+	historyVersion = 1
+)
+
+// secondsPerDay is the length of a history day
+const secondsPerDay = 86400
+
+// History remembers keys seen over a number of days with one Bloom filter per
+// day, so memory and file size depend only on the configured capacity
+type History struct {
+	mux      sync.Mutex
+	days     int
+	capacity int
+	fpRate   float64
+	created  time.Time
+	filters  map[int64]*bloom
+}
+
+// NewHistory creates an empty history keeping days days of capacity keys each
+func NewHistory(days, capacity int, fpRate float64, now time.Time) *History {
+	return &History{
+		days:     days,
+		capacity: capacity,
+		fpRate:   fpRate,
+		created:  now,
+		filters:  make(map[int64]*bloom),
+	}
+}
+
+// dayOf returns the UTC day number of a time
+func dayOf(t time.Time) int64 {
+	return t.Unix() / secondsPerDay
+}
+
+// Created returns when the history was started
+func (h *History) Created() time.Time {
+	h.mux.Lock()
+	defer h.mux.Unlock()
+	return h.created
+}
+
+// Seen reports whether a key was probably added within the retained days
+func (h *History) Seen(key string, now time.Time) bool {
+	h.mux.Lock()
+	defer h.mux.Unlock()
+
+	oldest := dayOf(now) - int64(h.days) + 1
+	for day, filter := range h.filters {
+		if day >= oldest && filter.test(key) {
+			return true
+		}
+	}
+	return false
+}
+
+// Add records a key for the current day and drops days past retention
+func (h *History) Add(key string, now time.Time) {
+	h.mux.Lock()
+	defer h.mux.Unlock()
+
+	today := dayOf(now)
+	filter, ok := h.filters[today]
+	if !ok {
+		filter = newBloom(h.capacity, h.fpRate)
+		h.filters[today] = filter
+		h.prune(today)
+	}
+	filter.add(key)
+}
+
+// prune removes days older than the retention
+func (h *History) prune(today int64) {
+	for day := range h.filters {
+		if day <= today-int64(h.days) {
+			delete(h.filters, day)
+		}
+	}
+}
+
+// merge adds the days of another history. Days whose filters were sized
+// differently are skipped.
+func (h *History) merge(other *History) {
+	if other.created.Before(h.created) {
+		h.created = other.created
+	}
+	for day, filter := range other.filters {
+		if existing, ok := h.filters[day]; ok {
+			existing.merge(filter)
+			continue
+		}
+		if reference := newBloom(h.capacity, h.fpRate); reference.m == filter.m && reference.hashes == filter.hashes {
+			h.filters[day] = filter
+		}
+	}
+}
+
+// Save writes the history atomically to path. With merge set, days already in
+// the file are merged first so several collectors can share one file.
+func (h *History) Save(path string, merge bool, now time.Time) error {
+	if merge {
+		existing := NewHistory(h.days, h.capacity, h.fpRate, now)
+		if err := existing.Load(path); err != nil {
+			return err
+		}
+		h.mux.Lock()
+		h.merge(existing)
+		h.mux.Unlock()
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".tmp*")
+	if err != nil {
+		return err
+	}
+	w := bufio.NewWriter(tmp)
+	h.mux.Lock()
+	h.prune(dayOf(now))
+	err = h.write(w)
+	h.mux.Unlock()
+	if err == nil {
+		err = w.Flush()
+	}
+	if err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+// write encodes the history
+func (h *History) write(w io.Writer) error {
+	days := make([]int64, 0, len(h.filters))
+	for day := range h.filters {
+		days = append(days, day)
+	}
+	sort.Slice(days, func(i, j int) bool { return days[i] < days[j] })
+
+	header := []interface{}{
+		[]byte(historyMagic),
+		uint32(historyVersion),
+		h.created.Unix(),
+		uint32(len(days)),
+	}
+	for _, value := range header {
+		if err := binary.Write(w, binary.LittleEndian, value); err != nil {
+			return err
+		}
+	}
+	for _, day := range days {
+		filter := h.filters[day]
+		for _, value := range []interface{}{day, filter.m, filter.hashes, filter.bits} {
+			if err := binary.Write(w, binary.LittleEndian, value); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// Load replaces the history with one saved by Save. A missing file leaves the
+// history unchanged; days sized for a different capacity are discarded.
+func (h *History) Load(path string) error {
+	file, err := os.Open(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	loaded, err := h.read(bufio.NewReader(file))
+	if err != nil {
+		return fmt.Errorf("reading domain history %s: %w", path, err)
+	}
+
+	h.mux.Lock()
+	defer h.mux.Unlock()
+	h.created = loaded.created
+	h.filters = make(map[int64]*bloom)
+	h.merge(loaded)
+	return nil
+}
+
+// read decodes a history with the dimensions of h
+func (h *History) read(r io.Reader) (*History, error) {
+	var magic [4]byte
+	var version, count uint32
+	var created int64
+	for _, value := range []interface{}{&magic, &version, &created, &count} {
+		if err := binary.Read(r, binary.LittleEndian, value); err != nil {
+			return nil, err
+		}
+	}
+	if string(magic[:]) != historyMagic {
+		return nil, fmt.Errorf("not a domain history file")
+	}
+	if version != historyVersion {
+		return nil, fmt.Errorf("version %d, expected %d", version, historyVersion)
+	}
+
+	loaded := NewHistory(h.days, h.capacity, h.fpRate, time.Unix(created, 0))
+	for i := uint32(0); i < count; i++ {
+		var day int64
+		filter := &bloom{}
+		for _, value := range []interface{}{&day, &filter.m, &filter.hashes} {
+			if err := binary.Read(r, binary.LittleEndian, value); err != nil {
+				return nil, err
+			}
+		}
+		if filter.m == 0 || filter.m%64 != 0 || filter.m > 1<<36 {
+			return nil, fmt.Errorf("invalid filter size %d", filter.m)
+		}
+		filter.bits = make([]uint64, filter.m/64)
+		if err := binary.Read(r, binary.LittleEndian, filter.bits); err != nil {
+			return nil, err
+		}
+		loaded.filters[day] = filter
+	}
+	return loaded, nil
+}
@@ -0,0 +1,110 @@
+// Package nod flags newly observed domains: registered domains not seen by a
+// host, or by any host, within a number of days. History is kept in compact
+// per-day Bloom filters that persist across restarts.
+package nod
+
+import (
+	"strings"
+	"time"
+)
+
+// Options controls the history size, warm-up and persistence
+type Options struct {
+	// Days is the number of days a domain is remembered
+	Days int
+	// Capacity is the number of distinct keys expected per day in each history
+	Capacity int
+	// FalsePositiveRate is the chance that a new domain is mistaken for a seen one
+	FalsePositiveRate float64
+	// WarmUp suppresses flags until the history has been collected for this long
+	WarmUp time.Duration
+	// HostFile persists the per-host history
+	HostFile string
+	// GlobalFile persists the fleet-wide history. It may be shared by several
+	// collectors; each save merges the domains the others have written.
+	GlobalFile string
+}
+
+// Result flags a domain observation
+type Result struct {
+	// FirstSeenHost is set when the host has not queried the domain before
+	FirstSeenHost bool
+	// FirstSeenGlobal is set when no host has queried the domain before
+	FirstSeenGlobal bool
+	// HostWarmingUp and GlobalWarmingUp are set while the corresponding
+	// history is too young for its flag to be meaningful
+	HostWarmingUp   bool
+	GlobalWarmingUp bool
+}
+
+// Tracker records the registered domains queried per host and across hosts
+type Tracker struct {
+	opts   Options
+	host   *History
+	global *History
+}
+
+// NewTracker creates a tracker with empty histories
+func NewTracker(opts Options, now time.Time) *Tracker {
+	if opts.Days <= 0 {
+		opts.Days = 30
+	}
+	if opts.Capacity <= 0 {
+		opts.Capacity = 100000
+	}
+	if opts.FalsePositiveRate <= 0 || opts.FalsePositiveRate >= 1 {
+		opts.FalsePositiveRate = 0.001
+	}
+	return &Tracker{
+		opts:   opts,
+		host:   NewHistory(opts.Days, opts.Capacity, opts.FalsePositiveRate, now),
+		global: NewHistory(opts.Days, opts.Capacity, opts.FalsePositiveRate, now),
+	}
+}
+
+// Load restores the histories from their files
+func (t *Tracker) Load() error {
+	if t.opts.HostFile != "" {
+		if err := t.host.Load(t.opts.HostFile); err != nil {
+			return err
+		}
+	}
+	if t.opts.GlobalFile != "" {
+		if err := t.global.Load(t.opts.GlobalFile); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Save writes the histories to their files
+func (t *Tracker) Save(now time.Time) error {
+	if t.opts.HostFile != "" {
+		if err := t.host.Save(t.opts.HostFile, false, now); err != nil {
+			return err
+		}
+	}
+	if t.opts.GlobalFile != "" {
+		if err := t.global.Save(t.opts.GlobalFile, true, now); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Observe records that host queried a registered domain and reports whether
+// it is the first time within the history
+func (t *Tracker) Observe(host, domain string, now time.Time) Result {
+	domain = strings.TrimSuffix(strings.ToLower(domain), ".")
+	hostKey := strings.ToLower(host) + "|" + domain
+
+	result := Result{
+		FirstSeenHost:   !t.host.Seen(hostKey, now),
+		FirstSeenGlobal: !t.global.Seen(domain, now),
+		HostWarmingUp:   now.Sub(t.host.Created()) < t.opts.WarmUp,
+		GlobalWarmingUp: now.Sub(t.global.Created()) < t.opts.WarmUp,
+	}
+	t.host.Add(hostKey, now)
+	t.global.Add(domain, now)
+	return result
+}
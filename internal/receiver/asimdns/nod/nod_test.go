@@ -0,0 +1,99 @@
+package nod
+
+import (
+	"fmt"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestObserveFlagsFirstSightings(t *testing.T) {
+	start := time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)
+	tracker := NewTracker(Options{Days: 7, Capacity: 1000, WarmUp: 24 * time.Hour}, start)
+
+	if r := tracker.Observe("host-a", "example.com", start); !r.FirstSeenHost || !r.FirstSeenGlobal || !r.HostWarmingUp {
+		t.Errorf("expected first sighting during warm-up, got %+v", r)
+	}
+
+	now := start.Add(48 * time.Hour)
+	if r := tracker.Observe("host-a", "Example.com.", now); r.FirstSeenHost || r.FirstSeenGlobal || r.HostWarmingUp {
+		t.Errorf("expected a known domain after warm-up, got %+v", r)
+	}
+	if r := tracker.Observe("host-b", "example.com", now); !r.FirstSeenHost || r.FirstSeenGlobal {
+		t.Errorf("expected a new domain for host-b only, got %+v", r)
+	}
+	if r := tracker.Observe("host-b", "new.example", now); !r.FirstSeenHost || !r.FirstSeenGlobal {
+		t.Errorf("expected a new domain everywhere, got %+v", r)
+	}
+
+	// Domains are forgotten once their day leaves the history
+	later := start.Add(9 * 24 * time.Hour)
+	if r := tracker.Observe("host-b", "new.example", later); !r.FirstSeenHost || !r.FirstSeenGlobal {
+		t.Errorf("expected an expired domain to be new again, got %+v", r)
+	}
+}
+
+func TestHistoryPersists(t *testing.T) {
+	dir := t.TempDir()
+	start := time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)
+	opts := Options{
+		Days:       7,
+		Capacity:   1000,
+		WarmUp:     72 * time.Hour,
+		HostFile:   filepath.Join(dir, "host.nod"),
+		GlobalFile: filepath.Join(dir, "global.nod"),
+	}
+
+	first := NewTracker(opts, start)
+	for i := 0; i < 100; i++ {
+		first.Observe("host-a", fmt.Sprintf("domain%d.example", i), start)
+	}
+	if err := first.Save(start); err != nil {
+		t.Fatalf("save failed: %v", err)
+	}
+
+	// A restart keeps the history and the warm-up start
+	now := start.Add(24 * time.Hour)
+	restarted := NewTracker(opts, now)
+	if err := restarted.Load(); err != nil {
+		t.Fatalf("load failed: %v", err)
+	}
+	if r := restarted.Observe("host-a", "domain42.example", now); r.FirstSeenHost || r.FirstSeenGlobal || !r.HostWarmingUp {
+		t.Errorf("expected a restored domain still in warm-up, got %+v", r)
+	}
+
+	// A second collector sharing the global file learns the first one's domains
+	other := NewTracker(Options{Days: 7, Capacity: 1000, GlobalFile: opts.GlobalFile}, now)
+	other.Observe("host-b", "other.example", now)
+	if err := other.Save(now); err != nil {
+		t.Fatalf("save failed: %v", err)
+	}
+	if r := other.Observe("host-b", "domain7.example", now); r.FirstSeenGlobal {
+		t.Errorf("expected the shared history to include domains of other collectors")
+	}
+	if err := restarted.Load(); err != nil {
+		t.Fatalf("load failed: %v", err)
+	}
+	if r := restarted.Observe("host-a", "other.example", now); !r.FirstSeenHost || r.FirstSeenGlobal {
+		t.Errorf("expected other.example to be known fleet-wide only, got %+v", r)
+	}
+}
+
+func TestBloomFalsePositiveRate(t *testing.T) {
+	b := newBloom(10000, 0.01)
+	for i := 0; i < 10000; i++ {
+		b.add(fmt.Sprintf("seen-%d", i))
+	}
+	var falsePositives int
+	for i := 0; i < 10000; i++ {
+		if !b.test(fmt.Sprintf("seen-%d", i)) {
+			t.Fatalf("added key seen-%d not found", i)
+		}
+		if b.test(fmt.Sprintf("unseen-%d", i)) {
+			falsePositives++
+		}
+	}
+	if falsePositives > 200 {
+		t.Errorf("expected about 1%% false positives, got %d in 10000", falsePositives)
+	}
+}
@@ -0,0 +1,80 @@
+//go:build windows
+// +build windows
+
+package asimdns
+
+import (
+	"path/filepath"
+	"sync"
+	"syscall"
+	"time"
+	"unsafe"
+)
+
+const (
+	// processQueryLimitedInformation is PROCESS_QUERY_LIMITED_INFORMATION,
+	// which is enough to read the image name of another user's process
+	processQueryLimitedInformation = 0x1000
+	// processNameTTL bounds how long a name is trusted, as process IDs are reused
+	processNameTTL = time.Minute
+	// maxProcessNames limits the cache; it is emptied when full
+	maxProcessNames = 4096
+)
+
+var procQueryFullProcessImageName = syscall.NewLazyDLL("kernel32.dll").NewProc("QueryFullProcessImageNameW")
+
+type processName struct {
+	name    string
+	expires time.Time
+}
+
+// processNames resolves process IDs to image names, such as chrome.exe. Names
+// are cached briefly; a process that has already exited has no name.
+type processNames struct {
+	mux   sync.Mutex
+	names map[uint32]processName
+}
+
+func newProcessNames() *processNames {
+	return &processNames{names: make(map[uint32]processName)}
+}
+
+// Name returns the image name of a process, or "" when it cannot be resolved
+func (p *processNames) Name(pid uint32) string {
+	if pid == 0 {
+		return ""
+	}
+	now := time.Now()
+
+	p.mux.Lock()
+	defer p.mux.Unlock()
+	if entry, ok := p.names[pid]; ok && now.Before(entry.expires) {
+		return entry.name
+	}
+	if len(p.names) >= maxProcessNames {
+		p.names = make(map[uint32]processName)
+	}
+
+	// Failures are cached too, so exited processes are not looked up per event
+	name := processImageName(pid)
+	p.names[pid] = processName{name: name, expires: now.Add(processNameTTL)}
+	return name
+}
+
+// processImageName returns the file name of a process image
+func processImageName(pid uint32) string {
+	handle, err := syscall.OpenProcess(processQueryLimitedInformation, false, pid)
+	if err != nil {
+		return ""
+	}
+	defer syscall.CloseHandle(handle)
+
+	buf := make([]uint16, syscall.MAX_PATH)
+	size := uint32(len(buf))
+	ok, _, _ := procQueryFullProcessImageName.Call(uintptr(handle), 0,
+		uintptr(unsafe.Pointer(&buf[0])), uintptr(unsafe.Pointer(&size)))
+	if ok == 0 {
+		return ""
+	}
+	return filepath.Base(syscall.UTF16ToString(buf[:size]))
+}
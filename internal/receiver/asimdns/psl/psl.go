@@ -0,0 +1,160 @@
+// Package psl splits domain names into registered domain, subdomain and
+// public suffix using the Public Suffix List. The list compiled into the
+// binary can be replaced by a newer public_suffix_list.dat file at run time.
+package psl
+
+import (
+	"bufio"
+	"bytes"
+	"strings"
+
+	"golang.org/x/net/idna"
+	"golang.org/x/net/publicsuffix"
+
+	"github.com/LaurieRhodes/asim-dns-collector/internal/receiver/asimdns/dnsname"
+)
+
+// Reverse lookup zones, which are grouped under a single registered domain
+var reverseZones = []string{"in-addr.arpa", "ip6.arpa"}
+
+// Parts are the components of a domain name
+type Parts struct {
+	// Name is the lower-case ASCII form of the name without a trailing dot
+	Name string
+	// RegisteredDomain is the public suffix plus one label (eTLD+1). It is
+	// empty for single-label names and names that are themselves a public suffix.
+	RegisteredDomain string
+	// Subdomain is the part of the name left of the registered domain
+	Subdomain string
+	// PublicSuffix is the effective TLD, such as "co.uk" or "github.io"
+	PublicSuffix string
+	// TLD is the last label
+	TLD string
+	// Labels is the number of labels in the name
+	Labels int
+	// Private is set when the public suffix comes from the private section of
+	// the list, such as hosting and dynamic DNS providers
+	Private bool
+	// Reverse is set for PTR lookups under in-addr.arpa and ip6.arpa
+	Reverse bool
+}
+
+// rule is a parsed Public Suffix List entry
+type rule struct {
+	private bool
+}
+
+// List is a parsed Public Suffix List
+type List struct {
+	rules      map[string]rule
+	wildcards  map[string]rule
+	exceptions map[string]rule
+}
+
+// Parse reads a list in the public_suffix_list.dat format. Rules with
+// non-ASCII labels are converted to punycode.
+func Parse(data []byte) (*List, error) {
+	list := &List{
+		rules:      make(map[string]rule),
+		wildcards:  make(map[string]rule),
+		exceptions: make(map[string]rule),
+	}
+
+	private := false
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		switch {
+		case strings.Contains(line, "===BEGIN PRIVATE DOMAINS==="):
+			private = true
+			continue
+		case strings.Contains(line, "===END PRIVATE DOMAINS==="):
+			private = false
+			continue
+		case line == "" || strings.HasPrefix(line, "//"):
+			continue
+		}
+
+		entry := strings.Fields(line)[0]
+		target := list.rules
+		switch {
+		case strings.HasPrefix(entry, "!"):
+			target, entry = list.exceptions, entry[1:]
+		case strings.HasPrefix(entry, "*."):
+			target, entry = list.wildcards, entry[2:]
+		}
+		ascii, err := idna.ToASCII(strings.ToLower(entry))
+		if err != nil {
+			continue
+		}
+		target[ascii] = rule{private: private}
+	}
+	return list, scanner.Err()
+}
+
+// Len returns the number of rules in the list
+func (l *List) Len() int {
+	return len(l.rules) + len(l.wildcards) + len(l.exceptions)
+}
+
+// PublicSuffix returns the public suffix of an ASCII name and whether it
+// comes from the private section. Names matching no rule use their last label.
+func (l *List) PublicSuffix(name string) (string, bool) {
+	labels := strings.Split(name, ".")
+	for i := range labels {
+		suffix := strings.Join(labels[i:], ".")
+		if r, ok := l.exceptions[suffix]; ok {
+			return strings.Join(labels[i+1:], "."), r.private
+		}
+		if r, ok := l.wildcards[suffix]; ok && i > 0 {
+			return strings.Join(labels[i-1:], "."), r.private
+		}
+		if r, ok := l.rules[suffix]; ok {
+			return suffix, r.private
+		}
+	}
+	return labels[len(labels)-1], false
+}
+
+// embeddedSuffix looks a name up in the list compiled into x/net
+func embeddedSuffix(name string) (string, bool) {
+	suffix, icann := publicsuffix.PublicSuffix(name)
+	// Names that match no rule are reported as non-ICANN single labels
+	return suffix, !icann && strings.Contains(suffix, ".")
+}
+
+// split divides a name using a public suffix lookup
+func split(name string, lookup func(string) (string, bool)) Parts {
+	name = dnsname.ToASCII(name)
+	parts := Parts{Name: name}
+	if name == "" {
+		return parts
+	}
+	parts.Labels = strings.Count(name, ".") + 1
+	if parts.Labels == 1 {
+		return parts
+	}
+	parts.TLD = name[strings.LastIndexByte(name, '.')+1:]
+
+	for _, zone := range reverseZones {
+		if name == zone || strings.HasSuffix(name, "."+zone) {
+			parts.Reverse = true
+			parts.PublicSuffix = zone
+			parts.RegisteredDomain = zone
+			parts.Subdomain = strings.TrimSuffix(strings.TrimSuffix(name, zone), ".")
+			return parts
+		}
+	}
+
+	parts.PublicSuffix, parts.Private = lookup(name)
+	if parts.PublicSuffix == name {
+		return parts
+	}
+	rest := strings.TrimSuffix(name, "."+parts.PublicSuffix)
+	i := strings.LastIndexByte(rest, '.')
+	parts.RegisteredDomain = rest[i+1:] + "." + parts.PublicSuffix
+	if i >= 0 {
+		parts.Subdomain = rest[:i]
+	}
+	return parts
+}
@@ -0,0 +1,107 @@
+package psl
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"go.uber.org/zap"
+)
+
+func TestSplitEmbedded(t *testing.T) {
+	r := NewResolver(zap.NewNop(), "")
+
+	tests := []struct {
+		name string
+		want Parts
+	}{
+		{"WWW.Example.COM.", Parts{Name: "www.example.com", RegisteredDomain: "example.com", Subdomain: "www", PublicSuffix: "com", TLD: "com", Labels: 3}},
+		{"a.b.bbc.co.uk", Parts{Name: "a.b.bbc.co.uk", RegisteredDomain: "bbc.co.uk", Subdomain: "a.b", PublicSuffix: "co.uk", TLD: "uk", Labels: 5}},
+		{"user.github.io", Parts{Name: "user.github.io", RegisteredDomain: "user.github.io", PublicSuffix: "github.io", TLD: "io", Labels: 3, Private: true}},
+		{"www.bücher.de", Parts{Name: "www.xn--bcher-kva.de", RegisteredDomain: "xn--bcher-kva.de", Subdomain: "www", PublicSuffix: "de", TLD: "de", Labels: 3}},
+		{"10.2.0.192.in-addr.arpa", Parts{Name: "10.2.0.192.in-addr.arpa", RegisteredDomain: "in-addr.arpa", Subdomain: "10.2.0.192", PublicSuffix: "in-addr.arpa", TLD: "arpa", Labels: 6, Reverse: true}},
+		{"co.uk", Parts{Name: "co.uk", PublicSuffix: "co.uk", TLD: "uk", Labels: 2}},
+		{"wpad", Parts{Name: "wpad", Labels: 1}},
+		{"", Parts{}},
+	}
+	for _, tt := range tests {
+		if got := r.Split(tt.name); got != tt.want {
+			t.Errorf("Split(%q) = %+v, want %+v", tt.name, got, tt.want)
+		}
+	}
+
+	if got := r.RegisteredDomain("fileserver"); got != "fileserver" {
+		t.Errorf("expected a single-label name to be its own registered domain, got %q", got)
+	}
+}
+
+const testList = `// ===BEGIN ICANN DOMAINS===
+com
+uk
+co.uk
+*.ck
+!www.ck
+// ===END ICANN DOMAINS===
+// ===BEGIN PRIVATE DOMAINS===
+// Example hosting provider
+pages.example.com
+// ===END PRIVATE DOMAINS===
+`
+
+func TestParseRules(t *testing.T) {
+	list, err := Parse([]byte(testList))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		suffix  string
+		private bool
+	}{
+		{"www.example.co.uk", "co.uk", false},
+		{"site.pages.example.com", "pages.example.com", true},
+		{"a.b.ck", "b.ck", false},
+		{"www.ck", "ck", false},
+		{"a.www.ck", "ck", false},
+		{"example.unlisted", "unlisted", false},
+	}
+	for _, tt := range tests {
+		if suffix, private := list.PublicSuffix(tt.name); suffix != tt.suffix || private != tt.private {
+			t.Errorf("PublicSuffix(%q) = %q %v, want %q %v", tt.name, suffix, private, tt.suffix, tt.private)
+		}
+	}
+}
+
+func TestReloadReplacesEmbeddedList(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "public_suffix_list.dat")
+	r := NewResolver(zap.NewNop(), path)
+
+	// A truncated file is rejected and the embedded list stays in use
+	if err := os.WriteFile(path, []byte(testList), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := r.Reload(); err == nil {
+		t.Fatal("expected a truncated list to be rejected")
+	}
+	if got := r.Split("site.pages.example.com").RegisteredDomain; got != "example.com" {
+		t.Errorf("expected the embedded list, got %q", got)
+	}
+
+	var b strings.Builder
+	b.WriteString(testList)
+	for i := 0; i < minRules; i++ {
+		fmt.Fprintf(&b, "filler%d\n", i)
+	}
+	if err := os.WriteFile(path, []byte(b.String()), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := r.Reload(); err != nil {
+		t.Fatalf("reload failed: %v", err)
+	}
+	if parts := r.Split("site.pages.example.com"); parts.RegisteredDomain != "site.pages.example.com" || !parts.Private {
+		t.Errorf("expected the file list with its private rule, got %+v", parts)
+	}
+}
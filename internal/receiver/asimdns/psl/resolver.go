@@ -0,0 +1,108 @@
+package psl
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// minRules guards against replacing the list with a truncated download
+const minRules = 1000
+
+// Resolver splits names using the embedded list, or a list file when one is
+// configured. The file is reloaded when its size or modification time changes.
+type Resolver struct {
+	logger  *zap.Logger
+	path    string
+	mux     sync.RWMutex
+	list    *List
+	modTime time.Time
+	size    int64
+}
+
+// NewResolver creates a resolver. An empty path uses the embedded list only.
+func NewResolver(logger *zap.Logger, path string) *Resolver {
+	return &Resolver{logger: logger, path: path}
+}
+
+// Reload reads the list file if it changed. On error the previous list stays in use.
+func (r *Resolver) Reload() error {
+	if r.path == "" {
+		return nil
+	}
+	info, err := os.Stat(r.path)
+	if err != nil {
+		return err
+	}
+
+	r.mux.RLock()
+	unchanged := r.list != nil && info.ModTime().Equal(r.modTime) && info.Size() == r.size
+	r.mux.RUnlock()
+	if unchanged {
+		return nil
+	}
+
+	data, err := os.ReadFile(r.path)
+	if err != nil {
+		return err
+	}
+	list, err := Parse(data)
+	if err != nil {
+		return fmt.Errorf("parsing public suffix list %s: %w", r.path, err)
+	}
+	if list.Len() < minRules {
+		return fmt.Errorf("public suffix list %s has only %d rules", r.path, list.Len())
+	}
+
+	r.mux.Lock()
+	r.list, r.modTime, r.size = list, info.ModTime(), info.Size()
+	r.mux.Unlock()
+	r.logger.Info("Loaded public suffix list", zap.String("path", r.path), zap.Int("rules", list.Len()))
+	return nil
+}
+
+// Watch reloads the list file at the given interval until the context is done
+func (r *Resolver) Watch(ctx context.Context, interval time.Duration) {
+	if r.path == "" {
+		return
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := r.Reload(); err != nil {
+				r.logger.Warn("Public suffix list reload failed", zap.Error(err))
+			}
+		}
+	}
+}
+
+// Split divides a name into its registered domain, subdomain and suffix
+func (r *Resolver) Split(name string) Parts {
+	r.mux.RLock()
+	list := r.list
+	r.mux.RUnlock()
+
+	if list == nil {
+		return split(name, embeddedSuffix)
+	}
+	return split(name, list.PublicSuffix)
+}
+
+// RegisteredDomain returns the registered domain of a name, or the name
+// itself when it has none
+func (r *Resolver) RegisteredDomain(name string) string {
+	parts := r.Split(name)
+	if parts.RegisteredDomain == "" {
+		return parts.Name
+	}
+	return parts.RegisteredDomain
+}
@@ -0,0 +1,269 @@
+// Package rawevent preserves the raw ETW event behind a transformed record,
+// so history can be re-processed when the ASIM mapping improves. Events are
+// kept as JSON-compatible values within a size limit; the largest payload
+// values are truncated first.
+package rawevent
+
+import (
+	"bytes"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Modes of preservation
+const (
+	// ModeNone keeps no raw event
+	ModeNone = "none"
+	// ModeBody replaces the record body with a map of the message and the raw event
+	ModeBody = "body"
+	// ModeAttribute adds the raw event as the EventOriginal attribute
+	ModeAttribute = "attribute"
+)
+
+// Content kinds
+const (
+	// ContentEvent keeps the System header and the full event payload
+	ContentEvent = "event"
+	// ContentPacket keeps only the DNS packet bytes of events that carry one,
+	// and the full event otherwise
+	ContentPacket = "packet"
+)
+
+// DefaultMaxSize is the default limit in bytes of an encoded raw event
+const DefaultMaxSize = 16384
+
+// truncatedMarker replaces payload values dropped to fit the size limit
+const truncatedMarker = "[truncated]"
+
+// payloadKeys are the parts of an event whose values may be truncated
+var payloadKeys = []string{"EventData", "UserData", "ExtendedData"}
+
+// Settings configures a preserver
+type Settings struct {
+	Mode    string
+	Content string
+	// MaxSize limits the JSON, or hexadecimal packet, encoding in bytes
+	MaxSize int
+	// EventTypes limits preservation to records of these ASIM event types;
+	// empty preserves every record
+	EventTypes []string
+}
+
+// Preserver encodes raw events for the records that keep them
+type Preserver struct {
+	mode    string
+	content string
+	maxSize int
+	types   map[string]bool
+}
+
+// NewPreserver validates settings and creates a preserver. Empty values
+// take the defaults.
+func NewPreserver(settings Settings) (*Preserver, error) {
+	p := &Preserver{
+		mode:    settings.Mode,
+		content: settings.Content,
+		maxSize: settings.MaxSize,
+	}
+	if p.mode == "" {
+		p.mode = ModeNone
+	}
+	if p.content == "" {
+		p.content = ContentEvent
+	}
+	if p.maxSize == 0 {
+		p.maxSize = DefaultMaxSize
+	}
+	switch p.mode {
+	case ModeNone, ModeBody, ModeAttribute:
+	default:
+		return nil, fmt.Errorf("raw_event_mode must be %s, %s or %s, got %q", ModeNone, ModeBody, ModeAttribute, p.mode)
+	}
+	switch p.content {
+	case ContentEvent, ContentPacket:
+	default:
+		return nil, fmt.Errorf("raw_event_content must be %s or %s, got %q", ContentEvent, ContentPacket, p.content)
+	}
+	if p.maxSize < 0 {
+		return nil, fmt.Errorf("raw_event_max_size must not be negative")
+	}
+	if len(settings.EventTypes) > 0 {
+		p.types = make(map[string]bool, len(settings.EventTypes))
+		for _, t := range settings.EventTypes {
+			p.types[t] = true
+		}
+	}
+	return p, nil
+}
+
+// Mode returns the preservation mode
+func (p *Preserver) Mode() string {
+	return p.mode
+}
+
+// Preserves reports whether records of an ASIM event type keep their raw event
+func (p *Preserver) Preserves(eventType string) bool {
+	if p.mode == ModeNone {
+		return false
+	}
+	return p.types == nil || p.types[eventType]
+}
+
+// Original is a preserved raw event
+type Original struct {
+	// Value is the event as a map of JSON-compatible values, with integers
+	// as int64, or nil when the packet is kept
+	Value map[string]any
+	// Packet holds the DNS packet bytes when the packet is kept
+	Packet []byte
+	// Encoded is the JSON encoding of the event, or the packet in
+	// hexadecimal, within the size limit
+	Encoded string
+	// Size is the encoded size before truncation
+	Size int
+	// Truncated reports that values were dropped to fit the size limit. An
+	// event whose header alone exceeds the limit keeps nothing.
+	Truncated bool
+}
+
+// Preserve encodes an event, given as a value that marshals to a JSON
+// object, or the DNS packet it carries
+func (p *Preserver) Preserve(event any, packet []byte) (Original, error) {
+	if p.content == ContentPacket && len(packet) > 0 {
+		return p.preservePacket(packet), nil
+	}
+
+	data, err := json.Marshal(event)
+	if err != nil {
+		return Original{}, err
+	}
+	original := Original{Size: len(data)}
+	value, err := decode(data)
+	if err != nil {
+		return Original{}, err
+	}
+
+	if len(data) > p.maxSize {
+		original.Truncated = true
+		for _, leaf := range payloadLeaves(value) {
+			leaf.set(truncatedMarker)
+			if data, err = json.Marshal(value); err != nil {
+				return Original{}, err
+			}
+			if len(data) <= p.maxSize {
+				break
+			}
+		}
+		if len(data) > p.maxSize {
+			return original, nil
+		}
+	}
+	original.Value = value
+	original.Encoded = string(data)
+	return original, nil
+}
+
+// preservePacket keeps as much of a packet as fits the size limit. A
+// truncated packet still holds its header and leading records.
+func (p *Preserver) preservePacket(packet []byte) Original {
+	original := Original{Size: hex.EncodedLen(len(packet))}
+	if original.Size > p.maxSize {
+		original.Truncated = true
+		packet = packet[:p.maxSize/2]
+	}
+	original.Packet = packet
+	original.Encoded = hex.EncodeToString(packet)
+	return original
+}
+
+// decode decodes a JSON object, keeping integers exact: integers become
+// int64 and those beyond its range strings
+func decode(data []byte) (map[string]any, error) {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	var value map[string]any
+	if err := dec.Decode(&value); err != nil {
+		return nil, err
+	}
+	if value == nil {
+		return nil, fmt.Errorf("raw event is not a JSON object")
+	}
+	return normalize(value).(map[string]any), nil
+}
+
+func normalize(v any) any {
+	switch v := v.(type) {
+	case map[string]any:
+		for k, item := range v {
+			v[k] = normalize(item)
+		}
+		return v
+	case []any:
+		for i, item := range v {
+			v[i] = normalize(item)
+		}
+		return v
+	case json.Number:
+		if n, err := v.Int64(); err == nil {
+			return n
+		}
+		// Integers beyond int64, such as keyword masks, stay exact as strings
+		if !strings.ContainsAny(v.String(), ".eE") {
+			return v.String()
+		}
+		if f, err := v.Float64(); err == nil {
+			return f
+		}
+		return v.String()
+	default:
+		return v
+	}
+}
+
+// leaf is a string value within the event payload
+type leaf struct {
+	path   string
+	length int
+	set    func(any)
+}
+
+// payloadLeaves returns the string values of the event payload, longest first
+func payloadLeaves(value map[string]any) []leaf {
+	var leaves []leaf
+	var walk func(path string, v any, set func(any))
+	walk = func(path string, v any, set func(any)) {
+		switch v := v.(type) {
+		case map[string]any:
+			for k, item := range v {
+				k := k
+				walk(path+"."+k, item, func(n any) { v[k] = n })
+			}
+		case []any:
+			for i, item := range v {
+				i := i
+				walk(path+"."+strconv.Itoa(i), item, func(n any) { v[i] = n })
+			}
+		case string:
+			if len(v) > len(truncatedMarker) {
+				leaves = append(leaves, leaf{path: path, length: len(v), set: set})
+			}
+		}
+	}
+	for _, key := range payloadKeys {
+		if payload, ok := value[key]; ok {
+			key := key
+			walk(key, payload, func(n any) { value[key] = n })
+		}
+	}
+	sort.Slice(leaves, func(i, j int) bool {
+		if leaves[i].length != leaves[j].length {
+			return leaves[i].length > leaves[j].length
+		}
+		return leaves[i].path < leaves[j].path
+	})
+	return leaves
+}
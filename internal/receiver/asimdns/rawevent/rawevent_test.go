@@ -0,0 +1,127 @@
+package rawevent
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+// sampleEvent has the layout of a marshalled ETW event
+func sampleEvent(packetData string) map[string]any {
+	return map[string]any{
+		"EventData": map[string]any{
+			"QNAME":      "www.contoso.com.",
+			"QTYPE":      "1",
+			"PacketData": packetData,
+		},
+		"System": map[string]any{
+			"EventID":  uint16(257),
+			"Keywords": map[string]any{"Value": uint64(0x8000000000000FFF), "Name": ""},
+			"Provider": map[string]any{"Guid": "{EB79061A-A566-4698-9119-3ED2807060E7}", "Name": "Microsoft-Windows-DNSServer"},
+		},
+	}
+}
+
+func TestPreserveEvent(t *testing.T) {
+	p, err := NewPreserver(Settings{Mode: ModeAttribute})
+	if err != nil {
+		t.Fatal(err)
+	}
+	original, err := p.Preserve(sampleEvent("0x1234"), []byte{0x12, 0x34})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if original.Truncated || original.Packet != nil || original.Size != len(original.Encoded) {
+		t.Errorf("unexpected original %+v", original)
+	}
+	system := original.Value["System"].(map[string]any)
+	if system["EventID"] != int64(257) {
+		t.Errorf("EventID = %#v, want int64 257", system["EventID"])
+	}
+	if keywords := system["Keywords"].(map[string]any); keywords["Value"] != "9223372036854779903" {
+		t.Errorf("keyword mask = %#v, want an exact string", keywords["Value"])
+	}
+	var decoded map[string]any
+	if err := json.Unmarshal([]byte(original.Encoded), &decoded); err != nil {
+		t.Errorf("encoded event is not JSON: %v", err)
+	}
+}
+
+func TestPreservePacket(t *testing.T) {
+	p, err := NewPreserver(Settings{Mode: ModeBody, Content: ContentPacket, MaxSize: 6})
+	if err != nil {
+		t.Fatal(err)
+	}
+	original, err := p.Preserve(sampleEvent("0x12345678"), []byte{0x12, 0x34, 0x56, 0x78})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if original.Encoded != "123456" || !original.Truncated || original.Size != 8 || original.Value != nil {
+		t.Errorf("unexpected packet original %+v", original)
+	}
+
+	// Events without a packet keep the full event
+	p, _ = NewPreserver(Settings{Mode: ModeBody, Content: ContentPacket})
+	original, err = p.Preserve(map[string]any{"System": map[string]any{"EventID": 3008}}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if original.Value == nil || original.Truncated {
+		t.Errorf("event without a packet not kept: %+v", original)
+	}
+}
+
+func TestSizeLimit(t *testing.T) {
+	event := sampleEvent("0x" + strings.Repeat("ab", 2000))
+	p, err := NewPreserver(Settings{Mode: ModeAttribute, MaxSize: 400})
+	if err != nil {
+		t.Fatal(err)
+	}
+	original, err := p.Preserve(event, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !original.Truncated || len(original.Encoded) > 400 || original.Size <= 4000 {
+		t.Fatalf("unexpected truncation %d of %d bytes", len(original.Encoded), original.Size)
+	}
+	data := original.Value["EventData"].(map[string]any)
+	if data["PacketData"] != truncatedMarker || data["QNAME"] != "www.contoso.com." {
+		t.Errorf("truncation dropped the wrong values: %v", data)
+	}
+
+	// A header larger than the limit keeps nothing
+	p, _ = NewPreserver(Settings{Mode: ModeAttribute, MaxSize: 40})
+	original, err = p.Preserve(event, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !original.Truncated || original.Value != nil || original.Encoded != "" {
+		t.Errorf("oversized header kept: %+v", original)
+	}
+}
+
+func TestEventTypes(t *testing.T) {
+	p, err := NewPreserver(Settings{Mode: ModeBody, EventTypes: []string{"Query"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !p.Preserves("Query") || p.Preserves("Info") {
+		t.Errorf("event type selection not applied")
+	}
+	p, _ = NewPreserver(Settings{})
+	if p.Mode() != ModeNone || p.Preserves("Query") {
+		t.Errorf("preservation must be off by default")
+	}
+}
+
+func TestInvalidSettings(t *testing.T) {
+	for name, settings := range map[string]Settings{
+		"mode":     {Mode: "inline"},
+		"content":  {Mode: ModeBody, Content: "payload"},
+		"max size": {Mode: ModeBody, MaxSize: -1},
+	} {
+		if _, err := NewPreserver(settings); err == nil {
+			t.Errorf("%s: expected an error", name)
+		}
+	}
+}
@@ -0,0 +1,342 @@
+// Package recommend analyses heavy-hitter statistics gathered over a learning
+// period and suggests exclusions as a ready-to-use receiver configuration.
+package recommend
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/LaurieRhodes/asim-dns-collector/internal/receiver/asimdns/stats"
+)
+
+// Suggestion kinds
+const (
+	KindDomain           = "domain"
+	KindRegisteredDomain = "registered_domain"
+	KindEventID          = "event_id"
+	KindProcess          = "process"
+)
+
+// Options controls which suggestions are made
+type Options struct {
+	// MinShare is the minimum fraction of exported events a suggestion must remove
+	MinShare float64
+	// MaxSuggestions limits the number of suggestions
+	MaxSuggestions int
+	// ProtectedDomains are patterns that are never excluded, directly or through a parent domain
+	ProtectedDomains []string
+	// ProtectedEventIDs are event IDs that are never suggested for exclusion
+	ProtectedEventIDs []uint16
+	// IncludeProcesses enables process suggestions. Disable it when a single
+	// process produces all events, as on a DNS server.
+	IncludeProcesses bool
+}
+
+// Current describes the exclusions already configured
+type Current struct {
+	ExcludedDomains           []string
+	ExcludedRegisteredDomains []string
+	ExcludedEventIDs          []uint16
+}
+
+// Suggestion is a single recommended exclusion
+type Suggestion struct {
+	Kind  string `json:"kind"`
+	Value string `json:"value"`
+	// Events is the approximate number of exported events the exclusion removes
+	Events int64 `json:"events"`
+	// Reduction is the estimated fraction of exported volume removed
+	Reduction float64 `json:"reduction"`
+}
+
+// Recommendation is the result of analysing a learning period
+type Recommendation struct {
+	GeneratedAt        time.Time    `json:"generated_at"`
+	LearningSeconds    int64        `json:"learning_seconds"`
+	ObservedEvents     int64        `json:"observed_events"`
+	ExportedEvents     int64        `json:"exported_events"`
+	EstimatedReduction float64      `json:"estimated_reduction"`
+	Suggestions        []Suggestion `json:"suggestions"`
+	current            Current
+}
+
+// Recommender produces exclusion suggestions from statistics reports
+type Recommender struct {
+	opts      Options
+	protected []*regexp.Regexp
+	// protectors are additional checks, such as threat or allow lists
+	protectors []func(domain string) bool
+}
+
+// New creates a recommender
+func New(opts Options) *Recommender {
+	if opts.MaxSuggestions <= 0 {
+		opts.MaxSuggestions = 20
+	}
+
+	r := &Recommender{opts: opts}
+	for _, pattern := range opts.ProtectedDomains {
+		r.protected = append(r.protected, globRegexp(pattern))
+	}
+	return r
+}
+
+// AddProtector registers an additional check for domains that must never be excluded
+func (r *Recommender) AddProtector(fn func(domain string) bool) {
+	r.protectors = append(r.protectors, fn)
+}
+
+// Recommend analyses a report covering the learning period
+func (r *Recommender) Recommend(report stats.Report, current Current) Recommendation {
+	before := report.Stages[stats.StageBeforeFiltering]
+	after := report.Stages[stats.StageAfterFiltering]
+
+	rec := Recommendation{
+		GeneratedAt:     report.GeneratedAt,
+		LearningSeconds: report.WindowSeconds,
+		ObservedEvents:  before.Total,
+		ExportedEvents:  after.Total,
+		Suggestions:     []Suggestion{},
+		current:         current,
+	}
+	if after.Total == 0 {
+		return rec
+	}
+
+	var candidates []Suggestion
+	candidates = append(candidates, r.domainSuggestions(after, current)...)
+	candidates = append(candidates, r.eventIDSuggestions(after, current)...)
+	if r.opts.IncludeProcesses {
+		candidates = append(candidates, r.processSuggestions(after)...)
+	}
+
+	sort.SliceStable(candidates, func(i, j int) bool {
+		return candidates[i].Events > candidates[j].Events
+	})
+	if len(candidates) > r.opts.MaxSuggestions {
+		candidates = candidates[:r.opts.MaxSuggestions]
+	}
+
+	// Suggestions may overlap, so cap the combined estimate
+	for _, s := range candidates {
+		rec.EstimatedReduction += s.Reduction
+	}
+	if rec.EstimatedReduction > 1 {
+		rec.EstimatedReduction = 1
+	}
+	rec.Suggestions = candidates
+	return rec
+}
+
+// domainSuggestions suggests noisy registered domains, falling back to
+// individual query names when the registered domain is protected
+func (r *Recommender) domainSuggestions(after stats.StageReport, current Current) []Suggestion {
+	existing := make([]*regexp.Regexp, 0, len(current.ExcludedDomains))
+	for _, pattern := range current.ExcludedDomains {
+		existing = append(existing, globRegexp(pattern))
+	}
+
+	// Names under an excluded or suggested registered domain are covered by it
+	var suggested []string
+	for _, domain := range current.ExcludedRegisteredDomains {
+		suggested = append(suggested, strings.ToLower(strings.TrimSuffix(domain, ".")))
+	}
+
+	var suggestions []Suggestion
+	for _, e := range after.Dimensions[stats.DimensionRegisteredDomain] {
+		if !r.qualifies(e, after.Total) || matchesAny(existing, e.Key) || coveredBy(e.Key, suggested) ||
+			r.isProtected(e.Key, true) {
+			continue
+		}
+		suggestions = append(suggestions, r.suggestion(KindRegisteredDomain, e.Key, e, after.Total))
+		suggested = append(suggested, e.Key)
+	}
+
+	for _, e := range after.Dimensions[stats.DimensionQueryDomain] {
+		if !r.qualifies(e, after.Total) || matchesAny(existing, e.Key) || r.isProtected(e.Key, false) {
+			continue
+		}
+		if coveredBy(e.Key, suggested) {
+			continue
+		}
+		suggestions = append(suggestions, r.suggestion(KindDomain, e.Key, e, after.Total))
+	}
+	return suggestions
+}
+
+// eventIDSuggestions suggests event IDs that make up a large share of exported events
+func (r *Recommender) eventIDSuggestions(after stats.StageReport, current Current) []Suggestion {
+	skip := make(map[string]bool)
+	for _, id := range current.ExcludedEventIDs {
+		skip[strconv.Itoa(int(id))] = true
+	}
+	for _, id := range r.opts.ProtectedEventIDs {
+		skip[strconv.Itoa(int(id))] = true
+	}
+
+	var suggestions []Suggestion
+	for _, e := range after.Dimensions[stats.DimensionEventID] {
+		if !r.qualifies(e, after.Total) || skip[e.Key] {
+			continue
+		}
+		suggestions = append(suggestions, r.suggestion(KindEventID, e.Key, e, after.Total))
+	}
+	return suggestions
+}
+
+// processSuggestions suggests chatty processes by image name
+func (r *Recommender) processSuggestions(after stats.StageReport) []Suggestion {
+	var suggestions []Suggestion
+	for _, e := range after.Dimensions[stats.DimensionProcess] {
+		if !r.qualifies(e, after.Total) {
+			continue
+		}
+		suggestions = append(suggestions, r.suggestion(KindProcess, e.Key, e, after.Total))
+	}
+	return suggestions
+}
+
+// qualifies reports whether an entry removes at least the minimum share of events
+func (r *Recommender) qualifies(e stats.Entry, total int64) bool {
+	return e.Key != "" && float64(e.Count)/float64(total) >= r.opts.MinShare
+}
+
+// suggestion builds a suggestion for an entry
+func (r *Recommender) suggestion(kind, value string, e stats.Entry, total int64) Suggestion {
+	reduction := float64(e.Count) / float64(total)
+	if reduction > 1 {
+		reduction = 1
+	}
+	return Suggestion{Kind: kind, Value: value, Events: e.Count, Reduction: reduction}
+}
+
+// isProtected reports whether excluding the domain would exclude a protected
+// name. With subdomains set, the exclusion also covers every subdomain.
+func (r *Recommender) isProtected(domain string, subdomains bool) bool {
+	for _, fn := range r.protectors {
+		if fn(domain) {
+			return true
+		}
+	}
+
+	for i, re := range r.protected {
+		if re.MatchString(domain) {
+			return true
+		}
+		if !subdomains {
+			continue
+		}
+		base := strings.ToLower(strings.TrimPrefix(r.opts.ProtectedDomains[i], "*."))
+		if base == domain || strings.HasSuffix(base, "."+domain) {
+			return true
+		}
+	}
+	return false
+}
+
+// coveredBy reports whether name equals or is a subdomain of any of the domains
+func coveredBy(name string, domains []string) bool {
+	for _, d := range domains {
+		if name == d || strings.HasSuffix(name, "."+d) {
+			return true
+		}
+	}
+	return false
+}
+
+// matchesAny reports whether any pattern matches the name
+func matchesAny(patterns []*regexp.Regexp, name string) bool {
+	for _, re := range patterns {
+		if re.MatchString(name) {
+			return true
+		}
+	}
+	return false
+}
+
+// globRegexp converts a domain pattern to a case-insensitive regular expression
+func globRegexp(pattern string) *regexp.Regexp {
+	quoted := regexp.QuoteMeta(strings.TrimSuffix(pattern, "."))
+	quoted = strings.ReplaceAll(quoted, `\*`, ".*")
+	return regexp.MustCompile("(?i)^" + quoted + "$")
+}
+
+// YAML renders the recommendation as a receiver configuration snippet. The
+// lists include the exclusions already configured so they can replace them.
+func (rec Recommendation) YAML() string {
+	var b strings.Builder
+
+	fmt.Fprintf(&b, "# Recommended asimdns exclusions generated %s\n", rec.GeneratedAt.UTC().Format(time.RFC3339))
+	fmt.Fprintf(&b, "# Learning period: %s, observed events: %d, exported events: %d\n",
+		time.Duration(rec.LearningSeconds)*time.Second, rec.ObservedEvents, rec.ExportedEvents)
+	if len(rec.Suggestions) == 0 {
+		b.WriteString("# No exclusions recommended\n")
+		return b.String()
+	}
+	fmt.Fprintf(&b, "# Estimated volume reduction: %s\n", percent(rec.EstimatedReduction))
+
+	var domains, registeredDomains, eventIDs, processes []Suggestion
+	for _, s := range rec.Suggestions {
+		switch s.Kind {
+		case KindDomain:
+			domains = append(domains, s)
+		case KindRegisteredDomain:
+			registeredDomains = append(registeredDomains, s)
+		case KindEventID:
+			eventIDs = append(eventIDs, s)
+		case KindProcess:
+			processes = append(processes, s)
+		}
+	}
+
+	if len(domains) > 0 {
+		b.WriteString("excluded_domains:\n")
+		for _, pattern := range rec.current.ExcludedDomains {
+			fmt.Fprintf(&b, "  - %s\n", strconv.Quote(pattern))
+		}
+		for _, s := range domains {
+			fmt.Fprintf(&b, "  - %s # ~%s of exported volume (%d events)\n", strconv.Quote(s.Value), percent(s.Reduction), s.Events)
+		}
+	}
+
+	if len(registeredDomains) > 0 {
+		b.WriteString("excluded_registered_domains:\n")
+		for _, domain := range rec.current.ExcludedRegisteredDomains {
+			fmt.Fprintf(&b, "  - %s\n", strconv.Quote(domain))
+		}
+		for _, s := range registeredDomains {
+			fmt.Fprintf(&b, "  - %s # ~%s of exported volume (%d events)\n", strconv.Quote(s.Value), percent(s.Reduction), s.Events)
+		}
+	}
+
+	if len(eventIDs) > 0 {
+		b.WriteString("excluded_event_ids:\n")
+		for _, id := range rec.current.ExcludedEventIDs {
+			fmt.Fprintf(&b, "  - %d\n", id)
+		}
+		for _, s := range eventIDs {
+			fmt.Fprintf(&b, "  - %s # ~%s of exported volume (%d events)\n", s.Value, percent(s.Reduction), s.Events)
+		}
+	}
+
+	if len(processes) > 0 {
+		b.WriteString("# Append these to any existing filter_rules\n")
+		b.WriteString("filter_rules:\n")
+		for _, s := range processes {
+			fmt.Fprintf(&b, "  - name: exclude-process-%s # ~%s of exported volume (%d events)\n", s.Value, percent(s.Reduction), s.Events)
+			fmt.Fprintf(&b, "    expression: %s\n", strconv.Quote("SrcProcessName == "+strconv.Quote(s.Value)))
+			b.WriteString("    action: drop\n")
+		}
+	}
+
+	return b.String()
+}
+
+// percent formats a fraction as a percentage
+func percent(fraction float64) string {
+	return strconv.FormatFloat(fraction*100, 'f', 1, 64) + "%"
+}
@@ -0,0 +1,133 @@
+package recommend
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/LaurieRhodes/asim-dns-collector/internal/receiver/asimdns/stats"
+)
+
+func testReport() stats.Report {
+	return stats.Report{
+		GeneratedAt:   time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC),
+		WindowSeconds: 86400,
+		Stages: map[string]stats.StageReport{
+			stats.StageBeforeFiltering: {Total: 2000},
+			stats.StageAfterFiltering: {
+				Total: 1000,
+				Dimensions: map[string][]stats.Entry{
+					stats.DimensionRegisteredDomain: {
+						{Key: "telemetry.example", Count: 400},
+						{Key: "corp.local", Count: 300},
+						{Key: "rare.example", Count: 1},
+					},
+					stats.DimensionQueryDomain: {
+						{Key: "www.telemetry.example", Count: 400},
+						{Key: "wpad.corp.local", Count: 250},
+						{Key: "login.corp.local", Count: 50},
+					},
+					stats.DimensionEventID: {
+						{Key: "256", Count: 900},
+						{Key: "280", Count: 100},
+					},
+					stats.DimensionProcess: {
+						{Key: "updater.exe", Count: 600},
+					},
+				},
+			},
+		},
+	}
+}
+
+func TestRecommendRespectsProtectedDomains(t *testing.T) {
+	r := New(Options{
+		MinShare:          0.05,
+		ProtectedDomains:  []string{"login.corp.local"},
+		ProtectedEventIDs: []uint16{256},
+	})
+	rec := r.Recommend(testReport(), Current{ExcludedEventIDs: []uint16{1001}})
+
+	values := make(map[string]Suggestion)
+	for _, s := range rec.Suggestions {
+		values[s.Kind+":"+s.Value] = s
+	}
+
+	if _, ok := values["registered_domain:telemetry.example"]; !ok {
+		t.Errorf("expected noisy registered domain to be suggested: %+v", rec.Suggestions)
+	}
+	if _, ok := values["domain:www.telemetry.example"]; ok {
+		t.Errorf("query name covered by a suggested registered domain must not be repeated")
+	}
+	if _, ok := values["registered_domain:corp.local"]; ok {
+		t.Errorf("registered domain containing a protected name must not be suggested")
+	}
+	if _, ok := values["domain:wpad.corp.local"]; !ok {
+		t.Errorf("expected unprotected query name to be suggested instead: %+v", rec.Suggestions)
+	}
+	if _, ok := values["domain:rare.example"]; ok {
+		t.Errorf("domain below the minimum share must not be suggested")
+	}
+	if _, ok := values["event_id:256"]; ok {
+		t.Errorf("protected event ID must not be suggested")
+	}
+	if s, ok := values["event_id:280"]; !ok || s.Reduction != 0.1 {
+		t.Errorf("expected event ID 280 with 10%% reduction, got %+v", s)
+	}
+	if _, ok := values["process:updater.exe"]; ok {
+		t.Errorf("processes must not be suggested unless enabled")
+	}
+
+	yaml := rec.YAML()
+	for _, want := range []string{
+		"excluded_registered_domains:\n  - \"telemetry.example\" # ~40.0% of exported volume (400 events)",
+		"excluded_domains:\n  - \"wpad.corp.local\" # ~25.0% of exported volume (250 events)",
+		"excluded_event_ids:\n  - 1001\n  - 280",
+	} {
+		if !strings.Contains(yaml, want) {
+			t.Errorf("YAML missing %q:\n%s", want, yaml)
+		}
+	}
+	if strings.Contains(yaml, "*.") {
+		t.Errorf("registered domains must not be rendered as glob patterns:\n%s", yaml)
+	}
+}
+
+func TestRecommendSkipsExcludedRegisteredDomains(t *testing.T) {
+	r := New(Options{MinShare: 0.05})
+	rec := r.Recommend(testReport(), Current{ExcludedRegisteredDomains: []string{"Telemetry.Example"}})
+
+	for _, s := range rec.Suggestions {
+		if strings.HasSuffix(s.Value, "telemetry.example") {
+			t.Errorf("name under an excluded registered domain was suggested: %+v", s)
+		}
+	}
+
+	yaml := rec.YAML()
+	if !strings.Contains(yaml, "excluded_registered_domains:\n  - \"Telemetry.Example\"\n  - \"corp.local\"") {
+		t.Errorf("expected the configured registered domains to be kept:\n%s", yaml)
+	}
+}
+
+func TestRecommendProtectorAndProcesses(t *testing.T) {
+	r := New(Options{MinShare: 0.05, IncludeProcesses: true})
+	r.AddProtector(func(domain string) bool { return domain == "telemetry.example" })
+	rec := r.Recommend(testReport(), Current{ExcludedDomains: []string{"*.corp.local"}})
+
+	for _, s := range rec.Suggestions {
+		if s.Value == "telemetry.example" {
+			t.Errorf("domain rejected by protector was suggested")
+		}
+		if strings.HasSuffix(s.Value, "corp.local") && s.Value != "corp.local" {
+			t.Errorf("already excluded domain %q was suggested", s.Value)
+		}
+	}
+
+	yaml := rec.YAML()
+	if !strings.Contains(yaml, `expression: "SrcProcessName == \"updater.exe\""`) {
+		t.Errorf("expected process filter rule in YAML:\n%s", yaml)
+	}
+	if rec.EstimatedReduction != 1 {
+		t.Errorf("expected combined estimate to be capped at 1, got %v", rec.EstimatedReduction)
+	}
+}
@@ -0,0 +1,338 @@
+package rules
+
+import (
+	"fmt"
+	"net/netip"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// node is an element of a compiled expression tree
+type node interface {
+	eval(fields Fields) bool
+}
+
+type andNode struct{ left, right node }
+type orNode struct{ left, right node }
+type notNode struct{ operand node }
+
+func (n andNode) eval(f Fields) bool { return n.left.eval(f) && n.right.eval(f) }
+func (n orNode) eval(f Fields) bool  { return n.left.eval(f) || n.right.eval(f) }
+func (n notNode) eval(f Fields) bool { return !n.operand.eval(f) }
+
+// comparisonNode compares a field against one or more values
+type comparisonNode struct {
+	field    string
+	operator string
+	strings  []string
+	number   float64
+	patterns []*regexp.Regexp
+	prefixes []netip.Prefix
+	// pos is the position of the field name in the expression
+	pos int
+}
+
+func (n comparisonNode) eval(f Fields) bool {
+	value, ok := f.Get(n.field)
+	if !ok {
+		// A missing field only satisfies inequality
+		return n.operator == "!="
+	}
+
+	switch n.operator {
+	case "==":
+		return strings.EqualFold(value, n.strings[0])
+	case "!=":
+		return !strings.EqualFold(value, n.strings[0])
+	case "in":
+		for _, s := range n.strings {
+			if strings.EqualFold(value, s) {
+				return true
+			}
+		}
+		return false
+	case "<", "<=", ">", ">=":
+		v, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			return false
+		}
+		switch n.operator {
+		case "<":
+			return v < n.number
+		case "<=":
+			return v <= n.number
+		case ">":
+			return v > n.number
+		default:
+			return v >= n.number
+		}
+	case "glob", "matches", "=~":
+		for _, re := range n.patterns {
+			if re.MatchString(value) {
+				return true
+			}
+		}
+		return false
+	case "cidr":
+		addr, err := netip.ParseAddr(value)
+		if err != nil {
+			return false
+		}
+		addr = addr.Unmap()
+		for _, prefix := range n.prefixes {
+			if prefix.Contains(addr) {
+				return true
+			}
+		}
+		return false
+	}
+	return false
+}
+
+// parser builds an expression tree from tokens using recursive descent:
+//
+//	expr       := and ("or" and)*
+//	and        := unary ("and" unary)*
+//	unary      := "not" unary | "(" expr ")" | comparison
+//	comparison := FIELD operator value
+//	value      := STRING | NUMBER | "[" value ("," value)* "]"
+type parser struct {
+	tokens []token
+	pos    int
+}
+
+// parseExpression compiles an expression string into an evaluable tree
+func parseExpression(input string) (node, error) {
+	tokens, err := lex(input)
+	if err != nil {
+		return nil, err
+	}
+
+	p := &parser{tokens: tokens}
+	n, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+	if tok := p.peek(); tok.kind != tokenEOF {
+		return nil, fmt.Errorf("unexpected %s at position %d", tok, tok.pos)
+	}
+	return n, nil
+}
+
+func (p *parser) peek() token { return p.tokens[p.pos] }
+
+func (p *parser) next() token {
+	tok := p.tokens[p.pos]
+	if tok.kind != tokenEOF {
+		p.pos++
+	}
+	return tok
+}
+
+// keyword reports whether the next token is the given case-insensitive keyword
+func (p *parser) keyword(word string) bool {
+	tok := p.peek()
+	return tok.kind == tokenIdent && strings.EqualFold(tok.text, word)
+}
+
+func (p *parser) parseOr() (node, error) {
+	left, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+	for p.keyword("or") {
+		p.next()
+		right, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		left = orNode{left, right}
+	}
+	return left, nil
+}
+
+func (p *parser) parseAnd() (node, error) {
+	left, err := p.parseUnary()
+	if err != nil {
+		return nil, err
+	}
+	for p.keyword("and") {
+		p.next()
+		right, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		left = andNode{left, right}
+	}
+	return left, nil
+}
+
+func (p *parser) parseUnary() (node, error) {
+	if p.keyword("not") {
+		p.next()
+		operand, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		return notNode{operand}, nil
+	}
+
+	if p.peek().kind == tokenLParen {
+		p.next()
+		n, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		if tok := p.next(); tok.kind != tokenRParen {
+			return nil, fmt.Errorf("expected \")\" but found %s at position %d", tok, tok.pos)
+		}
+		return n, nil
+	}
+
+	return p.parseComparison()
+}
+
+func (p *parser) parseComparison() (node, error) {
+	fieldTok := p.next()
+	if fieldTok.kind != tokenIdent {
+		return nil, fmt.Errorf("expected field name but found %s at position %d", fieldTok, fieldTok.pos)
+	}
+
+	opTok := p.next()
+	operator := strings.ToLower(opTok.text)
+	switch {
+	case opTok.kind == tokenOperator:
+	case opTok.kind == tokenIdent && (operator == "in" || operator == "glob" || operator == "matches" || operator == "cidr"):
+	default:
+		return nil, fmt.Errorf("expected operator after %q but found %s at position %d", fieldTok.text, opTok, opTok.pos)
+	}
+
+	values, isList, err := p.parseValue()
+	if err != nil {
+		return nil, err
+	}
+
+	n := comparisonNode{field: fieldTok.text, pos: fieldTok.pos, operator: operator, strings: values}
+
+	switch operator {
+	case "==", "!=":
+		if isList {
+			return nil, fmt.Errorf("operator %q at position %d does not accept a list, use \"in\"", operator, opTok.pos)
+		}
+	case "<", "<=", ">", ">=":
+		if isList {
+			return nil, fmt.Errorf("operator %q at position %d does not accept a list", operator, opTok.pos)
+		}
+		number, err := strconv.ParseFloat(values[0], 64)
+		if err != nil {
+			return nil, fmt.Errorf("operator %q at position %d requires a number, got %q", operator, opTok.pos, values[0])
+		}
+		n.number = number
+	case "glob":
+		for _, v := range values {
+			n.patterns = append(n.patterns, globToRegexp(v))
+		}
+	case "matches", "=~":
+		for _, v := range values {
+			re, err := regexp.Compile(v)
+			if err != nil {
+				return nil, fmt.Errorf("invalid regular expression %q at position %d: %w", v, opTok.pos, err)
+			}
+			n.patterns = append(n.patterns, re)
+		}
+	case "cidr":
+		for _, v := range values {
+			prefix, err := parsePrefix(v)
+			if err != nil {
+				return nil, fmt.Errorf("invalid CIDR %q at position %d: %w", v, opTok.pos, err)
+			}
+			n.prefixes = append(n.prefixes, prefix)
+		}
+	}
+
+	return n, nil
+}
+
+// unknownField returns the first comparison on a field that known does not recognise
+func unknownField(n node, known func(string) bool) (comparisonNode, bool) {
+	switch n := n.(type) {
+	case andNode:
+		if c, ok := unknownField(n.left, known); ok {
+			return c, true
+		}
+		return unknownField(n.right, known)
+	case orNode:
+		if c, ok := unknownField(n.left, known); ok {
+			return c, true
+		}
+		return unknownField(n.right, known)
+	case notNode:
+		return unknownField(n.operand, known)
+	case comparisonNode:
+		return n, !known(n.field)
+	}
+	return comparisonNode{}, false
+}
+
+// parseValue reads a single literal or a bracketed list of literals
+func (p *parser) parseValue() ([]string, bool, error) {
+	tok := p.next()
+	switch tok.kind {
+	case tokenString, tokenNumber:
+		return []string{tok.text}, false, nil
+	case tokenLBracket:
+		var values []string
+		for {
+			item := p.next()
+			if item.kind != tokenString && item.kind != tokenNumber {
+				return nil, true, fmt.Errorf("expected list value but found %s at position %d", item, item.pos)
+			}
+			values = append(values, item.text)
+
+			sep := p.next()
+			if sep.kind == tokenRBracket {
+				return values, true, nil
+			}
+			if sep.kind != tokenComma {
+				return nil, true, fmt.Errorf("expected \",\" or \"]\" but found %s at position %d", sep, sep.pos)
+			}
+		}
+	default:
+		return nil, false, fmt.Errorf("expected value but found %s at position %d", tok, tok.pos)
+	}
+}
+
+// globToRegexp converts a case-insensitive glob pattern (* and ?) to a regular expression
+func globToRegexp(glob string) *regexp.Regexp {
+	var sb strings.Builder
+	sb.WriteString("(?i)^")
+	for _, r := range glob {
+		switch r {
+		case '*':
+			sb.WriteString(".*")
+		case '?':
+			sb.WriteString(".")
+		default:
+			sb.WriteString(regexp.QuoteMeta(string(r)))
+		}
+	}
+	sb.WriteString("$")
+	return regexp.MustCompile(sb.String())
+}
+
+// parsePrefix parses a CIDR, treating a bare address as a single-host prefix
+func parsePrefix(value string) (netip.Prefix, error) {
+	if !strings.Contains(value, "/") {
+		addr, err := netip.ParseAddr(value)
+		if err != nil {
+			return netip.Prefix{}, err
+		}
+		return netip.PrefixFrom(addr, addr.BitLen()), nil
+	}
+	prefix, err := netip.ParsePrefix(value)
+	if err != nil {
+		return netip.Prefix{}, err
+	}
+	return prefix.Masked(), nil
+}
@@ -0,0 +1,196 @@
+// Package rules implements expression-based filter rules evaluated against the
+// ASIM attributes of a transformed DNS record.
+//
+// An expression combines field comparisons with and, or and not:
+//
+//	DnsQuery glob "*.corp.local" and EventResult == "Success"
+//	SrcIpAddr cidr ["10.0.0.0/8", "192.168.0.0/16"] and not (DnsQueryTypeName in ["A", "AAAA"])
+//	DnsResponseCode >= 2 or DnsQuery matches "^[a-z0-9]{32}\\."
+//
+// Supported operators are ==, !=, <, <=, >, >=, in, glob, matches (or =~) and cidr.
+// String comparisons and globs are case-insensitive.
+package rules
+
+import (
+	"fmt"
+	"math/rand"
+	"strings"
+)
+
+// Fields provides access to record attributes by name
+type Fields interface {
+	Get(name string) (string, bool)
+}
+
+// MapFields is a Fields implementation backed by a map
+type MapFields map[string]string
+
+// Get returns the value of a field
+func (m MapFields) Get(name string) (string, bool) {
+	value, ok := m[name]
+	return value, ok
+}
+
+// Rule actions
+const (
+	// ActionDrop discards the record and stops evaluation
+	ActionDrop = "drop"
+	// ActionKeep keeps the record and stops evaluation
+	ActionKeep = "keep"
+	// ActionTag adds a tag to the record and continues evaluation
+	ActionTag = "tag"
+	// ActionSample keeps a fraction of matching records and stops evaluation
+	ActionSample = "sample"
+)
+
+// Config is the configuration of a single filter rule
+type Config struct {
+	Name       string  `mapstructure:"name"`
+	Expression string  `mapstructure:"expression"`
+	Action     string  `mapstructure:"action"`
+	Tag        string  `mapstructure:"tag"`
+	SampleRate float64 `mapstructure:"sample_rate"`
+}
+
+// Rule is a compiled filter rule
+type Rule struct {
+	Name       string
+	Action     string
+	Tag        string
+	SampleRate float64
+	expr       node
+}
+
+// Matches reports whether the rule expression matches the fields
+func (r *Rule) Matches(fields Fields) bool {
+	return r.expr.eval(fields)
+}
+
+// Expression is a compiled expression that is not part of a rule set
+type Expression struct {
+	expr node
+}
+
+// ParseExpression compiles a standalone expression
+func ParseExpression(input string) (*Expression, error) {
+	if strings.TrimSpace(input) == "" {
+		return nil, fmt.Errorf("expression must not be empty")
+	}
+	expr, err := parseExpression(input)
+	if err != nil {
+		return nil, err
+	}
+	return &Expression{expr: expr}, nil
+}
+
+// Matches reports whether the expression matches the fields
+func (e *Expression) Matches(fields Fields) bool {
+	return e.expr.eval(fields)
+}
+
+// Result is the outcome of evaluating a rule set against a record
+type Result struct {
+	// Drop is true when the record must be discarded
+	Drop bool
+	// Rule is the name of the rule that decided the outcome, if any
+	Rule string
+	// Tags are the tags added by matching tag rules
+	Tags []string
+}
+
+// RuleSet is an ordered list of compiled rules
+type RuleSet struct {
+	rules  []*Rule
+	random func() float64
+}
+
+// Compile compiles rule configurations into a rule set. Errors identify the
+// offending rule and the position within its expression.
+func Compile(configs []Config) (*RuleSet, error) {
+	rs := &RuleSet{random: rand.Float64}
+
+	for i, cfg := range configs {
+		name := cfg.Name
+		if name == "" {
+			name = fmt.Sprintf("rule %d", i+1)
+		}
+
+		if strings.TrimSpace(cfg.Expression) == "" {
+			return nil, fmt.Errorf("filter rule %q: expression must not be empty", name)
+		}
+
+		expr, err := parseExpression(cfg.Expression)
+		if err != nil {
+			return nil, fmt.Errorf("filter rule %q: %w", name, err)
+		}
+
+		action := strings.ToLower(cfg.Action)
+		switch action {
+		case ActionDrop, ActionKeep:
+		case ActionTag:
+			if cfg.Tag == "" {
+				return nil, fmt.Errorf("filter rule %q: action \"tag\" requires a tag", name)
+			}
+		case ActionSample:
+			if cfg.SampleRate <= 0 || cfg.SampleRate > 1 {
+				return nil, fmt.Errorf("filter rule %q: sample_rate must be greater than 0 and at most 1", name)
+			}
+		default:
+			return nil, fmt.Errorf("filter rule %q: unknown action %q, expected drop, keep, tag or sample", name, cfg.Action)
+		}
+
+		rs.rules = append(rs.rules, &Rule{
+			Name:       name,
+			Action:     action,
+			Tag:        cfg.Tag,
+			SampleRate: cfg.SampleRate,
+			expr:       expr,
+		})
+	}
+
+	return rs, nil
+}
+
+// CheckFields returns an error naming the first field that known does not
+// recognise. A misspelt field never matches, and an inequality on it always
+// does, so a drop rule could silently discard every record.
+func (rs *RuleSet) CheckFields(known func(string) bool) error {
+	for _, rule := range rs.rules {
+		if c, ok := unknownField(rule.expr, known); ok {
+			return fmt.Errorf("filter rule %q: unknown field %q at position %d", rule.Name, c.field, c.pos)
+		}
+	}
+	return nil
+}
+
+// Len returns the number of rules in the set
+func (rs *RuleSet) Len() int {
+	return len(rs.rules)
+}
+
+// Evaluate applies the rules in order. Tag rules accumulate tags; the first
+// matching drop, keep or sample rule decides the outcome.
+func (rs *RuleSet) Evaluate(fields Fields) Result {
+	var result Result
+
+	for _, rule := range rs.rules {
+		if !rule.Matches(fields) {
+			continue
+		}
+
+		switch rule.Action {
+		case ActionTag:
+			result.Tags = append(result.Tags, rule.Tag)
+			continue
+		case ActionDrop:
+			result.Drop = true
+		case ActionSample:
+			result.Drop = rs.random() >= rule.SampleRate
+		}
+
+		result.Rule = rule.Name
+		return result
+	}
+
+	return result
+}
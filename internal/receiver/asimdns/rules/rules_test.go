@@ -0,0 +1,136 @@
+package rules
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestExpressions(t *testing.T) {
+	fields := MapFields{
+		"DnsQuery":         "host1.corp.local",
+		"EventResult":      "Success",
+		"SrcIpAddr":        "10.1.2.3",
+		"DnsQueryTypeName": "AAAA",
+		"DnsResponseCode":  "3",
+		"SrcProcessName":   "svchost.exe",
+	}
+
+	tests := []struct {
+		expr string
+		want bool
+	}{
+		{`DnsQuery glob "*.corp.local"`, true},
+		{`DnsQuery glob "*.CORP.LOCAL"`, true},
+		{`DnsQuery glob ["*.example.com", "host?.corp.local"]`, true},
+		{`EventResult == "success"`, true},
+		{`EventResult != "Success"`, false},
+		{`DnsQueryTypeName in ["A", "AAAA"]`, true},
+		{`DnsQueryTypeName in ['A', 'MX']`, false},
+		{`SrcIpAddr cidr "10.0.0.0/8"`, true},
+		{`SrcIpAddr cidr ["192.168.0.0/16", "172.16.0.0/12"]`, false},
+		{`DnsResponseCode >= 3 and DnsResponseCode < 4`, true},
+		{`DnsQuery matches "^host[0-9]+\\."`, true},
+		{`DnsQuery =~ "^web"`, false},
+		{`MissingField == "x"`, false},
+		{`MissingField != "x"`, true},
+		{`not EventResult == "Failure"`, true},
+		{`EventResult == "Failure" or SrcProcessName == "svchost.exe"`, true},
+		{`(EventResult == "Failure" or DnsQuery glob "*.local") and not SrcIpAddr cidr "10.1.2.3"`, false},
+		{`EventResult == "Failure" or EventResult == "Success" and DnsQueryTypeName == "A"`, false},
+	}
+
+	for _, tt := range tests {
+		rs, err := Compile([]Config{{Expression: tt.expr, Action: ActionDrop}})
+		if err != nil {
+			t.Fatalf("Compile(%q) failed: %v", tt.expr, err)
+		}
+		if got := rs.Evaluate(fields).Drop; got != tt.want {
+			t.Errorf("%q = %v, want %v", tt.expr, got, tt.want)
+		}
+	}
+}
+
+func TestCompileErrors(t *testing.T) {
+	tests := []struct {
+		cfg  Config
+		want string
+	}{
+		{Config{Name: "empty", Action: ActionDrop}, "must not be empty"},
+		{Config{Expression: `DnsQuery ==`, Action: ActionDrop}, "expected value"},
+		{Config{Expression: `DnsQuery = "x"`, Action: ActionDrop}, "unknown operator"},
+		{Config{Expression: `DnsQuery == "x`, Action: ActionDrop}, "unterminated string"},
+		{Config{Expression: `(DnsQuery == "x"`, Action: ActionDrop}, "expected \")\""},
+		{Config{Expression: `DnsQuery == ["x"]`, Action: ActionDrop}, "does not accept a list"},
+		{Config{Expression: `DnsResponseCode > "x"`, Action: ActionDrop}, "requires a number"},
+		{Config{Expression: `DnsQuery matches "("`, Action: ActionDrop}, "invalid regular expression"},
+		{Config{Expression: `SrcIpAddr cidr "10.0.0.0/33"`, Action: ActionDrop}, "invalid CIDR"},
+		{Config{Expression: `DnsQuery == "x"`, Action: "remove"}, "unknown action"},
+		{Config{Expression: `DnsQuery == "x"`, Action: ActionTag}, "requires a tag"},
+		{Config{Expression: `DnsQuery == "x"`, Action: ActionSample, SampleRate: 2}, "sample_rate"},
+	}
+
+	for _, tt := range tests {
+		_, err := Compile([]Config{tt.cfg})
+		if err == nil || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("Compile(%q) error = %v, want containing %q", tt.cfg.Expression, err, tt.want)
+		}
+	}
+}
+
+func TestCheckFields(t *testing.T) {
+	known := func(field string) bool { return field == "DnsQuery" || field == "EventResult" }
+
+	rs, err := Compile([]Config{{Name: "ok", Expression: `DnsQuery == "x" and not EventResult == "Success"`, Action: ActionDrop}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := rs.CheckFields(known); err != nil {
+		t.Errorf("known fields rejected: %v", err)
+	}
+
+	rs, err = Compile([]Config{{Name: "typo", Expression: `DnsQuery == "x" or not (DnsQuerry != "y")`, Action: ActionDrop}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = rs.CheckFields(known)
+	if err == nil || !strings.Contains(err.Error(), `unknown field "DnsQuerry" at position 24`) {
+		t.Errorf("CheckFields error = %v", err)
+	}
+}
+
+func TestEvaluateActions(t *testing.T) {
+	rs, err := Compile([]Config{
+		{Name: "tag-corp", Expression: `DnsQuery glob "*.corp.local"`, Action: ActionTag, Tag: "corp"},
+		{Name: "keep-failures", Expression: `EventResult == "Failure"`, Action: ActionKeep},
+		{Name: "drop-svchost", Expression: `SrcProcessName == "svchost.exe"`, Action: ActionDrop},
+		{Name: "sample-rest", Expression: `EventResult == "Success"`, Action: ActionSample, SampleRate: 0.5},
+	})
+	if err != nil {
+		t.Fatalf("Compile failed: %v", err)
+	}
+	rs.random = func() float64 { return 0.7 }
+
+	failure := rs.Evaluate(MapFields{"DnsQuery": "a.corp.local", "EventResult": "Failure", "SrcProcessName": "svchost.exe"})
+	if failure.Drop || failure.Rule != "keep-failures" || len(failure.Tags) != 1 || failure.Tags[0] != "corp" {
+		t.Errorf("unexpected result for failure: %+v", failure)
+	}
+
+	success := rs.Evaluate(MapFields{"DnsQuery": "a.corp.local", "EventResult": "Success", "SrcProcessName": "svchost.exe"})
+	if !success.Drop || success.Rule != "drop-svchost" {
+		t.Errorf("unexpected result for svchost success: %+v", success)
+	}
+
+	sampled := rs.Evaluate(MapFields{"DnsQuery": "example.com", "EventResult": "Success"})
+	if !sampled.Drop || sampled.Rule != "sample-rest" {
+		t.Errorf("expected sampled record to be dropped: %+v", sampled)
+	}
+
+	rs.random = func() float64 { return 0.2 }
+	if rs.Evaluate(MapFields{"DnsQuery": "example.com", "EventResult": "Success"}).Drop {
+		t.Error("expected sampled record to be kept")
+	}
+
+	if result := rs.Evaluate(MapFields{"EventResult": "NA"}); result.Drop || result.Rule != "" {
+		t.Errorf("expected no rule to match: %+v", result)
+	}
+}
@@ -0,0 +1,253 @@
+// Package severity derives the severity of DNS records from their result,
+// response code and enrichments, and maps it to the ASIM EventSeverity and
+// OpenTelemetry log severity.
+package severity
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/LaurieRhodes/asim-dns-collector/internal/receiver/asimdns/dnswire"
+	"github.com/LaurieRhodes/asim-dns-collector/internal/receiver/asimdns/rules"
+)
+
+// Level is an ASIM event severity. Higher levels are more severe.
+type Level int
+
+// Severity levels
+const (
+	Informational Level = iota
+	Low
+	Medium
+	High
+)
+
+// String returns the ASIM EventSeverity value of the level
+func (l Level) String() string {
+	switch l {
+	case Low:
+		return "Low"
+	case Medium:
+		return "Medium"
+	case High:
+		return "High"
+	default:
+		return "Informational"
+	}
+}
+
+// Number returns the OpenTelemetry severity number of the level: the first
+// number of the INFO, WARN, ERROR and FATAL ranges
+func (l Level) Number() int32 {
+	switch l {
+	case Low:
+		return 13
+	case Medium:
+		return 17
+	case High:
+		return 21
+	default:
+		return 9
+	}
+}
+
+// ParseLevel parses a severity name
+func ParseLevel(name string) (Level, error) {
+	switch strings.ToLower(name) {
+	case "informational", "info":
+		return Informational, nil
+	case "low":
+		return Low, nil
+	case "medium":
+		return Medium, nil
+	case "high":
+		return High, nil
+	default:
+		return Informational, fmt.Errorf("unknown severity %q, expected Informational, Low, Medium or High", name)
+	}
+}
+
+// OverrideConfig sets the severity of records matching an expression or
+// querying one of a set of domains. Domains match themselves and their
+// subdomains; a leading "*." is accepted.
+type OverrideConfig struct {
+	Severity   string   `mapstructure:"severity"`
+	Expression string   `mapstructure:"expression"`
+	Domains    []string `mapstructure:"domains"`
+}
+
+// Settings configures a policy. Levels are severity names.
+type Settings struct {
+	// ResponseCodes sets the base severity per response code name, over the
+	// levels of DefaultSettings
+	ResponseCodes map[string]string
+	// Failure is the base severity of failures without a listed response code
+	Failure string
+	// ThreatMatch, DGA and PolicyBlock raise the severity of threat
+	// intelligence matches, likely generated names and blocked queries
+	ThreatMatch string
+	DGA         string
+	PolicyBlock string
+	// Overrides replace the derived severity; the first match applies
+	Overrides []OverrideConfig
+}
+
+// DefaultSettings treat failures as Low, refused queries as Medium and
+// threat matches as High
+var DefaultSettings = Settings{
+	ResponseCodes: map[string]string{
+		"NOERROR":  "Informational",
+		"NXDOMAIN": "Low",
+		"SERVFAIL": "Low",
+		"REFUSED":  "Medium",
+	},
+	Failure:     "Low",
+	ThreatMatch: "High",
+	DGA:         "Medium",
+	PolicyBlock: "Medium",
+}
+
+type override struct {
+	level   Level
+	expr    *rules.Expression
+	domains []string
+}
+
+// Policy derives the severity of records
+type Policy struct {
+	responseCodes map[uint16]Level
+	failure       Level
+	threatMatch   Level
+	dga           Level
+	policyBlock   Level
+	overrides     []override
+}
+
+// NewPolicy compiles a severity policy. Empty levels take the default, and
+// response codes are merged over the default response codes.
+func NewPolicy(settings Settings) (*Policy, error) {
+	p := &Policy{responseCodes: make(map[uint16]Level)}
+	for _, codes := range []map[string]string{DefaultSettings.ResponseCodes, settings.ResponseCodes} {
+		for name, value := range codes {
+			code, ok := dnswire.ParseRcode(name)
+			if !ok {
+				return nil, fmt.Errorf("severity response code %q is not a response code name", name)
+			}
+			level, err := ParseLevel(value)
+			if err != nil {
+				return nil, fmt.Errorf("severity of %s: %w", name, err)
+			}
+			p.responseCodes[code] = level
+		}
+	}
+	for _, l := range []struct {
+		target   *Level
+		value    string
+		fallback string
+		name     string
+	}{
+		{&p.failure, settings.Failure, DefaultSettings.Failure, "failure"},
+		{&p.threatMatch, settings.ThreatMatch, DefaultSettings.ThreatMatch, "threat_match"},
+		{&p.dga, settings.DGA, DefaultSettings.DGA, "dga"},
+		{&p.policyBlock, settings.PolicyBlock, DefaultSettings.PolicyBlock, "policy_block"},
+	} {
+		value := l.value
+		if value == "" {
+			value = l.fallback
+		}
+		level, err := ParseLevel(value)
+		if err != nil {
+			return nil, fmt.Errorf("severity_%s: %w", l.name, err)
+		}
+		*l.target = level
+	}
+	for i, cfg := range settings.Overrides {
+		level, err := ParseLevel(cfg.Severity)
+		if err != nil {
+			return nil, fmt.Errorf("severity override %d: %w", i+1, err)
+		}
+		o := override{level: level}
+		if cfg.Expression == "" && len(cfg.Domains) == 0 {
+			return nil, fmt.Errorf("severity override %d: an expression or domains must be set", i+1)
+		}
+		if cfg.Expression != "" {
+			if o.expr, err = rules.ParseExpression(cfg.Expression); err != nil {
+				return nil, fmt.Errorf("severity override %d: %w", i+1, err)
+			}
+		}
+		for _, domain := range cfg.Domains {
+			o.domains = append(o.domains, normalizeDomain(strings.TrimPrefix(domain, "*.")))
+		}
+		p.overrides = append(p.overrides, o)
+	}
+	return p, nil
+}
+
+// Evaluate returns the severity of a record. The base severity comes from
+// the response code or result and is raised by threat matches, likely
+// generated names and blocked queries; a matching override replaces it.
+func (p *Policy) Evaluate(fields rules.Fields) Level {
+	for _, o := range p.overrides {
+		if o.matches(fields) {
+			return o.level
+		}
+	}
+
+	level := Informational
+	if result, _ := fields.Get("EventResult"); result == "Failure" {
+		level = p.failure
+	}
+	if value, ok := fields.Get("DnsResponseCode"); ok {
+		if code, err := strconv.ParseUint(value, 10, 16); err == nil {
+			if l, ok := p.responseCodes[uint16(code)]; ok {
+				level = l
+			}
+		}
+	}
+
+	// DGA threat mapping fills the threat fields too; it escalates as DGA
+	if indicator, _ := fields.Get("ThreatIndicatorType"); indicator != "" {
+		if category, _ := fields.Get("ThreatCategory"); category != "DGA" {
+			level = higher(level, p.threatMatch)
+		}
+	}
+	if verdict, _ := fields.Get("DnsQueryDgaVerdict"); verdict == "likely_dga" {
+		level = higher(level, p.dga)
+	}
+	if action, _ := fields.Get("DvcAction"); action == "Deny" || action == "Drop" {
+		level = higher(level, p.policyBlock)
+	}
+	return level
+}
+
+// matches reports whether an override applies to a record
+func (o override) matches(fields rules.Fields) bool {
+	if o.expr != nil && o.expr.Matches(fields) {
+		return true
+	}
+	if len(o.domains) == 0 {
+		return false
+	}
+	query, _ := fields.Get("DnsQuery")
+	query = normalizeDomain(query)
+	for _, domain := range o.domains {
+		if query == domain || strings.HasSuffix(query, "."+domain) {
+			return true
+		}
+	}
+	return false
+}
+
+// normalizeDomain lower-cases a name and removes its trailing dot
+func normalizeDomain(name string) string {
+	return strings.TrimSuffix(strings.ToLower(strings.TrimSpace(name)), ".")
+}
+
+// higher returns the more severe of two levels
+func higher(a, b Level) Level {
+	if a > b {
+		return a
+	}
+	return b
+}
@@ -0,0 +1,108 @@
+package severity
+
+import (
+	"testing"
+
+	"github.com/LaurieRhodes/asim-dns-collector/internal/receiver/asimdns/rules"
+)
+
+func TestDefaultPolicy(t *testing.T) {
+	p, err := NewPolicy(DefaultSettings)
+	if err != nil {
+		t.Fatalf("failed to compile default policy: %v", err)
+	}
+
+	tests := []struct {
+		fields rules.MapFields
+		want   Level
+	}{
+		{rules.MapFields{"EventResult": "Success", "DnsResponseCode": "0"}, Informational},
+		{rules.MapFields{"EventResult": "Failure", "DnsResponseCode": "3"}, Low},
+		{rules.MapFields{"EventResult": "Failure", "DnsResponseCode": "2"}, Low},
+		{rules.MapFields{"EventResult": "Failure", "DnsResponseCode": "5"}, Medium},
+		{rules.MapFields{"EventResult": "Failure", "DnsResponseCode": "9"}, Low},
+		{rules.MapFields{"EventResult": "Failure"}, Low},
+		{rules.MapFields{"EventType": "Info"}, Informational},
+		{rules.MapFields{"DnsResponseCode": "0", "ThreatIndicatorType": "Domain", "ThreatCategory": "Malware"}, High},
+		{rules.MapFields{"DnsResponseCode": "3", "ThreatIndicatorType": "Domain", "ThreatCategory": "DGA", "DnsQueryDgaVerdict": "likely_dga"}, Medium},
+		{rules.MapFields{"DnsResponseCode": "0", "DnsQueryDgaVerdict": "suspicious"}, Informational},
+		{rules.MapFields{"DnsResponseCode": "0", "DvcAction": "Drop"}, Medium},
+		{rules.MapFields{"DnsResponseCode": "0", "DvcAction": "Allow"}, Informational},
+	}
+	for _, tt := range tests {
+		if got := p.Evaluate(tt.fields); got != tt.want {
+			t.Errorf("Evaluate(%v) = %s, want %s", tt.fields, got, tt.want)
+		}
+	}
+}
+
+func TestOverrides(t *testing.T) {
+	p, err := NewPolicy(Settings{
+		ResponseCodes: map[string]string{"NXDOMAIN": "Informational"},
+		ThreatMatch:   "Medium",
+		Overrides: []OverrideConfig{
+			{Severity: "Informational", Domains: []string{"*.corp.contoso.com"}},
+			{Severity: "High", Expression: `EventType == "Query" and DnsQueryTypeName == "AXFR"`},
+			{Severity: "low", Domains: []string{"Telemetry.example."}},
+		},
+	})
+	if err != nil {
+		t.Fatalf("failed to compile policy: %v", err)
+	}
+
+	tests := []struct {
+		fields rules.MapFields
+		want   Level
+	}{
+		{rules.MapFields{"DnsResponseCode": "3"}, Informational},
+		// Unlisted codes keep their default level
+		{rules.MapFields{"DnsResponseCode": "5", "EventResult": "Failure"}, Medium},
+		{rules.MapFields{"DnsResponseCode": "2", "EventResult": "Failure"}, Low},
+		{rules.MapFields{"DnsResponseCode": "0", "ThreatIndicatorType": "Domain"}, Medium},
+		{rules.MapFields{"DnsQuery": "host.corp.contoso.com.", "ThreatIndicatorType": "Domain"}, Informational},
+		{rules.MapFields{"DnsQuery": "corp.contoso.com", "DvcAction": "Deny"}, Informational},
+		{rules.MapFields{"DnsQuery": "notcorp.contoso.com", "DvcAction": "Deny"}, Medium},
+		{rules.MapFields{"EventType": "Query", "DnsQueryTypeName": "AXFR"}, High},
+		{rules.MapFields{"DnsQuery": "a.telemetry.example", "EventResult": "Failure"}, Low},
+	}
+	for _, tt := range tests {
+		if got := p.Evaluate(tt.fields); got != tt.want {
+			t.Errorf("Evaluate(%v) = %s, want %s", tt.fields, got, tt.want)
+		}
+	}
+}
+
+func TestInvalidSettings(t *testing.T) {
+	for name, settings := range map[string]Settings{
+		"response code":    {ResponseCodes: map[string]string{"NOPE": "Low"}},
+		"response level":   {ResponseCodes: map[string]string{"NXDOMAIN": "Critical"}},
+		"failure":          {Failure: "warning"},
+		"override level":   {Overrides: []OverrideConfig{{Severity: "", Domains: []string{"contoso.com"}}}},
+		"override match":   {Overrides: []OverrideConfig{{Severity: "High"}}},
+		"override grammar": {Overrides: []OverrideConfig{{Severity: "High", Expression: `EventType ==`}}},
+	} {
+		if _, err := NewPolicy(settings); err == nil {
+			t.Errorf("%s: expected an error", name)
+		}
+	}
+}
+
+func TestLevelMapping(t *testing.T) {
+	for _, tt := range []struct {
+		level  Level
+		text   string
+		number int32
+	}{
+		{Informational, "Informational", 9},
+		{Low, "Low", 13},
+		{Medium, "Medium", 17},
+		{High, "High", 21},
+	} {
+		if tt.level.String() != tt.text || tt.level.Number() != tt.number {
+			t.Errorf("%d maps to %s/%d, want %s/%d", tt.level, tt.level, tt.level.Number(), tt.text, tt.number)
+		}
+		if parsed, err := ParseLevel(tt.text); err != nil || parsed != tt.level {
+			t.Errorf("ParseLevel(%q) = %s, %v", tt.text, parsed, err)
+		}
+	}
+}
@@ -0,0 +1,153 @@
+package shedding
+
+import (
+	"sync"
+	"time"
+)
+
+// Thresholds controls when tiers are shed
+type Thresholds struct {
+	// LowQueueFraction is the queue fill level at which low priority records are shed
+	LowQueueFraction float64
+	// NormalQueueFraction is the queue fill level at which normal priority records are shed
+	NormalQueueFraction float64
+	// RefusalHold is how long shedding stays escalated after the next
+	// consumer refused data
+	RefusalHold time.Duration
+}
+
+// Summary describes the records shed during an interval
+type Summary struct {
+	StartTime time.Time
+	EndTime   time.Time
+	Total     int64
+	// ByTier counts shed records per tier name
+	ByTier map[string]int64
+	// ByEventID counts shed records per original event ID
+	ByEventID map[string]int64
+	// Overflow counts records dropped because the queue was full
+	Overflow int64
+	// Refusals counts batches refused by the next consumer
+	Refusals int64
+}
+
+// Shedder decides which records to admit based on queue depth and refusals
+// reported by the next consumer
+type Shedder struct {
+	mux          sync.Mutex
+	thresholds   Thresholds
+	refusalLevel Tier
+	lastRefused  time.Time
+	summary      Summary
+}
+
+// NewShedder creates a shedder with the given thresholds
+func NewShedder(thresholds Thresholds) *Shedder {
+	s := &Shedder{thresholds: thresholds}
+	s.resetSummary(time.Time{})
+	return s
+}
+
+// resetSummary starts a new summary interval
+func (s *Shedder) resetSummary(now time.Time) {
+	s.summary = Summary{
+		StartTime: now,
+		ByTier:    make(map[string]int64),
+		ByEventID: make(map[string]int64),
+	}
+}
+
+// Level returns the lowest tier currently admitted. Records below it are shed.
+func (s *Shedder) Level(depth, capacity int, now time.Time) Tier {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	return s.level(depth, capacity, now)
+}
+
+func (s *Shedder) level(depth, capacity int, now time.Time) Tier {
+	level := TierLow
+	if capacity > 0 {
+		fill := float64(depth) / float64(capacity)
+		switch {
+		case fill >= s.thresholds.NormalQueueFraction:
+			level = TierHigh
+		case fill >= s.thresholds.LowQueueFraction:
+			level = TierNormal
+		}
+	}
+
+	if s.refusalLevel > TierLow {
+		if now.Sub(s.lastRefused) > s.thresholds.RefusalHold {
+			s.refusalLevel = TierLow
+		} else if s.refusalLevel > level {
+			level = s.refusalLevel
+		}
+	}
+	return level
+}
+
+// Admit reports whether a record of the given tier should be queued and
+// counts it as shed otherwise. High priority records are always admitted.
+func (s *Shedder) Admit(tier Tier, eventID string, depth, capacity int, now time.Time) bool {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+
+	if tier >= TierHigh || tier >= s.level(depth, capacity, now) {
+		return true
+	}
+	s.record(tier, eventID, now)
+	return false
+}
+
+// Overflow counts a record dropped because the queue was full
+func (s *Shedder) Overflow(tier Tier, eventID string, now time.Time) {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+
+	s.record(tier, eventID, now)
+	s.summary.Overflow++
+}
+
+// record counts a shed record
+func (s *Shedder) record(tier Tier, eventID string, now time.Time) {
+	if s.summary.StartTime.IsZero() {
+		s.summary.StartTime = now
+	}
+	s.summary.EndTime = now
+	s.summary.Total++
+	s.summary.ByTier[tier.String()]++
+	if eventID != "" {
+		s.summary.ByEventID[eventID]++
+	}
+}
+
+// Refused records that the next consumer refused data. Each refusal within
+// the hold period escalates shedding by one tier.
+func (s *Shedder) Refused(now time.Time) {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+
+	if now.Sub(s.lastRefused) > s.thresholds.RefusalHold {
+		s.refusalLevel = TierLow
+	}
+	if s.refusalLevel < TierHigh {
+		s.refusalLevel++
+	}
+	s.lastRefused = now
+	if s.summary.StartTime.IsZero() {
+		s.summary.StartTime = now
+	}
+	s.summary.EndTime = now
+	s.summary.Refusals++
+}
+
+// Summary returns the records shed since the previous call and starts a new
+// interval. The boolean is false when nothing was shed or refused.
+func (s *Shedder) Summary(now time.Time) (Summary, bool) {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+
+	summary := s.summary
+	s.resetSummary(now)
+	return summary, summary.Total > 0 || summary.Refusals > 0
+}
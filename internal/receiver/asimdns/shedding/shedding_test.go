@@ -0,0 +1,78 @@
+package shedding
+
+import (
+	"testing"
+	"time"
+
+	"github.com/LaurieRhodes/asim-dns-collector/internal/receiver/asimdns/rules"
+)
+
+func TestClassifierDefaultTiers(t *testing.T) {
+	c, err := NewClassifier(DefaultTiers)
+	if err != nil {
+		t.Fatalf("failed to compile default tiers: %v", err)
+	}
+
+	tests := []struct {
+		fields rules.MapFields
+		want   Tier
+	}{
+		{rules.MapFields{"EventType": "Query", "EventResult": "Failure"}, TierHigh},
+		{rules.MapFields{"EventType": "Info", "EventSubType": "cache_lookup", "ThreatIndicatorType": "Domain"}, TierHigh},
+		{rules.MapFields{"EventType": "Info", "EventSubType": "cache_lookup", "EventResult": "Failure"}, TierLow},
+		{rules.MapFields{"EventType": "Info", "EventResult": "Failure"}, TierHigh},
+		{rules.MapFields{"EventType": "Info"}, TierLow},
+		{rules.MapFields{"EventType": "Query", "EventResult": "Success"}, TierNormal},
+	}
+	for _, tt := range tests {
+		if got := c.Classify(tt.fields); got != tt.want {
+			t.Errorf("Classify(%v) = %s, want %s", tt.fields, got, tt.want)
+		}
+	}
+
+	if _, err := NewClassifier([]TierConfig{{Tier: "urgent", Expression: `EventType == "Query"`}}); err == nil {
+		t.Errorf("expected error for unknown tier")
+	}
+}
+
+func TestShedderQueueThresholds(t *testing.T) {
+	now := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	s := NewShedder(Thresholds{LowQueueFraction: 0.5, NormalQueueFraction: 0.8, RefusalHold: time.Minute})
+
+	if !s.Admit(TierLow, "3008", 10, 100, now) {
+		t.Errorf("low priority must be admitted below thresholds")
+	}
+	if s.Admit(TierLow, "3008", 60, 100, now) || !s.Admit(TierNormal, "3006", 60, 100, now) {
+		t.Errorf("only low priority must be shed above the low threshold")
+	}
+	if s.Admit(TierNormal, "3006", 90, 100, now) || !s.Admit(TierHigh, "3008", 100, 100, now) {
+		t.Errorf("only high priority must be admitted above the normal threshold")
+	}
+	s.Overflow(TierHigh, "3008", now)
+
+	summary, ok := s.Summary(now.Add(time.Second))
+	if !ok || summary.Total != 3 || summary.ByTier["low"] != 1 || summary.ByTier["normal"] != 1 ||
+		summary.ByEventID["3008"] != 2 || summary.Overflow != 1 {
+		t.Errorf("unexpected summary: %+v", summary)
+	}
+	if _, ok := s.Summary(now.Add(2 * time.Second)); ok {
+		t.Errorf("summary must reset after being read")
+	}
+}
+
+func TestShedderRefusalEscalation(t *testing.T) {
+	now := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	s := NewShedder(Thresholds{LowQueueFraction: 0.5, NormalQueueFraction: 0.8, RefusalHold: time.Minute})
+
+	s.Refused(now)
+	if level := s.Level(0, 100, now); level != TierNormal {
+		t.Errorf("expected first refusal to shed low priority, got level %s", level)
+	}
+	s.Refused(now.Add(10 * time.Second))
+	if level := s.Level(0, 100, now.Add(10*time.Second)); level != TierHigh {
+		t.Errorf("expected repeated refusal to shed normal priority, got level %s", level)
+	}
+	if level := s.Level(0, 100, now.Add(2*time.Minute)); level != TierLow {
+		t.Errorf("expected shedding to stop after the hold period, got level %s", level)
+	}
+}
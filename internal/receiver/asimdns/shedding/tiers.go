@@ -0,0 +1,102 @@
+// Package shedding assigns priority tiers to DNS records and decides which
+// tiers to discard when the pipeline is under pressure.
+package shedding
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/LaurieRhodes/asim-dns-collector/internal/receiver/asimdns/rules"
+)
+
+// Tier is the priority of a record. Lower tiers are shed first.
+type Tier int
+
+// Priority tiers
+const (
+	TierLow Tier = iota
+	TierNormal
+	TierHigh
+)
+
+// Tiers lists all tiers from lowest to highest priority
+var Tiers = []Tier{TierLow, TierNormal, TierHigh}
+
+// String returns the configuration name of the tier
+func (t Tier) String() string {
+	switch t {
+	case TierLow:
+		return "low"
+	case TierHigh:
+		return "high"
+	default:
+		return "normal"
+	}
+}
+
+// ParseTier parses a tier name
+func ParseTier(name string) (Tier, error) {
+	switch strings.ToLower(name) {
+	case "low":
+		return TierLow, nil
+	case "normal":
+		return TierNormal, nil
+	case "high":
+		return TierHigh, nil
+	default:
+		return TierNormal, fmt.Errorf("unknown tier %q, expected low, normal or high", name)
+	}
+}
+
+// TierConfig assigns records matching an expression to a tier
+type TierConfig struct {
+	Tier       string `mapstructure:"tier"`
+	Expression string `mapstructure:"expression"`
+}
+
+// DefaultTiers keeps threat matches and failures and treats cache lookups and
+// informational events as low priority. Cache lookups are low even when they
+// miss, as a miss is reported as a failure.
+var DefaultTiers = []TierConfig{
+	{Tier: "high", Expression: `ThreatIndicatorType glob "*"`},
+	{Tier: "low", Expression: `EventSubType == "cache_lookup"`},
+	{Tier: "high", Expression: `EventResult == "Failure"`},
+	{Tier: "low", Expression: `EventType == "Info"`},
+}
+
+type tierRule struct {
+	tier Tier
+	expr *rules.Expression
+}
+
+// Classifier assigns tiers to records using the first matching expression
+type Classifier struct {
+	rules []tierRule
+}
+
+// NewClassifier compiles tier assignments. Records matching none are normal priority.
+func NewClassifier(configs []TierConfig) (*Classifier, error) {
+	c := &Classifier{}
+	for i, cfg := range configs {
+		tier, err := ParseTier(cfg.Tier)
+		if err != nil {
+			return nil, fmt.Errorf("shedding tier %d: %w", i+1, err)
+		}
+		expr, err := rules.ParseExpression(cfg.Expression)
+		if err != nil {
+			return nil, fmt.Errorf("shedding tier %d: %w", i+1, err)
+		}
+		c.rules = append(c.rules, tierRule{tier: tier, expr: expr})
+	}
+	return c, nil
+}
+
+// Classify returns the tier of a record
+func (c *Classifier) Classify(fields rules.Fields) Tier {
+	for _, rule := range c.rules {
+		if rule.expr.Matches(fields) {
+			return rule.tier
+		}
+	}
+	return TierNormal
+}
@@ -0,0 +1,95 @@
+package stats
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net"
+	"net/http"
+	"strconv"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// Server exposes tracker reports as JSON on a local HTTP endpoint
+type Server struct {
+	logger   *zap.Logger
+	server   *http.Server
+	listener net.Listener
+	handlers *http.ServeMux
+}
+
+// NewServer creates a statistics server for the tracker. The default number
+// of entries per dimension is topN; requests may override it with ?n=. A nil
+// tracker creates a server with only the handlers added through Handle.
+func NewServer(logger *zap.Logger, endpoint string, tracker *Tracker, topN int) *Server {
+	mux := http.NewServeMux()
+	if tracker != nil {
+		mux.HandleFunc("/statistics", func(w http.ResponseWriter, req *http.Request) {
+			n := topN
+			if value := req.URL.Query().Get("n"); value != "" {
+				if parsed, err := strconv.Atoi(value); err == nil && parsed > 0 {
+					n = parsed
+				}
+			}
+			WriteJSON(w, tracker.Report(n))
+		})
+	}
+
+	return &Server{
+		logger:   logger,
+		handlers: mux,
+		server: &http.Server{
+			Addr:              endpoint,
+			Handler:           mux,
+			ReadHeaderTimeout: 5 * time.Second,
+		},
+	}
+}
+
+// Handle registers an additional handler on the server
+func (s *Server) Handle(pattern string, handler http.Handler) {
+	s.handlers.Handle(pattern, handler)
+}
+
+// Listen binds the endpoint, so that an address in use is reported before
+// serving starts
+func (s *Server) Listen() error {
+	listener, err := net.Listen("tcp", s.server.Addr)
+	if err != nil {
+		return err
+	}
+	s.listener = listener
+
+	s.logger.Info("Statistics endpoint listening", zap.String("endpoint", listener.Addr().String()))
+	return nil
+}
+
+// Serve serves requests on the bound endpoint until Shutdown is called
+func (s *Server) Serve() {
+	if err := s.server.Serve(s.listener); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		s.logger.Error("Statistics endpoint failed", zap.Error(err))
+	}
+}
+
+// Addr returns the address the server is listening on
+func (s *Server) Addr() string {
+	if s.listener == nil {
+		return s.server.Addr
+	}
+	return s.listener.Addr().String()
+}
+
+// Shutdown stops the server
+func (s *Server) Shutdown(ctx context.Context) error {
+	return s.server.Shutdown(ctx)
+}
+
+// WriteJSON writes v as an indented JSON response
+func WriteJSON(w http.ResponseWriter, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	_ = enc.Encode(v)
+}
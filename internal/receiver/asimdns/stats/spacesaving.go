@@ -0,0 +1,128 @@
+package stats
+
+import (
+	"container/heap"
+	"sort"
+)
+
+// Entry is an approximate count for a single key
+type Entry struct {
+	Key   string `json:"key"`
+	Count int64  `json:"count"`
+	// Error is the maximum overestimation of Count
+	Error int64 `json:"error,omitempty"`
+}
+
+// counter is a monitored key in a SpaceSaving summary
+type counter struct {
+	key   string
+	count int64
+	err   int64
+	index int
+}
+
+// counterHeap is a min-heap of counters ordered by count
+type counterHeap []*counter
+
+func (h counterHeap) Len() int           { return len(h) }
+func (h counterHeap) Less(i, j int) bool { return h[i].count < h[j].count }
+func (h counterHeap) Swap(i, j int) {
+	h[i], h[j] = h[j], h[i]
+	h[i].index = i
+	h[j].index = j
+}
+func (h *counterHeap) Push(x interface{}) {
+	c := x.(*counter)
+	c.index = len(*h)
+	*h = append(*h, c)
+}
+func (h *counterHeap) Pop() interface{} {
+	old := *h
+	c := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return c
+}
+
+// SpaceSaving tracks the most frequent keys of a stream in bounded memory
+// using the Space-Saving algorithm (Metwally et al.). Any key whose true
+// count exceeds total/capacity is guaranteed to be monitored.
+type SpaceSaving struct {
+	capacity int
+	counters map[string]*counter
+	heap     counterHeap
+	total    int64
+}
+
+// NewSpaceSaving creates a summary monitoring at most capacity keys
+func NewSpaceSaving(capacity int) *SpaceSaving {
+	if capacity < 1 {
+		capacity = 1
+	}
+	return &SpaceSaving{
+		capacity: capacity,
+		counters: make(map[string]*counter, capacity),
+		heap:     make(counterHeap, 0, capacity),
+	}
+}
+
+// Add records weight occurrences of key
+func (s *SpaceSaving) Add(key string, weight int64) {
+	s.total += weight
+
+	if c, ok := s.counters[key]; ok {
+		c.count += weight
+		heap.Fix(&s.heap, c.index)
+		return
+	}
+
+	if len(s.heap) < s.capacity {
+		c := &counter{key: key, count: weight}
+		s.counters[key] = c
+		heap.Push(&s.heap, c)
+		return
+	}
+
+	// Replace the least frequent key, inheriting its count as the error bound
+	min := s.heap[0]
+	delete(s.counters, min.key)
+	min.err = min.count
+	min.count += weight
+	min.key = key
+	s.counters[key] = min
+	heap.Fix(&s.heap, 0)
+}
+
+// Total returns the total weight added
+func (s *SpaceSaving) Total() int64 {
+	return s.total
+}
+
+// Reset clears the summary
+func (s *SpaceSaving) Reset() {
+	s.counters = make(map[string]*counter, s.capacity)
+	s.heap = s.heap[:0]
+	s.total = 0
+}
+
+// Top returns up to n entries ordered by descending count
+func (s *SpaceSaving) Top(n int) []Entry {
+	entries := make([]Entry, 0, len(s.heap))
+	for _, c := range s.heap {
+		entries = append(entries, Entry{Key: c.key, Count: c.count, Error: c.err})
+	}
+	return topEntries(entries, n)
+}
+
+// topEntries sorts entries by descending count and truncates to n
+func topEntries(entries []Entry, n int) []Entry {
+	sort.Slice(entries, func(i, j int) bool {
+		if entries[i].Count != entries[j].Count {
+			return entries[i].Count > entries[j].Count
+		}
+		return entries[i].Key < entries[j].Key
+	})
+	if n > 0 && len(entries) > n {
+		entries = entries[:n]
+	}
+	return entries
+}
@@ -0,0 +1,95 @@
+package stats
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+func TestSpaceSavingFindsHeavyHitters(t *testing.T) {
+	s := NewSpaceSaving(10)
+	for i := 0; i < 1000; i++ {
+		s.Add("heavy.example.com", 1)
+		if i%2 == 0 {
+			s.Add("medium.example.com", 1)
+		}
+		s.Add(fmt.Sprintf("noise-%d.example.com", i), 1)
+	}
+
+	top := s.Top(2)
+	if len(top) != 2 || top[0].Key != "heavy.example.com" || top[1].Key != "medium.example.com" {
+		t.Fatalf("unexpected top entries: %+v", top)
+	}
+	if top[0].Count < 1000 || top[0].Count-top[0].Error > 1000 {
+		t.Errorf("count bounds do not contain the true count: %+v", top[0])
+	}
+	if s.Total() != 2500 {
+		t.Errorf("expected total 2500, got %d", s.Total())
+	}
+}
+
+func TestWindowExpiresBuckets(t *testing.T) {
+	start := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	w := NewWindow(time.Minute, 6, 10)
+
+	w.Add(start, "old.example.com", 5)
+	w.Add(start.Add(30*time.Second), "new.example.com", 3)
+
+	if top := w.Top(start.Add(45*time.Second), 10); len(top) != 2 {
+		t.Fatalf("expected both keys within the window, got %+v", top)
+	}
+
+	top := w.Top(start.Add(65*time.Second), 10)
+	if len(top) != 1 || top[0].Key != "new.example.com" || top[0].Count != 3 {
+		t.Errorf("expected only the recent key, got %+v", top)
+	}
+	if total := w.Total(start.Add(5 * time.Minute)); total != 0 {
+		t.Errorf("expected empty window, got total %d", total)
+	}
+}
+
+func TestTrackerAndServer(t *testing.T) {
+	tracker := NewTracker(time.Hour, 12, 100)
+	for i := 0; i < 3; i++ {
+		tracker.Observe(StageBeforeFiltering, Observation{
+			DimensionQueryDomain:      "www.example.com",
+			DimensionRegisteredDomain: "example.com",
+			DimensionProcess:          "1234",
+		}, 1)
+	}
+	tracker.Observe(StageAfterFiltering, Observation{DimensionQueryDomain: "www.example.com"}, 10)
+
+	server := NewServer(zap.NewNop(), "127.0.0.1:0", tracker, 5)
+	if err := server.Listen(); err != nil {
+		t.Fatalf("failed to start server: %v", err)
+	}
+	go server.Serve()
+	defer server.Shutdown(context.Background())
+
+	resp, err := http.Get("http://" + server.Addr() + "/statistics")
+	if err != nil {
+		t.Fatalf("request failed: %v", err)
+	}
+	defer resp.Body.Close()
+
+	var report Report
+	if err := json.NewDecoder(resp.Body).Decode(&report); err != nil {
+		t.Fatalf("invalid report: %v", err)
+	}
+
+	before := report.Stages[StageBeforeFiltering]
+	if before.Total != 3 || before.Dimensions[DimensionRegisteredDomain][0].Count != 3 {
+		t.Errorf("unexpected before-filtering report: %+v", before)
+	}
+	if len(before.Dimensions[DimensionClientIP]) != 0 {
+		t.Errorf("empty values must not be counted: %+v", before.Dimensions[DimensionClientIP])
+	}
+	if after := report.Stages[StageAfterFiltering]; after.Total != 10 {
+		t.Errorf("expected weighted after-filtering total 10, got %d", after.Total)
+	}
+}
@@ -0,0 +1,123 @@
+// Package stats maintains approximate heavy-hitter statistics of DNS traffic
+// so operators can decide what to exclude without exporting everything.
+package stats
+
+import (
+	"sync"
+	"time"
+)
+
+// Stages at which traffic is observed
+const (
+	StageBeforeFiltering = "before_filtering"
+	StageAfterFiltering  = "after_filtering"
+)
+
+// Dimensions tracked for each stage
+const (
+	DimensionQueryDomain      = "query_domain"
+	DimensionRegisteredDomain = "registered_domain"
+	DimensionProcess          = "process"
+	DimensionClientIP         = "client_ip"
+	DimensionEventID          = "event_id"
+)
+
+// Stages lists all observation stages
+var Stages = []string{StageBeforeFiltering, StageAfterFiltering}
+
+// Dimensions lists all tracked dimensions
+var Dimensions = []string{DimensionQueryDomain, DimensionRegisteredDomain, DimensionProcess, DimensionClientIP, DimensionEventID}
+
+// Observation holds the dimension values of a single event. Empty values are not counted.
+type Observation map[string]string
+
+// Tracker maintains sliding-window top-N statistics per stage and dimension
+type Tracker struct {
+	mux     sync.Mutex
+	window  time.Duration
+	windows map[string]map[string]*Window
+	totals  map[string]*Window
+	now     func() time.Time
+}
+
+// NewTracker creates a tracker covering window, split into buckets, with
+// capacity monitored keys per bucket and dimension
+func NewTracker(window time.Duration, buckets int, capacity int) *Tracker {
+	t := &Tracker{
+		window:  window,
+		windows: make(map[string]map[string]*Window),
+		totals:  make(map[string]*Window),
+		now:     time.Now,
+	}
+	for _, stage := range Stages {
+		t.windows[stage] = make(map[string]*Window)
+		for _, dim := range Dimensions {
+			t.windows[stage][dim] = NewWindow(window, buckets, capacity)
+		}
+		t.totals[stage] = NewWindow(window, buckets, 1)
+	}
+	return t
+}
+
+// Observe records an event at the given stage with the given weight. Weights
+// greater than one are used for aggregated records.
+func (t *Tracker) Observe(stage string, obs Observation, weight int64) {
+	if weight <= 0 {
+		weight = 1
+	}
+
+	t.mux.Lock()
+	defer t.mux.Unlock()
+
+	dims, ok := t.windows[stage]
+	if !ok {
+		return
+	}
+	now := t.now()
+	t.totals[stage].Add(now, "", weight)
+	for dim, value := range obs {
+		if value == "" {
+			continue
+		}
+		if w, ok := dims[dim]; ok {
+			w.Add(now, value, weight)
+		}
+	}
+}
+
+// StageReport holds the top entries of each dimension for one stage
+type StageReport struct {
+	Total      int64              `json:"total"`
+	Dimensions map[string][]Entry `json:"dimensions"`
+}
+
+// Report is a snapshot of the tracked statistics
+type Report struct {
+	GeneratedAt   time.Time              `json:"generated_at"`
+	WindowSeconds int64                  `json:"window_seconds"`
+	Stages        map[string]StageReport `json:"stages"`
+}
+
+// Report returns the top n entries of every stage and dimension
+func (t *Tracker) Report(n int) Report {
+	t.mux.Lock()
+	defer t.mux.Unlock()
+
+	now := t.now()
+	report := Report{
+		GeneratedAt:   now.UTC(),
+		WindowSeconds: int64(t.window / time.Second),
+		Stages:        make(map[string]StageReport, len(t.windows)),
+	}
+	for stage, dims := range t.windows {
+		sr := StageReport{
+			Total:      t.totals[stage].Total(now),
+			Dimensions: make(map[string][]Entry, len(dims)),
+		}
+		for dim, w := range dims {
+			sr.Dimensions[dim] = w.Top(now, n)
+		}
+		report.Stages[stage] = sr
+	}
+	return report
+}
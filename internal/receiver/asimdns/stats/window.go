@@ -0,0 +1,92 @@
+package stats
+
+import "time"
+
+// Window maintains approximate top-N counts over a sliding time window made of
+// fixed-size buckets, each with its own SpaceSaving summary
+type Window struct {
+	bucketDuration time.Duration
+	buckets        []*SpaceSaving
+	current        int
+	currentStart   time.Time
+}
+
+// NewWindow creates a sliding window covering duration, split into the given
+// number of buckets each monitoring up to capacity keys
+func NewWindow(duration time.Duration, buckets int, capacity int) *Window {
+	if buckets < 1 {
+		buckets = 1
+	}
+	w := &Window{
+		bucketDuration: duration / time.Duration(buckets),
+		buckets:        make([]*SpaceSaving, buckets),
+	}
+	if w.bucketDuration <= 0 {
+		w.bucketDuration = time.Second
+	}
+	for i := range w.buckets {
+		w.buckets[i] = NewSpaceSaving(capacity)
+	}
+	return w
+}
+
+// advance rotates expired buckets out of the window
+func (w *Window) advance(now time.Time) {
+	if w.currentStart.IsZero() {
+		w.currentStart = now.Truncate(w.bucketDuration)
+		return
+	}
+
+	elapsed := int(now.Sub(w.currentStart) / w.bucketDuration)
+	if elapsed <= 0 {
+		return
+	}
+	if elapsed > len(w.buckets) {
+		elapsed = len(w.buckets)
+	}
+	for i := 0; i < elapsed; i++ {
+		w.current = (w.current + 1) % len(w.buckets)
+		w.buckets[w.current].Reset()
+	}
+	w.currentStart = now.Truncate(w.bucketDuration)
+}
+
+// Add records weight occurrences of key at time now
+func (w *Window) Add(now time.Time, key string, weight int64) {
+	w.advance(now)
+	w.buckets[w.current].Add(key, weight)
+}
+
+// Total returns the total weight observed within the window
+func (w *Window) Total(now time.Time) int64 {
+	w.advance(now)
+	var total int64
+	for _, b := range w.buckets {
+		total += b.Total()
+	}
+	return total
+}
+
+// Top returns up to n entries over the whole window by merging the buckets
+func (w *Window) Top(now time.Time, n int) []Entry {
+	w.advance(now)
+
+	merged := make(map[string]*Entry)
+	for _, b := range w.buckets {
+		for _, c := range b.heap {
+			e, ok := merged[c.key]
+			if !ok {
+				e = &Entry{Key: c.key}
+				merged[c.key] = e
+			}
+			e.Count += c.count
+			e.Error += c.err
+		}
+	}
+
+	entries := make([]Entry, 0, len(merged))
+	for _, e := range merged {
+		entries = append(entries, *e)
+	}
+	return topEntries(entries, n)
+}
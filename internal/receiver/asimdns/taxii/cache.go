@@ -0,0 +1,170 @@
+package taxii
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/LaurieRhodes/asim-dns-collector/internal/receiver/asimdns/threatintel"
+)
+
+// cacheVersion is incremented whenever the cache file format changes
+const cacheVersion = 1
+
+// cacheFile is the on-disk form of the cache
+type cacheFile struct {
+	Version    int                      `json:"version"`
+	AddedAfter time.Time                `json:"added_after"`
+	Objects    []threatintel.STIXObject `json:"objects"`
+}
+
+// Cache holds the latest version of every active indicator object of a
+// collection and the polling position
+type Cache struct {
+	mux        sync.Mutex
+	addedAfter time.Time
+	objects    map[string]threatintel.STIXObject
+}
+
+// NewCache creates an empty cache
+func NewCache() *Cache {
+	return &Cache{objects: make(map[string]threatintel.STIXObject)}
+}
+
+// AddedAfter returns the date-added of the last object fetched
+func (c *Cache) AddedAfter() time.Time {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+	return c.addedAfter
+}
+
+// Merge adds fetched objects, keeping the newest version of each and
+// removing revoked ones, and advances the polling position
+func (c *Cache) Merge(objects []threatintel.STIXObject, addedAfter time.Time) {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+
+	for _, obj := range objects {
+		if obj.Type != "indicator" || obj.ID == "" {
+			continue
+		}
+		if existing, ok := c.objects[obj.ID]; ok && newer(existing.Modified, obj.Modified) {
+			continue
+		}
+		if obj.Revoked {
+			delete(c.objects, obj.ID)
+			continue
+		}
+		c.objects[obj.ID] = obj
+	}
+	if addedAfter.After(c.addedAfter) {
+		c.addedAfter = addedAfter
+	}
+}
+
+// parseTimestamp parses a STIX timestamp
+func parseTimestamp(value string) (time.Time, bool) {
+	t, err := time.Parse(time.RFC3339Nano, value)
+	return t, err == nil
+}
+
+// newer reports whether modified time a is after b. Timestamps are compared
+// as times, since their precision and offset vary; values that do not parse
+// are compared as strings.
+func newer(a, b string) bool {
+	at, aok := parseTimestamp(a)
+	bt, bok := parseTimestamp(b)
+	if aok && bok {
+		return at.After(bt)
+	}
+	return a > b
+}
+
+// Active removes expired objects and returns the indicators of the remaining ones
+func (c *Cache) Active(now time.Time) []threatintel.Indicator {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+
+	var indicators []threatintel.Indicator
+	for id, obj := range c.objects {
+		if until, err := time.Parse(time.RFC3339, obj.ValidUntil); err == nil && now.After(until) {
+			delete(c.objects, id)
+			continue
+		}
+		indicators = append(indicators, obj.Indicators()...)
+	}
+	return indicators
+}
+
+// Len returns the number of cached objects
+func (c *Cache) Len() int {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+	return len(c.objects)
+}
+
+// Save writes the cache atomically to path
+func (c *Cache) Save(path string) error {
+	c.mux.Lock()
+	file := cacheFile{
+		Version:    cacheVersion,
+		AddedAfter: c.addedAfter,
+		Objects:    make([]threatintel.STIXObject, 0, len(c.objects)),
+	}
+	for _, obj := range c.objects {
+		file.Objects = append(file.Objects, obj)
+	}
+	c.mux.Unlock()
+
+	sort.Slice(file.Objects, func(i, j int) bool { return file.Objects[i].ID < file.Objects[j].ID })
+	data, err := json.Marshal(file)
+	if err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".tmp*")
+	if err != nil {
+		return err
+	}
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+// Load reads a cache saved by Save. A missing file leaves the cache empty.
+func (c *Cache) Load(path string) error {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	var file cacheFile
+	if err := json.Unmarshal(data, &file); err != nil {
+		return fmt.Errorf("parsing taxii cache %s: %w", path, err)
+	}
+	if file.Version != cacheVersion {
+		return fmt.Errorf("taxii cache %s has version %d, expected %d", path, file.Version, cacheVersion)
+	}
+
+	c.mux.Lock()
+	c.objects = make(map[string]threatintel.STIXObject, len(file.Objects))
+	c.addedAfter = time.Time{}
+	c.mux.Unlock()
+	c.Merge(file.Objects, file.AddedAfter)
+	return nil
+}
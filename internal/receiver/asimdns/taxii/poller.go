@@ -0,0 +1,111 @@
+package taxii
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/LaurieRhodes/asim-dns-collector/internal/receiver/asimdns/threatintel"
+)
+
+// Sink receives the complete set of active indicators of a source after every poll
+type Sink func(source string, indicators []threatintel.Indicator)
+
+// Poller periodically fetches new indicators from a collection into its cache
+type Poller struct {
+	logger *zap.Logger
+	cfg    CollectionConfig
+	client *Client
+	cache  *Cache
+	sink   Sink
+	now    func() time.Time
+}
+
+// NewPoller creates a poller for a validated collection configuration
+func NewPoller(logger *zap.Logger, cfg CollectionConfig, httpClient *http.Client, sink Sink) *Poller {
+	return &Poller{
+		logger: logger,
+		cfg:    cfg,
+		client: NewClient(cfg, httpClient),
+		cache:  NewCache(),
+		sink:   sink,
+		now:    time.Now,
+	}
+}
+
+// Source returns the name under which the poller publishes its indicators
+func (p *Poller) Source() string {
+	return "taxii:" + p.cfg.Name
+}
+
+// Poll fetches objects added since the previous poll and publishes the active indicators
+func (p *Poller) Poll(ctx context.Context) error {
+	addedAfter := p.cache.AddedAfter()
+	if addedAfter.IsZero() && p.cfg.InitialLookback > 0 {
+		addedAfter = p.now().AddDate(0, 0, -p.cfg.InitialLookback)
+	}
+
+	objects, last, err := p.client.Fetch(ctx, addedAfter)
+	if err != nil {
+		return err
+	}
+	p.cache.Merge(objects, last)
+	indicators := p.publish()
+
+	if p.cfg.CacheFile != "" {
+		if err := p.cache.Save(p.cfg.CacheFile); err != nil {
+			p.logger.Warn("Failed to save TAXII cache", zap.String("collection", p.cfg.Name), zap.Error(err))
+		}
+	}
+
+	p.logger.Info("Polled TAXII collection",
+		zap.String("collection", p.cfg.Name),
+		zap.Int("fetched", len(objects)),
+		zap.Int("active_indicators", len(indicators)))
+	return nil
+}
+
+// publish removes expired objects from the cache and sends the active indicators to the sink
+func (p *Poller) publish() []threatintel.Indicator {
+	indicators := p.cache.Active(p.now())
+	for i := range indicators {
+		if indicators[i].Category == "" {
+			indicators[i].Category = p.cfg.Category
+		}
+		if indicators[i].RiskLevel == 0 {
+			indicators[i].RiskLevel = p.cfg.RiskLevel
+		}
+		indicators[i].Source = p.Source()
+	}
+	p.sink(p.Source(), indicators)
+	return indicators
+}
+
+// Run restores the cache, then polls immediately and at the configured
+// interval until the context is done
+func (p *Poller) Run(ctx context.Context) {
+	if p.cfg.CacheFile != "" {
+		if err := p.cache.Load(p.cfg.CacheFile); err != nil {
+			p.logger.Warn("TAXII cache not restored", zap.String("collection", p.cfg.Name), zap.Error(err))
+		} else if p.cache.Len() > 0 {
+			p.publish()
+		}
+	}
+
+	ticker := time.NewTicker(time.Duration(p.cfg.PollInterval) * time.Second)
+	defer ticker.Stop()
+
+	for {
+		if err := p.Poll(ctx); err != nil && ctx.Err() == nil {
+			p.logger.Warn("TAXII poll failed", zap.String("collection", p.cfg.Name), zap.Error(err))
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
@@ -0,0 +1,220 @@
+package taxii
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"net/url"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/LaurieRhodes/asim-dns-collector/internal/receiver/asimdns/threatintel"
+)
+
+// fakeObject is a collection object with the time it was added
+type fakeObject struct {
+	added  time.Time
+	object threatintel.STIXObject
+}
+
+// fakeServer is a minimal TAXII 2.1 collection supporting added_after and pagination
+type fakeServer struct {
+	mux      sync.Mutex
+	objects  []fakeObject
+	requests []string
+	// noDateAdded omits the X-TAXII-Date-Added-Last header
+	noDateAdded bool
+}
+
+func (s *fakeServer) add(added time.Time, obj threatintel.STIXObject) {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	s.objects = append(s.objects, fakeObject{added: added, object: obj})
+}
+
+func (s *fakeServer) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+
+	if user, pass, ok := req.BasicAuth(); !ok || user != "ti" || pass != "secret" {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+	if req.URL.Path != "/api/collections/dns-indicators/objects/" || req.Header.Get("Accept") != MediaType {
+		http.Error(w, "not found", http.StatusNotFound)
+		return
+	}
+	s.requests = append(s.requests, req.URL.RawQuery)
+
+	query := req.URL.Query()
+	var after time.Time
+	if value := query.Get("added_after"); value != "" {
+		after, _ = time.Parse(time.RFC3339Nano, value)
+	}
+	limit, _ := strconv.Atoi(query.Get("limit"))
+	start, _ := strconv.Atoi(query.Get("next"))
+
+	var matching []fakeObject
+	for _, obj := range s.objects {
+		if obj.added.After(after) {
+			matching = append(matching, obj)
+		}
+	}
+	end := start + limit
+	if end > len(matching) {
+		end = len(matching)
+	}
+
+	env := envelope{Objects: []threatintel.STIXObject{}}
+	for _, obj := range matching[start:end] {
+		env.Objects = append(env.Objects, obj.object)
+	}
+	if end < len(matching) {
+		env.More = true
+		env.Next = strconv.Itoa(end)
+	}
+	if end > start && !s.noDateAdded {
+		w.Header().Set("X-TAXII-Date-Added-Last", matching[end-1].added.Format(time.RFC3339Nano))
+	}
+	w.Header().Set("Content-Type", MediaType)
+	_ = json.NewEncoder(w).Encode(env)
+}
+
+func containsParam(rawQuery, name, value string) bool {
+	query, err := url.ParseQuery(rawQuery)
+	return err == nil && query.Get(name) == value
+}
+
+func indicator(id, pattern, modified string) threatintel.STIXObject {
+	return threatintel.STIXObject{Type: "indicator", ID: id, Pattern: pattern, PatternType: "stix", Modified: modified}
+}
+
+func TestPollerIncrementalFetch(t *testing.T) {
+	base := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	fake := &fakeServer{}
+	fake.add(base, indicator("indicator--1", "[domain-name:value = 'one.example']", "2025-01-01T00:00:00Z"))
+	fake.add(base.Add(time.Minute), indicator("indicator--2", "[ipv4-addr:value = '192.0.2.1']", "2025-01-01T00:01:00Z"))
+	fake.add(base.Add(2*time.Minute), indicator("indicator--3", "[domain-name:value = 'three.example']", "2025-01-01T00:02:00Z"))
+	server := httptest.NewServer(fake)
+	defer server.Close()
+
+	cfg := CollectionConfig{
+		APIRoot:      server.URL + "/api/",
+		CollectionID: "dns-indicators",
+		Username:     "ti",
+		Password:     "secret",
+		PageSize:     2,
+		CacheFile:    filepath.Join(t.TempDir(), "taxii-cache.json"),
+	}
+	if err := cfg.Validate(); err != nil {
+		t.Fatal(err)
+	}
+
+	store := threatintel.NewStore(zap.NewNop(), nil)
+	poller := NewPoller(zap.NewNop(), cfg, server.Client(), store.SetIndicators)
+	if err := poller.Poll(context.Background()); err != nil {
+		t.Fatalf("poll failed: %v", err)
+	}
+	if len(fake.requests) != 2 {
+		t.Fatalf("expected two paginated requests, got %v", fake.requests)
+	}
+	if store.Len() != 3 {
+		t.Fatalf("expected 3 indicators, got %d", store.Len())
+	}
+
+	// Revoke one indicator and expire another; only changes are fetched
+	revoked := indicator("indicator--1", "[domain-name:value = 'one.example']", "2025-01-02T00:00:00Z")
+	revoked.Revoked = true
+	expired := indicator("indicator--3", "[domain-name:value = 'three.example']", "2025-01-02T00:00:00Z")
+	expired.ValidUntil = "2025-01-02T00:00:00Z"
+	fake.add(base.Add(time.Hour), revoked)
+	fake.add(base.Add(time.Hour+time.Minute), expired)
+
+	if err := poller.Poll(context.Background()); err != nil {
+		t.Fatalf("poll failed: %v", err)
+	}
+	if got := fake.requests[len(fake.requests)-1]; !containsParam(got, "added_after", base.Add(2*time.Minute).Format(time.RFC3339Nano)) {
+		t.Errorf("expected incremental request, got %q", got)
+	}
+	if _, ok := store.MatchDomain("one.example"); ok {
+		t.Errorf("revoked indicator must be removed")
+	}
+	if _, ok := store.MatchDomain("three.example"); ok {
+		t.Errorf("expired indicator must be removed")
+	}
+	if m, ok := store.Match("", []netip.Addr{netip.MustParseAddr("192.0.2.1")}); !ok || m.Indicator.Source != "taxii:dns-indicators" {
+		t.Errorf("expected remaining IP indicator from the TAXII source, got %+v", m)
+	}
+
+	// A restarted poller resumes from the cache file
+	restored := NewCache()
+	if err := restored.Load(cfg.CacheFile); err != nil {
+		t.Fatalf("failed to load cache: %v", err)
+	}
+	if restored.Len() != 1 || !restored.AddedAfter().Equal(base.Add(time.Hour+time.Minute)) {
+		t.Errorf("unexpected restored cache: %d objects, added after %v", restored.Len(), restored.AddedAfter())
+	}
+}
+
+func TestPollerReportsAuthFailure(t *testing.T) {
+	server := httptest.NewServer(&fakeServer{})
+	defer server.Close()
+
+	cfg := CollectionConfig{APIRoot: server.URL + "/api", CollectionID: "dns-indicators", Username: "ti", Password: "wrong"}
+	if err := cfg.Validate(); err != nil {
+		t.Fatal(err)
+	}
+	poller := NewPoller(zap.NewNop(), cfg, server.Client(), func(string, []threatintel.Indicator) {
+		t.Errorf("sink must not be called after a failed poll")
+	})
+	if err := poller.Poll(context.Background()); err == nil {
+		t.Errorf("expected error for rejected credentials")
+	}
+}
+
+func TestFetchWithoutDateAdded(t *testing.T) {
+	base := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	fake := &fakeServer{noDateAdded: true}
+	fake.add(base, indicator("indicator--1", "[domain-name:value = 'one.example']", "2025-01-01T01:00:00.250+01:00"))
+	fake.add(base, indicator("indicator--2", "[domain-name:value = 'two.example']", "2025-01-01T00:00:00Z"))
+	server := httptest.NewServer(fake)
+	defer server.Close()
+
+	cfg := CollectionConfig{APIRoot: server.URL + "/api", CollectionID: "dns-indicators", Username: "ti", Password: "secret"}
+	if err := cfg.Validate(); err != nil {
+		t.Fatal(err)
+	}
+	objects, last, err := NewClient(cfg, server.Client()).Fetch(context.Background(), time.Time{})
+	if err != nil {
+		t.Fatalf("fetch failed: %v", err)
+	}
+	if len(objects) != 2 || !last.Equal(base.Add(250*time.Millisecond)) {
+		t.Errorf("fetched %d objects, last %v; want the newest modified time", len(objects), last)
+	}
+}
+
+func TestCacheKeepsNewestModified(t *testing.T) {
+	cache := NewCache()
+	current := indicator("indicator--1", "[domain-name:value = 'new.example']", "2025-01-01T00:00:00.100Z")
+	cache.Merge([]threatintel.STIXObject{current}, time.Time{})
+
+	// Later as a string, earlier as a time
+	for _, modified := range []string{"2025-01-01T00:00:00Z", "2025-01-01T01:00:00.050+01:00"} {
+		cache.Merge([]threatintel.STIXObject{indicator("indicator--1", "[domain-name:value = 'old.example']", modified)}, time.Time{})
+	}
+	if active := cache.Active(time.Now()); len(active) != 1 || active[0].Value != "new.example" {
+		t.Errorf("older versions replaced the newest: %+v", active)
+	}
+
+	cache.Merge([]threatintel.STIXObject{indicator("indicator--1", "[domain-name:value = 'newer.example']", "2025-01-01T00:00:01Z")}, time.Time{})
+	if active := cache.Active(time.Now()); len(active) != 1 || active[0].Value != "newer.example" {
+		t.Errorf("newer version not kept: %+v", active)
+	}
+}
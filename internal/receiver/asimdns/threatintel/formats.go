@@ -0,0 +1,473 @@
+package threatintel
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/netip"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Indicator file formats
+const (
+	FormatPlain = "plain"
+	FormatCSV   = "csv"
+	FormatSTIX  = "stix"
+	FormatMISP  = "misp"
+	FormatRPZ   = "rpz"
+)
+
+// FormatFromPath guesses the format of an indicator file from its extension
+func FormatFromPath(path string) string {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".csv":
+		return FormatCSV
+	case ".json":
+		return FormatSTIX
+	case ".rpz", ".zone", ".db":
+		return FormatRPZ
+	default:
+		return FormatPlain
+	}
+}
+
+// Parse reads indicators in the given format. Fields missing from the data
+// are taken from defaults.
+func Parse(format string, data []byte, defaults Indicator) ([]Indicator, error) {
+	var indicators []Indicator
+	var err error
+
+	switch format {
+	case FormatPlain:
+		indicators, err = parsePlain(data)
+	case FormatCSV:
+		indicators, err = parseCSV(data)
+	case FormatSTIX:
+		indicators, err = parseSTIX(data)
+	case FormatMISP:
+		indicators, err = parseMISP(data)
+	case FormatRPZ:
+		indicators, err = parseRPZ(data)
+	default:
+		return nil, fmt.Errorf("unknown indicator format %q", format)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	for i := range indicators {
+		applyDefaults(&indicators[i], defaults)
+	}
+	return indicators, nil
+}
+
+// applyDefaults fills empty indicator fields from defaults
+func applyDefaults(ind *Indicator, defaults Indicator) {
+	if ind.Category == "" {
+		ind.Category = defaults.Category
+	}
+	if ind.RiskLevel == 0 {
+		ind.RiskLevel = defaults.RiskLevel
+	}
+	if ind.Confidence == "" {
+		ind.Confidence = defaults.Confidence
+	}
+	if ind.Source == "" {
+		ind.Source = defaults.Source
+	}
+}
+
+// parsePlain reads one domain or address per line. Lines starting with # are
+// comments, and hosts-file lines such as "0.0.0.0 bad.example" use the name.
+func parsePlain(data []byte) ([]Indicator, error) {
+	var indicators []Indicator
+
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		line := scanner.Text()
+		if i := strings.IndexByte(line, '#'); i >= 0 {
+			line = line[:i]
+		}
+		fields := strings.Fields(line)
+		if len(fields) == 0 {
+			continue
+		}
+
+		value := fields[0]
+		if len(fields) > 1 {
+			if addr, err := netip.ParseAddr(fields[0]); err == nil && (addr.IsUnspecified() || addr.IsLoopback()) {
+				value = fields[1]
+			}
+		}
+		if ind, ok := NewIndicator(value); ok {
+			indicators = append(indicators, ind)
+		}
+	}
+	return indicators, scanner.Err()
+}
+
+// csvColumns maps recognised header names to indicator fields
+var csvColumns = map[string]string{
+	"indicator":       "value",
+	"value":           "value",
+	"domain":          "value",
+	"ip":              "value",
+	"type":            "type",
+	"category":        "category",
+	"threat_category": "category",
+	"risk":            "risk",
+	"risk_level":      "risk",
+	"confidence":      "confidence",
+	"name":            "name",
+	"description":     "name",
+	"id":              "id",
+	"valid_until":     "valid_until",
+	"expiration":      "valid_until",
+}
+
+// parseCSV reads a CSV file with a header row naming its columns
+func parseCSV(data []byte) ([]Indicator, error) {
+	reader := csv.NewReader(bytes.NewReader(data))
+	reader.Comment = '#'
+	reader.FieldsPerRecord = -1
+	reader.TrimLeadingSpace = true
+
+	header, err := reader.Read()
+	if err != nil {
+		return nil, fmt.Errorf("reading CSV header: %w", err)
+	}
+	columns := make(map[string]int)
+	for i, name := range header {
+		if field, ok := csvColumns[strings.ToLower(strings.TrimSpace(name))]; ok {
+			if _, seen := columns[field]; !seen {
+				columns[field] = i
+			}
+		}
+	}
+	if _, ok := columns["value"]; !ok {
+		return nil, fmt.Errorf("CSV header must include an indicator, value, domain or ip column")
+	}
+
+	get := func(record []string, field string) string {
+		if i, ok := columns[field]; ok && i < len(record) {
+			return strings.TrimSpace(record[i])
+		}
+		return ""
+	}
+
+	var indicators []Indicator
+	for {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		ind, ok := NewIndicator(get(record, "value"))
+		if !ok {
+			continue
+		}
+		ind.Category = get(record, "category")
+		ind.Confidence = get(record, "confidence")
+		ind.Name = get(record, "name")
+		ind.ID = get(record, "id")
+		if risk, err := strconv.Atoi(get(record, "risk")); err == nil {
+			ind.RiskLevel = risk
+		}
+		if until, err := time.Parse(time.RFC3339, get(record, "valid_until")); err == nil {
+			ind.ValidUntil = until
+		}
+		indicators = append(indicators, ind)
+	}
+	return indicators, nil
+}
+
+// stixComparison matches domain and address comparisons in a STIX pattern
+var stixComparison = regexp.MustCompile(`(domain-name|ipv4-addr|ipv6-addr):value\s*=\s*'((?:[^'\\]|\\.)*)'`)
+
+// STIXObject is the subset of a STIX 2.1 indicator used for matching
+type STIXObject struct {
+	Type           string   `json:"type"`
+	ID             string   `json:"id"`
+	Name           string   `json:"name,omitempty"`
+	Pattern        string   `json:"pattern,omitempty"`
+	PatternType    string   `json:"pattern_type,omitempty"`
+	IndicatorTypes []string `json:"indicator_types,omitempty"`
+	Labels         []string `json:"labels,omitempty"`
+	Confidence     *int     `json:"confidence,omitempty"`
+	Modified       string   `json:"modified,omitempty"`
+	ValidUntil     string   `json:"valid_until,omitempty"`
+	Revoked        bool     `json:"revoked,omitempty"`
+}
+
+// Indicators converts a STIX indicator object into domain and IP indicators
+func (o STIXObject) Indicators() []Indicator {
+	if o.Type != "indicator" || o.Revoked || (o.PatternType != "" && o.PatternType != "stix") {
+		return nil
+	}
+
+	var indicators []Indicator
+	for _, m := range stixComparison.FindAllStringSubmatch(o.Pattern, -1) {
+		ind, ok := NewIndicator(strings.ReplaceAll(m[2], `\'`, `'`))
+		if !ok {
+			continue
+		}
+		ind.ID = o.ID
+		ind.Name = o.Name
+		if len(o.IndicatorTypes) > 0 {
+			ind.Category = o.IndicatorTypes[0]
+		} else if len(o.Labels) > 0 {
+			ind.Category = o.Labels[0]
+		}
+		if o.Confidence != nil {
+			ind.Confidence = strconv.Itoa(*o.Confidence)
+			ind.RiskLevel = *o.Confidence
+		}
+		if until, err := time.Parse(time.RFC3339, o.ValidUntil); err == nil {
+			ind.ValidUntil = until
+		}
+		indicators = append(indicators, ind)
+	}
+	return indicators
+}
+
+// parseSTIX reads a STIX 2.1 bundle
+func parseSTIX(data []byte) ([]Indicator, error) {
+	var bundle struct {
+		Type    string       `json:"type"`
+		Objects []STIXObject `json:"objects"`
+	}
+	if err := json.Unmarshal(data, &bundle); err != nil {
+		return nil, fmt.Errorf("parsing STIX bundle: %w", err)
+	}
+	if bundle.Type != "bundle" {
+		return nil, fmt.Errorf("parsing STIX bundle: expected type \"bundle\", got %q", bundle.Type)
+	}
+
+	var indicators []Indicator
+	for _, obj := range bundle.Objects {
+		indicators = append(indicators, obj.Indicators()...)
+	}
+	return indicators, nil
+}
+
+type mispAttribute struct {
+	UUID     string `json:"uuid"`
+	Type     string `json:"type"`
+	Category string `json:"category"`
+	Value    string `json:"value"`
+	ToIDS    *bool  `json:"to_ids"`
+}
+
+type mispEvent struct {
+	Info          string          `json:"info"`
+	ThreatLevelID string          `json:"threat_level_id"`
+	Attribute     []mispAttribute `json:"Attribute"`
+	Object        []struct {
+		Attribute []mispAttribute `json:"Attribute"`
+	} `json:"Object"`
+}
+
+// mispRiskLevels maps MISP threat levels to risk levels
+var mispRiskLevels = map[string]int{"1": 90, "2": 60, "3": 30}
+
+// parseMISP reads a MISP event export, a list of events or a REST search response
+func parseMISP(data []byte) ([]Indicator, error) {
+	type wrapper struct {
+		Event mispEvent `json:"Event"`
+	}
+	var events []mispEvent
+
+	var single wrapper
+	var list []wrapper
+	var search struct {
+		Response []wrapper `json:"response"`
+	}
+	switch {
+	case json.Unmarshal(data, &list) == nil:
+		for _, w := range list {
+			events = append(events, w.Event)
+		}
+	case json.Unmarshal(data, &search) == nil && search.Response != nil:
+		for _, w := range search.Response {
+			events = append(events, w.Event)
+		}
+	default:
+		if err := json.Unmarshal(data, &single); err != nil {
+			return nil, fmt.Errorf("parsing MISP event: %w", err)
+		}
+		events = append(events, single.Event)
+	}
+
+	var indicators []Indicator
+	for _, event := range events {
+		attributes := event.Attribute
+		for _, obj := range event.Object {
+			attributes = append(attributes, obj.Attribute...)
+		}
+
+		for _, attr := range attributes {
+			if attr.ToIDS != nil && !*attr.ToIDS {
+				continue
+			}
+			for _, value := range mispValues(attr) {
+				ind, ok := NewIndicator(value)
+				if !ok {
+					continue
+				}
+				ind.ID = attr.UUID
+				ind.Name = event.Info
+				ind.Category = attr.Category
+				ind.RiskLevel = mispRiskLevels[event.ThreatLevelID]
+				indicators = append(indicators, ind)
+			}
+		}
+	}
+	return indicators, nil
+}
+
+// mispValues returns the domain and address values of a MISP attribute
+func mispValues(attr mispAttribute) []string {
+	switch attr.Type {
+	case "domain", "hostname", "ip-dst", "ip-src":
+		return []string{attr.Value}
+	case "domain|ip":
+		return strings.Split(attr.Value, "|")
+	case "hostname|port", "ip-dst|port", "ip-src|port":
+		return strings.Split(attr.Value, "|")[:1]
+	default:
+		return nil
+	}
+}
+
+// parseRPZ reads a Response Policy Zone file. QNAME triggers become domain
+// indicators and rpz-ip triggers become address indicators; passthru rules
+// and other trigger types are ignored.
+func parseRPZ(data []byte) ([]Indicator, error) {
+	var indicators []Indicator
+	origin := ""
+	inParens := false
+
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		line := scanner.Text()
+		if i := strings.IndexByte(line, ';'); i >= 0 {
+			line = line[:i]
+		}
+
+		// Skip multi-line records such as the SOA
+		if inParens {
+			inParens = !strings.Contains(line, ")")
+			continue
+		}
+		if strings.Contains(line, "(") && !strings.Contains(line, ")") {
+			inParens = true
+			continue
+		}
+
+		// Lines without an owner name repeat the previous owner and carry no new trigger
+		fields := strings.Fields(line)
+		if len(fields) == 0 || strings.HasPrefix(line, " ") || strings.HasPrefix(line, "\t") {
+			continue
+		}
+		if strings.EqualFold(fields[0], "$ORIGIN") && len(fields) > 1 {
+			origin = strings.ToLower(fields[1])
+			continue
+		}
+		if strings.HasPrefix(fields[0], "$") || fields[0] == "@" || len(fields) < 3 {
+			continue
+		}
+
+		rrType, rdata := rpzRecord(fields[1:])
+		if rrType != "CNAME" || strings.HasPrefix(strings.ToLower(rdata), "rpz-passthru") {
+			continue
+		}
+
+		owner := strings.ToLower(fields[0])
+		if origin != "" && strings.HasSuffix(owner, "."+origin) {
+			owner = strings.TrimSuffix(owner, "."+origin)
+		}
+		owner = strings.TrimSuffix(owner, ".")
+
+		if strings.HasSuffix(owner, ".rpz-ip") {
+			if prefix, ok := rpzIPPrefix(strings.TrimSuffix(owner, ".rpz-ip")); ok {
+				indicators = append(indicators, Indicator{Type: TypeIP, Value: prefix.String(), Prefix: prefix})
+			}
+			continue
+		}
+		if strings.Contains(owner, ".rpz-") {
+			continue
+		}
+		if ind, ok := NewIndicator(owner); ok && ind.Type == TypeDomain {
+			indicators = append(indicators, ind)
+		}
+	}
+	return indicators, scanner.Err()
+}
+
+// rpzRecord returns the type and first rdata field of a record after its owner,
+// skipping optional TTL and class fields
+func rpzRecord(fields []string) (string, string) {
+	for i, field := range fields {
+		upper := strings.ToUpper(field)
+		if _, err := strconv.Atoi(field); err == nil || upper == "IN" {
+			continue
+		}
+		if i+1 < len(fields) {
+			return upper, fields[i+1]
+		}
+		return upper, ""
+	}
+	return "", ""
+}
+
+// rpzIPPrefix decodes an rpz-ip trigger such as "24.0.2.0.192" (192.0.2.0/24)
+// or "48.zz.1.db8.2001" (2001:db8:1::/48)
+func rpzIPPrefix(name string) (netip.Prefix, bool) {
+	labels := strings.Split(name, ".")
+	if len(labels) < 2 {
+		return netip.Prefix{}, false
+	}
+	bits, err := strconv.Atoi(labels[0])
+	if err != nil {
+		return netip.Prefix{}, false
+	}
+
+	parts := labels[1:]
+	for i, j := 0, len(parts)-1; i < j; i, j = i+1, j-1 {
+		parts[i], parts[j] = parts[j], parts[i]
+	}
+
+	// IPv6 triggers use "zz" for the "::" run of zero groups
+	text := strings.Join(parts, ".")
+	if bits > 32 || len(parts) != 4 {
+		text = strings.Join(parts, ":")
+		switch {
+		case strings.HasPrefix(text, "zz:"):
+			text = "::" + text[len("zz:"):]
+		case strings.HasSuffix(text, ":zz"):
+			text = text[:len(text)-len(":zz")] + "::"
+		default:
+			text = strings.Replace(text, ":zz:", "::", 1)
+		}
+	}
+
+	addr, err := netip.ParseAddr(text)
+	if err != nil {
+		return netip.Prefix{}, false
+	}
+	prefix, err := addr.Prefix(bits)
+	if err != nil {
+		return netip.Prefix{}, false
+	}
+	return prefix, true
+}
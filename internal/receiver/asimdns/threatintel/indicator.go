@@ -0,0 +1,133 @@
+// Package threatintel loads threat indicators from local files and matches
+// DNS query names and resolved addresses against them.
+package threatintel
+
+import (
+	"net/netip"
+	"strings"
+	"time"
+)
+
+// Indicator types, using the ASIM ThreatIndicatorType values
+const (
+	TypeDomain = "Domain"
+	TypeIP     = "Ip"
+)
+
+// Indicator is a single domain or IP indicator
+type Indicator struct {
+	Type  string
+	Value string
+	// Prefix is the address range of an IP indicator
+	Prefix netip.Prefix
+	// Category is the threat category, such as "malware" or "c2"
+	Category string
+	// RiskLevel is the risk from 0 to 100
+	RiskLevel int
+	// Confidence is the confidence as reported by the source
+	Confidence string
+	Name       string
+	ID         string
+	Source     string
+	// ValidUntil is the expiry of the indicator; zero means it does not expire
+	ValidUntil time.Time
+}
+
+// Expired reports whether the indicator is no longer valid at now
+func (i *Indicator) Expired(now time.Time) bool {
+	return !i.ValidUntil.IsZero() && now.After(i.ValidUntil)
+}
+
+// NewIndicator creates an indicator from a value, detecting whether it is an
+// address, an address range or a domain. It returns false for empty values.
+func NewIndicator(value string) (Indicator, bool) {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return Indicator{}, false
+	}
+
+	if prefix, err := netip.ParsePrefix(value); err == nil {
+		return Indicator{Type: TypeIP, Value: prefix.Masked().String(), Prefix: prefix.Masked()}, true
+	}
+	if addr, err := netip.ParseAddr(value); err == nil {
+		addr = addr.Unmap()
+		return Indicator{Type: TypeIP, Value: addr.String(), Prefix: netip.PrefixFrom(addr, addr.BitLen())}, true
+	}
+
+	domain := NormalizeDomain(value)
+	if domain == "" || strings.ContainsAny(domain, " /\t") {
+		return Indicator{}, false
+	}
+	return Indicator{Type: TypeDomain, Value: domain}, true
+}
+
+// NormalizeDomain lower-cases a domain and strips wildcard prefixes and trailing dots
+func NormalizeDomain(domain string) string {
+	domain = strings.ToLower(strings.TrimSpace(domain))
+	domain = strings.TrimPrefix(domain, "*.")
+	return strings.TrimSuffix(domain, ".")
+}
+
+// Set is an immutable collection of indicators indexed for matching
+type Set struct {
+	domains  map[string]*Indicator
+	addrs    map[netip.Addr]*Indicator
+	prefixes []*Indicator
+}
+
+// NewSet indexes indicators. Later indicators for the same value replace earlier ones.
+func NewSet(indicators []Indicator) *Set {
+	s := &Set{
+		domains: make(map[string]*Indicator),
+		addrs:   make(map[netip.Addr]*Indicator),
+	}
+	for i := range indicators {
+		ind := &indicators[i]
+		switch ind.Type {
+		case TypeDomain:
+			s.domains[ind.Value] = ind
+		case TypeIP:
+			if ind.Prefix.IsSingleIP() {
+				s.addrs[ind.Prefix.Addr()] = ind
+			} else if ind.Prefix.IsValid() {
+				s.prefixes = append(s.prefixes, ind)
+			}
+		}
+	}
+	return s
+}
+
+// Len returns the number of indicators in the set
+func (s *Set) Len() int {
+	return len(s.domains) + len(s.addrs) + len(s.prefixes)
+}
+
+// MatchDomain returns the indicator for the domain or its closest listed parent
+func (s *Set) MatchDomain(domain string, now time.Time) (*Indicator, bool) {
+	domain = NormalizeDomain(domain)
+	for domain != "" {
+		if ind, ok := s.domains[domain]; ok && !ind.Expired(now) {
+			return ind, true
+		}
+		dot := strings.IndexByte(domain, '.')
+		if dot < 0 {
+			break
+		}
+		domain = domain[dot+1:]
+	}
+	return nil, false
+}
+
+// MatchIP returns the indicator for an address or a range containing it
+func (s *Set) MatchIP(addr netip.Addr, now time.Time) (*Indicator, bool) {
+	addr = addr.Unmap()
+	if ind, ok := s.addrs[addr]; ok && !ind.Expired(now) {
+		return ind, true
+	}
+	for _, ind := range s.prefixes {
+		if ind.Prefix.Contains(addr) && !ind.Expired(now) {
+			return ind, true
+		}
+	}
+	return nil, false
+}
@@ -0,0 +1,251 @@
+package threatintel
+
+import (
+	"context"
+	"fmt"
+	"net/netip"
+	"os"
+	"sort"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// SourceConfig configures an indicator file
+type SourceConfig struct {
+	Path string `mapstructure:"path"`
+	// Format is plain, csv, stix, misp or rpz; it defaults from the file extension
+	Format string `mapstructure:"format"`
+	// Category, RiskLevel and Confidence apply to indicators that do not carry their own
+	Category   string `mapstructure:"category"`
+	RiskLevel  int    `mapstructure:"risk_level"`
+	Confidence string `mapstructure:"confidence"`
+}
+
+// Validate checks the source and fills in its format
+func (c *SourceConfig) Validate() error {
+	if c.Path == "" {
+		return fmt.Errorf("threat intelligence source path must be specified")
+	}
+	if c.Format == "" {
+		c.Format = FormatFromPath(c.Path)
+	}
+	switch c.Format {
+	case FormatPlain, FormatCSV, FormatSTIX, FormatMISP, FormatRPZ:
+	default:
+		return fmt.Errorf("threat intelligence source %q: unknown format %q", c.Path, c.Format)
+	}
+	if c.RiskLevel < 0 || c.RiskLevel > 100 {
+		return fmt.Errorf("threat intelligence source %q: risk_level must be between 0 and 100", c.Path)
+	}
+	return nil
+}
+
+// fileState identifies a loaded version of an indicator file
+type fileState struct {
+	modTime time.Time
+	size    int64
+}
+
+// Match is the result of matching a value against the indicators
+type Match struct {
+	Indicator *Indicator
+	// Field is the ASIM field that matched, such as DnsQuery
+	Field string
+	// Value is the matched value
+	Value string
+}
+
+// Store holds indicators from files and from named dynamic sources such as
+// TAXII collections, and reloads files when they change
+type Store struct {
+	logger  *zap.Logger
+	sources []SourceConfig
+
+	mux     sync.RWMutex
+	set     *Set
+	files   map[string]fileState
+	loaded  map[string][]Indicator
+	dynamic map[string][]Indicator
+	now     func() time.Time
+}
+
+// NewStore creates a store for the configured indicator files
+func NewStore(logger *zap.Logger, sources []SourceConfig) *Store {
+	return &Store{
+		logger:  logger,
+		sources: sources,
+		set:     NewSet(nil),
+		files:   make(map[string]fileState),
+		loaded:  make(map[string][]Indicator),
+		dynamic: make(map[string][]Indicator),
+		now:     time.Now,
+	}
+}
+
+// Reload reads indicator files that changed since they were last loaded. A
+// file that fails to load keeps its previous indicators, while a file that no
+// longer exists drops them.
+func (s *Store) Reload() error {
+	var errs []error
+	changed := false
+
+	for _, src := range s.sources {
+		info, err := os.Stat(src.Path)
+		if err != nil {
+			errs = append(errs, err)
+			if os.IsNotExist(err) && s.forget(src.Path) {
+				changed = true
+				s.logger.Info("Removed threat indicators of missing file", zap.String("path", src.Path))
+			}
+			continue
+		}
+		state := fileState{modTime: info.ModTime(), size: info.Size()}
+
+		s.mux.RLock()
+		previous, seen := s.files[src.Path]
+		s.mux.RUnlock()
+		if seen && previous == state {
+			continue
+		}
+
+		data, err := os.ReadFile(src.Path)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		indicators, err := Parse(src.Format, data, Indicator{
+			Category:   src.Category,
+			RiskLevel:  src.RiskLevel,
+			Confidence: src.Confidence,
+			Source:     src.Path,
+		})
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", src.Path, err))
+			continue
+		}
+
+		s.mux.Lock()
+		s.files[src.Path] = state
+		s.loaded[src.Path] = indicators
+		s.mux.Unlock()
+		changed = true
+
+		s.logger.Info("Loaded threat indicators",
+			zap.String("path", src.Path),
+			zap.String("format", src.Format),
+			zap.Int("count", len(indicators)))
+	}
+
+	if changed {
+		s.rebuild()
+	}
+	if len(errs) > 0 {
+		return fmt.Errorf("loading threat indicators: %v", errs)
+	}
+	return nil
+}
+
+// forget drops the indicators of a file and reports whether any were loaded
+func (s *Store) forget(path string) bool {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+
+	if _, ok := s.files[path]; !ok {
+		return false
+	}
+	delete(s.files, path)
+	delete(s.loaded, path)
+	return true
+}
+
+// SetIndicators replaces the indicators of a dynamic source
+func (s *Store) SetIndicators(source string, indicators []Indicator) {
+	s.mux.Lock()
+	s.dynamic[source] = indicators
+	s.mux.Unlock()
+	s.rebuild()
+}
+
+// rebuild indexes all file and dynamic indicators into a new set
+func (s *Store) rebuild() {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+
+	// Build in a stable order so duplicates resolve the same way every time
+	names := make([]string, 0, len(s.loaded)+len(s.dynamic))
+	var all []Indicator
+	for name := range s.loaded {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		all = append(all, s.loaded[name]...)
+	}
+	names = names[:0]
+	for name := range s.dynamic {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		all = append(all, s.dynamic[name]...)
+	}
+
+	s.set = NewSet(all)
+}
+
+// Watch reloads changed files at the given interval until the context is done
+func (s *Store) Watch(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := s.Reload(); err != nil {
+				s.logger.Warn("Threat indicator reload failed", zap.Error(err))
+			}
+		}
+	}
+}
+
+// Len returns the number of indexed indicators
+func (s *Store) Len() int {
+	s.mux.RLock()
+	defer s.mux.RUnlock()
+	return s.set.Len()
+}
+
+// MatchDomain matches a query name exactly or by parent domain
+func (s *Store) MatchDomain(domain string) (*Indicator, bool) {
+	s.mux.RLock()
+	set := s.set
+	s.mux.RUnlock()
+	return set.MatchDomain(domain, s.now())
+}
+
+// MatchIP matches an address
+func (s *Store) MatchIP(addr netip.Addr) (*Indicator, bool) {
+	s.mux.RLock()
+	set := s.set
+	s.mux.RUnlock()
+	return set.MatchIP(addr, s.now())
+}
+
+// Match checks the query name and then the resolved addresses
+func (s *Store) Match(queryName string, addrs []netip.Addr) (Match, bool) {
+	if queryName != "" {
+		if ind, ok := s.MatchDomain(queryName); ok {
+			return Match{Indicator: ind, Field: "DnsQuery", Value: NormalizeDomain(queryName)}, true
+		}
+	}
+	for _, addr := range addrs {
+		if ind, ok := s.MatchIP(addr); ok {
+			return Match{Indicator: ind, Field: "DnsResponseName", Value: addr.Unmap().String()}, true
+		}
+	}
+	return Match{}, false
+}
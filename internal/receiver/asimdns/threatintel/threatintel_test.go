@@ -0,0 +1,231 @@
+package threatintel
+
+import (
+	"net/netip"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+func parse(t *testing.T, format, data string) *Set {
+	t.Helper()
+	indicators, err := Parse(format, []byte(data), Indicator{Category: "default", RiskLevel: 50})
+	if err != nil {
+		t.Fatalf("failed to parse %s: %v", format, err)
+	}
+	return NewSet(indicators)
+}
+
+func TestPlainAndParentMatching(t *testing.T) {
+	set := parse(t, FormatPlain, `
+# comment
+Bad.Example.
+0.0.0.0 tracker.example.net
+198.51.100.7
+203.0.113.0/24
+`)
+	now := time.Now()
+
+	for _, name := range []string{"bad.example", "www.BAD.example.", "tracker.example.net"} {
+		if _, ok := set.MatchDomain(name, now); !ok {
+			t.Errorf("expected %q to match", name)
+		}
+	}
+	if _, ok := set.MatchDomain("notbad.example", now); ok {
+		t.Errorf("sibling domain must not match")
+	}
+	if ind, ok := set.MatchIP(netip.MustParseAddr("::ffff:198.51.100.7"), now); !ok || ind.Category != "default" {
+		t.Errorf("expected mapped address to match with default category, got %+v", ind)
+	}
+	if _, ok := set.MatchIP(netip.MustParseAddr("203.0.113.99"), now); !ok {
+		t.Errorf("expected address within range to match")
+	}
+}
+
+func TestCSVAndExpiry(t *testing.T) {
+	set := parse(t, FormatCSV, `indicator,category,risk_level,confidence,valid_until
+c2.example,c2,90,high,2000-01-01T00:00:00Z
+phish.example,phishing,70,medium,
+`)
+	now := time.Now()
+
+	if _, ok := set.MatchDomain("c2.example", now); ok {
+		t.Errorf("expired indicator must not match")
+	}
+	ind, ok := set.MatchDomain("login.phish.example", now)
+	if !ok || ind.Category != "phishing" || ind.RiskLevel != 70 || ind.Confidence != "medium" {
+		t.Errorf("unexpected indicator: %+v", ind)
+	}
+}
+
+func TestSTIXBundle(t *testing.T) {
+	set := parse(t, FormatSTIX, `{
+  "type": "bundle",
+  "id": "bundle--1",
+  "objects": [
+    {"type": "indicator", "id": "indicator--1", "name": "C2 domain", "pattern_type": "stix",
+     "pattern": "[domain-name:value = 'evil.example'] OR [ipv4-addr:value = '192.0.2.10']",
+     "indicator_types": ["malicious-activity"], "confidence": 85},
+    {"type": "indicator", "id": "indicator--2", "pattern": "[domain-name:value = 'revoked.example']", "revoked": true},
+    {"type": "malware", "id": "malware--1", "name": "ignored"}
+  ]
+}`)
+	now := time.Now()
+
+	ind, ok := set.MatchDomain("evil.example", now)
+	if !ok || ind.ID != "indicator--1" || ind.Category != "malicious-activity" || ind.Confidence != "85" {
+		t.Errorf("unexpected indicator: %+v", ind)
+	}
+	if _, ok := set.MatchIP(netip.MustParseAddr("192.0.2.10"), now); !ok {
+		t.Errorf("expected IP from the same pattern to match")
+	}
+	if _, ok := set.MatchDomain("revoked.example", now); ok {
+		t.Errorf("revoked indicator must not match")
+	}
+}
+
+func TestMISPEvent(t *testing.T) {
+	set := parse(t, FormatMISP, `{"Event": {
+  "info": "Phishing campaign", "threat_level_id": "1",
+  "Attribute": [
+    {"uuid": "a1", "type": "domain", "category": "Network activity", "value": "phish.example", "to_ids": true},
+    {"uuid": "a2", "type": "domain", "category": "Network activity", "value": "benign.example", "to_ids": false}
+  ],
+  "Object": [{"Attribute": [{"uuid": "a3", "type": "domain|ip", "value": "drop.example|198.51.100.20", "to_ids": true}]}]
+}}`)
+	now := time.Now()
+
+	ind, ok := set.MatchDomain("phish.example", now)
+	if !ok || ind.RiskLevel != 90 || ind.Name != "Phishing campaign" {
+		t.Errorf("unexpected indicator: %+v", ind)
+	}
+	if _, ok := set.MatchDomain("benign.example", now); ok {
+		t.Errorf("attribute without to_ids must not match")
+	}
+	if _, ok := set.MatchIP(netip.MustParseAddr("198.51.100.20"), now); !ok {
+		t.Errorf("expected IP from domain|ip attribute to match")
+	}
+}
+
+func TestRPZZone(t *testing.T) {
+	set := parse(t, FormatRPZ, `$TTL 300
+@ IN SOA localhost. admin.localhost. (
+    1 3600 600 86400 300 )
+  IN NS localhost.
+$ORIGIN rpz.example.
+bad.example           CNAME .
+*.bad.example         CNAME .
+allowed.example       CNAME rpz-passthru.
+abs.example.rpz.example. 300 IN CNAME *.
+24.0.2.0.192.rpz-ip   CNAME .
+48.zz.1.db8.2001.rpz-ip CNAME .
+ns.example.rpz-nsdname CNAME .
+`)
+	now := time.Now()
+
+	for _, name := range []string{"bad.example", "x.bad.example", "abs.example"} {
+		if _, ok := set.MatchDomain(name, now); !ok {
+			t.Errorf("expected %q to match", name)
+		}
+	}
+	for _, name := range []string{"allowed.example", "ns.example", "localhost"} {
+		if _, ok := set.MatchDomain(name, now); ok {
+			t.Errorf("%q must not match", name)
+		}
+	}
+	if _, ok := set.MatchIP(netip.MustParseAddr("192.0.2.55"), now); !ok {
+		t.Errorf("expected rpz-ip IPv4 range to match")
+	}
+	if _, ok := set.MatchIP(netip.MustParseAddr("2001:db8:1::5"), now); !ok {
+		t.Errorf("expected rpz-ip IPv6 range to match")
+	}
+}
+
+func TestStoreReloadsChangedFiles(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "domains.txt")
+	if err := os.WriteFile(path, []byte("first.example\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	src := SourceConfig{Path: path}
+	if err := src.Validate(); err != nil {
+		t.Fatal(err)
+	}
+	store := NewStore(zap.NewNop(), []SourceConfig{src})
+	if err := store.Reload(); err != nil {
+		t.Fatalf("reload failed: %v", err)
+	}
+	if _, ok := store.Match("first.example", nil); !ok {
+		t.Fatalf("expected initial indicator to match")
+	}
+
+	if err := os.WriteFile(path, []byte("second.example\nthird.example\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	future := time.Now().Add(time.Minute)
+	if err := os.Chtimes(path, future, future); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.Reload(); err != nil {
+		t.Fatalf("reload failed: %v", err)
+	}
+	if _, ok := store.Match("first.example", nil); ok {
+		t.Errorf("removed indicator must no longer match")
+	}
+
+	store.SetIndicators("taxii", []Indicator{{Type: TypeIP, Value: "192.0.2.1", Prefix: netip.MustParsePrefix("192.0.2.1/32")}})
+	m, ok := store.Match("clean.example", []netip.Addr{netip.MustParseAddr("192.0.2.1")})
+	if !ok || m.Field != "DnsResponseName" || m.Value != "192.0.2.1" {
+		t.Errorf("expected dynamic IP indicator to match, got %+v", m)
+	}
+	if store.Len() != 3 {
+		t.Errorf("expected 3 indicators, got %d", store.Len())
+	}
+}
+
+func TestStoreDropsDeletedFiles(t *testing.T) {
+	dir := t.TempDir()
+	kept := filepath.Join(dir, "kept.txt")
+	deleted := filepath.Join(dir, "deleted.txt")
+	if err := os.WriteFile(kept, []byte("kept.example\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(deleted, []byte("deleted.example\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	var sources []SourceConfig
+	for _, path := range []string{kept, deleted} {
+		src := SourceConfig{Path: path}
+		if err := src.Validate(); err != nil {
+			t.Fatal(err)
+		}
+		sources = append(sources, src)
+	}
+	store := NewStore(zap.NewNop(), sources)
+	if err := store.Reload(); err != nil {
+		t.Fatalf("reload failed: %v", err)
+	}
+	if _, ok := store.Match("deleted.example", nil); !ok {
+		t.Fatalf("expected indicator of the second file to match")
+	}
+
+	if err := os.Remove(deleted); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.Reload(); err == nil {
+		t.Errorf("expected the missing file to be reported")
+	}
+	if _, ok := store.Match("deleted.example", nil); ok {
+		t.Errorf("indicator of a deleted file must no longer match")
+	}
+	if _, ok := store.Match("kept.example", nil); !ok {
+		t.Errorf("indicator of the remaining file must still match")
+	}
+	if store.Len() != 1 {
+		t.Errorf("expected 1 indicator, got %d", store.Len())
+	}
+}
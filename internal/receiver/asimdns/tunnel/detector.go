@@ -0,0 +1,408 @@
+// Package tunnel detects DNS tunnelling and exfiltration by tracking, per
+// source and registered domain, the cardinality and shape of subdomains and
+// the volume of TXT and NULL queries over a sliding window.
+package tunnel
+
+import (
+	"container/list"
+	"math"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Query types used for tunnelling payloads
+const (
+	queryTypeNULL = 10
+	queryTypeTXT  = 16
+)
+
+// Detection reasons
+const (
+	ReasonUniqueSubdomains = "unique_subdomains"
+	ReasonLongSubdomains   = "long_subdomains"
+	ReasonHighEntropy      = "high_entropy"
+	ReasonEncodedPayload   = "encoded_payload"
+	ReasonTXTVolume        = "txt_volume"
+)
+
+// maxSamples is the number of example query names kept as evidence
+const maxSamples = 5
+
+// Options controls the detector window, thresholds and memory use
+type Options struct {
+	// Window is the sliding window, divided into Buckets
+	Window  time.Duration
+	Buckets int
+	// MaxTracked limits the number of source and domain pairs tracked; the
+	// least recently seen pair is evicted first
+	MaxTracked int
+	// SketchSize is the number of hashes kept per bucket to estimate unique subdomains
+	SketchSize int
+	// MinUniqueSubdomains is the unique subdomain count required for a detection
+	MinUniqueSubdomains int
+	// MinMeanLength is the mean subdomain length indicating encoded data
+	MinMeanLength float64
+	// MinMeanEntropy is the mean subdomain entropy in bits per character
+	MinMeanEntropy float64
+	// MinEncodedShare is the share of queries with hex, base32 or base64 labels
+	MinEncodedShare float64
+	// MinTXTQueries is the number of TXT and NULL queries indicating a payload channel
+	MinTXTQueries int
+	// AllowDomains are registered domains never reported, such as security
+	// services that look up hashes over DNS
+	AllowDomains []string
+	// RegisteredDomain returns the registered domain of a name; defaults to
+	// the last two labels
+	RegisteredDomain func(name string) string
+}
+
+// Query is a single DNS query seen by the receiver
+type Query struct {
+	Time time.Time
+	// Source identifies the querying client address or process
+	Source    string
+	Name      string
+	QueryType int
+}
+
+// Detection is the evidence for a suspected tunnel
+type Detection struct {
+	Source              string
+	Domain              string
+	WindowStart         time.Time
+	WindowEnd           time.Time
+	Queries             int64
+	UniqueSubdomains    int
+	MeanSubdomainLength float64
+	MaxLabelLength      int
+	MeanEntropy         float64
+	EncodedQueries      int64
+	TXTQueries          int64
+	// Reasons lists the thresholds exceeded
+	Reasons []string
+	// Samples are example query names
+	Samples []string
+	// RiskLevel is 0 to 100, rising with the number of reasons
+	RiskLevel int
+}
+
+// bucket holds the counters of one slice of the window
+type bucket struct {
+	epoch          int64
+	queries        int64
+	lengthSum      int64
+	entropySum     float64
+	encodedQueries int64
+	txtQueries     int64
+	maxLabel       int
+	unique         *sketch
+}
+
+// tracked is the state of one source and registered domain pair
+type tracked struct {
+	key          string
+	source       string
+	domain       string
+	buckets      []bucket
+	samples      []string
+	lastReported time.Time
+	element      *list.Element
+}
+
+// Detector tracks query patterns and reports suspected tunnels
+type Detector struct {
+	mux       sync.Mutex
+	opts      Options
+	bucketDur time.Duration
+	allowed   map[string]bool
+	tracked   map[string]*tracked
+	lru       *list.List
+	evictions int64
+}
+
+// NewDetector creates a detector
+func NewDetector(opts Options) *Detector {
+	if opts.Window <= 0 {
+		opts.Window = 10 * time.Minute
+	}
+	if opts.Buckets <= 0 {
+		opts.Buckets = 5
+	}
+	if opts.MaxTracked <= 0 {
+		opts.MaxTracked = 5000
+	}
+	if opts.SketchSize <= 0 {
+		opts.SketchSize = 32
+	}
+	if opts.MinUniqueSubdomains <= 0 {
+		opts.MinUniqueSubdomains = 50
+	}
+	if opts.MinMeanLength <= 0 {
+		opts.MinMeanLength = 30
+	}
+	if opts.MinMeanEntropy <= 0 {
+		opts.MinMeanEntropy = 3.8
+	}
+	if opts.MinEncodedShare <= 0 {
+		opts.MinEncodedShare = 0.5
+	}
+	if opts.MinTXTQueries <= 0 {
+		opts.MinTXTQueries = 30
+	}
+	if opts.RegisteredDomain == nil {
+		opts.RegisteredDomain = lastTwoLabels
+	}
+
+	d := &Detector{
+		opts:      opts,
+		bucketDur: opts.Window / time.Duration(opts.Buckets),
+		allowed:   make(map[string]bool),
+		tracked:   make(map[string]*tracked),
+		lru:       list.New(),
+	}
+	if d.bucketDur <= 0 {
+		d.bucketDur = time.Second
+	}
+	for _, domain := range opts.AllowDomains {
+		d.allowed[strings.TrimSuffix(strings.ToLower(domain), ".")] = true
+	}
+	return d
+}
+
+// Tracked returns the number of source and domain pairs currently tracked
+func (d *Detector) Tracked() int {
+	d.mux.Lock()
+	defer d.mux.Unlock()
+	return len(d.tracked)
+}
+
+// Evictions returns the number of pairs evicted to stay within MaxTracked
+func (d *Detector) Evictions() int64 {
+	d.mux.Lock()
+	defer d.mux.Unlock()
+	return d.evictions
+}
+
+// Observe records a query and returns a detection when the pair it belongs to
+// exceeds the thresholds. A pair is reported at most once per window.
+func (d *Detector) Observe(q Query) (Detection, bool) {
+	name := strings.TrimSuffix(strings.ToLower(q.Name), ".")
+	domain := d.opts.RegisteredDomain(name)
+	if domain == "" || len(name) <= len(domain) || d.allowed[domain] {
+		return Detection{}, false
+	}
+	subdomain := strings.TrimSuffix(name[:len(name)-len(domain)], ".")
+	// Keep the original case of the subdomain, which base64 payloads depend on
+	original := subdomain
+	if raw := strings.TrimSuffix(q.Name, "."); len(raw) == len(name) {
+		original = raw[:len(subdomain)]
+	}
+
+	d.mux.Lock()
+	defer d.mux.Unlock()
+
+	t := d.lookup(q.Source, domain)
+	b := d.currentBucket(t, q.Time)
+
+	compact := strings.ReplaceAll(subdomain, ".", "")
+	b.queries++
+	b.lengthSum += int64(len(compact))
+	b.entropySum += entropy(compact)
+	b.unique.add(hashString(subdomain))
+	encoded := false
+	for _, label := range strings.Split(original, ".") {
+		if len(label) > b.maxLabel {
+			b.maxLabel = len(label)
+		}
+		if isEncoded(label) {
+			encoded = true
+		}
+	}
+	if encoded {
+		b.encodedQueries++
+	}
+	if q.QueryType == queryTypeTXT || q.QueryType == queryTypeNULL {
+		b.txtQueries++
+	}
+	if len(t.samples) < maxSamples {
+		t.samples = append(t.samples, name)
+	}
+
+	if !t.lastReported.IsZero() && q.Time.Sub(t.lastReported) < d.opts.Window {
+		return Detection{}, false
+	}
+	detection, ok := d.evaluate(t, q.Time)
+	if ok {
+		t.lastReported = q.Time
+		t.samples = t.samples[:0]
+	}
+	return detection, ok
+}
+
+// lookup returns the state of a pair, creating it and evicting the least
+// recently seen pair when needed
+func (d *Detector) lookup(source, domain string) *tracked {
+	key := source + "|" + domain
+	if t, ok := d.tracked[key]; ok {
+		d.lru.MoveToFront(t.element)
+		return t
+	}
+
+	if len(d.tracked) >= d.opts.MaxTracked {
+		oldest := d.lru.Back()
+		evicted := oldest.Value.(*tracked)
+		d.lru.Remove(oldest)
+		delete(d.tracked, evicted.key)
+		d.evictions++
+	}
+
+	t := &tracked{
+		key:     key,
+		source:  source,
+		domain:  domain,
+		buckets: make([]bucket, d.opts.Buckets),
+	}
+	for i := range t.buckets {
+		t.buckets[i] = bucket{epoch: -1, unique: newSketch(d.opts.SketchSize)}
+	}
+	t.element = d.lru.PushFront(t)
+	d.tracked[key] = t
+	return t
+}
+
+// currentBucket returns the bucket for a time, clearing it if it holds an older slice
+func (d *Detector) currentBucket(t *tracked, now time.Time) *bucket {
+	epoch := now.UnixNano() / int64(d.bucketDur)
+	b := &t.buckets[int(epoch%int64(len(t.buckets)))]
+	if b.epoch != epoch {
+		unique := b.unique
+		unique.reset()
+		*b = bucket{epoch: epoch, unique: unique}
+	}
+	return b
+}
+
+// evaluate sums the buckets within the window and checks the thresholds
+func (d *Detector) evaluate(t *tracked, now time.Time) (Detection, bool) {
+	epoch := now.UnixNano() / int64(d.bucketDur)
+	oldest := epoch - int64(len(t.buckets)) + 1
+
+	unique := newSketch(d.opts.SketchSize)
+	var lengthSum int64
+	var entropySum float64
+	det := Detection{Source: t.source, Domain: t.domain}
+	for i := range t.buckets {
+		b := &t.buckets[i]
+		if b.epoch < oldest || b.epoch > epoch || b.queries == 0 {
+			continue
+		}
+		start := time.Unix(0, b.epoch*int64(d.bucketDur))
+		if det.WindowStart.IsZero() || start.Before(det.WindowStart) {
+			det.WindowStart = start
+		}
+		det.Queries += b.queries
+		det.EncodedQueries += b.encodedQueries
+		det.TXTQueries += b.txtQueries
+		if b.maxLabel > det.MaxLabelLength {
+			det.MaxLabelLength = b.maxLabel
+		}
+		lengthSum += b.lengthSum
+		entropySum += b.entropySum
+		unique.merge(b.unique)
+	}
+	if det.Queries == 0 {
+		return Detection{}, false
+	}
+	det.WindowEnd = now
+	det.UniqueSubdomains = unique.estimate()
+	det.MeanSubdomainLength = round(float64(lengthSum) / float64(det.Queries))
+	det.MeanEntropy = round(entropySum / float64(det.Queries))
+
+	if det.UniqueSubdomains < d.opts.MinUniqueSubdomains {
+		return Detection{}, false
+	}
+	det.Reasons = append(det.Reasons, ReasonUniqueSubdomains)
+	if det.MeanSubdomainLength >= d.opts.MinMeanLength {
+		det.Reasons = append(det.Reasons, ReasonLongSubdomains)
+	}
+	if det.MeanEntropy >= d.opts.MinMeanEntropy {
+		det.Reasons = append(det.Reasons, ReasonHighEntropy)
+	}
+	if float64(det.EncodedQueries) >= d.opts.MinEncodedShare*float64(det.Queries) {
+		det.Reasons = append(det.Reasons, ReasonEncodedPayload)
+	}
+	if det.TXTQueries >= int64(d.opts.MinTXTQueries) {
+		det.Reasons = append(det.Reasons, ReasonTXTVolume)
+	}
+	// Many unique names alone are common for CDNs; a tunnel also carries data
+	if len(det.Reasons) < 2 {
+		return Detection{}, false
+	}
+
+	det.RiskLevel = 40 + 15*(len(det.Reasons)-1)
+	if det.RiskLevel > 100 {
+		det.RiskLevel = 100
+	}
+	det.Samples = append([]string(nil), t.samples...)
+	sort.Strings(det.Samples)
+	return det, true
+}
+
+var (
+	hexLabel    = regexp.MustCompile(`^[0-9a-fA-F]{16,}$`)
+	base32Label = regexp.MustCompile(`^[a-zA-Z2-7]{16,}=*$`)
+	base64Label = regexp.MustCompile(`^[A-Za-z0-9+/_-]{16,}=*$`)
+)
+
+// isEncoded reports whether a label looks like hex, base32 or base64 data
+func isEncoded(label string) bool {
+	if len(label) < 16 {
+		return false
+	}
+	hasDigit := strings.ContainsAny(label, "0123456789")
+	if hexLabel.MatchString(label) {
+		return hasDigit
+	}
+	if base32Label.MatchString(label) {
+		return strings.ContainsAny(label, "234567")
+	}
+	hasUpper := strings.ToLower(label) != label
+	hasLower := strings.ToUpper(label) != label
+	return base64Label.MatchString(label) && hasDigit && hasUpper && hasLower
+}
+
+// entropy returns the Shannon entropy of s in bits per character
+func entropy(s string) float64 {
+	if s == "" {
+		return 0
+	}
+	var freq [256]int
+	for i := 0; i < len(s); i++ {
+		freq[s[i]]++
+	}
+	var h float64
+	for _, n := range freq {
+		if n > 0 {
+			p := float64(n) / float64(len(s))
+			h -= p * math.Log2(p)
+		}
+	}
+	return h
+}
+
+// round rounds to two decimal places
+func round(v float64) float64 {
+	return math.Round(v*100) / 100
+}
+
+// lastTwoLabels approximates the registered domain of a name
+func lastTwoLabels(name string) string {
+	labels := strings.Split(name, ".")
+	if len(labels) <= 2 {
+		return name
+	}
+	return strings.Join(labels[len(labels)-2:], ".")
+}
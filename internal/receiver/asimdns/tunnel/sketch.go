@@ -0,0 +1,70 @@
+package tunnel
+
+import (
+	"hash/fnv"
+	"math"
+	"sort"
+)
+
+// sketch estimates the number of distinct strings with a k-minimum-values
+// sketch, so memory stays fixed however many subdomains are seen
+type sketch struct {
+	k      int
+	values []uint64
+}
+
+func newSketch(k int) *sketch {
+	return &sketch{k: k, values: make([]uint64, 0, k)}
+}
+
+// hashString returns a 64-bit hash of s
+func hashString(s string) uint64 {
+	h := fnv.New64a()
+	h.Write([]byte(s))
+	// FNV-1a leaves the high bits poorly mixed for short inputs
+	x := h.Sum64()
+	x ^= x >> 33
+	x *= 0xff51afd7ed558ccd
+	x ^= x >> 33
+	x *= 0xc4ceb9fe1a85ec53
+	x ^= x >> 33
+	return x
+}
+
+// add inserts a hash, keeping the k smallest distinct values
+func (s *sketch) add(v uint64) {
+	i := sort.Search(len(s.values), func(i int) bool { return s.values[i] >= v })
+	if i < len(s.values) && s.values[i] == v {
+		return
+	}
+	if len(s.values) == s.k {
+		if i == s.k {
+			return
+		}
+		s.values = s.values[:s.k-1]
+	}
+	s.values = append(s.values, 0)
+	copy(s.values[i+1:], s.values[i:])
+	s.values[i] = v
+}
+
+// merge adds the values of another sketch
+func (s *sketch) merge(other *sketch) {
+	for _, v := range other.values {
+		s.add(v)
+	}
+}
+
+// reset empties the sketch
+func (s *sketch) reset() {
+	s.values = s.values[:0]
+}
+
+// estimate returns the approximate number of distinct values added
+func (s *sketch) estimate() int {
+	if len(s.values) < s.k {
+		return len(s.values)
+	}
+	kth := float64(s.values[s.k-1]) / math.MaxUint64
+	return int(float64(s.k-1) / kth)
+}
@@ -0,0 +1,126 @@
+package tunnel
+
+import (
+	"encoding/hex"
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestDetectsEncodedSubdomains(t *testing.T) {
+	d := NewDetector(Options{Window: time.Minute, MinUniqueSubdomains: 20})
+	start := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	var detection Detection
+	var detected int
+	for i := 0; i < 100; i++ {
+		payload := hex.EncodeToString([]byte(fmt.Sprintf("chunk-%04d-of-exfiltrated-data", i)))
+		q := Query{Time: start.Add(time.Duration(i) * 100 * time.Millisecond), Source: "10.0.0.5", Name: payload[:60] + "." + payload[60:] + ".t.tunnel.example", QueryType: queryTypeTXT}
+		if det, ok := d.Observe(q); ok {
+			detection = det
+			detected++
+		}
+	}
+
+	if detected != 1 {
+		t.Fatalf("expected one detection per window, got %d", detected)
+	}
+	if detection.Domain != "tunnel.example" || detection.Source != "10.0.0.5" {
+		t.Errorf("unexpected pair %q %q", detection.Source, detection.Domain)
+	}
+	got := map[string]bool{}
+	for _, reason := range detection.Reasons {
+		got[reason] = true
+	}
+	for _, reason := range []string{ReasonUniqueSubdomains, ReasonLongSubdomains, ReasonEncodedPayload} {
+		if !got[reason] {
+			t.Errorf("expected reason %s in %v", reason, detection.Reasons)
+		}
+	}
+	if detection.MaxLabelLength != 60 || len(detection.Samples) == 0 || detection.RiskLevel < 55 {
+		t.Errorf("unexpected evidence %+v", detection)
+	}
+}
+
+func TestIgnoresOrdinaryTraffic(t *testing.T) {
+	d := NewDetector(Options{Window: time.Minute, MinUniqueSubdomains: 20})
+	start := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	// Many short hosts under one domain, as a CDN or intranet produces
+	for i := 0; i < 200; i++ {
+		q := Query{Time: start.Add(time.Duration(i) * 100 * time.Millisecond), Source: "10.0.0.5", Name: fmt.Sprintf("host%d.cdn.example", i), QueryType: 1}
+		if det, ok := d.Observe(q); ok {
+			t.Fatalf("unexpected detection %+v", det)
+		}
+	}
+
+	// Hash lookups of security services look like tunnels but are allowed
+	allowed := NewDetector(Options{Window: time.Minute, MinUniqueSubdomains: 20, AllowDomains: []string{"av-lookup.example"}})
+	for i := 0; i < 100; i++ {
+		payload := hex.EncodeToString([]byte(fmt.Sprintf("file-hash-%04d-abcdefghijkl", i)))
+		q := Query{Time: start.Add(time.Duration(i) * time.Second), Source: "10.0.0.5", Name: payload + ".av-lookup.example"}
+		if det, ok := allowed.Observe(q); ok {
+			t.Fatalf("allowed domain reported %+v", det)
+		}
+	}
+}
+
+func TestWindowExpires(t *testing.T) {
+	d := NewDetector(Options{Window: time.Minute, Buckets: 6, MinUniqueSubdomains: 20})
+	start := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	// Ten queries per minute never reach 20 unique names within one window
+	for i := 0; i < 100; i++ {
+		payload := hex.EncodeToString([]byte(fmt.Sprintf("slow-%04d-exfiltrated-data-x", i)))
+		q := Query{Time: start.Add(time.Duration(i) * 6 * time.Second), Source: "10.0.0.5", Name: payload + ".slow.example"}
+		if det, ok := d.Observe(q); ok {
+			t.Fatalf("expected old buckets to expire, got %+v", det)
+		}
+	}
+}
+
+func TestMemoryIsBounded(t *testing.T) {
+	d := NewDetector(Options{MaxTracked: 100, SketchSize: 16})
+	start := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	for i := 0; i < 1000; i++ {
+		d.Observe(Query{Time: start, Source: fmt.Sprintf("10.0.%d.%d", i/256, i%256), Name: fmt.Sprintf("www.domain%d.example", i%300)})
+	}
+	if d.Tracked() != 100 || d.Evictions() != 900 {
+		t.Errorf("expected 100 tracked pairs and 900 evictions, got %d and %d", d.Tracked(), d.Evictions())
+	}
+}
+
+func TestSketchEstimate(t *testing.T) {
+	s := newSketch(64)
+	for i := 0; i < 10000; i++ {
+		s.add(hashString(fmt.Sprintf("name-%d", i%5000)))
+	}
+	if got := s.estimate(); got < 4000 || got > 6000 {
+		t.Errorf("expected an estimate near 5000, got %d", got)
+	}
+
+	small := newSketch(64)
+	for i := 0; i < 10; i++ {
+		small.add(hashString(fmt.Sprintf("name-%d", i)))
+	}
+	if got := small.estimate(); got != 10 {
+		t.Errorf("expected an exact count below the sketch size, got %d", got)
+	}
+}
+
+func TestIsEncoded(t *testing.T) {
+	tests := map[string]bool{
+		"6368756e6b2d303030312d6f66":  true,
+		"mfrggzdfmztwq2lknnwg23tp":    true,
+		"aGVsbG8gd29ybGQgZnJvbSBETlM": true,
+		"thisisaverylonglabelname":    false,
+		"www":                         false,
+		"deadbeefdeadbeef":            false,
+	}
+	for label, want := range tests {
+		if got := isEncoded(label); got != want {
+			t.Errorf("isEncoded(%q) = %v, want %v", label, got, want)
+		}
+	}
+}